@@ -6,3 +6,9 @@ source .envrc
 
 GOOS=linux go build -ldflags="-s -w" -o bin/supply dotnetcore/supply/cli
 GOOS=linux go build -ldflags="-s -w" -o bin/finalize dotnetcore/finalize/cli
+GOOS=linux go build -ldflags="-s -w" -o bin/staticserver dotnetcore/staticserver/cli
+GOOS=linux go build -ldflags="-s -w" -o bin/launchenv dotnetcore/launchenv/cli
+GOOS=linux go build -ldflags="-s -w" -o bin/cnb dotnetcore/cnb/cli
+
+# buildpack.toml is packaged as is, so its version has to be kept in step
+grep -q "^version = \"$(cat VERSION)\"$" buildpack.toml || { echo "buildpack.toml version does not match VERSION $(cat VERSION)" >&2; exit 1; }
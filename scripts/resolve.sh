@@ -0,0 +1,7 @@
+#!/usr/bin/env bash
+set -euo pipefail
+
+cd "$( dirname "${BASH_SOURCE[0]}" )/.."
+source .envrc
+
+BUILDPACK_DIR=$(pwd) go run dotnetcore/resolve/cli "$@"
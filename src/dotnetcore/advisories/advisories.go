@@ -0,0 +1,114 @@
+package advisories
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Advisory is a published vulnerability of the versions of a dependency
+// that match Versions, a semver constraint such as ">= 8.0.0, < 8.0.7".
+// Name is dotnet-sdk, dotnet-runtime or dotnet-aspnetcore.
+type Advisory struct {
+	ID       string `yaml:"id"`
+	Name     string `yaml:"name"`
+	Versions string `yaml:"versions"`
+	Summary  string `yaml:"summary"`
+}
+
+// Load reads the advisories from the dataset at ADVISORIES_URL when the
+// operator sets it, or else from the one shipped at path. A missing
+// shipped dataset has no advisories.
+func Load(path string) ([]Advisory, error) {
+	var data []byte
+	var err error
+	if dataset := os.Getenv("ADVISORIES_URL"); dataset != "" {
+		data, err = fetch(dataset)
+	} else if data, err = ioutil.ReadFile(path); os.IsNotExist(err) {
+		return []Advisory{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	obj := struct {
+		Advisories []Advisory `yaml:"advisories"`
+	}{}
+	if err := yaml.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("parsing advisories: %v", err)
+	}
+	return obj.Advisories, nil
+}
+
+// Client fetches the operator's dataset, which only comes over https so
+// staging can't be made to skip advisories, and can't hang on a slow server
+var Client = &http.Client{
+	Timeout: time.Minute,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("redirected to %s, but ADVISORIES_URL must be https", req.URL.Host)
+		}
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		return nil
+	},
+}
+
+func fetch(rawurl string) ([]byte, error) {
+	if u, err := url.Parse(rawurl); err != nil {
+		return nil, fmt.Errorf("fetching advisories: %v", err)
+	} else if u.Scheme != "https" {
+		return nil, fmt.Errorf("ADVISORIES_URL must be an https URL")
+	}
+	resp, err := Client.Get(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("fetching advisories: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching advisories: %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Affecting returns the advisories for the version of the named dependency
+func Affecting(advisories []Advisory, name, version string) ([]Advisory, error) {
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return nil, nil
+	}
+	var affecting []Advisory
+	for _, advisory := range advisories {
+		if advisory.Name != name {
+			continue
+		}
+		constraint, err := semver.NewConstraint(advisory.Versions)
+		if err != nil {
+			return nil, fmt.Errorf("advisory %s has invalid versions %q: %v", advisory.ID, advisory.Versions, err)
+		}
+		if constraint.Check(v) {
+			affecting = append(affecting, advisory)
+		}
+	}
+	return affecting, nil
+}
+
+// Ignored reports whether IGNORE_ADVISORIES, a comma separated list of
+// advisory IDs or all, lets staging go ahead despite the advisory
+func Ignored(advisory Advisory) bool {
+	for _, id := range strings.Split(os.Getenv("IGNORE_ADVISORIES"), ",") {
+		id = strings.TrimSpace(id)
+		if strings.EqualFold(id, "all") || strings.EqualFold(id, advisory.ID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package advisories_test
+
+import (
+	"dotnetcore/advisories"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const dataset = `advisories:
+- id: CVE-2024-0001
+  name: dotnet-runtime
+  versions: ">= 8.0.0, < 8.0.7"
+  summary: Denial of service
+- id: CVE-2024-0002
+  name: dotnet-sdk
+  versions: "< 8.0.303"
+  summary: Remote code execution
+`
+
+var _ = Describe("Advisories", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "advisories")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "advisories.yml"), []byte(dataset), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+		Expect(os.Unsetenv("ADVISORIES_URL")).To(Succeed())
+		Expect(os.Unsetenv("IGNORE_ADVISORIES")).To(Succeed())
+	})
+
+	Describe("Load", func() {
+		It("reads the shipped dataset", func() {
+			list, err := advisories.Load(filepath.Join(dir, "advisories.yml"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(list).To(HaveLen(2))
+			Expect(list[0]).To(Equal(advisories.Advisory{ID: "CVE-2024-0001", Name: "dotnet-runtime", Versions: ">= 8.0.0, < 8.0.7", Summary: "Denial of service"}))
+		})
+
+		It("has no advisories without a dataset", func() {
+			Expect(advisories.Load(filepath.Join(dir, "missing.yml"))).To(BeEmpty())
+		})
+
+		It("prefers the operator's dataset", func() {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "advisories:\n- id: OPERATOR-1\n  name: dotnet-aspnetcore\n  versions: '*'\n")
+			}))
+			defer server.Close()
+			transport := advisories.Client.Transport
+			advisories.Client.Transport = server.Client().Transport
+			defer func() { advisories.Client.Transport = transport }()
+			Expect(os.Setenv("ADVISORIES_URL", server.URL)).To(Succeed())
+
+			list, err := advisories.Load(filepath.Join(dir, "advisories.yml"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(list).To(HaveLen(1))
+			Expect(list[0].ID).To(Equal("OPERATOR-1"))
+		})
+
+		It("refuses an operator's dataset over plain http", func() {
+			Expect(os.Setenv("ADVISORIES_URL", "http://advisories.example.com/advisories.yml")).To(Succeed())
+			_, err := advisories.Load(filepath.Join(dir, "advisories.yml"))
+			Expect(err).To(MatchError("ADVISORIES_URL must be an https URL"))
+		})
+
+		It("ships a valid dataset", func() {
+			list, err := advisories.Load(filepath.Join("..", "..", "..", "advisories.yml"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(list).ToNot(BeEmpty())
+			for _, advisory := range list {
+				Expect(advisories.Affecting([]advisories.Advisory{advisory}, advisory.Name, "1.0.0")).To(Or(BeEmpty(), HaveLen(1)))
+			}
+			affecting, err := advisories.Affecting(list, "dotnet-runtime", "2.1.1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(affecting).ToNot(BeEmpty())
+		})
+	})
+
+	Describe("Affecting", func() {
+		It("matches the versions of the named dependency", func() {
+			list, err := advisories.Load(filepath.Join(dir, "advisories.yml"))
+			Expect(err).ToNot(HaveOccurred())
+
+			affecting, err := advisories.Affecting(list, "dotnet-runtime", "8.0.6")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(affecting).To(HaveLen(1))
+			Expect(affecting[0].ID).To(Equal("CVE-2024-0001"))
+			Expect(advisories.Affecting(list, "dotnet-runtime", "8.0.7")).To(BeEmpty())
+			Expect(advisories.Affecting(list, "dotnet-aspnetcore", "8.0.6")).To(BeEmpty())
+		})
+	})
+
+	Describe("Ignored", func() {
+		It("ignores the listed advisories, or all", func() {
+			advisory := advisories.Advisory{ID: "CVE-2024-0001"}
+			Expect(advisories.Ignored(advisory)).To(BeFalse())
+			Expect(os.Setenv("IGNORE_ADVISORIES", "CVE-2024-0009, cve-2024-0001")).To(Succeed())
+			Expect(advisories.Ignored(advisory)).To(BeTrue())
+			Expect(os.Setenv("IGNORE_ADVISORIES", "all")).To(Succeed())
+			Expect(advisories.Ignored(advisories.Advisory{ID: "OTHER"})).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"dotnetcore/cnb"
+	"os"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Describes the layers and processes of an app staged by supply and
+// finalize for the Cloud Native Buildpacks lifecycle
+func main() {
+	logger := libbuildpack.NewLogger(os.Stdout)
+
+	if len(os.Args) != 3 {
+		logger.Error("Usage: %s <app-dir> <layers-dir>", os.Args[0])
+		os.Exit(1)
+	}
+	appDir, layersDir := os.Args[1], os.Args[2]
+
+	if err := cnb.WriteLayers(appDir, layersDir); err != nil {
+		logger.Error("Unable to write layer metadata: %s", err.Error())
+		os.Exit(2)
+	}
+	if err := cnb.WriteLaunch(appDir, layersDir); err != nil {
+		logger.Error("Unable to write launch.toml: %s", err.Error())
+		os.Exit(3)
+	}
+}
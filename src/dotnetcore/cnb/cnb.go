@@ -0,0 +1,78 @@
+// Package cnb adapts the output of supply and finalize to the Cloud Native
+// Buildpacks lifecycle. bin/build stages the app with DEPS_DIR set to the
+// deps layer and index 0, as Cloud Foundry would, and this package then
+// describes the layers and processes the way the lifecycle expects.
+package cnb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// DepsLayer holds DEPS_DIR, and CacheLayer the buildpack's cache dir
+const (
+	DepsLayer  = "deps"
+	CacheLayer = "cache"
+	DepsIdx    = "0"
+)
+
+// defaultPort is the port apps listen on when the platform sets no PORT
+const defaultPort = "8080"
+
+// WriteLayers marks the deps layer for launch and the cache layer for
+// caching, and sets the launch environment the profile.d scripts and
+// process commands expect on Cloud Foundry
+func WriteLayers(appDir, layersDir string) error {
+	if err := ioutil.WriteFile(filepath.Join(layersDir, DepsLayer+".toml"), []byte("launch = true\n"), 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(layersDir, CacheLayer+".toml"), []byte("cache = true\n"), 0644); err != nil {
+		return err
+	}
+
+	envDir := filepath.Join(layersDir, DepsLayer, "env.launch")
+	if err := os.MkdirAll(envDir, 0755); err != nil {
+		return err
+	}
+	for name, value := range map[string]string{
+		"DEPS_DIR.override": filepath.Join(layersDir, DepsLayer),
+		"HOME.override":     appDir,
+		"PORT.default":      defaultPort,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(envDir, name), []byte(value), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteLaunch turns the process types of the release step into the
+// processes of launch.toml, run by bash so the profile.d scripts of the
+// deps layer are sourced first
+func WriteLaunch(appDir, layersDir string) error {
+	release := struct {
+		DefaultProcessTypes map[string]string `yaml:"default_process_types"`
+	}{}
+	releasePath := filepath.Join(appDir, "tmp", "dotnet-core-buildpack-release-step.yml")
+	if err := libbuildpack.NewYAML().Load(releasePath, &release); err != nil {
+		return fmt.Errorf("could not read the release step: %s", err)
+	}
+
+	var types []string
+	for processType := range release.DefaultProcessTypes {
+		types = append(types, processType)
+	}
+	sort.Strings(types)
+
+	launch := ""
+	for _, processType := range types {
+		launch += fmt.Sprintf("[[processes]]\ntype = %s\ncommand = %s\n\n", strconv.Quote(processType), strconv.Quote(release.DefaultProcessTypes[processType]))
+	}
+	return ioutil.WriteFile(filepath.Join(layersDir, "launch.toml"), []byte(launch), 0644)
+}
@@ -0,0 +1,13 @@
+package cnb_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCnb(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Cnb Suite")
+}
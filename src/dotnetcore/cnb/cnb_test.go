@@ -0,0 +1,64 @@
+package cnb_test
+
+import (
+	"dotnetcore/cnb"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cnb", func() {
+	var appDir, layersDir string
+
+	BeforeEach(func() {
+		var err error
+		appDir, err = ioutil.TempDir("", "dotnet-core-buildpack.app.")
+		Expect(err).ToNot(HaveOccurred())
+		layersDir, err = ioutil.TempDir("", "dotnet-core-buildpack.layers.")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(appDir)).To(Succeed())
+		Expect(os.RemoveAll(layersDir)).To(Succeed())
+	})
+
+	Describe("WriteLayers", func() {
+		It("launches with the deps layer as DEPS_DIR and the app as HOME", func() {
+			Expect(cnb.WriteLayers(appDir, layersDir)).To(Succeed())
+			Expect(ioutil.ReadFile(filepath.Join(layersDir, "deps.toml"))).To(Equal([]byte("launch = true\n")))
+			Expect(ioutil.ReadFile(filepath.Join(layersDir, "cache.toml"))).To(Equal([]byte("cache = true\n")))
+			Expect(ioutil.ReadFile(filepath.Join(layersDir, "deps", "env.launch", "DEPS_DIR.override"))).To(Equal([]byte(filepath.Join(layersDir, "deps"))))
+			Expect(ioutil.ReadFile(filepath.Join(layersDir, "deps", "env.launch", "HOME.override"))).To(Equal([]byte(appDir)))
+			Expect(ioutil.ReadFile(filepath.Join(layersDir, "deps", "env.launch", "PORT.default"))).To(Equal([]byte("8080")))
+		})
+	})
+
+	Describe("WriteLaunch", func() {
+		It("writes the release step's process types as processes", func() {
+			Expect(os.MkdirAll(filepath.Join(appDir, "tmp"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(appDir, "tmp", "dotnet-core-buildpack-release-step.yml"), []byte(`default_process_types:
+  web: cd ${DEPS_DIR}/0/dotnet_publish && ./app
+  migrate: cd ${DEPS_DIR}/0/dotnet_publish && ./efbundle
+`), 0644)).To(Succeed())
+
+			Expect(cnb.WriteLaunch(appDir, layersDir)).To(Succeed())
+			Expect(ioutil.ReadFile(filepath.Join(layersDir, "launch.toml"))).To(Equal([]byte(`[[processes]]
+type = "migrate"
+command = "cd ${DEPS_DIR}/0/dotnet_publish && ./efbundle"
+
+[[processes]]
+type = "web"
+command = "cd ${DEPS_DIR}/0/dotnet_publish && ./app"
+
+`)))
+		})
+
+		It("fails when the app was not staged", func() {
+			Expect(cnb.WriteLaunch(appDir, layersDir)).To(MatchError(ContainSubstring("could not read the release step")))
+		})
+	})
+})
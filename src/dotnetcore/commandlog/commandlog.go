@@ -0,0 +1,99 @@
+package commandlog
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+var secretNameRe = regexp.MustCompile(`(?i)(password|passwd|secret|token|key|credential|connectionstring|VCAP_SERVICES)`)
+
+// Command wraps libbuildpack.Command and logs each external command it
+// runs at debug level
+type Command struct {
+	Command *libbuildpack.Command
+	Log     *libbuildpack.Logger
+}
+
+func New(logger *libbuildpack.Logger) *Command {
+	return &Command{Command: &libbuildpack.Command{}, Log: logger}
+}
+
+// Enable turns on debug logging when BP_LOG_LEVEL=debug. libbuildpack only
+// knows about BP_DEBUG, so that is set as well.
+func Enable() {
+	if strings.ToLower(os.Getenv("BP_LOG_LEVEL")) == "debug" {
+		os.Setenv("BP_DEBUG", "1")
+	}
+}
+
+func (c *Command) Execute(dir string, stdout io.Writer, stderr io.Writer, program string, args ...string) error {
+	c.log(dir, nil, append([]string{program}, args...))
+	return c.Command.Execute(dir, stdout, stderr, program, args...)
+}
+
+func (c *Command) Output(dir string, program string, args ...string) (string, error) {
+	c.log(dir, nil, append([]string{program}, args...))
+	return c.Command.Output(dir, program, args...)
+}
+
+func (c *Command) Run(cmd *exec.Cmd) error {
+	c.log(cmd.Dir, cmd.Env, cmd.Args)
+	return c.Command.Run(cmd)
+}
+
+// RunGroup runs cmd in its own process group, which is killed as a whole
+// once ctx is done, since MSBuild starts worker processes that would keep
+// the output pipes open after cmd itself was killed. The group is left
+// alone once cmd has been waited for.
+func (c *Command) RunGroup(ctx context.Context, cmd *exec.Cmd) error {
+	c.log(cmd.Dir, cmd.Env, cmd.Args)
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func(pgid int) {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-pgid, syscall.SIGKILL)
+		case <-done:
+		}
+	}(cmd.Process.Pid)
+	err := cmd.Wait()
+	close(done)
+	return err
+}
+
+func (c *Command) log(dir string, env []string, args []string) {
+	if os.Getenv("BP_DEBUG") == "" {
+		return
+	}
+	c.Log.Debug("Running %s (in %s)", strings.Join(args, " "), dir)
+	for _, v := range Sanitize(env) {
+		c.Log.Debug("  %s", v)
+	}
+}
+
+// Sanitize redacts the values of variables whose names suggest a secret
+func Sanitize(env []string) []string {
+	sanitized := make([]string, 0, len(env))
+	for _, v := range env {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) == 2 && secretNameRe.MatchString(parts[0]) {
+			v = parts[0] + "=[REDACTED]"
+		}
+		sanitized = append(sanitized, v)
+	}
+	return sanitized
+}
@@ -0,0 +1,13 @@
+package commandlog_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCommandlog(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Commandlog Suite")
+}
@@ -0,0 +1,100 @@
+package commandlog_test
+
+import (
+	"bytes"
+	"context"
+	"dotnetcore/commandlog"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Commandlog", func() {
+	Describe("Sanitize", func() {
+		It("redacts secret looking variables", func() {
+			Expect(commandlog.Sanitize([]string{
+				"PATH=/bin",
+				"NUGET_API_KEY=abc",
+				"DB_PASSWORD=hunter2",
+				"ConnectionStrings__Default=Server=db",
+				"VCAP_SERVICES={}",
+			})).To(Equal([]string{
+				"PATH=/bin",
+				"NUGET_API_KEY=[REDACTED]",
+				"DB_PASSWORD=[REDACTED]",
+				"ConnectionStrings__Default=[REDACTED]",
+				"VCAP_SERVICES=[REDACTED]",
+			}))
+		})
+	})
+
+	Describe("Run", func() {
+		var (
+			buffer  *bytes.Buffer
+			command *commandlog.Command
+		)
+
+		BeforeEach(func() {
+			buffer = new(bytes.Buffer)
+			command = commandlog.New(libbuildpack.NewLogger(buffer))
+		})
+
+		AfterEach(func() {
+			Expect(os.Unsetenv("BP_DEBUG")).To(Succeed())
+			Expect(os.Unsetenv("BP_LOG_LEVEL")).To(Succeed())
+		})
+
+		It("logs the command and sanitized env when BP_LOG_LEVEL=debug", func() {
+			Expect(os.Setenv("BP_LOG_LEVEL", "debug")).To(Succeed())
+			commandlog.Enable()
+
+			cmd := exec.Command("true")
+			cmd.Dir = "/"
+			cmd.Env = []string{"A=1", "SECRET_TOKEN=xyz"}
+			Expect(command.Run(cmd)).To(Succeed())
+
+			Expect(buffer.String()).To(ContainSubstring("Running true (in /)"))
+			Expect(buffer.String()).To(ContainSubstring("A=1"))
+			Expect(buffer.String()).To(ContainSubstring("SECRET_TOKEN=[REDACTED]"))
+			Expect(buffer.String()).NotTo(ContainSubstring("xyz"))
+		})
+
+		It("logs nothing otherwise", func() {
+			Expect(command.Execute("/", ioutil.Discard, ioutil.Discard, "true")).To(Succeed())
+			Expect(buffer.String()).To(BeEmpty())
+		})
+	})
+
+	Describe("RunGroup", func() {
+		var command *commandlog.Command
+
+		BeforeEach(func() {
+			command = commandlog.New(libbuildpack.NewLogger(new(bytes.Buffer)))
+		})
+
+		It("kills the processes the command started once ctx is done", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			cmd := exec.CommandContext(ctx, "sh", "-c", "sleep 30 & sleep 30")
+			cmd.Stdout = new(bytes.Buffer)
+
+			start := time.Now()
+			Expect(command.RunGroup(ctx, cmd)).To(MatchError("signal: killed"))
+			Expect(time.Since(start)).To(BeNumerically("<", 10*time.Second))
+		})
+
+		It("runs the command to completion", func() {
+			output := new(bytes.Buffer)
+			cmd := exec.Command("echo", "done")
+			cmd.Stdout = output
+
+			Expect(command.RunGroup(context.Background(), cmd)).To(Succeed())
+			Expect(output.String()).To(Equal("done\n"))
+		})
+	})
+})
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SplitArgs splits a command line setting into arguments the way a shell
+// would, honouring single and double quotes and backslash escapes, so an
+// argument may contain spaces
+func SplitArgs(line string) ([]string, error) {
+	args := []string{}
+	var arg []rune
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, c := range line {
+		switch {
+		case escaped:
+			arg = append(arg, c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				arg = append(arg, c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, string(arg))
+				arg, inArg = nil, false
+			}
+		default:
+			arg = append(arg, c)
+			inArg = true
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("%s ends with an unescaped backslash", strings.TrimSpace(line))
+	} else if quote != 0 {
+		return nil, fmt.Errorf("%s has an unterminated %c quote", strings.TrimSpace(line), quote)
+	}
+	if inArg {
+		args = append(args, string(arg))
+	}
+	return args, nil
+}
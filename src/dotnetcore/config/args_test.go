@@ -0,0 +1,27 @@
+package config_test
+
+import (
+	"dotnetcore/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SplitArgs", func() {
+	It("splits on whitespace", func() {
+		Expect(config.SplitArgs("  --self-contained\t--no-restore ")).To(Equal([]string{"--self-contained", "--no-restore"}))
+	})
+
+	It("keeps quoted and escaped spaces within an argument", func() {
+		Expect(config.SplitArgs(`-p:Product="My App" -p:Company='A \ B' -p:Title=A\ B ""`)).To(Equal([]string{"-p:Product=My App", `-p:Company=A \ B`, "-p:Title=A B", ""}))
+	})
+
+	It("is empty for an empty line", func() {
+		Expect(config.SplitArgs("")).To(BeEmpty())
+	})
+
+	It("rejects an unterminated quote", func() {
+		_, err := config.SplitArgs(`-p:Product="My App`)
+		Expect(err).To(MatchError(`-p:Product="My App has an unterminated " quote`))
+	})
+})
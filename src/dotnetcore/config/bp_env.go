@@ -0,0 +1,34 @@
+package config
+
+import "os"
+
+// bpAliases maps the Paketo .NET Core buildpack's env vars to the ones
+// this buildpack reads, so apps can move between the two without changing
+// their configuration. The targets are this buildpack's own settings:
+// DOTNET_FRAMEWORK_VERSION pins the framework installed, PROJECT_PATH
+// selects the main project as the .deployment project setting does, and
+// PUBLISH_FLAGS adds arguments, split and quoted as a shell would, to
+// dotnet publish.
+var bpAliases = map[string]string{
+	"BP_DOTNET_FRAMEWORK_VERSION": "DOTNET_FRAMEWORK_VERSION",
+	"BP_DOTNET_PROJECT_PATH":      "PROJECT_PATH",
+	"BP_DOTNET_PUBLISH_FLAGS":     "PUBLISH_FLAGS",
+}
+
+// ApplyBPAliases sets this buildpack's env vars from their BP_* aliases,
+// unless they are set already, and returns the aliases it used
+func ApplyBPAliases() []string {
+	var used []string
+	for alias, name := range bpAliases {
+		value, set := os.LookupEnv(alias)
+		if !set {
+			continue
+		}
+		if _, set := os.LookupEnv(name); set {
+			continue
+		}
+		os.Setenv(name, value)
+		used = append(used, alias)
+	}
+	return used
+}
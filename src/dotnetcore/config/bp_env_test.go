@@ -0,0 +1,30 @@
+package config_test
+
+import (
+	"dotnetcore/config"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ApplyBPAliases", func() {
+	AfterEach(func() {
+		for _, name := range []string{"BP_DOTNET_PROJECT_PATH", "PROJECT_PATH", "BP_DOTNET_PUBLISH_FLAGS", "PUBLISH_FLAGS"} {
+			Expect(os.Unsetenv(name)).To(Succeed())
+		}
+	})
+
+	It("sets this buildpack's env vars from their aliases", func() {
+		Expect(os.Setenv("BP_DOTNET_PROJECT_PATH", "src/api")).To(Succeed())
+		Expect(config.ApplyBPAliases()).To(Equal([]string{"BP_DOTNET_PROJECT_PATH"}))
+		Expect(os.Getenv("PROJECT_PATH")).To(Equal("src/api"))
+	})
+
+	It("lets this buildpack's own env vars win", func() {
+		Expect(os.Setenv("BP_DOTNET_PUBLISH_FLAGS", "--self-contained")).To(Succeed())
+		Expect(os.Setenv("PUBLISH_FLAGS", "--no-self-contained")).To(Succeed())
+		Expect(config.ApplyBPAliases()).To(BeEmpty())
+		Expect(os.Getenv("PUBLISH_FLAGS")).To(Equal("--no-self-contained"))
+	})
+})
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+type BuildpackYML struct {
+	DotnetCore DotnetCore `yaml:"dotnet-core"`
+}
+
+type DotnetCore struct {
+	Sdk                   string                `yaml:"sdk"`
+	NodeVersion           string                `yaml:"node-version"`
+	InstallNode           *bool                 `yaml:"install-node"`
+	InstallBower          *bool                 `yaml:"install-bower"`
+	MSBuildProperties     []string              `yaml:"msbuild-properties"`
+	MSBuildMaxCPUCount    int                   `yaml:"msbuild-max-cpu-count"`
+	MSBuildNodeReuse      *bool                 `yaml:"msbuild-node-reuse"`
+	DisableAnalyzers      bool                  `yaml:"disable-analyzers"`
+	Deterministic         Deterministic         `yaml:"deterministic"`
+	PublishProfile        string                `yaml:"publish-profile"`
+	TargetFramework       string                `yaml:"target-framework"`
+	Migrations            Migrations            `yaml:"migrations"`
+	AspnetcoreEnvironment AspnetcoreEnvironment `yaml:"aspnetcore-environment"`
+	GC                    GC                    `yaml:"gc"`
+	Libgdiplus            OptionalDependency    `yaml:"libgdiplus"`
+	Globalization         Globalization         `yaml:"globalization"`
+	Tzdata                OptionalDependency    `yaml:"tzdata"`
+	Krb5                  OptionalDependency    `yaml:"krb5"`
+	Yarn                  OptionalDependency    `yaml:"yarn"`
+	Spa                   Spa                   `yaml:"spa"`
+	Prune                 Prune                 `yaml:"prune"`
+	Sources               Sources               `yaml:"sources"`
+	Timeouts              Timeouts              `yaml:"timeouts"`
+	Fake                  Fake                  `yaml:"fake"`
+	Tests                 Tests                 `yaml:"tests"`
+	Tasks                 map[string]string     `yaml:"tasks"`
+	Precompress           Precompress           `yaml:"precompress"`
+	Kestrel               Kestrel               `yaml:"kestrel"`
+	SmokeTest             SmokeTest             `yaml:"smoke-test"`
+	CleanBuildOutput      *bool                 `yaml:"clean-build-output"`
+	PublishDir            string                `yaml:"publish-dir"`
+	RetainSdk             bool                  `yaml:"retain-sdk"`
+	Droplet               string                `yaml:"droplet"`
+	HostingStartup        *bool                 `yaml:"hosting-startup"`
+	Audit                 Audit                 `yaml:"nuget-audit"`
+	LicenseReport         LicenseReport         `yaml:"license-report"`
+}
+
+// Migrations run during staging when enabled. TaskCommand, when set, is
+// also offered as the migrate task, run from the published app with
+// cf run-task --process migrate; it must not need the SDK, e.g. an EF Core
+// migration bundle.
+type Migrations struct {
+	Enabled          bool   `yaml:"enabled"`
+	Command          string `yaml:"command"`
+	Service          string `yaml:"service"`
+	ConnectionString string `yaml:"connection-string"`
+	TaskCommand      string `yaml:"task-command"`
+}
+
+// AspnetcoreEnvironment derives ASPNETCORE_ENVIRONMENT at launch from
+// another env var, or from the name of the space the app runs in
+type AspnetcoreEnvironment struct {
+	Variable string `yaml:"variable"`
+	Spaces   []struct {
+		Match       string `yaml:"match"`
+		Environment string `yaml:"environment"`
+	} `yaml:"spaces"`
+}
+
+// GC settings are left to the launch time heuristic when unset
+type GC struct {
+	Server     *bool `yaml:"server"`
+	Concurrent *bool `yaml:"concurrent"`
+}
+
+// Kestrel settings applied at launch. Http2 serves HTTP/2 without TLS
+// (h2c) on $PORT, as gRPC needs behind a router that speaks h2c to the app.
+type Kestrel struct {
+	Http2 bool `yaml:"http2"`
+}
+
+// Globalization either installs ICU from the manifest, or runs the app in
+// invariant mode so it doesn't need ICU at all
+type Globalization struct {
+	Invariant *bool              `yaml:"invariant"`
+	ICU       OptionalDependency `yaml:"icu"`
+}
+
+// Spa configures the frontend build of apps with a SpaRoot. Script is the
+// npm script to run, build by default.
+type Spa struct {
+	Build  *bool  `yaml:"build"`
+	Script string `yaml:"script"`
+}
+
+// Prune removes files the app doesn't need at runtime from the publish
+// output. Languages lists the satellite assembly cultures to keep; all are
+// kept when it is empty or [all], and none when it is [none].
+type Prune struct {
+	Docs      bool     `yaml:"docs"`
+	Symbols   bool     `yaml:"symbols"`
+	Languages []string `yaml:"languages"`
+}
+
+// Precompress writes gzip, and with Brotli also brotli, copies of the
+// static assets under wwwroot next to them after publish
+type Precompress struct {
+	Enabled bool `yaml:"enabled"`
+	Brotli  bool `yaml:"brotli"`
+}
+
+// Sources controls whether the app's sources are removed from the droplet
+// once published. Preserve lists paths, relative to the app root and with
+// the syntax of filepath.Match, that the app still reads at runtime.
+type Sources struct {
+	Remove   bool     `yaml:"remove"`
+	Preserve []string `yaml:"preserve"`
+}
+
+// Deterministic builds the app as a CI build with the PDBs and untracked
+// sources embedded in the assemblies, so SourceLink information survives
+// publishing. The repository and revision stand in for the .git directory,
+// which cf push leaves out.
+type Deterministic struct {
+	Enabled       bool   `yaml:"enabled"`
+	RepositoryURL string `yaml:"repository-url"`
+	Revision      string `yaml:"revision"`
+}
+
+// Timeouts bound how long dotnet restore, test and publish may run, as Go
+// durations (e.g. 10m) or whole minutes. They are unbounded when unset.
+// Each covers the whole step, so the test timeout is shared by all the test
+// projects run, not given to each.
+type Timeouts struct {
+	Restore string `yaml:"restore"`
+	Publish string `yaml:"publish"`
+	Test    string `yaml:"test"`
+}
+
+// Fake builds the app with its FAKE script instead of dotnet publish.
+// Script defaults to build.fsx. Output is the directory, relative to the
+// app, the script publishes to; when unset the script is expected to
+// publish to $PUBLISH_DIR.
+type Fake struct {
+	Enabled bool   `yaml:"enabled"`
+	Script  string `yaml:"script"`
+	Target  string `yaml:"target"`
+	Output  string `yaml:"output"`
+}
+
+// Tests runs dotnet test before publishing and fails staging when a test
+// fails. Projects lists the test projects to run, relative to the app; all
+// of them run when it is empty. Filter is passed to dotnet test --filter.
+type Tests struct {
+	Enabled  bool     `yaml:"enabled"`
+	Projects []string `yaml:"projects"`
+	Filter   string   `yaml:"filter"`
+}
+
+// SmokeTest starts the published app at the end of staging and fails
+// staging if it exits, or does not listen on its port, within Seconds
+// (10 by default)
+type SmokeTest struct {
+	Enabled bool `yaml:"enabled"`
+	Seconds int  `yaml:"seconds"`
+}
+
+// Audit lists the app's NuGet packages with known vulnerabilities after
+// restore. Staging fails on findings of FailOn severity or above, one of
+// low, moderate, high or critical, and only warns when it is unset.
+type Audit struct {
+	Enabled bool   `yaml:"enabled"`
+	FailOn  string `yaml:"fail-on"`
+}
+
+// LicenseReport prints the licenses of the app's NuGet packages, which are
+// always recorded in nuget-licenses.json in the dep dir
+type LicenseReport struct {
+	Print bool `yaml:"print"`
+}
+
+// OptionalDependency controls a dependency that is only installed for some
+// apps. Install overrides detection when set, and Version pins one of the
+// manifest's versions.
+type OptionalDependency struct {
+	Install *bool  `yaml:"install"`
+	Version string `yaml:"version"`
+}
+
+// LoadBuildpackYML reads the app's buildpack.yml, returning an empty
+// configuration if the app doesn't have one
+func LoadBuildpackYML(buildDir string) (*BuildpackYML, error) {
+	obj := &BuildpackYML{}
+	if found, err := libbuildpack.FileExists(filepath.Join(buildDir, "buildpack.yml")); err != nil || !found {
+		return obj, err
+	}
+
+	if err := libbuildpack.NewYAML().Load(filepath.Join(buildDir, "buildpack.yml"), obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
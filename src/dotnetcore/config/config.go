@@ -2,4 +2,5 @@ package config
 
 type Config struct {
 	DotnetSdkVersion string
+	DotnetRoot       string
 }
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// ProjectTOML is the part of a Cloud Native Buildpacks project.toml this
+// buildpack understands: build time env vars, and include or exclude
+// patterns for the app's files. Both the 0.1 ([build]) and the 0.2
+// ([io.buildpacks]) layouts are read.
+type ProjectTOML struct {
+	Env     map[string]string
+	Include []string
+	Exclude []string
+}
+
+// LoadProjectTOML reads the app's project.toml, returning an empty
+// configuration if the app doesn't have one. Only the TOML that
+// project.toml files use is supported: tables, arrays of tables, strings,
+// and arrays of strings.
+func LoadProjectTOML(buildDir string) (*ProjectTOML, error) {
+	obj := &ProjectTOML{Env: map[string]string{}}
+	path := filepath.Join(buildDir, "project.toml")
+	if found, err := libbuildpack.FileExists(path); err != nil || !found {
+		return obj, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var table string
+	var env map[string]string
+	flushEnv := func() {
+		if env != nil && env["name"] != "" {
+			obj.Env[env["name"]] = env["value"]
+		}
+		env = nil
+	}
+
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(stripTOMLComment(scanner.Text()))
+		// Arrays may span lines
+		for strings.Count(line, "[")-strings.Count(line, "]") > 0 && strings.Contains(line, "=") && scanner.Scan() {
+			lineNo++
+			line += " " + strings.TrimSpace(stripTOMLComment(scanner.Text()))
+		}
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "[["):
+			flushEnv()
+			table = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "[["), "]]"))
+			if table == "build.env" || table == "io.buildpacks.build.env" {
+				env = map[string]string{}
+			}
+		case strings.HasPrefix(line, "["):
+			flushEnv()
+			table = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"))
+		default:
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("could not parse project.toml line %d: %s", lineNo, line)
+			}
+			key := strings.Trim(strings.TrimSpace(parts[0]), `"`)
+			values, err := parseTOMLValue(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return nil, fmt.Errorf("could not parse project.toml line %d: %s", lineNo, err)
+			}
+			switch {
+			case env != nil && (key == "name" || key == "value") && len(values) == 1:
+				env[key] = values[0]
+			case (table == "build" || table == "io.buildpacks") && key == "include":
+				obj.Include = values
+			case (table == "build" || table == "io.buildpacks") && key == "exclude":
+				obj.Exclude = values
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flushEnv()
+	return obj, nil
+}
+
+// SetEnv sets the env vars project.toml declares, except those the app
+// already set through cf, and returns their names
+func (p *ProjectTOML) SetEnv() []string {
+	var names []string
+	for name, value := range p.Env {
+		if _, set := os.LookupEnv(name); set {
+			continue
+		}
+		os.Setenv(name, value)
+		names = append(names, name)
+	}
+	return names
+}
+
+// parseTOMLValue returns the strings of a string or array of strings value.
+// Other values are returned as written.
+func parseTOMLValue(value string) ([]string, error) {
+	if !strings.HasPrefix(value, "[") {
+		s, err := parseTOMLString(value)
+		return []string{s}, err
+	}
+	if !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("unterminated array %s", value)
+	}
+	values := []string{}
+	rest := strings.TrimSpace(value[1 : len(value)-1])
+	for rest != "" {
+		end := len(rest)
+		if rest[0] == '"' || rest[0] == '\'' {
+			if end = stringEnd(rest); end < 0 {
+				return nil, fmt.Errorf("unterminated string in %s", value)
+			}
+		} else if comma := strings.IndexByte(rest, ','); comma >= 0 {
+			end = comma
+		}
+		s, err := parseTOMLString(strings.TrimSpace(rest[:end]))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, s)
+		rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rest[end:]), ","))
+	}
+	return values, nil
+}
+
+func parseTOMLString(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		return value[1 : len(value)-1], nil
+	}
+	return value, nil
+}
+
+// stringEnd returns the index just past the string s starts with, or -1 if
+// it is not terminated
+func stringEnd(s string) int {
+	for i := 1; i < len(s); i++ {
+		if s[0] == '"' && s[i] == '\\' {
+			i++
+		} else if s[i] == s[0] {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// stripTOMLComment removes a # comment that is outside of any string
+func stripTOMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
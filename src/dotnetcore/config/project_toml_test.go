@@ -0,0 +1,88 @@
+package config_test
+
+import (
+	"dotnetcore/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoadProjectTOML", func() {
+	var buildDir string
+
+	BeforeEach(func() {
+		var err error
+		buildDir, err = ioutil.TempDir("", "dotnet-core-buildpack.build.")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+	})
+
+	It("returns an empty configuration without a project.toml", func() {
+		projectTOML, err := config.LoadProjectTOML(buildDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(projectTOML.Env).To(BeEmpty())
+		Expect(projectTOML.Exclude).To(BeEmpty())
+	})
+
+	It("reads the 0.1 layout", func() {
+		Expect(ioutil.WriteFile(filepath.Join(buildDir, "project.toml"), []byte(`
+[project]
+id = "orders" # the service
+
+[build]
+exclude = [
+  "docs",
+  "*.md",
+]
+
+[[build.env]]
+name = "RUN_TESTS"
+value = "true"
+
+[[build.env]]
+name = 'PUBLISH_TIMEOUT'
+value = "10m # not a comment"
+`), 0644)).To(Succeed())
+
+		projectTOML, err := config.LoadProjectTOML(buildDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(projectTOML.Exclude).To(Equal([]string{"docs", "*.md"}))
+		Expect(projectTOML.Env).To(Equal(map[string]string{"RUN_TESTS": "true", "PUBLISH_TIMEOUT": "10m # not a comment"}))
+	})
+
+	It("reads the 0.2 layout", func() {
+		Expect(ioutil.WriteFile(filepath.Join(buildDir, "project.toml"), []byte(`
+[_]
+schema-version = "0.2"
+
+[io.buildpacks]
+include = ["src", "buildpack.yml"]
+
+[[io.buildpacks.build.env]]
+name = "SMOKE_TEST"
+value = "true"
+`), 0644)).To(Succeed())
+
+		projectTOML, err := config.LoadProjectTOML(buildDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(projectTOML.Include).To(Equal([]string{"src", "buildpack.yml"}))
+		Expect(projectTOML.Env).To(Equal(map[string]string{"SMOKE_TEST": "true"}))
+	})
+
+	It("does not override env vars the app set", func() {
+		Expect(os.Setenv("RUN_TESTS", "false")).To(Succeed())
+		defer os.Unsetenv("RUN_TESTS")
+		defer os.Unsetenv("SMOKE_TEST")
+
+		projectTOML := &config.ProjectTOML{Env: map[string]string{"RUN_TESTS": "true", "SMOKE_TEST": "true"}}
+		Expect(projectTOML.SetEnv()).To(Equal([]string{"SMOKE_TEST"}))
+		Expect(os.Getenv("RUN_TESTS")).To(Equal("false"))
+		Expect(os.Getenv("SMOKE_TEST")).To(Equal("true"))
+	})
+})
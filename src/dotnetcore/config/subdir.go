@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BuildSubdir returns the subdirectory of the pushed app that BUILD_SUBDIR
+// names as the app's root, cleaned and relative, or "" when it is unset
+func BuildSubdir() string {
+	subdir := filepath.Clean(strings.Trim(os.Getenv("BUILD_SUBDIR"), "/"))
+	if subdir == "." {
+		return ""
+	}
+	return subdir
+}
+
+// AppRoot returns the directory staging treats as the app: the build dir,
+// or its BUILD_SUBDIR
+func AppRoot(buildDir string) (string, error) {
+	subdir := BuildSubdir()
+	if subdir == "" {
+		return buildDir, nil
+	}
+	if subdir == ".." || strings.HasPrefix(subdir, "../") {
+		return "", fmt.Errorf("BUILD_SUBDIR %s is outside the app", subdir)
+	}
+	root := filepath.Join(buildDir, subdir)
+	if info, err := os.Stat(root); os.IsNotExist(err) {
+		return "", fmt.Errorf("BUILD_SUBDIR %s does not exist", subdir)
+	} else if err != nil {
+		return "", err
+	} else if !info.IsDir() {
+		return "", fmt.Errorf("BUILD_SUBDIR %s is not a directory", subdir)
+	}
+	return root, nil
+}
+
+// StagerArgs replaces the build dir in the buildpack's arguments with the
+// app root. Profile scripts stay at the root of the droplet, where they are
+// run from at launch.
+func StagerArgs(args []string) ([]string, error) {
+	root, err := AppRoot(args[0])
+	if err != nil || root == args[0] {
+		return args, err
+	}
+	stagerArgs := append([]string{root}, args[1:]...)
+	if len(stagerArgs) < 5 {
+		stagerArgs = append(stagerArgs, make([]string, 5-len(stagerArgs))...)
+	}
+	if stagerArgs[4] == "" {
+		stagerArgs[4] = filepath.Join(args[0], ".profile.d")
+	}
+	return stagerArgs, nil
+}
@@ -0,0 +1,64 @@
+package config_test
+
+import (
+	"dotnetcore/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AppRoot", func() {
+	var buildDir string
+
+	BeforeEach(func() {
+		var err error
+		buildDir, err = ioutil.TempDir("", "dotnet-core-buildpack.build.")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Join(buildDir, "services", "orders"), 0755)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.Unsetenv("BUILD_SUBDIR")).To(Succeed())
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+	})
+
+	It("is the build dir by default", func() {
+		Expect(config.AppRoot(buildDir)).To(Equal(buildDir))
+	})
+
+	It("is the BUILD_SUBDIR of the build dir", func() {
+		Expect(os.Setenv("BUILD_SUBDIR", "/services/orders/")).To(Succeed())
+		Expect(config.BuildSubdir()).To(Equal("services/orders"))
+		Expect(config.AppRoot(buildDir)).To(Equal(filepath.Join(buildDir, "services", "orders")))
+	})
+
+	It("rejects subdirectories outside the app or missing", func() {
+		Expect(os.Setenv("BUILD_SUBDIR", "../other")).To(Succeed())
+		_, err := config.AppRoot(buildDir)
+		Expect(err).To(MatchError("BUILD_SUBDIR ../other is outside the app"))
+
+		Expect(os.Setenv("BUILD_SUBDIR", "services/missing")).To(Succeed())
+		_, err = config.AppRoot(buildDir)
+		Expect(err).To(MatchError("BUILD_SUBDIR services/missing does not exist"))
+	})
+})
+
+var _ = Describe("StagerArgs", func() {
+	AfterEach(func() {
+		Expect(os.Unsetenv("BUILD_SUBDIR")).To(Succeed())
+	})
+
+	It("stages the subdirectory with profile scripts at the root", func() {
+		buildDir, err := ioutil.TempDir("", "dotnet-core-buildpack.build.")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(buildDir)
+		Expect(os.MkdirAll(filepath.Join(buildDir, "api"), 0755)).To(Succeed())
+		Expect(os.Setenv("BUILD_SUBDIR", "api")).To(Succeed())
+
+		Expect(config.StagerArgs([]string{buildDir, "/cache", "/deps", "0"})).To(Equal([]string{filepath.Join(buildDir, "api"), "/cache", "/deps", "0", filepath.Join(buildDir, ".profile.d")}))
+		Expect(config.StagerArgs([]string{buildDir, "/cache", "/deps", "0", "/profile"})).To(Equal([]string{filepath.Join(buildDir, "api"), "/cache", "/deps", "0", "/profile"}))
+	})
+})
@@ -1,16 +1,21 @@
 package dotnetframework
 
 import (
+	"context"
+	"dotnetcore/fileindex"
+	"dotnetcore/runtimeconfig"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/Masterminds/semver"
 	"github.com/cloudfoundry/libbuildpack"
 )
 
 type Installer interface {
-	InstallDependency(libbuildpack.Dependency, string) error
+	InstallDependencyContext(context.Context, libbuildpack.Dependency, string) error
 }
 
 type DotnetFramework struct {
@@ -19,6 +24,8 @@ type DotnetFramework struct {
 	manifest  *libbuildpack.Manifest
 	logger    *libbuildpack.Logger
 	buildDir  string
+	files     *fileindex.Index
+	ctx       context.Context
 }
 
 func New(depDir string, buildDir string, installer Installer, manifest *libbuildpack.Manifest, logger *libbuildpack.Logger) *DotnetFramework {
@@ -28,11 +35,27 @@ func New(depDir string, buildDir string, installer Installer, manifest *libbuild
 		manifest:  manifest,
 		logger:    logger,
 		buildDir:  buildDir,
+		files:     fileindex.New(buildDir),
+		ctx:       context.Background(),
 	}
 }
 
+// SetIndex shares a listing of the build dir, such as the project's, so
+// that the tree is not walked again
+func (d *DotnetFramework) SetIndex(files *fileindex.Index) *DotnetFramework {
+	d.files = files
+	return d
+}
+
+// SetContext abandons framework installs once ctx is done, such as when
+// staging times out
+func (d *DotnetFramework) SetContext(ctx context.Context) *DotnetFramework {
+	d.ctx = ctx
+	return d
+}
+
 func (d *DotnetFramework) Install() error {
-	versions, err := d.requiredVersions()
+	versions, err := d.RequiredVersions()
 	if err != nil {
 		return err
 	}
@@ -53,39 +76,50 @@ func (d *DotnetFramework) Install() error {
 	return nil
 }
 
-func (d *DotnetFramework) requiredVersions() ([]string, error) {
-	runtimeFile, err := d.runtimeConfigFile()
+// RequiredVersions returns the framework versions the app needs. For apps
+// that are not yet published they are only known after dotnet restore.
+// DOTNET_FRAMEWORK_VERSION, which may end in .x, pins the version instead.
+func (d *DotnetFramework) RequiredVersions() ([]string, error) {
+	if pinned := os.Getenv("DOTNET_FRAMEWORK_VERSION"); pinned != "" {
+		version, err := libbuildpack.FindMatchingVersion(pinned, d.manifest.AllDependencyVersions("dotnet-framework"))
+		if err != nil {
+			return []string{}, fmt.Errorf("DOTNET_FRAMEWORK_VERSION %s: %s", pinned, err)
+		}
+		return []string{version}, nil
+	}
+	runtimeFile, err := runtimeconfig.Find(d.files)
 	if err != nil {
 		return []string{}, err
 	}
 	if runtimeFile != "" {
-		obj := struct {
-			RuntimeOptions struct {
-				Framework struct {
-					Name    string `json:"name"`
-					Version string `json:"version"`
-				} `json:"framework"`
-				ApplyPatches *bool `json:"applyPatches"`
-			} `json:"runtimeOptions"`
-		}{}
-
-		if err := libbuildpack.NewJSON().Load(runtimeFile, &obj); err != nil {
+		config, err := runtimeconfig.Load(runtimeFile)
+		if err != nil {
 			return []string{}, err
 		}
-		version := obj.RuntimeOptions.Framework.Version
-		if version != "" {
-			if obj.RuntimeOptions.ApplyPatches == nil || *obj.RuntimeOptions.ApplyPatches {
-				v := strings.Split(version, ".")
-				v[2] = "x"
-				versions := d.manifest.AllDependencyVersions("dotnet-framework")
-				version, err = libbuildpack.FindMatchingVersion(strings.Join(v, "."), versions)
-				if err != nil {
-					return []string{}, err
-				}
+		// Apps on just ASP.NET Core's framework run on the runtime of the
+		// same version
+		framework, found := config.Framework("Microsoft.NETCore.App")
+		if !found && len(config.Frameworks) == 1 {
+			framework = config.Frameworks[0]
+		}
+		if framework.Version == "" {
+			return []string{}, nil
+		}
+		requested := framework.Version
+		version := requested
+		if config.AppliesPatches() {
+			constraint, err := framework.PatchConstraint()
+			if err != nil {
+				return []string{}, err
+			}
+			versions := d.manifest.AllDependencyVersions("dotnet-framework")
+			version, err = libbuildpack.FindMatchingVersion(constraint, versions)
+			if err != nil {
+				return []string{}, err
 			}
-			return []string{version}, nil
+			d.logger.Debug("Rolled framework %s from %s forward to %s", requested, runtimeFile, version)
 		}
-		return []string{}, nil
+		return []string{version}, nil
 	}
 	restoredVersionsDir := filepath.Join(d.depDir, ".nuget", "packages", "microsoft.netcore.app")
 	if exists, err := libbuildpack.FileExists(restoredVersionsDir); err != nil {
@@ -119,20 +153,68 @@ func (d *DotnetFramework) isInstalled(version string) (bool, error) {
 	return false, nil
 }
 
+// installFramework installs the version from the manifest. A version the
+// manifest lacks fails with the closest one it has, or with
+// DOTNET_FRAMEWORK_ROLL_FORWARD set by the operator, installs that instead.
 func (d *DotnetFramework) installFramework(version string) error {
-	if err := d.installer.InstallDependency(libbuildpack.Dependency{Name: "dotnet-framework", Version: version}, filepath.Join(d.depDir, "dotnet")); err != nil {
-		return err
+	available := d.manifest.AllDependencyVersions("dotnet-framework")
+	closest := ""
+	if !containsVersion(available, version) {
+		closest = closestVersion(version, available)
+		if closest != "" && os.Getenv("DOTNET_FRAMEWORK_ROLL_FORWARD") == "true" {
+			d.logger.Warning("dotnet-framework %s is not provided by this buildpack, installing %s instead", version, closest)
+			version = closest
+		}
+	}
+
+	if err := d.installer.InstallDependencyContext(d.ctx, libbuildpack.Dependency{Name: "dotnet-framework", Version: version}, filepath.Join(d.depDir, "dotnet")); err != nil {
+		if containsVersion(available, version) {
+			return err
+		}
+		message := fmt.Sprintf("dotnet-framework %s is not provided by this buildpack, which has %s", version, strings.Join(available, ", "))
+		if closest != "" {
+			message += fmt.Sprintf(". The closest is %s: let the app roll forward to it by removing applyPatches false from runtimeconfig.json, or ask your operator to set DOTNET_FRAMEWORK_ROLL_FORWARD=true", closest)
+		}
+		return fmt.Errorf("%s", message)
 	}
 	return nil
 }
 
-func (d *DotnetFramework) runtimeConfigFile() (string, error) {
-	if configFiles, err := filepath.Glob(filepath.Join(d.buildDir, "*.runtimeconfig.json")); err != nil {
-		return "", err
-	} else if len(configFiles) == 1 {
-		return configFiles[0], nil
-	} else if len(configFiles) > 1 {
-		return "", fmt.Errorf("Multiple .runtimeconfig.json files present")
+// closestVersion returns the available version the framework would roll
+// forward to: the lowest later patch of the same major.minor, or else the
+// highest earlier one. It is empty when no version shares the major.minor.
+func closestVersion(version string, available []string) string {
+	requested, err := semver.NewVersion(version)
+	if err != nil {
+		return ""
+	}
+	var later, earlier *semver.Version
+	for _, candidate := range available {
+		v, err := semver.NewVersion(candidate)
+		if err != nil || v.Major() != requested.Major() || v.Minor() != requested.Minor() {
+			continue
+		}
+		if !v.LessThan(requested) {
+			if later == nil || v.LessThan(later) {
+				later = v
+			}
+		} else if earlier == nil || v.GreaterThan(earlier) {
+			earlier = v
+		}
+	}
+	if later != nil {
+		return later.Original()
+	} else if earlier != nil {
+		return earlier.Original()
+	}
+	return ""
+}
+
+func containsVersion(versions []string, version string) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
 	}
-	return "", nil
+	return false
 }
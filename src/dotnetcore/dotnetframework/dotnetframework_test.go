@@ -3,6 +3,7 @@ package dotnetframework_test
 import (
 	"bytes"
 	"dotnetcore/dotnetframework"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -69,7 +70,7 @@ var _ = Describe("Dotnetframework", func() {
 					})
 
 					It("does not install the framework again", func() {
-						mockInstaller.EXPECT().InstallDependency(libbuildpack.Dependency{Name: "dotnet-framework", Version: "4.5.6"}, gomock.Any()).Times(0)
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), libbuildpack.Dependency{Name: "dotnet-framework", Version: "4.5.6"}, gomock.Any()).Times(0)
 						Expect(subject.Install()).To(Succeed())
 					})
 				})
@@ -81,10 +82,82 @@ var _ = Describe("Dotnetframework", func() {
 					})
 
 					It("installs the additional framework", func() {
-						mockInstaller.EXPECT().InstallDependency(libbuildpack.Dependency{Name: "dotnet-framework", Version: "7.8.9"}, filepath.Join(depDir, "dotnet"))
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), libbuildpack.Dependency{Name: "dotnet-framework", Version: "7.8.9"}, filepath.Join(depDir, "dotnet"))
 						Expect(subject.Install()).To(Succeed())
 					})
 				})
+
+				Context("the runtimeconfig lists several frameworks", func() {
+					BeforeEach(func() {
+						Expect(ioutil.WriteFile(filepath.Join(buildDir, "foo.runtimeconfig.json"),
+							[]byte(`{ "runtimeOptions": { "frameworks": [{ "name": "Microsoft.AspNetCore.App", "version": "9.9.9" }, { "name": "Microsoft.NETCore.App", "version": "7.8.9" }], "applyPatches": false } }`), 0644)).To(Succeed())
+					})
+
+					It("installs the version of Microsoft.NETCore.App", func() {
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), libbuildpack.Dependency{Name: "dotnet-framework", Version: "7.8.9"}, filepath.Join(depDir, "dotnet"))
+						Expect(subject.Install()).To(Succeed())
+					})
+				})
+
+				Context("the runtimeconfig has comments and trailing commas", func() {
+					BeforeEach(func() {
+						Expect(ioutil.WriteFile(filepath.Join(buildDir, "foo.runtimeconfig.json"),
+							[]byte("{\n  \"runtimeOptions\": {\n    /* pinned */ \"framework\": { \"name\": \"Microsoft.NETCore.App\", \"version\": \"7.8.9\", },\n    \"applyPatches\": false, // exact\n  }\n}"), 0644)).To(Succeed())
+					})
+
+					It("installs the framework it names", func() {
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), libbuildpack.Dependency{Name: "dotnet-framework", Version: "7.8.9"}, filepath.Join(depDir, "dotnet"))
+						Expect(subject.Install()).To(Succeed())
+					})
+				})
+			})
+
+			Context("the exact version required is not in the manifest", func() {
+				BeforeEach(func() {
+					deps := ""
+					for _, version := range []string{"2.0.6", "2.1.0", "2.1.5"} {
+						deps += "- name: dotnet-framework\n  version: " + version + "\n  uri: https://example.com/dotnet-framework." + version + ".tar.xz\n  sha256: abc\n  cf_stacks: [cflinuxfs2]\n"
+					}
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "manifest.yml"), []byte("---\ndependencies:\n"+deps), 0644)).To(Succeed())
+					Expect(os.Setenv("CF_STACK", "cflinuxfs2")).To(Succeed())
+					manifest, err = libbuildpack.NewManifest(buildDir, logger, time.Now())
+					Expect(err).To(BeNil())
+					subject = dotnetframework.New(depDir, buildDir, mockInstaller, manifest, logger)
+
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "foo.runtimeconfig.json"),
+						[]byte(`{ "runtimeOptions": { "framework": { "name": "Microsoft.NETCore.App", "version": "2.1.3" }, "applyPatches": false } }`), 0644)).To(Succeed())
+				})
+
+				AfterEach(func() {
+					Expect(os.Unsetenv("CF_STACK")).To(Succeed())
+					Expect(os.Unsetenv("DOTNET_FRAMEWORK_ROLL_FORWARD")).To(Succeed())
+				})
+
+				It("lists the available versions and suggests the closest", func() {
+					mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), libbuildpack.Dependency{Name: "dotnet-framework", Version: "2.1.3"}, gomock.Any()).Return(fmt.Errorf("dependency not found"))
+					Expect(subject.Install()).To(MatchError(ContainSubstring("dotnet-framework 2.1.3 is not provided by this buildpack, which has 2.0.6, 2.1.0, 2.1.5. The closest is 2.1.5")))
+				})
+
+				It("installs the version DOTNET_FRAMEWORK_VERSION pins", func() {
+					Expect(os.Setenv("DOTNET_FRAMEWORK_VERSION", "2.0.x")).To(Succeed())
+					defer os.Unsetenv("DOTNET_FRAMEWORK_VERSION")
+					mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), libbuildpack.Dependency{Name: "dotnet-framework", Version: "2.0.6"}, filepath.Join(depDir, "dotnet"))
+					Expect(subject.Install()).To(Succeed())
+				})
+
+				It("rolls a major.minor version forward to its latest patch", func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "foo.runtimeconfig.json"),
+						[]byte(`{ "runtimeOptions": { "framework": { "name": "Microsoft.AspNetCore.App", "version": "2.1" } } }`), 0644)).To(Succeed())
+					mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), libbuildpack.Dependency{Name: "dotnet-framework", Version: "2.1.5"}, filepath.Join(depDir, "dotnet"))
+					Expect(subject.Install()).To(Succeed())
+				})
+
+				It("rolls forward to the closest when the operator allows it", func() {
+					Expect(os.Setenv("DOTNET_FRAMEWORK_ROLL_FORWARD", "true")).To(Succeed())
+					mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), libbuildpack.Dependency{Name: "dotnet-framework", Version: "2.1.5"}, filepath.Join(depDir, "dotnet"))
+					Expect(subject.Install()).To(Succeed())
+					Expect(buffer.String()).To(ContainSubstring("dotnet-framework 2.1.3 is not provided by this buildpack, installing 2.1.5 instead"))
+				})
 			})
 
 			Context("when required versions are discovered via restored packages", func() {
@@ -94,7 +167,7 @@ var _ = Describe("Dotnetframework", func() {
 					})
 
 					It("does not install the framework again", func() {
-						mockInstaller.EXPECT().InstallDependency(libbuildpack.Dependency{Name: "dotnet-framework", Version: "4.5.6"}, gomock.Any()).Times(0)
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), libbuildpack.Dependency{Name: "dotnet-framework", Version: "4.5.6"}, gomock.Any()).Times(0)
 						Expect(subject.Install()).To(Succeed())
 					})
 				})
@@ -105,7 +178,7 @@ var _ = Describe("Dotnetframework", func() {
 					})
 
 					It("installs the additional framework", func() {
-						mockInstaller.EXPECT().InstallDependency(libbuildpack.Dependency{Name: "dotnet-framework", Version: "7.8.9"}, filepath.Join(depDir, "dotnet"))
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), libbuildpack.Dependency{Name: "dotnet-framework", Version: "7.8.9"}, filepath.Join(depDir, "dotnet"))
 						Expect(subject.Install()).To(Succeed())
 					})
 				})
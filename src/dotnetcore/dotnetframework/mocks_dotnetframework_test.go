@@ -5,6 +5,7 @@
 package dotnetframework_test
 
 import (
+	context "context"
 	libbuildpack "github.com/cloudfoundry/libbuildpack"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
@@ -33,14 +34,14 @@ func (m *MockInstaller) EXPECT() *MockInstallerMockRecorder {
 	return m.recorder
 }
 
-// InstallDependency mocks base method
-func (m *MockInstaller) InstallDependency(arg0 libbuildpack.Dependency, arg1 string) error {
-	ret := m.ctrl.Call(m, "InstallDependency", arg0, arg1)
+// InstallDependencyContext mocks base method
+func (m *MockInstaller) InstallDependencyContext(arg0 context.Context, arg1 libbuildpack.Dependency, arg2 string) error {
+	ret := m.ctrl.Call(m, "InstallDependencyContext", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// InstallDependency indicates an expected call of InstallDependency
-func (mr *MockInstallerMockRecorder) InstallDependency(arg0, arg1 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InstallDependency", reflect.TypeOf((*MockInstaller)(nil).InstallDependency), arg0, arg1)
+// InstallDependencyContext indicates an expected call of InstallDependencyContext
+func (mr *MockInstallerMockRecorder) InstallDependencyContext(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InstallDependencyContext", reflect.TypeOf((*MockInstaller)(nil).InstallDependencyContext), arg0, arg1, arg2)
 }
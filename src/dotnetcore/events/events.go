@@ -0,0 +1,93 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+type Event struct {
+	Time       string  `json:"time"`
+	Phase      string  `json:"phase,omitempty"`
+	Dependency string  `json:"dependency,omitempty"`
+	Version    string  `json:"version,omitempty"`
+	Duration   float64 `json:"duration,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Log writes staging events as JSON lines, interleaved with the human
+// readable output, when BP_LOG_FORMAT=json. A nil Log discards events.
+type Log struct {
+	w       io.Writer
+	json    bool
+	now     func() time.Time
+	timings []Timing
+}
+
+type Timing struct {
+	Phase    string
+	Duration time.Duration
+}
+
+func New(w io.Writer) *Log {
+	return &Log{w: w, json: os.Getenv("BP_LOG_FORMAT") == "json", now: time.Now}
+}
+
+func (l *Log) Emit(e Event) {
+	if l == nil || !l.json {
+		return
+	}
+	e.Time = l.now().UTC().Format(time.RFC3339)
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(l.w, "%s\n", data)
+}
+
+// Dependency records that a dependency was installed
+func (l *Log) Dependency(name, version string) {
+	l.Emit(Event{Dependency: name, Version: version})
+}
+
+// Phase runs fn and records its duration and error, if any
+func (l *Log) Phase(name string, fn func() error) error {
+	if l == nil {
+		return fn()
+	}
+	start := l.now()
+	err := fn()
+	duration := l.now().Sub(start)
+	l.timings = append(l.timings, Timing{Phase: name, Duration: duration})
+	e := Event{Phase: name, Duration: duration.Seconds()}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	l.Emit(e)
+	return err
+}
+
+func (l *Log) Timings() []Timing {
+	if l == nil {
+		return nil
+	}
+	return l.timings
+}
+
+// PrintTimings prints how long each phase run so far took
+func (l *Log) PrintTimings(logger *libbuildpack.Logger) {
+	if l == nil || len(l.timings) == 0 {
+		return
+	}
+	var total time.Duration
+	logger.BeginStep("Phase timings")
+	for _, t := range l.timings {
+		logger.Info("%-26s %6.1fs", t.Phase, t.Duration.Seconds())
+		total += t.Duration
+	}
+	logger.Info("%-26s %6.1fs", "total", total.Seconds())
+}
@@ -0,0 +1,103 @@
+package events_test
+
+import (
+	"bytes"
+	"dotnetcore/events"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Events", func() {
+	var (
+		buffer *bytes.Buffer
+		log    *events.Log
+	)
+
+	BeforeEach(func() {
+		buffer = new(bytes.Buffer)
+	})
+
+	AfterEach(func() {
+		Expect(os.Unsetenv("BP_LOG_FORMAT")).To(Succeed())
+	})
+
+	decode := func() []map[string]interface{} {
+		var all []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+			e := map[string]interface{}{}
+			Expect(json.Unmarshal([]byte(line), &e)).To(Succeed())
+			all = append(all, e)
+		}
+		return all
+	}
+
+	Context("BP_LOG_FORMAT is json", func() {
+		BeforeEach(func() {
+			Expect(os.Setenv("BP_LOG_FORMAT", "json")).To(Succeed())
+			log = events.New(buffer)
+		})
+
+		It("emits dependency events", func() {
+			log.Dependency("dotnet-sdk", "2.1.301")
+			e := decode()[0]
+			Expect(e["dependency"]).To(Equal("dotnet-sdk"))
+			Expect(e["version"]).To(Equal("2.1.301"))
+			Expect(e["time"]).NotTo(BeEmpty())
+		})
+
+		It("emits phase events with the error", func() {
+			err := log.Phase("publish", func() error { return errors.New("exit status 1") })
+			Expect(err).To(MatchError("exit status 1"))
+			e := decode()[0]
+			Expect(e["phase"]).To(Equal("publish"))
+			Expect(e["error"]).To(Equal("exit status 1"))
+		})
+	})
+
+	Context("BP_LOG_FORMAT is not set", func() {
+		It("emits nothing", func() {
+			log = events.New(buffer)
+			log.Dependency("dotnet-sdk", "2.1.301")
+			Expect(log.Phase("publish", func() error { return nil })).To(Succeed())
+			Expect(buffer.String()).To(BeEmpty())
+		})
+	})
+
+	Context("phases have run", func() {
+		BeforeEach(func() {
+			log = events.New(buffer)
+			Expect(log.Phase("restore", func() error { return nil })).To(Succeed())
+			Expect(log.Phase("publish", func() error { return errors.New("failed") })).NotTo(Succeed())
+		})
+
+		It("records their durations in order", func() {
+			Expect(log.Timings()).To(HaveLen(2))
+			Expect(log.Timings()[0].Phase).To(Equal("restore"))
+			Expect(log.Timings()[1].Phase).To(Equal("publish"))
+		})
+
+		It("prints them with a total", func() {
+			log.PrintTimings(libbuildpack.NewLogger(buffer))
+			Expect(buffer.String()).To(ContainSubstring("Phase timings"))
+			Expect(buffer.String()).To(MatchRegexp(`restore\s+\d+\.\ds`))
+			Expect(buffer.String()).To(MatchRegexp(`publish\s+\d+\.\ds`))
+			Expect(buffer.String()).To(MatchRegexp(`total\s+\d+\.\ds`))
+		})
+	})
+
+	Context("the log is nil", func() {
+		It("still runs phases", func() {
+			ran := false
+			log = nil
+			Expect(log.Phase("publish", func() error { ran = true; return nil })).To(Succeed())
+			Expect(ran).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,91 @@
+package fileindex
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Index lists the files in the build dir that matter for detecting what to
+// install and build. The tree is walked once, when first needed, and the
+// result is shared by everything that looks for files during staging. Call
+// Reset after a step that changes the tree.
+type Index struct {
+	root    string
+	files   []string
+	scanned bool
+}
+
+func New(root string) *Index {
+	return &Index{root: root}
+}
+
+func (i *Index) Root() string {
+	return i.root
+}
+
+// skippedDirs hold build output, packages or buildpack state, which are
+// slow to walk and may contain stale copies of project files
+var skippedDirs = map[string]bool{
+	".cloudfoundry": true,
+	"bin":           true,
+	"obj":           true,
+	"node_modules":  true,
+}
+
+// Files returns the paths of the files below the root, outside skipped
+// directories, in lexical order
+func (i *Index) Files() ([]string, error) {
+	if i.scanned {
+		return i.files, nil
+	}
+
+	files := []string{}
+	if err := filepath.Walk(i.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != i.root && skippedDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	i.files = files
+	i.scanned = true
+	return i.files, nil
+}
+
+// Glob returns the files whose path relative to the root matches the
+// pattern, with the syntax of filepath.Match
+func (i *Index) Glob(pattern string) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	files, err := i.Files()
+	if err != nil {
+		return nil, err
+	}
+	matches := []string{}
+	for _, path := range files {
+		rel, err := filepath.Rel(i.root, path)
+		if err != nil {
+			return nil, err
+		}
+		if matched, _ := filepath.Match(pattern, rel); matched {
+			matches = append(matches, path)
+		}
+	}
+	return matches, nil
+}
+
+// Reset discards the cached listing, so the next lookup walks the tree again
+func (i *Index) Reset() {
+	i.files = nil
+	i.scanned = false
+}
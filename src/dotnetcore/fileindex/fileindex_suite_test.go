@@ -0,0 +1,13 @@
+package fileindex_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFileindex(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fileindex Suite")
+}
@@ -0,0 +1,64 @@
+package fileindex_test
+
+import (
+	"dotnetcore/fileindex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Index", func() {
+	var (
+		root  string
+		index *fileindex.Index
+	)
+
+	write := func(name string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(root, name), []byte(""), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "fileindex")
+		Expect(err).ToNot(HaveOccurred())
+		for _, name := range []string{"app.runtimeconfig.json", "src/app.csproj", ".cloudfoundry/cached.csproj", "src/bin/Debug/app.csproj", "src/obj/app.csproj", "ClientApp/node_modules/pkg/index.js"} {
+			write(name)
+		}
+		index = fileindex.New(root)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	It("lists the files outside .cloudfoundry, bin, obj and node_modules", func() {
+		Expect(index.Files()).To(Equal([]string{
+			filepath.Join(root, "app.runtimeconfig.json"),
+			filepath.Join(root, "src", "app.csproj"),
+		}))
+	})
+
+	It("matches globs against paths relative to the root", func() {
+		Expect(index.Glob("*.runtimeconfig.json")).To(Equal([]string{filepath.Join(root, "app.runtimeconfig.json")}))
+		Expect(index.Glob("*.csproj")).To(BeEmpty())
+		Expect(index.Glob("src/*.csproj")).To(Equal([]string{filepath.Join(root, "src", "app.csproj")}))
+	})
+
+	It("rejects malformed patterns", func() {
+		_, err := index.Glob("[")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("walks the tree once until reset", func() {
+		Expect(index.Files()).To(HaveLen(2))
+		write("new.csproj")
+		Expect(index.Files()).To(HaveLen(2))
+
+		index.Reset()
+		Expect(index.Files()).To(HaveLen(3))
+	})
+})
@@ -0,0 +1,63 @@
+package finalize
+
+import (
+	"dotnetcore/advisories"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// installedProducts maps the directories of a dotnet install holding
+// versions of a product to the product's name in advisories
+var installedProducts = map[string]string{
+	"sdk":                             "dotnet-sdk",
+	"shared/Microsoft.NETCore.App":    "dotnet-runtime",
+	"shared/Microsoft.AspNetCore.App": "dotnet-aspnetcore",
+}
+
+// CheckAdvisories looks up the SDK, runtime and ASP.NET Core versions
+// installed for the app in the advisories dataset. Affected versions are
+// warned about, or fail staging when the operator sets
+// ADVISORY_POLICY=fail; IGNORE_ADVISORIES lets an app stage anyway in an
+// emergency.
+func (f *Finalizer) CheckAdvisories() error {
+	dotnetDir := filepath.Join(f.Stager.DepDir(), "dotnet")
+	if _, err := os.Stat(dotnetDir); os.IsNotExist(err) {
+		return nil
+	}
+	list, err := advisories.Load(f.Advisories)
+	if err != nil || len(list) == 0 {
+		return err
+	}
+
+	var failures []string
+	for dir, name := range installedProducts {
+		versions, err := ioutil.ReadDir(filepath.Join(dotnetDir, dir))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for _, version := range versions {
+			affecting, err := advisories.Affecting(list, name, version.Name())
+			if err != nil {
+				return err
+			}
+			for _, advisory := range affecting {
+				message := fmt.Sprintf("%s %s is affected by %s: %s", name, version.Name(), advisory.ID, advisory.Summary)
+				if os.Getenv("ADVISORY_POLICY") != "fail" || advisories.Ignored(advisory) {
+					f.Log.Warning("%s", message)
+					continue
+				}
+				f.Log.Error("%s", message)
+				failures = append(failures, advisory.ID)
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("the installed dotnet versions are affected by %s; update them, or set IGNORE_ADVISORIES to stage anyway", strings.Join(failures, ", "))
+	}
+	return nil
+}
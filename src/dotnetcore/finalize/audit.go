@@ -0,0 +1,148 @@
+package finalize
+
+import (
+	"bytes"
+	"dotnetcore/config"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// auditSDK is the first SDK whose dotnet list package can both report
+// vulnerable packages, which came in 5.0.200, and do so as json
+const auditSDK = "7.0.200"
+
+// severities of NuGet advisories, from least to most severe
+var severities = []string{"low", "moderate", "high", "critical"}
+
+// AuditPackages lists the restored NuGet packages of the main project that
+// have known vulnerabilities, when NUGET_AUDIT or nuget-audit in
+// buildpack.yml enables it, and fails staging on findings at or above the
+// fail-on severity. NUGET_AUDIT_FAIL_ON overrides that severity.
+func (f *Finalizer) AuditPackages() error {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	audit := buildpackYML.DotnetCore.Audit
+	if !audit.Enabled && os.Getenv("NUGET_AUDIT") != "true" {
+		return nil
+	}
+	if env := os.Getenv("NUGET_AUDIT_FAIL_ON"); env != "" {
+		audit.FailOn = env
+	}
+	threshold := -1
+	if audit.FailOn != "" {
+		if threshold = severityIndex(audit.FailOn); threshold < 0 {
+			return fmt.Errorf("unknown NuGet audit severity %s, expected one of %s", audit.FailOn, strings.Join(severities, ", "))
+		}
+	}
+	if published, err := f.Project.IsPublished(); err != nil || published {
+		return err
+	}
+	mainProject, err := f.Project.MainPath()
+	if err != nil || mainProject == "" {
+		return err
+	}
+
+	sdk, err := f.latestSDK()
+	if err != nil {
+		return err
+	} else if sdk == "" {
+		f.Log.Warning("Skipping the NuGet audit, as no .NET SDK is installed")
+		return nil
+	} else if compareVersions(sdk, auditSDK) < 0 {
+		f.Log.Warning("Skipping the NuGet audit, as it needs the .NET SDK %s or later and the app is built with %s", auditSDK, sdk)
+		return nil
+	}
+
+	f.Log.BeginStep("Auditing NuGet packages for known vulnerabilities")
+	output := &bytes.Buffer{}
+	cmd := exec.Command("dotnet", "list", mainProject, "package", "--vulnerable", "--include-transitive", "--format", "json")
+	cmd.Dir = f.Stager.BuildDir()
+	cmd.Env = f.shellEnvironment()
+	cmd.Stdout = output
+	cmd.Stderr = indentWriter(os.Stderr)
+	if err := f.Command.Run(cmd); err != nil {
+		return fmt.Errorf("dotnet list package --vulnerable: %s", err)
+	}
+
+	report := struct {
+		Projects []struct {
+			Frameworks []struct {
+				Framework          string              `json:"framework"`
+				TopLevelPackages   []vulnerablePackage `json:"topLevelPackages"`
+				TransitivePackages []vulnerablePackage `json:"transitivePackages"`
+			} `json:"frameworks"`
+		} `json:"projects"`
+	}{}
+	if err := json.Unmarshal(output.Bytes(), &report); err != nil {
+		return fmt.Errorf("parsing dotnet list package output: %s", err)
+	}
+
+	found := map[string]bool{}
+	var failing []string
+	for _, project := range report.Projects {
+		for _, framework := range project.Frameworks {
+			for _, pkg := range append(framework.TopLevelPackages, framework.TransitivePackages...) {
+				for _, vulnerability := range pkg.Vulnerabilities {
+					finding := fmt.Sprintf("%s %s: %s severity, %s", pkg.ID, pkg.ResolvedVersion, vulnerability.Severity, vulnerability.AdvisoryURL)
+					if found[finding] {
+						continue
+					}
+					found[finding] = true
+					if threshold >= 0 && severityIndex(vulnerability.Severity) >= threshold {
+						f.Log.Error("%s", finding)
+						failing = append(failing, pkg.ID+" "+pkg.ResolvedVersion)
+					} else {
+						f.Log.Warning("%s", finding)
+					}
+				}
+			}
+		}
+	}
+	if len(found) == 0 {
+		f.Log.Info("No known vulnerabilities found")
+	}
+	if len(failing) > 0 {
+		return fmt.Errorf("vulnerabilities of %s severity or higher found in %s", strings.ToLower(audit.FailOn), strings.Join(failing, ", "))
+	}
+	return nil
+}
+
+// latestSDK returns the newest SDK version installed for the app, which is
+// the one dotnet runs unless global.json asks for another
+func (f *Finalizer) latestSDK() (string, error) {
+	versions, err := installedVersions(filepath.Join(f.Stager.DepDir(), "dotnet", "sdk"))
+	if err != nil {
+		return "", err
+	}
+	latest := ""
+	for _, version := range versions {
+		if latest == "" || compareVersions(version, latest) > 0 {
+			latest = version
+		}
+	}
+	return latest, nil
+}
+
+type vulnerablePackage struct {
+	ID              string `json:"id"`
+	ResolvedVersion string `json:"resolvedVersion"`
+	Vulnerabilities []struct {
+		Severity    string `json:"severity"`
+		AdvisoryURL string `json:"advisoryurl"`
+	} `json:"vulnerabilities"`
+}
+
+func severityIndex(severity string) int {
+	for i, s := range severities {
+		if strings.EqualFold(s, strings.TrimSpace(severity)) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,81 @@
+package finalize
+
+import (
+	"dotnetcore/config"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// buildOutputDirs are the directories, relative to a project, that dotnet
+// build writes to by default. Other files in bin, such as scripts of an app
+// at the root of the push, are left alone.
+var buildOutputDirs = []string{"obj", filepath.Join("bin", "Debug"), filepath.Join("bin", "Release")}
+
+// CleanBuildOutput warns about build output pushed next to the projects,
+// whose project.assets.json and binaries from another machine confuse
+// restore and build, and removes it unless clean-build-output in
+// buildpack.yml or CLEAN_BUILD_OUTPUT is false
+func (f *Finalizer) CleanBuildOutput() error {
+	if published, err := f.Project.IsPublished(); err != nil || published {
+		return err
+	}
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	clean := buildpackYML.DotnetCore.CleanBuildOutput == nil || *buildpackYML.DotnetCore.CleanBuildOutput
+	if env := os.Getenv("CLEAN_BUILD_OUTPUT"); env != "" {
+		clean = env != "false"
+	}
+
+	paths, err := f.Project.ProjFilePaths()
+	if err != nil {
+		return err
+	}
+	var found []string
+	seen := map[string]bool{}
+	for _, path := range paths {
+		for _, name := range buildOutputDirs {
+			dir := filepath.Join(filepath.Dir(path), name)
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				found = append(found, dir)
+			} else if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+
+	var rels []string
+	for _, dir := range found {
+		rel, err := filepath.Rel(f.Stager.BuildDir(), dir)
+		if err != nil {
+			return err
+		}
+		rels = append(rels, rel)
+	}
+	f.Log.Warning("The app was pushed with build output in %s; add bin/Debug/, bin/Release/ and obj/ to .cfignore", strings.Join(rels, ", "))
+	if !clean {
+		return nil
+	}
+	f.Log.Info("Removing the pushed build output")
+	for _, dir := range found {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		// Drop bin once nothing else is left in it
+		if parent := filepath.Dir(dir); filepath.Base(parent) == "bin" {
+			if err := os.Remove(parent); err != nil && !os.IsNotExist(err) && !isNotEmpty(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package finalize
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// CheckProject fails staging up front when the app has nothing the
+// buildpack can run, rather than producing an empty start command
+func (f *Finalizer) CheckProject() error {
+	mainPath, err := f.Project.MainPath()
+	if err != nil {
+		return err
+	} else if mainPath != "" {
+		if err := f.checkExecutable(); err != nil {
+			return err
+		}
+		if published, err := f.Project.IsPublished(); err != nil || published {
+			return err
+		}
+		return f.checkTargetFramework(mainPath)
+	}
+
+	return fmt.Errorf("%s", strings.Join([]string{
+		"No project or published app was found. The buildpack looked for:",
+		"  - a *.csproj, *.fsproj or *.vbproj file anywhere outside bin, obj, node_modules and .cloudfoundry",
+		"  - a *.runtimeconfig.json file at the root of the app, for apps published before pushing",
+		"Common fixes:",
+		"  - push the directory containing the project or solution, e.g. cf push -p ./src/MyApp",
+		"  - push the output of dotnet publish rather than the build output",
+		"  - check that .cfignore does not exclude the project file",
+	}, "\n"))
+}
+
+// checkExecutable warns when every project file seems to build a class
+// library, as publishing them would leave nothing to start. It only reads
+// the project files themselves, not Directory.Build.props or other imports
+// that may set OutputType, so it doesn't fail staging.
+func (f *Finalizer) checkExecutable() error {
+	if published, err := f.Project.IsPublished(); err != nil || published {
+		return err
+	}
+	paths, err := f.Project.ProjFilePaths()
+	if err != nil {
+		return err
+	}
+
+	var libraries []string
+	for _, path := range paths {
+		if executable, err := f.Project.IsExecutable(path); err != nil {
+			return err
+		} else if executable {
+			return nil
+		}
+		rel, err := filepath.Rel(f.Stager.BuildDir(), path)
+		if err != nil {
+			return err
+		}
+		libraries = append(libraries, rel)
+	}
+
+	f.Log.Warning("No executable project was found, these projects seem to build class libraries: %s. "+
+		"Set <OutputType>Exe</OutputType> in the app's project, or use Sdk=\"Microsoft.NET.Sdk.Web\" for web apps", strings.Join(libraries, ", "))
+	return nil
+}
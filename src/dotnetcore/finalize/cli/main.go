@@ -1,21 +1,25 @@
 package main
 
 import (
+	"dotnetcore/commandlog"
 	"dotnetcore/config"
 	"dotnetcore/dotnetframework"
+	"dotnetcore/events"
 	"dotnetcore/finalize"
+	_ "dotnetcore/hooks"
+	"dotnetcore/installer"
 	"dotnetcore/project"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	// _ "dotnetcore/hooks"
 	"time"
 
 	"github.com/cloudfoundry/libbuildpack"
 )
 
 func main() {
+	commandlog.Enable()
 	logfile, err := ioutil.TempFile("", "cloudfoundry.dotnetcore-buildpack.finalize")
 	defer logfile.Close()
 	if err != nil {
@@ -39,7 +43,12 @@ func main() {
 		os.Exit(10)
 	}
 
-	stager := libbuildpack.NewStager(os.Args[1:], logger, manifest)
+	stagerArgs, err := config.StagerArgs(os.Args[1:])
+	if err != nil {
+		logger.Error("Unable to find the app root: %s", err.Error())
+		os.Exit(21)
+	}
+	stager := libbuildpack.NewStager(stagerArgs, logger, manifest)
 
 	if err = manifest.ApplyOverride(stager.DepsDir()); err != nil {
 		logger.Error("Unable to apply override.yml files: %s", err)
@@ -51,6 +60,18 @@ func main() {
 		os.Exit(11)
 	}
 
+	projectTOML, err := config.LoadProjectTOML(stager.BuildDir())
+	if err != nil {
+		logger.Error("Unable to read project.toml: %s", err.Error())
+		os.Exit(20)
+	}
+	for _, name := range projectTOML.SetEnv() {
+		logger.Info("Setting %s from project.toml", name)
+	}
+	for _, alias := range config.ApplyBPAliases() {
+		logger.Info("Using %s", alias)
+	}
+
 	configYml := struct {
 		Config config.Config `yaml:"config"`
 	}{}
@@ -59,20 +80,38 @@ func main() {
 		os.Exit(15)
 	}
 
-	dotnetframework := dotnetframework.New(stager.DepDir(), stager.BuildDir(), libbuildpack.NewInstaller(manifest), manifest, logger)
+	project := project.New(stager.BuildDir(), stager.DepDir(), stager.DepsIdx()).SetLogger(logger)
+	// SIGTERM is left to end finalize when staging times out, as its
+	// commands don't stop on a cancelled context
+	installer := installer.New(manifest, logger).SetProgress(installer.LogProgress(logger))
+	dotnetframework := dotnetframework.New(stager.DepDir(), stager.BuildDir(), installer, manifest, logger).SetIndex(project.Index())
 	f := finalize.Finalizer{
 		Stager:          stager,
 		Log:             logger,
-		Command:         &libbuildpack.Command{},
+		Command:         commandlog.New(logger),
 		DotnetFramework: dotnetframework,
+		Manifest:        manifest,
 		Config:          &configYml.Config,
-		Project:         project.New(stager.BuildDir(), stager.DepDir(), stager.DepsIdx()),
+		Project:         project,
+		StaticServer:    filepath.Join(filepath.Dir(os.Args[0]), "staticserver"),
+		LaunchEnv:       filepath.Join(filepath.Dir(os.Args[0]), "launchenv"),
+		Advisories:      filepath.Join(buildpackDir, "advisories.yml"),
+		Events:          events.New(stdout),
 	}
 
 	if err := finalize.Run(&f); err != nil {
 		os.Exit(12)
 	}
 
+	// The release step reads its YAML from the root of the droplet
+	if root := os.Args[1]; root != stager.BuildDir() {
+		release := filepath.Join("tmp", "dotnet-core-buildpack-release-step.yml")
+		if err := libbuildpack.CopyFile(filepath.Join(stager.BuildDir(), release), filepath.Join(root, release)); err != nil {
+			logger.Error("Unable to write the release YAML: %s", err.Error())
+			os.Exit(22)
+		}
+	}
+
 	if err := libbuildpack.RunAfterCompile(stager); err != nil {
 		logger.Error("After Compile: %s", err.Error())
 		os.Exit(13)
@@ -0,0 +1,68 @@
+package finalize
+
+import (
+	"dotnetcore/config"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// serialBuildMemoryMB is the staging memory below which MSBuild builds one
+// project at a time, as parallel nodes get the build OOM-killed
+const serialBuildMemoryMB = 1024
+
+// concurrencyArgs limits the MSBuild nodes of restore and publish. The
+// node count comes from MSBUILD_MAX_CPU_COUNT or buildpack.yml, defaulting
+// to 1 in small staging containers. Nodes are not kept around after the
+// build unless MSBUILD_NODE_REUSE or buildpack.yml asks for it.
+func (f *Finalizer) concurrencyArgs() ([]string, error) {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return nil, err
+	}
+
+	maxCPUCount := buildpackYML.DotnetCore.MSBuildMaxCPUCount
+	if env := os.Getenv("MSBUILD_MAX_CPU_COUNT"); env != "" {
+		if maxCPUCount, err = strconv.Atoi(env); err != nil {
+			return nil, fmt.Errorf("MSBUILD_MAX_CPU_COUNT must be a number, not %s", env)
+		}
+	}
+	if maxCPUCount < 0 {
+		return nil, fmt.Errorf("the MSBuild max CPU count must not be negative, not %d", maxCPUCount)
+	}
+	if memory := memoryLimitMB(); maxCPUCount == 0 && memory > 0 && memory < serialBuildMemoryMB {
+		f.Log.Info("Building one project at a time with %dMB of memory", memory)
+		maxCPUCount = 1
+	}
+
+	nodeReuse := buildpackYML.DotnetCore.MSBuildNodeReuse != nil && *buildpackYML.DotnetCore.MSBuildNodeReuse
+	if env := os.Getenv("MSBUILD_NODE_REUSE"); env != "" {
+		nodeReuse = env == "true"
+	}
+
+	args := []string{fmt.Sprintf("-nodeReuse:%t", nodeReuse)}
+	if maxCPUCount > 0 {
+		args = append(args, fmt.Sprintf("-maxcpucount:%d", maxCPUCount))
+	}
+	return args, nil
+}
+
+// memoryLimitMB parses the container's MEMORY_LIMIT, e.g. 1024m or 2G,
+// returning 0 when it is unset or unreadable
+func memoryLimitMB() int {
+	limit := strings.ToLower(os.Getenv("MEMORY_LIMIT"))
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(limit, "g"):
+		multiplier = 1024
+	case strings.HasSuffix(limit, "m"):
+	default:
+		return 0
+	}
+	value, err := strconv.Atoi(limit[:len(limit)-1])
+	if err != nil {
+		return 0
+	}
+	return value * multiplier
+}
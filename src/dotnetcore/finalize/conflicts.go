@@ -0,0 +1,73 @@
+package finalize
+
+import (
+	"dotnetcore/jsonc"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CheckAssemblyConflicts warns about assemblies that more than one library
+// in the published deps.json provides with different versions. Only one
+// copy is published, so code built against the other may fail at runtime
+// with MissingMethodException or TypeLoadException.
+func (f *Finalizer) CheckAssemblyConflicts() error {
+	dir, err := f.publishOutputDir()
+	if err != nil {
+		return err
+	}
+	depsFiles, err := filepath.Glob(filepath.Join(dir, "*.deps.json"))
+	if err != nil || len(depsFiles) != 1 {
+		return err
+	}
+
+	deps := struct {
+		RuntimeTarget struct {
+			Name string `json:"name"`
+		} `json:"runtimeTarget"`
+		Targets map[string]map[string]struct {
+			Runtime map[string]struct {
+				AssemblyVersion string `json:"assemblyVersion"`
+			} `json:"runtime"`
+		} `json:"targets"`
+	}{}
+	if err := jsonc.Load(depsFiles[0], &deps); err != nil {
+		return err
+	}
+
+	type provider struct{ library, version string }
+	providers := map[string][]provider{}
+	// The runtime target is the one the host resolves assets from
+	for library, target := range deps.Targets[deps.RuntimeTarget.Name] {
+		for asset, info := range target.Runtime {
+			assembly := path.Base(asset)
+			providers[assembly] = append(providers[assembly], provider{library, info.AssemblyVersion})
+		}
+	}
+
+	var assemblies []string
+	for assembly := range providers {
+		assemblies = append(assemblies, assembly)
+	}
+	sort.Strings(assemblies)
+	for _, assembly := range assemblies {
+		list := providers[assembly]
+		versions := map[string]bool{}
+		var names []string
+		for _, p := range list {
+			versions[p.version] = true
+			name := p.library
+			if p.version != "" {
+				name += " (" + p.version + ")"
+			}
+			names = append(names, name)
+		}
+		if len(list) < 2 || len(versions) < 2 {
+			continue
+		}
+		sort.Strings(names)
+		f.Log.Warning("%s is provided with different versions by %s; only one is published, which can cause MissingMethodException at runtime", assembly, strings.Join(names, ", "))
+	}
+	return nil
+}
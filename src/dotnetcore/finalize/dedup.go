@@ -0,0 +1,118 @@
+package finalize
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DeduplicateDotnet replaces identical files in the dotnet install, such
+// as assemblies shared between the SDK and the separately installed
+// frameworks, with hardlinks to a single copy
+func (f *Finalizer) DeduplicateDotnet() error {
+	dir := filepath.Join(f.Stager.DepDir(), "dotnet")
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	files, saved, err := deduplicate(dir)
+	if err != nil {
+		return err
+	}
+	if files > 0 {
+		f.Log.Info("Linked %d duplicate files in dotnet, saving %dMB", files, saved>>20)
+	}
+	return nil
+}
+
+// deduplicate hardlinks regular files below dir that have the same size,
+// mode and contents, returning the number of files linked and bytes saved
+func deduplicate(dir string) (int, int64, error) {
+	type key struct {
+		size int64
+		mode os.FileMode
+	}
+	candidates := map[key][]string{}
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && info.Size() > 0 {
+			k := key{info.Size(), info.Mode()}
+			candidates[k] = append(candidates[k], path)
+		}
+		return nil
+	}); err != nil {
+		return 0, 0, err
+	}
+
+	linked := 0
+	var saved int64
+	for k, paths := range candidates {
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Strings(paths)
+		originals := map[string]string{}
+		for _, path := range paths {
+			hash, err := sha256File(path)
+			if err != nil {
+				return 0, 0, err
+			}
+			original, found := originals[hash]
+			if !found {
+				originals[hash] = path
+				continue
+			}
+			if same, err := sameFile(original, path); err != nil {
+				return 0, 0, err
+			} else if same {
+				continue
+			}
+			if err := replaceWithLink(original, path); err != nil {
+				return 0, 0, err
+			}
+			linked++
+			saved += k.size
+		}
+	}
+	return linked, saved, nil
+}
+
+func sha256File(path string) (string, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, fh); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func sameFile(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(infoA, infoB), nil
+}
+
+// replaceWithLink swaps path for a hardlink to original without a window
+// in which path is missing
+func replaceWithLink(original, path string) error {
+	tmp := path + ".dedup"
+	if err := os.Link(original, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,170 @@
+package finalize
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+const outputTailLines = 50
+
+// outputTail keeps the last lines written to it, so that the end of the
+// MSBuild output can be repeated in the diagnostics after a failure. Lines
+// matching a known failure signature are kept regardless of position.
+type outputTail struct {
+	lines   []string
+	partial []byte
+	flagged []string
+}
+
+func (t *outputTail) Write(p []byte) (int, error) {
+	data := append(t.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(data[:i])
+		t.lines = append(t.lines, line)
+		if len(matchRemediations([]string{line})) > 0 && len(t.flagged) < outputTailLines {
+			t.flagged = append(t.flagged, line)
+		}
+		data = data[i+1:]
+	}
+	t.partial = append([]byte{}, data...)
+	if len(t.lines) > outputTailLines {
+		t.lines = t.lines[len(t.lines)-outputTailLines:]
+	}
+	return len(p), nil
+}
+
+func (t *outputTail) Lines() []string {
+	if len(t.partial) > 0 {
+		return append(t.lines, string(t.partial))
+	}
+	return t.lines
+}
+
+// groupRunner is implemented by commandlog.Command, which kills the whole
+// process group of a step command once the step times out
+type groupRunner interface {
+	RunGroup(context.Context, *exec.Cmd) error
+}
+
+// runWithDiagnostics runs a restore, test or publish command bound to ctx,
+// printing a diagnostics section when it fails.
+func (f *Finalizer) runWithDiagnostics(ctx context.Context, cmd *exec.Cmd) error {
+	tail := &outputTail{}
+	cmd.Stdout = io.MultiWriter(indentWriter(os.Stdout), tail)
+	cmd.Stderr = io.MultiWriter(indentWriter(os.Stderr), tail)
+	var err error
+	if runner, ok := f.Command.(groupRunner); ok {
+		err = runner.RunGroup(ctx, cmd)
+	} else {
+		err = f.Command.Run(cmd)
+	}
+	if err != nil {
+		f.printDiagnostics(cmd, tail)
+	}
+	return err
+}
+
+func (f *Finalizer) printDiagnostics(failed *exec.Cmd, tail *outputTail) {
+	f.Log.BeginStep("Diagnostics")
+	f.Log.Info("Failed command: %s", strings.Join(failed.Args, " "))
+
+	sdkVersion := f.Config.DotnetSdkVersion
+	if sdkVersion == "" {
+		sdkVersion = "unknown"
+	}
+	f.Log.Info("Dotnet SDK version: %s", sdkVersion)
+	f.Log.Info("Dotnet runtime versions: %s", strings.Join(f.installedFrameworks("Microsoft.NETCore.App"), ", "))
+	f.Log.Info("ASP.NET Core versions: %s", strings.Join(f.installedFrameworks("Microsoft.AspNetCore.App"), ", "))
+
+	info := &bytes.Buffer{}
+	cmd := exec.Command("dotnet", "--info")
+	cmd.Dir = f.Stager.BuildDir()
+	cmd.Env = f.shellEnvironment()
+	cmd.Stdout = info
+	cmd.Stderr = info
+	if err := f.Command.Run(cmd); err != nil {
+		f.Log.Info("dotnet --info: %s", err.Error())
+	} else {
+		f.Log.Info("dotnet --info:")
+		f.printLines(strings.Split(strings.TrimRight(info.String(), "\n"), "\n"))
+	}
+
+	for _, dir := range []string{f.Stager.BuildDir(), f.Stager.DepDir()} {
+		f.Log.Info("Disk usage of %s: %s", dir, diskUsage(dir))
+	}
+	f.Log.Info("Memory: %s", memoryUsage())
+
+	if lines := tail.Lines(); len(lines) > 0 {
+		f.Log.Info("Last %d lines of output:", len(lines))
+		f.printLines(lines)
+	}
+
+	for _, r := range matchRemediations(append(tail.flagged, tail.Lines()...)) {
+		f.Log.Protip(r.tip, r.url)
+	}
+}
+
+func (f *Finalizer) printLines(lines []string) {
+	for _, line := range lines {
+		f.Log.Info("  %s", line)
+	}
+}
+
+func (f *Finalizer) installedFrameworks(name string) []string {
+	files, err := ioutil.ReadDir(filepath.Join(f.Stager.DepDir(), "dotnet", "shared", name))
+	if err != nil || len(files) == 0 {
+		return []string{"none"}
+	}
+	var versions []string
+	for _, file := range files {
+		versions = append(versions, file.Name())
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+func diskUsage(dir string) string {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return err.Error()
+	}
+	total := stat.Blocks * uint64(stat.Bsize)
+	free := stat.Bavail * uint64(stat.Bsize)
+	return fmt.Sprintf("%dMB free of %dMB", free>>20, total>>20)
+}
+
+func memoryUsage() string {
+	fh, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return err.Error()
+	}
+	defer fh.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 {
+			values[strings.TrimSuffix(fields[0], ":")] = strings.Join(fields[1:], " ")
+		}
+	}
+	usage := fmt.Sprintf("%s available of %s", values["MemAvailable"], values["MemTotal"])
+	if limit := os.Getenv("MEMORY_LIMIT"); limit != "" {
+		usage += fmt.Sprintf(" (MEMORY_LIMIT=%s)", limit)
+	}
+	return usage
+}
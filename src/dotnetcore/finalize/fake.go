@@ -0,0 +1,81 @@
+package finalize
+
+import (
+	"dotnetcore/config"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// fakeVersion is the FAKE runner installed for apps that don't have it as
+// a local tool. FAKE 5 runs on .NET Core 2.1, unlike FAKE 6.
+const fakeVersion = "5.20.4"
+
+// fakeBuild runs the app's FAKE script in place of dotnet publish when it
+// opted in, through FAKE_BUILD or buildpack.yml, and moves what the script
+// published into publishPath. It reports whether the script ran.
+func (f *Finalizer) fakeBuild(publishPath string) (bool, error) {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return false, err
+	}
+	fake := buildpackYML.DotnetCore.Fake
+	if !fake.Enabled && os.Getenv("FAKE_BUILD") != "true" {
+		return false, nil
+	}
+	script := fake.Script
+	if script == "" {
+		script = "build.fsx"
+	}
+	if exists, err := libbuildpack.FileExists(filepath.Join(f.Stager.BuildDir(), script)); err != nil {
+		return false, err
+	} else if !exists {
+		return false, fmt.Errorf("FAKE build was requested but %s does not exist", script)
+	}
+
+	f.Log.BeginStep("Building with FAKE script %s", script)
+	fakeCmd, err := f.toolCommand("fake-cli", fakeVersion, "fake")
+	if err != nil {
+		return false, err
+	}
+	args := append(fakeCmd[1:], "run", script)
+	if fake.Target != "" {
+		args = append(args, "--target", fake.Target)
+	}
+
+	ctx, cancel, err := f.stepContext("publish")
+	if err != nil {
+		return false, err
+	}
+	defer cancel()
+	cmd := exec.CommandContext(ctx, fakeCmd[0], args...)
+	cmd.Dir = f.Stager.BuildDir()
+	cmd.Env = append(f.shellEnvironment(), "PUBLISH_DIR="+publishPath, "CONFIGURATION="+f.publicConfig())
+	f.Log.Debug("Running command: %v", cmd)
+	if err := f.runWithDiagnostics(ctx, cmd); err != nil {
+		return false, stepError(ctx, "publish", err)
+	}
+
+	if fake.Output != "" {
+		output := filepath.Join(f.Stager.BuildDir(), fake.Output)
+		if exists, err := libbuildpack.FileExists(output); err != nil {
+			return false, err
+		} else if !exists {
+			return false, fmt.Errorf("the FAKE script did not publish anything to %s", fake.Output)
+		}
+		if err := moveDir(output, publishPath); err != nil {
+			return false, err
+		}
+	}
+
+	if files, err := ioutil.ReadDir(publishPath); err != nil {
+		return false, err
+	} else if len(files) == 0 {
+		return false, fmt.Errorf("the FAKE script published nothing; publish to $PUBLISH_DIR or set fake.output in buildpack.yml")
+	}
+	return true, nil
+}
@@ -2,13 +2,19 @@ package finalize
 
 import (
 	"dotnetcore/config"
+	"dotnetcore/events"
+	"dotnetcore/launchenv"
 	"dotnetcore/project"
+	"dotnetcore/runtimeconfig"
+	"dotnetcore/services"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/cloudfoundry/libbuildpack"
@@ -17,6 +23,7 @@ import (
 
 type Stager interface {
 	BuildDir() string
+	CacheDir() string
 	DepsIdx() string
 	DepDir() string
 	WriteProfileD(string, string) error
@@ -30,63 +37,221 @@ type DotnetFramework interface {
 	Install() error
 }
 
+type Manifest interface {
+	AllDependencyVersions(string) []string
+}
+
 type Finalizer struct {
 	Stager          Stager
 	Log             *libbuildpack.Logger
 	Command         Command
 	DotnetFramework DotnetFramework
+	Manifest        Manifest
 	Config          *config.Config
 	Project         *project.Project
+	StaticServer    string
+	LaunchEnv       string
+	Advisories      string
+	Events          *events.Log
 }
 
 func Run(f *Finalizer) error {
 	f.Log.BeginStep("Finalizing Dotnet Core")
+	defer f.Events.PrintTimings(f.Log)
 
-	if err := f.DotnetRestore(); err != nil {
+	if err := f.Events.Phase("check-project", f.CheckProject); err != nil {
+		f.Log.Error("Unable to find a project to build: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("clean-build-output", f.CleanBuildOutput); err != nil {
+		f.Log.Error("Unable to clean committed build output: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("restore-paket", f.RestorePaket); err != nil {
+		f.Log.Error("Unable to restore Paket dependencies: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("restore", f.DotnetRestore); err != nil {
 		f.Log.Error("Unable to run dotnet restore: %s", err.Error())
 		return err
 	}
 
-	if err := f.DotnetFramework.Install(); err != nil {
+	if err := f.Events.Phase("audit-packages", f.AuditPackages); err != nil {
+		f.Log.Error("NuGet package audit failed: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("license-report", f.WriteLicenseReport); err != nil {
+		f.Log.Error("Unable to write NuGet license report: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("install-frameworks", f.DotnetFramework.Install); err != nil {
 		f.Log.Error("Unable to install required dotnet frameworks: %s", err.Error())
 		return err
 	}
 
-	if err := f.DotnetPublish(); err != nil {
+	if err := f.Events.Phase("check-advisories", f.CheckAdvisories); err != nil {
+		f.Log.Error("Unable to check advisories: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("deduplicate-dotnet", f.DeduplicateDotnet); err != nil {
+		f.Log.Error("Unable to deduplicate dotnet files: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("build-spa", f.BuildSpa); err != nil {
+		f.Log.Error("Unable to build SPA: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("restore-libman", f.RestoreLibman); err != nil {
+		f.Log.Error("Unable to restore LibMan libraries: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("test", f.RunTests); err != nil {
+		f.Log.Error("Unable to run dotnet test: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("pre-publish", func() error { return f.RunHook("pre_publish") }); err != nil {
+		f.Log.Error("Unable to run pre_publish hook: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("publish", f.DotnetPublish); err != nil {
 		f.Log.Error("Unable to run dotnet publish: %s", err.Error())
 		return err
 	}
 
-	if err := f.CleanStagingArea(); err != nil {
+	if err := f.Events.Phase("post-publish", func() error { return f.RunHook("post_publish") }); err != nil {
+		f.Log.Error("Unable to run post_publish hook: %s", err.Error())
+		return err
+	}
+	// The build and the publish hooks may have added or removed files
+	f.Project.Index().Reset()
+
+	if err := f.Events.Phase("prune-publish-output", f.PrunePublishOutput); err != nil {
+		f.Log.Error("Unable to prune publish output: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("apply-publish-ignore", f.ApplyPublishIgnore); err != nil {
+		f.Log.Error("Unable to apply .publishignore: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("check-assembly-conflicts", f.CheckAssemblyConflicts); err != nil {
+		f.Log.Error("Unable to check for assembly conflicts: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("inject-hosting-startup", f.InjectHostingStartup); err != nil {
+		f.Log.Error("Unable to inject hosting startup assemblies: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("precompress-static-assets", f.PrecompressStaticAssets); err != nil {
+		f.Log.Error("Unable to precompress static assets: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("migrations", f.RunMigrations); err != nil {
+		f.Log.Error("Unable to run database migrations: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("install-launch-env", f.InstallLaunchEnv); err != nil {
+		f.Log.Error("Unable to install launch environment helper: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("install-static-server", f.InstallStaticServer); err != nil {
+		f.Log.Error("Unable to install static file server: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("clean-staging-area", f.CleanStagingArea); err != nil {
 		f.Log.Error("Unable to run CleanStagingArea: %s", err.Error())
 		return err
 	}
 
-	if err := f.WriteProfileD(); err != nil {
+	if err := f.Events.Phase("write-profile-d", f.WriteProfileD); err != nil {
 		f.Log.Error("Unable to write profile.d: %s", err.Error())
 		return err
 	}
 
+	if err := f.Events.Phase("normalize-permissions", f.NormalizePermissions); err != nil {
+		f.Log.Error("Unable to normalize file permissions: %s", err.Error())
+		return err
+	}
+
+	if err := f.Events.Phase("smoke-test", f.SmokeTest); err != nil {
+		f.Log.Error("The app failed its smoke test: %s", err.Error())
+		return err
+	}
+
 	data, err := f.GenerateReleaseYaml()
 	if err != nil {
 		f.Log.Error("Error generating release YAML: %s", err)
 		return err
 	}
 	releasePath := filepath.Join(f.Stager.BuildDir(), "tmp", "dotnet-core-buildpack-release-step.yml")
-	return libbuildpack.NewYAML().Write(releasePath, data)
+	if err := libbuildpack.NewYAML().Write(releasePath, data); err != nil {
+		return err
+	}
+
+	// Last, as everything before may still read the project's sources
+	if err := f.Events.Phase("remove-sources", f.RemoveSources); err != nil {
+		f.Log.Error("Unable to remove sources: %s", err.Error())
+		return err
+	}
+	return nil
 }
 
 func (f *Finalizer) CleanStagingArea() error {
 	f.Log.BeginStep("Cleaning staging area")
 
+	minimal, err := f.runtimeMinimal()
+	if err != nil {
+		return err
+	}
+	var sizeBefore int64
+	if minimal {
+		if sizeBefore, err = f.dropletSize(); err != nil {
+			return err
+		}
+	}
+
 	dirsToRemove := []string{"nuget", ".nuget", ".local", ".cache", ".config", ".npm"}
+	if probing, err := f.hasProbingPaths(); err != nil {
+		return err
+	} else if probing {
+		f.Log.Info("Keeping the NuGet package cache for the app's additional probing paths")
+		dirsToRemove = []string{"nuget", ".local", ".cache", ".config", ".npm"}
+	}
 
-	if startCmd, err := f.Project.StartCommand(); err != nil {
+	if retain, err := f.retainSdk(); err != nil {
+		return err
+	} else if retain && minimal {
+		return fmt.Errorf("the SDK can't be retained in a runtime-minimal droplet")
+	} else if retain {
+		size, err := diskSize(filepath.Join(f.Stager.DepDir(), "dotnet"))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		f.Log.Warning("Keeping the .NET SDK in the droplet and on PATH, which adds %dMB to it", size>>20)
+	} else if startCmd, err := f.Project.StartCommand(); err != nil {
 		return err
 	} else if !strings.HasSuffix(startCmd, ".dll") {
 		dirsToRemove = append(dirsToRemove, "dotnet")
 	}
-	if os.Getenv("INSTALL_NODE") != "true" {
+	if os.Getenv("INSTALL_NODE") != "true" || minimal {
 		dirsToRemove = append(dirsToRemove, "node")
 	}
 
@@ -101,8 +266,25 @@ func (f *Finalizer) CleanStagingArea() error {
 			if err := f.removeSymlinksTo(filepath.Join(f.Stager.DepDir(), dir)); err != nil {
 				return err
 			}
+			if dir == "dotnet" {
+				if err := os.RemoveAll(filepath.Join(f.Stager.DepDir(), "profile.d", "dotnet-root.sh")); err != nil {
+					return err
+				}
+			}
 		}
 	}
+
+	if !minimal {
+		return nil
+	}
+	if err := f.minimizeDotnet(); err != nil {
+		return err
+	}
+	sizeAfter, err := f.dropletSize()
+	if err != nil {
+		return err
+	}
+	f.Log.Info("Minimized the droplet from %dMB to %dMB", sizeBefore>>20, sizeAfter>>20)
 	return nil
 }
 
@@ -132,26 +314,430 @@ func (f *Finalizer) removeSymlinksTo(dir string) error {
 }
 
 func (f *Finalizer) WriteProfileD() error {
-	scriptContents := "export ASPNETCORE_URLS=http://0.0.0.0:${PORT}\n"
+	scriptContents := ""
+	if worker, err := f.Project.IsWorkerService(); err != nil {
+		return err
+	} else if !worker {
+		scriptContents += "export ASPNETCORE_URLS=${ASPNETCORE_URLS:-http://0.0.0.0:${PORT}}\n"
+		// The router terminates TLS, so redirects and links need the scheme
+		// and host it forwards
+		scriptContents += "export ASPNETCORE_FORWARDEDHEADERS_ENABLED=${ASPNETCORE_FORWARDEDHEADERS_ENABLED:-true}\n"
+	}
+	scriptContents += "export DOTNET_CLI_TELEMETRY_OPTOUT=${DOTNET_CLI_TELEMETRY_OPTOUT:-1}\n"
+
+	runtimeEnv, err := f.runtimeEnvironment()
+	if err != nil {
+		return err
+	}
+	scriptContents += runtimeEnv
+
+	globalizationEnv, err := f.globalizationEnvironment()
+	if err != nil {
+		return err
+	}
+	scriptContents += globalizationEnv
+
+	launchEnv, err := f.launchEnvScript()
+	if err != nil {
+		return err
+	}
+	scriptContents += launchEnv
+
+	kestrelEnv, err := f.kestrelEnvironment()
+	if err != nil {
+		return err
+	}
+	scriptContents += kestrelEnv
+
+	aspnetcoreEnv, err := f.aspnetcoreEnvironment()
+	if err != nil {
+		return err
+	}
+	scriptContents += aspnetcoreEnv
+
+	gcMode, err := f.gcModeScript()
+	if err != nil {
+		return err
+	}
+	scriptContents += memoryLimitScript + gcHeapLimitScript + gcMode + "unset memory_mb\n"
 
 	return f.Stager.WriteProfileD("startup.sh", scriptContents)
 }
 
+var (
+	envVarNameRe    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	spaceMatchRe    = regexp.MustCompile(`^[A-Za-z0-9*?._-]+$`)
+	environmentRe   = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	spaceNameScript = `$(echo "${VCAP_APPLICATION:-}" | sed -n 's/.*"space_name": *"\([^"]*\)".*/\1/p')`
+)
+
+// aspnetcoreEnvironment sets ASPNETCORE_ENVIRONMENT at launch, unless the
+// app already set it, from the configured env var or else from the first
+// matching space name pattern
+func (f *Finalizer) aspnetcoreEnvironment() (string, error) {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return "", err
+	}
+	cfg := buildpackYML.DotnetCore.AspnetcoreEnvironment
+	if cfg.Variable == "" && len(cfg.Spaces) == 0 {
+		return "", nil
+	}
+
+	script := "if [ -z \"${ASPNETCORE_ENVIRONMENT:-}\" ]; then\n"
+	if cfg.Variable != "" {
+		if !envVarNameRe.MatchString(cfg.Variable) {
+			return "", fmt.Errorf("invalid aspnetcore-environment variable name %q", cfg.Variable)
+		}
+		script += fmt.Sprintf("  export ASPNETCORE_ENVIRONMENT=\"${%s:-}\"\n", cfg.Variable)
+	}
+	if len(cfg.Spaces) > 0 {
+		script += "  if [ -z \"${ASPNETCORE_ENVIRONMENT:-}\" ]; then\n"
+		script += fmt.Sprintf("    case \"%s\" in\n", spaceNameScript)
+		for _, space := range cfg.Spaces {
+			if !spaceMatchRe.MatchString(space.Match) || !environmentRe.MatchString(space.Environment) {
+				return "", fmt.Errorf("invalid aspnetcore-environment space mapping %q: %q", space.Match, space.Environment)
+			}
+			script += fmt.Sprintf("      %s) export ASPNETCORE_ENVIRONMENT=%s ;;\n", space.Match, space.Environment)
+		}
+		script += "    esac\n  fi\n"
+	}
+	script += "  if [ -z \"${ASPNETCORE_ENVIRONMENT:-}\" ]; then unset ASPNETCORE_ENVIRONMENT; fi\nfi\n"
+	return script, nil
+}
+
+// memoryLimitScript converts the container's MEMORY_LIMIT into megabytes
+// for the GC settings below, which must follow it in the profile script
+const memoryLimitScript = `case "${MEMORY_LIMIT:-}" in
+  *[gG]) memory_mb=$(( ${MEMORY_LIMIT%[gG]} * 1024 )) ;;
+  *[mM]) memory_mb=${MEMORY_LIMIT%[mM]} ;;
+  *) memory_mb=0 ;;
+esac
+`
+
+// gcHeapLimitScript caps the GC heap at GC_HEAP_LIMIT_PERCENT (75 by
+// default) of the container's memory, leaving room for native memory,
+// unless the app configured a heap limit itself. The CLR reads the limit as
+// a hex number of bytes.
+const gcHeapLimitScript = `if [ "$memory_mb" -gt 0 ] && [ -z "${DOTNET_GCHeapHardLimit:-}${DOTNET_GCHeapHardLimitPercent:-}${COMPlus_GCHeapHardLimit:-}${COMPlus_GCHeapHardLimitPercent:-}" ]; then
+  export DOTNET_GCHeapHardLimit=$(printf '%x' $(( memory_mb * 1024 * 1024 * ${GC_HEAP_LIMIT_PERCENT:-75} / 100 )))
+  export COMPlus_GCHeapHardLimit=$DOTNET_GCHeapHardLimit
+fi
+`
+
+// gcServerHeuristic only turns on server GC when the container has at
+// least 2G of memory and more than one CPU, as server GC's per core heaps
+// are wasteful in small containers. Without MEMORY_LIMIT the runtime's
+// default is kept.
+const gcServerHeuristic = `if [ "$memory_mb" -gt 0 ] && [ -z "${DOTNET_gcServer:-}${COMPlus_gcServer:-}" ]; then
+  if [ "$memory_mb" -ge 2048 ] && [ "$(nproc 2>/dev/null || echo 1)" -gt 1 ]; then
+    export DOTNET_gcServer=1
+  else
+    export DOTNET_gcServer=0
+  fi
+fi
+`
+
+func (f *Finalizer) gcModeScript() (string, error) {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return "", err
+	}
+	gc := buildpackYML.DotnetCore.GC
+
+	script := ""
+	for _, setting := range []struct {
+		name  string
+		env   string
+		value *bool
+	}{
+		{"gcServer", "GC_SERVER", gc.Server},
+		{"gcConcurrent", "GC_CONCURRENT", gc.Concurrent},
+	} {
+		value := setting.value
+		if env := os.Getenv(setting.env); env != "" {
+			parsed, err := strconv.ParseBool(env)
+			if err != nil {
+				return "", fmt.Errorf("%s must be true or false, not %s", setting.env, env)
+			}
+			value = &parsed
+		}
+
+		if value != nil {
+			enabled := "0"
+			if *value {
+				enabled = "1"
+			}
+			script += fmt.Sprintf("export DOTNET_%[1]s=${DOTNET_%[1]s:-%[2]s}\n", setting.name, enabled)
+		} else if setting.name == "gcServer" {
+			// The env var would override the app's own runtimeconfig setting
+			if configured, err := f.appConfiguresGCServer(); err != nil {
+				return "", err
+			} else if !configured {
+				script += gcServerHeuristic
+			}
+		}
+	}
+	return script, nil
+}
+
+// appConfiguresGCServer reports whether the published app's
+// runtimeconfig.json sets System.GC.Server, as ServerGarbageCollection in
+// the project does
+func (f *Finalizer) appConfiguresGCServer() (bool, error) {
+	dir, err := f.publishOutputDir()
+	if err != nil {
+		return false, err
+	}
+	configFile, err := runtimeconfig.FindIn(dir)
+	if err != nil || configFile == "" {
+		return false, err
+	}
+	config, err := runtimeconfig.Load(configFile)
+	if err != nil {
+		return false, err
+	}
+	_, configured := config.ConfigProperties["System.GC.Server"]
+	return configured, nil
+}
+
+// kestrelEnvironment makes Kestrel's endpoints speak HTTP/2 only, without
+// TLS, when buildpack.yml or KESTREL_HTTP2 asks for it. Protocols the app
+// configures itself still win.
+func (f *Finalizer) kestrelEnvironment() (string, error) {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return "", err
+	}
+	if !buildpackYML.DotnetCore.Kestrel.Http2 && os.Getenv("KESTREL_HTTP2") != "true" {
+		return "", nil
+	}
+	return "export Kestrel__EndpointDefaults__Protocols=${Kestrel__EndpointDefaults__Protocols:-Http2}\n", nil
+}
+
+// globalizationEnvironment runs the app in globalization invariant mode
+// when buildpack.yml or the app itself asks for it. A value the app sets
+// for DOTNET_SYSTEM_GLOBALIZATION_INVARIANT still wins.
+func (f *Finalizer) globalizationEnvironment() (string, error) {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return "", err
+	}
+
+	invariant := buildpackYML.DotnetCore.Globalization.Invariant
+	if invariant == nil {
+		detected, err := f.Project.InvariantGlobalization()
+		if err != nil {
+			return "", err
+		}
+		invariant = &detected
+	}
+	if !*invariant {
+		return "", nil
+	}
+	return "export DOTNET_SYSTEM_GLOBALIZATION_INVARIANT=${DOTNET_SYSTEM_GLOBALIZATION_INVARIANT:-1}\n", nil
+}
+
+// retainSdk reports whether the SDK is kept in the droplet for running
+// dotnet commands over cf ssh, as RETAIN_SDK or retain-sdk in buildpack.yml
+// asks
+func (f *Finalizer) retainSdk() (bool, error) {
+	if os.Getenv("RETAIN_SDK") == "true" {
+		return true, nil
+	}
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return false, err
+	}
+	return buildpackYML.DotnetCore.RetainSdk, nil
+}
+
+// runtimeEnvironment points DOTNET_ROOT, PATH and the runtime package store
+// at the dotnet install kept in the droplet, so custom start commands and
+// tasks can find the runtime
+func (f *Finalizer) runtimeEnvironment() (string, error) {
+	dotnetDir := filepath.Join(f.Stager.DepDir(), "dotnet")
+	if exists, err := libbuildpack.FileExists(dotnetDir); err != nil || !exists {
+		return "", err
+	}
+
+	dotnetRoot := filepath.Join("$DEPS_DIR", f.Stager.DepsIdx(), "dotnet")
+	env := fmt.Sprintf("export DOTNET_ROOT=%s\nexport PATH=$DOTNET_ROOT:$PATH\n", dotnetRoot)
+
+	if exists, err := libbuildpack.FileExists(filepath.Join(dotnetDir, "store")); err != nil {
+		return "", err
+	} else if exists {
+		env += fmt.Sprintf("export DOTNET_SHARED_STORE=%s\n", filepath.Join(dotnetRoot, "store"))
+	}
+	return env, nil
+}
+
+// InstallStaticServer copies the bundled static file server into the
+// droplet for Blazor WebAssembly apps, which don't need a runtime at launch
+func (f *Finalizer) InstallStaticServer() error {
+	if blazor, err := f.Project.IsBlazorWebAssembly(); err != nil || !blazor {
+		return err
+	}
+	f.Log.BeginStep("Installing static file server for Blazor WebAssembly")
+	return libbuildpack.CopyFile(f.StaticServer, filepath.Join(f.Stager.DepDir(), "bin", "staticserver"))
+}
+
+// InstallLaunchEnv installs the helper profile.d uses to derive parts of the
+// launch environment from the app's service bindings
+func (f *Finalizer) InstallLaunchEnv() error {
+	if f.LaunchEnv == "" {
+		return nil
+	}
+	if exists, err := libbuildpack.FileExists(f.LaunchEnv); err != nil {
+		return err
+	} else if !exists {
+		f.Log.Warning("The buildpack has no launchenv helper, so service bindings won't configure Kestrel certificates, data protection or app settings")
+		return nil
+	}
+	return libbuildpack.CopyFile(f.LaunchEnv, filepath.Join(f.Stager.DepDir(), "bin", "launchenv"))
+}
+
+func (f *Finalizer) launchEnvScript() (string, error) {
+	if exists, err := libbuildpack.FileExists(filepath.Join(f.Stager.DepDir(), "bin", "launchenv")); err != nil || !exists {
+		return "", err
+	}
+	depDir := filepath.Join("$DEPS_DIR", f.Stager.DepsIdx())
+	launchEnv := filepath.Join(depDir, "bin", "launchenv")
+	script := fmt.Sprintf("eval \"$(%s kestrel-certificate %s)\"\n", launchEnv, filepath.Join(depDir, "kestrel"))
+	script += fmt.Sprintf("eval \"$(%s data-protection $HOME)\"\n", launchEnv)
+	script += fmt.Sprintf("eval \"$(%s service-configuration %s)\"\n", launchEnv, launchAppDir())
+
+	if probing, err := f.hasProbingPaths(); err != nil {
+		return "", err
+	} else if probing {
+		_, appDir, err := f.Project.PublishDir()
+		if err != nil {
+			return "", err
+		}
+		script += fmt.Sprintf("eval \"$(%s probing-paths %s %s)\"\n", launchEnv, appDir, filepath.Join(depDir, ".nuget", "packages"))
+	}
+	return script, nil
+}
+
 func (f *Finalizer) GenerateReleaseYaml() (map[string]map[string]string, error) {
+	if blazor, err := f.Project.IsBlazorWebAssembly(); err != nil {
+		return nil, err
+	} else if blazor {
+		_, publishDir, err := f.Project.PublishDir()
+		if err != nil {
+			return nil, err
+		}
+		depDir := filepath.Join("${DEPS_DIR}", f.Stager.DepsIdx())
+		return map[string]map[string]string{
+			"default_process_types": {"web": fmt.Sprintf("cd %s && %s", filepath.Join(publishDir, "wwwroot"), filepath.Join(depDir, "bin", "staticserver"))},
+		}, nil
+	}
+
 	startCmd, err := f.Project.StartCommand()
 	if err != nil {
 		return nil, err
+	} else if startCmd == "" {
+		mainPath, err := f.Project.MainPath()
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no executable or dll was published for %s; check that the project's OutputType is Exe", mainPath)
+	}
+	if err := f.verifyStartCommand(startCmd); err != nil {
+		return nil, err
 	}
 	directory := filepath.Dir(startCmd)
 	startCmd = "./" + filepath.Base(startCmd)
 	if strings.HasSuffix(startCmd, ".dll") {
 		startCmd = "dotnet " + startCmd
 	}
+	// The app listens on $PORT through the ASPNETCORE_URLS default in
+	// profile.d, which apps can override
+	processTypes := map[string]string{"web": fmt.Sprintf("cd %s && %s", directory, startCmd)}
+	if worker, err := f.Project.IsWorkerService(); err != nil {
+		return nil, err
+	} else if worker {
+		f.Log.Info("Worker Service detected; push it with --no-route and --health-check-type process")
+		processTypes["worker"] = processTypes["web"]
+	}
+	if err := f.addTaskProcessTypes(processTypes, directory); err != nil {
+		return nil, err
+	}
 	return map[string]map[string]string{
-		"default_process_types": {"web": fmt.Sprintf("cd %s && %s --server.urls http://0.0.0.0:${PORT}", directory, startCmd)},
+		"default_process_types": processTypes,
 	}, nil
 }
 
+// verifyStartCommand checks that the start command's target exists and can
+// be run: an executable apphost, or a dll with its runtimeconfig.json and a
+// dotnet install kept in the droplet
+func (f *Finalizer) verifyStartCommand(startCmd string) error {
+	path := f.stagedPath(startCmd)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("the start command runs %s, which does not exist", startCmd)
+	} else if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(path, ".dll") {
+		if info.Mode()&0111 == 0 {
+			return fmt.Errorf("the start command runs %s, which is not executable", startCmd)
+		}
+		return nil
+	}
+
+	runtimeConfig := strings.TrimSuffix(path, ".dll") + ".runtimeconfig.json"
+	if exists, err := libbuildpack.FileExists(runtimeConfig); err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("dotnet cannot run %s without %s", filepath.Base(path), filepath.Base(runtimeConfig))
+	}
+	if exists, err := libbuildpack.FileExists(filepath.Join(f.Stager.DepDir(), "dotnet", "dotnet")); err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("the start command runs %s with dotnet, but dotnet was not installed", filepath.Base(path))
+	}
+	return nil
+}
+
+// stagedPath resolves a path in the start command to where it is during
+// staging
+func (f *Finalizer) stagedPath(path string) string {
+	return strings.NewReplacer("${DEPS_DIR}", filepath.Dir(f.Stager.DepDir()), filepath.Join("${HOME}", config.BuildSubdir()), f.Stager.BuildDir()).Replace(path)
+}
+
+// launchAppDir is where the app's root is at launch, below $HOME when it
+// was staged from a BUILD_SUBDIR
+func launchAppDir() string {
+	return filepath.Join("$HOME", config.BuildSubdir())
+}
+
+// addTaskProcessTypes adds the one-off tasks from buildpack.yml as process
+// types run from the published app, so cf run-task --process <name> gets
+// the same directory and profile.d environment as the web process
+func (f *Finalizer) addTaskProcessTypes(processTypes map[string]string, directory string) error {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	tasks := map[string]string{}
+	if command := buildpackYML.DotnetCore.Migrations.TaskCommand; command != "" {
+		tasks["migrate"] = command
+	}
+	for name, command := range buildpackYML.DotnetCore.Tasks {
+		tasks[name] = command
+	}
+	for name, command := range tasks {
+		if name == "web" {
+			return fmt.Errorf("the task name web is reserved for the start command")
+		} else if strings.TrimSpace(command) == "" {
+			return fmt.Errorf("task %s has no command", name)
+		}
+		processTypes[name] = fmt.Sprintf("cd %s && %s", directory, command)
+	}
+	return nil
+}
+
 func (f *Finalizer) DotnetRestore() error {
 	if published, err := f.Project.IsPublished(); err != nil {
 		return err
@@ -164,14 +750,26 @@ func (f *Finalizer) DotnetRestore() error {
 	if err != nil {
 		return err
 	}
+	verbosity, err := f.verbosityArgs()
+	if err != nil {
+		return err
+	}
+	concurrency, err := f.concurrencyArgs()
+	if err != nil {
+		return err
+	}
+	ctx, cancel, err := f.stepContext("restore")
+	if err != nil {
+		return err
+	}
+	defer cancel()
 	for _, path := range paths {
-		cmd := exec.Command("dotnet", "restore", path)
+		args := append(append([]string{"restore", path}, concurrency...), verbosity...)
+		cmd := exec.CommandContext(ctx, "dotnet", args...)
 		cmd.Dir = f.Stager.BuildDir()
 		cmd.Env = env
-		cmd.Stdout = indentWriter(os.Stdout)
-		cmd.Stderr = indentWriter(os.Stderr)
-		if err := f.Command.Run(cmd); err != nil {
-			return err
+		if err := f.runWithDiagnostics(ctx, cmd); err != nil {
+			return stepError(ctx, "restore", err)
 		}
 	}
 	return nil
@@ -193,34 +791,352 @@ func (f *Finalizer) DotnetPublish() error {
 	env := f.shellEnvironment()
 	env = append(env, "PATH="+filepath.Join(filepath.Dir(mainProject), "node_modules", ".bin")+":"+os.Getenv("PATH"))
 
-	publishPath := filepath.Join(f.Stager.DepDir(), "dotnet_publish")
+	publishPath, _, err := f.Project.PublishDir()
+	if err != nil {
+		return err
+	}
 	if err := os.MkdirAll(publishPath, 0755); err != nil {
 		return err
 	}
-	args := []string{"publish", mainProject, "-o", publishPath, "-c", f.publicConfig()}
-	if strings.HasPrefix(f.Config.DotnetSdkVersion, "2.") {
-		args = append(args, "-r", "ubuntu.14.04-x64")
+	if faked, err := f.fakeBuild(publishPath); err != nil || faked {
+		return err
+	}
+	concurrency, err := f.concurrencyArgs()
+	if err != nil {
+		return err
+	}
+	args := append([]string{"publish", mainProject, "-o", publishPath, "-c", f.publicConfig()}, concurrency...)
+	frameworkArgs, err := f.targetFrameworkArgs(mainProject)
+	if err != nil {
+		return err
+	}
+	args = append(args, frameworkArgs...)
+	if rid := f.runtimeIdentifier(); rid != "" {
+		args = append(args, "-r", rid)
+	}
+	verbosity, err := f.verbosityArgs()
+	if err != nil {
+		return err
+	}
+	args = append(args, verbosity...)
+	properties, err := f.msbuildPropertyArgs()
+	if err != nil {
+		return err
+	}
+	args = append(args, properties...)
+	profile, err := f.publishProfileArgs(mainProject)
+	if err != nil {
+		return err
+	}
+	args = append(args, profile...)
+	flags, err := config.SplitArgs(os.Getenv("PUBLISH_FLAGS"))
+	if err != nil {
+		return fmt.Errorf("PUBLISH_FLAGS: %s", err)
 	}
-	cmd := exec.Command("dotnet", args...)
+	args = append(args, flags...)
+	ctx, cancel, err := f.stepContext("publish")
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "dotnet", args...)
 	cmd.Dir = f.Stager.BuildDir()
 	cmd.Env = env
+
+	f.Log.Debug("Running command: %v", cmd)
+	if err := f.runWithDiagnostics(ctx, cmd); err != nil {
+		return stepError(ctx, "publish", err)
+	}
+
+	return nil
+}
+
+// libmanVersion is a LibMan CLI release built for .NET Core 2.1, which is
+// installed when the app doesn't have libman as a local tool
+const libmanVersion = "1.0.163"
+
+// RestoreLibman restores client side libraries listed in the main
+// project's libman.json, using the libman local tool when the app has one
+func (f *Finalizer) RestoreLibman() error {
+	if published, err := f.Project.IsPublished(); err != nil || published {
+		return err
+	}
+	mainProject, err := f.Project.MainPath()
+	if err != nil || mainProject == "" {
+		return err
+	}
+	projectDir := filepath.Dir(mainProject)
+	if exists, err := libbuildpack.FileExists(filepath.Join(projectDir, "libman.json")); err != nil || !exists {
+		return err
+	}
+
+	f.Log.BeginStep("Restoring client side libraries with LibMan")
+	toolPath := filepath.Join(f.Stager.DepDir(), "dotnet-tools")
+	libman := filepath.Join(toolPath, "libman")
+	if exists, err := libbuildpack.FileExists(libman); err != nil {
+		return err
+	} else if !exists {
+		cmd := exec.Command("dotnet", "tool", "install", "Microsoft.Web.LibraryManager.Cli", "--version", libmanVersion, "--tool-path", toolPath)
+		cmd.Dir = f.Stager.BuildDir()
+		cmd.Env = f.shellEnvironment()
+		cmd.Stdout = indentWriter(os.Stdout)
+		cmd.Stderr = indentWriter(os.Stderr)
+		if err := f.Command.Run(cmd); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.Command(libman, "restore")
+	cmd.Dir = projectDir
+	cmd.Env = f.shellEnvironment()
 	cmd.Stdout = indentWriter(os.Stdout)
 	cmd.Stderr = indentWriter(os.Stderr)
+	return f.Command.Run(cmd)
+}
 
-	f.Log.Debug("Running command: %v", cmd)
-	if err := f.Command.Run(cmd); err != nil {
+// RunHook runs the app's .buildpack/hooks/<name> script, if present, from
+// the build dir with the dotnet SDK on PATH
+func (f *Finalizer) RunHook(name string) error {
+	hook := filepath.Join(f.Stager.BuildDir(), ".buildpack", "hooks", name)
+	info, err := os.Stat(hook)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
 		return err
 	}
 
-	return nil
+	f.Log.BeginStep("Running %s hook", name)
+	cmd := exec.Command(hook)
+	if info.Mode()&0111 == 0 {
+		f.Log.Warning("%s is not executable, running it with bash", hook)
+		cmd = exec.Command("bash", hook)
+	}
+	cmd.Dir = f.Stager.BuildDir()
+	publishDir, _, err := f.Project.PublishDir()
+	if err != nil {
+		return err
+	}
+	cmd.Env = append(f.shellEnvironment(), "PUBLISH_DIR="+publishDir)
+	cmd.Stdout = indentWriter(os.Stdout)
+	cmd.Stderr = indentWriter(os.Stderr)
+	return f.Command.Run(cmd)
 }
 
-func (f *Finalizer) publicConfig() string {
-	if os.Getenv("PUBLISH_RELEASE_CONFIG") == "true" {
-		return "Release"
+// RunMigrations runs the configured database migration command against the
+// project, with a connection string taken from a bound service
+func (f *Finalizer) RunMigrations() error {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	migrations := buildpackYML.DotnetCore.Migrations
+	if !migrations.Enabled && os.Getenv("RUN_MIGRATIONS") != "true" {
+		return nil
+	}
+	if published, err := f.Project.IsPublished(); err != nil || published {
+		return err
+	}
+
+	f.Log.BeginStep("Running database migrations")
+	command := migrations.Command
+	if command == "" {
+		command = "dotnet ef database update"
+	}
+	mainProject, err := f.Project.MainPath()
+	if err != nil {
+		return err
+	}
+
+	env := f.shellEnvironment()
+	if connectionString, err := f.migrationConnectionString(migrations.Service); err != nil {
+		return err
+	} else if connectionString != "" {
+		name := migrations.ConnectionString
+		if name == "" {
+			name = "DefaultConnection"
+		}
+		env = append(env, "ConnectionStrings__"+name+"="+connectionString)
+	}
+
+	cmd := exec.Command("bash", "-c", command)
+	cmd.Dir = filepath.Dir(mainProject)
+	cmd.Env = env
+	cmd.Stdout = indentWriter(os.Stdout)
+	cmd.Stderr = indentWriter(os.Stderr)
+	return f.Command.Run(cmd)
+}
+
+func (f *Finalizer) migrationConnectionString(serviceName string) (string, error) {
+	all, err := services.Load()
+	if err != nil {
+		return "", err
+	}
+	for _, service := range all {
+		if serviceName != "" && service.Name != serviceName {
+			continue
+		}
+		if connectionString := service.Credential("connectionString", "connection_string", "uri"); connectionString != "" {
+			return connectionString, nil
+		}
+	}
+	if serviceName != "" {
+		return "", fmt.Errorf("no bound service named %s with a connection string", serviceName)
+	}
+	return "", nil
+}
+
+// hasProbingPaths reports whether the app to run probes for assemblies
+// outside its own directory, through runtimeconfig.dev.json or
+// additionalProbingPaths
+func (f *Finalizer) hasProbingPaths() (bool, error) {
+	dir, err := f.publishOutputDir()
+	if err != nil {
+		return false, err
+	}
+	return launchenv.HasProbingPaths(dir)
+}
+
+// runtimeIdentifier picks the RID passed to dotnet publish. An explicit
+// PUBLISH_RUNTIME_IDENTIFIER (e.g. linux-x64, linux-musl-x64, linux-arm64)
+// wins, otherwise 2.x SDKs get the distro specific RID of the stack, or the
+// portable linux-x64 on stacks without one
+func (f *Finalizer) runtimeIdentifier() string {
+	if rid := os.Getenv("PUBLISH_RUNTIME_IDENTIFIER"); rid != "" {
+		return rid
+	}
+
+	if !strings.HasPrefix(f.Config.DotnetSdkVersion, "2.") {
+		return ""
+	}
+
+	switch os.Getenv("CF_STACK") {
+	case "cflinuxfs2":
+		return "ubuntu.14.04-x64"
+	case "cflinuxfs3":
+		return "ubuntu.18.04-x64"
+	case "cflinuxfs4":
+		return "ubuntu.22.04-x64"
+	default:
+		return "linux-x64"
+	}
+}
+
+func (f *Finalizer) verbosityArgs() ([]string, error) {
+	verbosity := os.Getenv("MSBUILD_VERBOSITY")
+	if verbosity == "" {
+		return []string{}, nil
+	}
+
+	for _, level := range []string{"q", "quiet", "m", "minimal", "n", "normal", "d", "detailed", "diag", "diagnostic"} {
+		if verbosity == level {
+			return []string{"-v", verbosity}, nil
+		}
+	}
+	return nil, fmt.Errorf("MSBUILD_VERBOSITY must be one of quiet, minimal, normal, detailed or diagnostic, not %s", verbosity)
+}
+
+var msbuildPropertyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*=`)
+
+// msbuildPropertyArgs turns the MSBuild properties from buildpack.yml and
+// the space separated MSBUILD_PROPERTIES env var into /p: arguments.
+// disable-analyzers, or DISABLE_ANALYZERS, skips analyzers and keeps
+// warnings from failing the build; properties set explicitly still win.
+func (f *Finalizer) msbuildPropertyArgs() ([]string, error) {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return nil, err
+	}
+	properties := append(buildpackYML.DotnetCore.MSBuildProperties, strings.Fields(os.Getenv("MSBUILD_PROPERTIES"))...)
+
+	args := []string{}
+	if buildpackYML.DotnetCore.DisableAnalyzers || os.Getenv("DISABLE_ANALYZERS") == "true" {
+		f.Log.Info("Disabling analyzers and warnings as errors")
+		args = append(args, "/p:RunAnalyzers=false", "/p:TreatWarningsAsErrors=false")
+	}
+	args = append(args, f.deterministicArgs(buildpackYML.DotnetCore.Deterministic)...)
+	for _, property := range properties {
+		property = strings.TrimPrefix(strings.TrimPrefix(property, "/p:"), "-p:")
+		if !msbuildPropertyRe.MatchString(property) {
+			return nil, fmt.Errorf("invalid MSBuild property %q, expected Name=Value", property)
+		}
+		f.Log.Info("Using MSBuild property %s", property)
+		args = append(args, "/p:"+property)
+	}
+	return args, nil
+}
+
+// deterministicArgs enables deterministic builds from buildpack.yml or
+// DETERMINISTIC_BUILD. SOURCE_REPOSITORY_URL and SOURCE_REVISION override the
+// configured repository and revision.
+func (f *Finalizer) deterministicArgs(deterministic config.Deterministic) []string {
+	if !deterministic.Enabled && os.Getenv("DETERMINISTIC_BUILD") != "true" {
+		return []string{}
+	}
+	f.Log.Info("Building deterministically with embedded sources")
+	args := []string{
+		"/p:ContinuousIntegrationBuild=true",
+		"/p:Deterministic=true",
+		"/p:DebugType=embedded",
+		"/p:EmbedUntrackedSources=true",
 	}
 
-	return "Debug"
+	repositoryURL := deterministic.RepositoryURL
+	if env := os.Getenv("SOURCE_REPOSITORY_URL"); env != "" {
+		repositoryURL = env
+	}
+	revision := deterministic.Revision
+	if env := os.Getenv("SOURCE_REVISION"); env != "" {
+		revision = env
+	}
+	if repositoryURL != "" {
+		args = append(args, "/p:RepositoryUrl="+repositoryURL)
+	}
+	if revision != "" {
+		args = append(args, "/p:SourceRevisionId="+revision)
+	}
+	if exists, err := libbuildpack.FileExists(filepath.Join(f.Stager.BuildDir(), ".git")); err == nil && !exists && (repositoryURL != "" || revision != "") {
+		// Without .git SourceLink would fail to query the repository
+		args = append(args, "/p:EnableSourceControlManagerQueries=false")
+	}
+	return args
+}
+
+// publishProfileArgs selects one of the project's
+// Properties/PublishProfiles/*.pubxml files by name
+func (f *Finalizer) publishProfileArgs(mainProject string) ([]string, error) {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return nil, err
+	}
+	profile := buildpackYML.DotnetCore.PublishProfile
+	if env := os.Getenv("PUBLISH_PROFILE"); env != "" {
+		profile = env
+	}
+	if profile == "" {
+		return []string{}, nil
+	}
+
+	profile = strings.TrimSuffix(profile, ".pubxml")
+	profilesDir := filepath.Join(filepath.Dir(mainProject), "Properties", "PublishProfiles")
+	if exists, err := libbuildpack.FileExists(filepath.Join(profilesDir, profile+".pubxml")); err != nil {
+		return nil, err
+	} else if !exists {
+		available, err := filepath.Glob(filepath.Join(profilesDir, "*.pubxml"))
+		if err != nil {
+			return nil, err
+		}
+		for i, path := range available {
+			available[i] = strings.TrimSuffix(filepath.Base(path), ".pubxml")
+		}
+		return nil, fmt.Errorf("publish profile %s not found in %s, available profiles: %v", profile, profilesDir, available)
+	}
+
+	f.Log.Info("Using publish profile %s", profile)
+	return []string{"/p:PublishProfile=" + profile}, nil
+}
+
+func (f *Finalizer) publicConfig() string {
+	return project.Configuration()
 }
 
 func (f *Finalizer) shellEnvironment() []string {
@@ -232,6 +1148,9 @@ func (f *Finalizer) shellEnvironment() []string {
 	} {
 		env = append(env, v)
 	}
+	if _, set := os.LookupEnv("DOTNET_CLI_TELEMETRY_OPTOUT"); !set {
+		env = append(env, "DOTNET_CLI_TELEMETRY_OPTOUT=1")
+	}
 	return env
 }
 
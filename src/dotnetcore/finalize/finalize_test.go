@@ -2,12 +2,17 @@ package finalize_test
 
 import (
 	"bytes"
+	"dotnetcore/commandlog"
 	"dotnetcore/config"
 	"dotnetcore/finalize"
 	"dotnetcore/project"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/cloudfoundry/libbuildpack"
 	"github.com/cloudfoundry/libbuildpack/ansicleaner"
@@ -22,6 +27,7 @@ var _ = Describe("Finalize", func() {
 	var (
 		err         error
 		buildDir    string
+		cacheDir    string
 		depsDir     string
 		depsIdx     string
 		finalizer   *finalize.Finalizer
@@ -35,6 +41,9 @@ var _ = Describe("Finalize", func() {
 		buildDir, err = ioutil.TempDir("", "dotnet-core-buildpack.build.")
 		Expect(err).To(BeNil())
 
+		cacheDir, err = ioutil.TempDir("", "dotnet-core-buildpack.cache.")
+		Expect(err).To(BeNil())
+
 		depsDir, err = ioutil.TempDir("", "dotnet-core-buildpack.deps.")
 		Expect(err).To(BeNil())
 
@@ -48,7 +57,7 @@ var _ = Describe("Finalize", func() {
 		mockCtrl = gomock.NewController(GinkgoT())
 		mockCommand = NewMockCommand(mockCtrl)
 
-		args := []string{buildDir, "", depsDir, depsIdx}
+		args := []string{buildDir, cacheDir, depsDir, depsIdx}
 		stager := libbuildpack.NewStager(args, logger, &libbuildpack.Manifest{})
 		project := project.New(stager.BuildDir(), filepath.Join(depsDir, depsIdx), depsIdx)
 		cfg := &config.Config{}
@@ -68,6 +77,9 @@ var _ = Describe("Finalize", func() {
 		err = os.RemoveAll(buildDir)
 		Expect(err).To(BeNil())
 
+		err = os.RemoveAll(cacheDir)
+		Expect(err).To(BeNil())
+
 		err = os.RemoveAll(depsDir)
 		Expect(err).To(BeNil())
 	})
@@ -86,6 +98,435 @@ var _ = Describe("Finalize", func() {
 				mockCommand.EXPECT().Run(gomock.Any())
 				Expect(finalizer.DotnetPublish()).To(Succeed())
 			})
+
+			It("opts out of CLI telemetry", func() {
+				mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+					Expect(cmd.Env).To(ContainElement("DOTNET_CLI_TELEMETRY_OPTOUT=1"))
+				})
+				Expect(finalizer.DotnetPublish()).To(Succeed())
+			})
+
+			It("appends PUBLISH_FLAGS to dotnet publish", func() {
+				Expect(os.Setenv("PUBLISH_FLAGS", "--self-contained --no-restore")).To(Succeed())
+				defer os.Unsetenv("PUBLISH_FLAGS")
+				mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+					Expect(cmd.Args[len(cmd.Args)-2:]).To(Equal([]string{"--self-contained", "--no-restore"}))
+				})
+				Expect(finalizer.DotnetPublish()).To(Succeed())
+			})
+
+			It("keeps quoted PUBLISH_FLAGS arguments together", func() {
+				Expect(os.Setenv("PUBLISH_FLAGS", `-p:Product="My App" --no-restore`)).To(Succeed())
+				defer os.Unsetenv("PUBLISH_FLAGS")
+				mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+					Expect(cmd.Args[len(cmd.Args)-2:]).To(Equal([]string{"-p:Product=My App", "--no-restore"}))
+				})
+				Expect(finalizer.DotnetPublish()).To(Succeed())
+			})
+
+			It("fails on malformed PUBLISH_FLAGS", func() {
+				Expect(os.Setenv("PUBLISH_FLAGS", `-p:Product="My App`)).To(Succeed())
+				defer os.Unsetenv("PUBLISH_FLAGS")
+				mockCommand.EXPECT().Run(gomock.Any()).Times(0)
+				Expect(finalizer.DotnetPublish()).To(MatchError(ContainSubstring("PUBLISH_FLAGS: ")))
+			})
+
+			Context("The app builds with a FAKE script", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "build.fsx"), []byte(""), 0644)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  fake:\n    enabled: true\n    target: Publish\n    output: out\n"), 0644)).To(Succeed())
+				})
+
+				It("runs the script instead of dotnet publish and collects its output", func() {
+					fake := filepath.Join(depsDir, depsIdx, "dotnet-tools", "fake")
+					gomock.InOrder(
+						mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+							Expect(cmd.Args).To(Equal([]string{"dotnet", "tool", "install", "fake-cli", "--version", "5.20.4", "--tool-path", filepath.Dir(fake)}))
+						}),
+						mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+							Expect(cmd.Args).To(Equal([]string{fake, "run", "build.fsx", "--target", "Publish"}))
+							Expect(cmd.Env).To(ContainElement("PUBLISH_DIR=" + filepath.Join(depsDir, depsIdx, "dotnet_publish")))
+							Expect(os.MkdirAll(filepath.Join(buildDir, "out"), 0755)).To(Succeed())
+							Expect(ioutil.WriteFile(filepath.Join(buildDir, "out", "app.dll"), []byte(""), 0644)).To(Succeed())
+						}),
+					)
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+					Expect(filepath.Join(depsDir, depsIdx, "dotnet_publish", "app.dll")).To(BeARegularFile())
+					Expect(filepath.Join(buildDir, "out")).ToNot(BeAnExistingFile())
+				})
+
+				It("copies the output when it can't be moved onto what the script published", func() {
+					mockCommand.EXPECT().Run(gomock.Any())
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet_publish", "web.config"), []byte(""), 0644)).To(Succeed())
+						Expect(os.MkdirAll(filepath.Join(buildDir, "out"), 0755)).To(Succeed())
+						Expect(ioutil.WriteFile(filepath.Join(buildDir, "out", "app.dll"), []byte(""), 0644)).To(Succeed())
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+					Expect(filepath.Join(depsDir, depsIdx, "dotnet_publish", "app.dll")).To(BeARegularFile())
+					Expect(filepath.Join(depsDir, depsIdx, "dotnet_publish", "web.config")).To(BeARegularFile())
+					Expect(filepath.Join(buildDir, "out")).ToNot(BeAnExistingFile())
+				})
+
+				It("fails when the script publishes nothing", func() {
+					mockCommand.EXPECT().Run(gomock.Any()).Times(2)
+					Expect(finalizer.DotnetPublish()).To(MatchError(ContainSubstring("did not publish anything to out")))
+				})
+			})
+
+			Context("MSBuild concurrency", func() {
+				AfterEach(func() {
+					Expect(os.Unsetenv("MEMORY_LIMIT")).To(Succeed())
+					Expect(os.Unsetenv("MSBUILD_MAX_CPU_COUNT")).To(Succeed())
+					Expect(os.Unsetenv("MSBUILD_NODE_REUSE")).To(Succeed())
+				})
+
+				It("disables node reuse and leaves the node count to MSBuild", func() {
+					Expect(os.Setenv("MEMORY_LIMIT", "2G")).To(Succeed())
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args).To(ContainElement("-nodeReuse:false"))
+						Expect(strings.Join(cmd.Args, " ")).NotTo(ContainSubstring("-maxcpucount"))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+				})
+
+				It("builds serially with less than 1GB of memory", func() {
+					Expect(os.Setenv("MEMORY_LIMIT", "768m")).To(Succeed())
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args).To(ContainElement("-maxcpucount:1"))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+					Expect(buffer.String()).To(ContainSubstring("Building one project at a time with 768MB of memory"))
+				})
+
+				It("uses the configured settings", func() {
+					Expect(os.Setenv("MEMORY_LIMIT", "768m")).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  msbuild-max-cpu-count: 2\n  msbuild-node-reuse: true\n"), 0644)).To(Succeed())
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args).To(ContainElement("-maxcpucount:2"))
+						Expect(cmd.Args).To(ContainElement("-nodeReuse:true"))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+				})
+
+				It("prefers the env vars", func() {
+					Expect(os.Setenv("MSBUILD_MAX_CPU_COUNT", "4")).To(Succeed())
+					Expect(os.Setenv("MSBUILD_NODE_REUSE", "false")).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  msbuild-node-reuse: true\n"), 0644)).To(Succeed())
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args).To(ContainElement("-maxcpucount:4"))
+						Expect(cmd.Args).To(ContainElement("-nodeReuse:false"))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+				})
+
+				It("rejects a non numeric count", func() {
+					Expect(os.Setenv("MSBUILD_MAX_CPU_COUNT", "all")).To(Succeed())
+					Expect(finalizer.DotnetPublish()).To(MatchError("MSBUILD_MAX_CPU_COUNT must be a number, not all"))
+				})
+			})
+
+			Context("with a 2.x SDK", func() {
+				BeforeEach(func() {
+					finalizer.Config.DotnetSdkVersion = "2.1.301"
+				})
+
+				AfterEach(func() {
+					Expect(os.Unsetenv("CF_STACK")).To(Succeed())
+				})
+
+				It("publishes for the stack specific runtime identifier", func() {
+					Expect(os.Setenv("CF_STACK", "cflinuxfs2")).To(Succeed())
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args).To(ContainElement("ubuntu.14.04-x64"))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+				})
+
+				It("publishes for the runtime identifier of cflinuxfs4", func() {
+					Expect(os.Setenv("CF_STACK", "cflinuxfs4")).To(Succeed())
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args).To(ContainElement("ubuntu.22.04-x64"))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+				})
+
+				It("publishes for the portable runtime identifier on other stacks", func() {
+					Expect(os.Setenv("CF_STACK", "io.buildpacks.stacks.jammy")).To(Succeed())
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args).To(ContainElement("linux-x64"))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+				})
+			})
+
+			Context("MSBUILD_VERBOSITY is set", func() {
+				AfterEach(func() {
+					Expect(os.Unsetenv("MSBUILD_VERBOSITY")).To(Succeed())
+				})
+
+				It("passes the verbosity to dotnet publish", func() {
+					Expect(os.Setenv("MSBUILD_VERBOSITY", "detailed")).To(Succeed())
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args[len(cmd.Args)-2:]).To(Equal([]string{"-v", "detailed"}))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+				})
+
+				It("rejects unknown verbosity levels", func() {
+					Expect(os.Setenv("MSBUILD_VERBOSITY", "loud")).To(Succeed())
+					Expect(finalizer.DotnetPublish()).To(MatchError(ContainSubstring("MSBUILD_VERBOSITY must be one of")))
+				})
+			})
+
+			Context("dotnet publish fails", func() {
+				BeforeEach(func() {
+					finalizer.Config.DotnetSdkVersion = "2.1.301"
+					Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet", "shared", "Microsoft.NETCore.App", "2.1.5"), 0755)).To(Succeed())
+				})
+
+				It("prints diagnostics including the tail of the output", func() {
+					gomock.InOrder(
+						mockCommand.EXPECT().Run(gomock.Any()).DoAndReturn(func(cmd *exec.Cmd) error {
+							fmt.Fprintln(cmd.Stdout, "error CS1002: ; expected")
+							return fmt.Errorf("exit status 1")
+						}),
+						mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+							Expect(cmd.Args).To(Equal([]string{"dotnet", "--info"}))
+							fmt.Fprintln(cmd.Stdout, "Host (useful for support):")
+						}),
+					)
+					Expect(finalizer.DotnetPublish()).To(MatchError("exit status 1"))
+
+					Expect(buffer.String()).To(ContainSubstring("-----> Diagnostics"))
+					Expect(buffer.String()).To(ContainSubstring("Dotnet SDK version: 2.1.301"))
+					Expect(buffer.String()).To(ContainSubstring("Dotnet runtime versions: 2.1.5"))
+					Expect(buffer.String()).To(ContainSubstring("Host (useful for support):"))
+					Expect(buffer.String()).To(ContainSubstring("Disk usage of " + buildDir))
+					Expect(buffer.String()).To(ContainSubstring("Last 1 lines of output:"))
+					Expect(buffer.String()).To(ContainSubstring("error CS1002: ; expected"))
+					Expect(buffer.String()).NotTo(ContainSubstring("PRO TIP"))
+				})
+
+				It("prints remediation tips for known failure signatures", func() {
+					mockCommand.EXPECT().Run(gomock.Any()).DoAndReturn(func(cmd *exec.Cmd) error {
+						fmt.Fprintln(cmd.Stdout, "error NU1101: Unable to find package Foo.Bar. No packages exist with this id")
+						for i := 0; i < 100; i++ {
+							fmt.Fprintln(cmd.Stdout, "noise")
+						}
+						return fmt.Errorf("exit status 1")
+					})
+					mockCommand.EXPECT().Run(gomock.Any())
+					Expect(finalizer.DotnetPublish()).NotTo(Succeed())
+
+					Expect(buffer.String()).To(ContainSubstring("PRO TIP: A package could not be found in any configured source"))
+					Expect(buffer.String()).To(ContainSubstring("nu1101"))
+					Expect(strings.Count(buffer.String(), "PRO TIP")).To(Equal(1))
+				})
+
+				It("only suggests runtimeconfig.json fixes for errors about the file", func() {
+					mockCommand.EXPECT().Run(gomock.Any()).DoAndReturn(func(cmd *exec.Cmd) error {
+						fmt.Fprintln(cmd.Stdout, "  Copying obj/Release/app.runtimeconfig.json to bin/Release/app.runtimeconfig.json")
+						fmt.Fprintln(cmd.Stdout, "error CS1002: ; expected")
+						return fmt.Errorf("exit status 1")
+					})
+					mockCommand.EXPECT().Run(gomock.Any())
+					Expect(finalizer.DotnetPublish()).NotTo(Succeed())
+					Expect(buffer.String()).NotTo(ContainSubstring("PRO TIP"))
+				})
+
+				It("suggests fixes for a missing runtimeconfig.json", func() {
+					mockCommand.EXPECT().Run(gomock.Any()).DoAndReturn(func(cmd *exec.Cmd) error {
+						fmt.Fprintln(cmd.Stdout, "The specified runtimeconfig.json [/tmp/app/app.runtimeconfig.json] does not exist")
+						return fmt.Errorf("exit status 1")
+					})
+					mockCommand.EXPECT().Run(gomock.Any())
+					Expect(finalizer.DotnetPublish()).NotTo(Succeed())
+					Expect(buffer.String()).To(ContainSubstring("PRO TIP: No .runtimeconfig.json was produced or found"))
+				})
+			})
+
+			Context("MSBuild properties are configured", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  msbuild-properties:\n  - Version=1.2.3\n"), 0644)).To(Succeed())
+					Expect(os.Setenv("MSBUILD_PROPERTIES", "/p:DefineConstants=CF")).To(Succeed())
+				})
+
+				AfterEach(func() {
+					Expect(os.Unsetenv("MSBUILD_PROPERTIES")).To(Succeed())
+				})
+
+				It("passes them to dotnet publish", func() {
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args[len(cmd.Args)-2:]).To(Equal([]string{"/p:Version=1.2.3", "/p:DefineConstants=CF"}))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+				})
+
+				It("rejects malformed properties", func() {
+					Expect(os.Setenv("MSBUILD_PROPERTIES", "NotAProperty")).To(Succeed())
+					Expect(finalizer.DotnetPublish()).To(MatchError(ContainSubstring(`invalid MSBuild property "NotAProperty"`)))
+				})
+			})
+
+			Context("analyzers are disabled", func() {
+				AfterEach(func() {
+					Expect(os.Unsetenv("DISABLE_ANALYZERS")).To(Succeed())
+				})
+
+				It("turns off analyzers and warnings as errors before the app's own properties", func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  disable-analyzers: true\n  msbuild-properties:\n  - TreatWarningsAsErrors=true\n"), 0644)).To(Succeed())
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args[len(cmd.Args)-3:]).To(Equal([]string{"/p:RunAnalyzers=false", "/p:TreatWarningsAsErrors=false", "/p:TreatWarningsAsErrors=true"}))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+					Expect(buffer.String()).To(ContainSubstring("Disabling analyzers and warnings as errors"))
+				})
+
+				It("can be turned on with DISABLE_ANALYZERS", func() {
+					Expect(os.Setenv("DISABLE_ANALYZERS", "true")).To(Succeed())
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args).To(ContainElement("/p:RunAnalyzers=false"))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+				})
+			})
+
+			Context("deterministic builds are enabled", func() {
+				AfterEach(func() {
+					Expect(os.Unsetenv("DETERMINISTIC_BUILD")).To(Succeed())
+					Expect(os.Unsetenv("SOURCE_REVISION")).To(Succeed())
+				})
+
+				It("builds as CI with embedded PDBs and sources", func() {
+					Expect(os.Setenv("DETERMINISTIC_BUILD", "true")).To(Succeed())
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args[len(cmd.Args)-4:]).To(Equal([]string{"/p:ContinuousIntegrationBuild=true", "/p:Deterministic=true", "/p:DebugType=embedded", "/p:EmbedUntrackedSources=true"}))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+				})
+
+				It("passes the repository and revision in place of .git", func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  deterministic:\n    enabled: true\n    repository-url: https://example.com/app.git\n    revision: abc123\n"), 0644)).To(Succeed())
+					Expect(os.Setenv("SOURCE_REVISION", "def456")).To(Succeed())
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args[len(cmd.Args)-3:]).To(Equal([]string{"/p:RepositoryUrl=https://example.com/app.git", "/p:SourceRevisionId=def456", "/p:EnableSourceControlManagerQueries=false"}))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+				})
+			})
+
+			Context("A publish profile is configured", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+					Expect(os.MkdirAll(filepath.Join(buildDir, "Properties", "PublishProfiles"), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "Properties", "PublishProfiles", "CloudFoundry.pubxml"), []byte("<Project></Project>"), 0644)).To(Succeed())
+				})
+
+				AfterEach(func() {
+					Expect(os.Unsetenv("PUBLISH_PROFILE")).To(Succeed())
+				})
+
+				It("passes the profile to dotnet publish", func() {
+					Expect(os.Setenv("PUBLISH_PROFILE", "CloudFoundry")).To(Succeed())
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args).To(ContainElement("/p:PublishProfile=CloudFoundry"))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+				})
+
+				It("lists the available profiles when the profile is missing", func() {
+					Expect(os.Setenv("PUBLISH_PROFILE", "Azure")).To(Succeed())
+					Expect(finalizer.DotnetPublish()).To(MatchError(ContainSubstring("available profiles: [CloudFoundry]")))
+				})
+			})
+
+			Context("PUBLISH_RUNTIME_IDENTIFIER is set", func() {
+				BeforeEach(func() {
+					Expect(os.Setenv("PUBLISH_RUNTIME_IDENTIFIER", "linux-musl-x64")).To(Succeed())
+				})
+
+				AfterEach(func() {
+					Expect(os.Unsetenv("PUBLISH_RUNTIME_IDENTIFIER")).To(Succeed())
+				})
+
+				It("publishes for the configured runtime identifier", func() {
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args[len(cmd.Args)-2:]).To(Equal([]string{"-r", "linux-musl-x64"}))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+				})
+			})
+
+			Context("the project has several target frameworks", func() {
+				var mockManifest *MockManifest
+
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk.Web"><PropertyGroup><TargetFrameworks>netstandard2.0;netcoreapp2.0;netcoreapp2.1;netcoreapp3.1</TargetFrameworks></PropertyGroup></Project>`), 0644)).To(Succeed())
+					mockManifest = NewMockManifest(mockCtrl)
+					finalizer.Manifest = mockManifest
+				})
+
+				AfterEach(func() {
+					Expect(os.Unsetenv("TARGET_FRAMEWORK")).To(Succeed())
+				})
+
+				It("publishes for the newest one the manifest has a runtime for", func() {
+					mockManifest.EXPECT().AllDependencyVersions("dotnet-framework").Return([]string{"2.0.6", "2.1.0", "2.1.1"})
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(strings.Join(cmd.Args, " ")).To(HaveSuffix(" -f netcoreapp2.1"))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+				})
+
+				It("publishes for the configured one", func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  target-framework: netcoreapp2.0\n"), 0644)).To(Succeed())
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(strings.Join(cmd.Args, " ")).To(HaveSuffix(" -f netcoreapp2.0"))
+					})
+					Expect(finalizer.DotnetPublish()).To(Succeed())
+				})
+
+				It("rejects a configured framework the project does not target", func() {
+					Expect(os.Setenv("TARGET_FRAMEWORK", "net8.0")).To(Succeed())
+					Expect(finalizer.DotnetPublish()).To(MatchError("target framework net8.0 is not one of the project's target frameworks netstandard2.0, netcoreapp2.0, netcoreapp2.1, netcoreapp3.1"))
+				})
+
+				It("fails when the manifest has no runtime for any of them", func() {
+					mockManifest.EXPECT().AllDependencyVersions("dotnet-framework").Return([]string{"1.0.5", "1.1.2"})
+					Expect(finalizer.DotnetPublish()).To(MatchError(ContainSubstring("can run on the runtimes this buildpack provides: 1.0.x and 1.1.x")))
+				})
+			})
+		})
+	})
+
+	Describe("CleanBuildOutput", func() {
+		BeforeEach(func() {
+			Expect(os.MkdirAll(filepath.Join(buildDir, "src", "obj"), 0755)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(buildDir, "src", "bin", "Release"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "src", "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "src", "obj", "project.assets.json"), []byte("{}"), 0644)).To(Succeed())
+		})
+
+		It("warns about and removes pushed build output", func() {
+			Expect(finalizer.CleanBuildOutput()).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("The app was pushed with build output in src/obj, src/bin/Release"))
+			Expect(filepath.Join(buildDir, "src", "obj")).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(buildDir, "src", "bin")).ToNot(BeAnExistingFile())
+		})
+
+		It("keeps other files in bin", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "src", "bin", "start.sh"), []byte(""), 0755)).To(Succeed())
+			Expect(finalizer.CleanBuildOutput()).To(Succeed())
+			Expect(filepath.Join(buildDir, "src", "bin", "Release")).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(buildDir, "src", "bin", "start.sh")).To(BeARegularFile())
+		})
+
+		It("only warns when cleaning is turned off", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  clean-build-output: false\n"), 0644)).To(Succeed())
+			Expect(finalizer.CleanBuildOutput()).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("The app was pushed with build output"))
+			Expect(filepath.Join(buildDir, "src", "obj", "project.assets.json")).To(BeARegularFile())
 		})
 	})
 
@@ -114,39 +555,1319 @@ var _ = Describe("Finalize", func() {
 				mockCommand.EXPECT().Run(gomock.Any()).Times(3).Return(nil)
 				Expect(finalizer.DotnetRestore()).To(Succeed())
 			})
+
+			Context("a restore timeout is configured", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  timeouts:\n    restore: 20ms\n"), 0644)).To(Succeed())
+				})
+				AfterEach(func() {
+					Expect(os.Unsetenv("RESTORE_TIMEOUT")).To(Succeed())
+				})
+
+				It("stops a hung restore with an explanation", func() {
+					mockCommand.EXPECT().Run(gomock.Any()).DoAndReturn(func(cmd *exec.Cmd) error {
+						time.Sleep(50 * time.Millisecond)
+						return fmt.Errorf("signal: killed")
+					})
+					mockCommand.EXPECT().Run(gomock.Any())
+					err := finalizer.DotnetRestore()
+					Expect(err).To(MatchError(ContainSubstring("dotnet restore did not finish within its timeout")))
+					Expect(err).To(MatchError(ContainSubstring("NuGet.Config")))
+					Expect(buffer.String()).To(ContainSubstring("Timing out dotnet restore after 20ms"))
+					Expect(buffer.String()).To(ContainSubstring("-----> Diagnostics"))
+				})
+
+				It("kills worker processes that keep the output open", func() {
+					binDir := filepath.Join(depsDir, "fakebin")
+					Expect(os.MkdirAll(binDir, 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(binDir, "dotnet"), []byte("#!/bin/sh\nif [ \"$1\" = restore ]; then sleep 30 & sleep 30; fi\n"), 0755)).To(Succeed())
+					path := os.Getenv("PATH")
+					Expect(os.Setenv("PATH", binDir+":"+path)).To(Succeed())
+					defer os.Setenv("PATH", path)
+					finalizer.Command = commandlog.New(logger)
+
+					start := time.Now()
+					Expect(finalizer.DotnetRestore()).To(MatchError(ContainSubstring("dotnet restore did not finish within its timeout")))
+					Expect(time.Since(start)).To(BeNumerically("<", 10*time.Second))
+				})
+
+				It("takes RESTORE_TIMEOUT in minutes over buildpack.yml", func() {
+					Expect(os.Setenv("RESTORE_TIMEOUT", "15")).To(Succeed())
+					mockCommand.EXPECT().Run(gomock.Any()).Times(3).Return(nil)
+					Expect(finalizer.DotnetRestore()).To(Succeed())
+					Expect(buffer.String()).To(ContainSubstring("Timing out dotnet restore after 15m0s"))
+				})
+
+				It("rejects invalid timeouts", func() {
+					Expect(os.Setenv("RESTORE_TIMEOUT", "soon")).To(Succeed())
+					Expect(finalizer.DotnetRestore()).To(MatchError(ContainSubstring(`invalid restore timeout "soon"`)))
+				})
+			})
 		})
 	})
 
-	Describe("CleanStagingArea", func() {
-		Context(`The .nuget directory exists with a symlink to it`, func() {
-			BeforeEach(func() {
-				Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "bin"), 0755)).To(Succeed())
-				Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "lib"), 0755)).To(Succeed())
-				for _, name := range []string{
-					".nuget/fileA.txt",
-					".nuget/fileB.txt",
-					"other/file.txt",
-				} {
-					Expect(os.MkdirAll(filepath.Dir(filepath.Join(depsDir, depsIdx, name)), 0755)).To(Succeed())
-					Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, name), []byte(""), 0644)).To(Succeed())
-					Expect(os.Symlink(filepath.Join(depsDir, depsIdx, name), filepath.Join(depsDir, depsIdx, "bin", filepath.Base(name)))).To(Succeed())
-					Expect(os.Symlink(filepath.Join(depsDir, depsIdx, name), filepath.Join(depsDir, depsIdx, "lib", filepath.Base(name)))).To(Succeed())
+	Describe("DeduplicateDotnet", func() {
+		var dotnetDir string
+
+		BeforeEach(func() {
+			dotnetDir = filepath.Join(depsDir, depsIdx, "dotnet")
+			for name, contents := range map[string]string{
+				"sdk/2.1.500/System.Runtime.dll":                           "runtime",
+				"shared/Microsoft.NETCore.App/2.1.6/System.Runtime.dll":    "runtime",
+				"shared/Microsoft.NETCore.App/2.1.6/System.Private.dll":    "private-2.1.6",
+				"shared/Microsoft.NETCore.App/2.1.5/System.Private.dll":    "private-2.1.5",
+				"shared/Microsoft.AspNetCore.App/2.1.6/System.Runtime.dll": "runtime",
+			} {
+				path := filepath.Join(dotnetDir, name)
+				Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+			}
+		})
+
+		It("hardlinks identical files and leaves different ones alone", func() {
+			Expect(finalizer.DeduplicateDotnet()).To(Succeed())
+
+			original, err := os.Stat(filepath.Join(dotnetDir, "sdk/2.1.500/System.Runtime.dll"))
+			Expect(err).ToNot(HaveOccurred())
+			for _, name := range []string{"shared/Microsoft.NETCore.App/2.1.6/System.Runtime.dll", "shared/Microsoft.AspNetCore.App/2.1.6/System.Runtime.dll"} {
+				info, err := os.Stat(filepath.Join(dotnetDir, name))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(os.SameFile(original, info)).To(BeTrue())
+			}
+
+			a, err := os.Stat(filepath.Join(dotnetDir, "shared/Microsoft.NETCore.App/2.1.6/System.Private.dll"))
+			Expect(err).ToNot(HaveOccurred())
+			b, err := os.Stat(filepath.Join(dotnetDir, "shared/Microsoft.NETCore.App/2.1.5/System.Private.dll"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.SameFile(a, b)).To(BeFalse())
+			Expect(ioutil.ReadFile(filepath.Join(dotnetDir, "shared/Microsoft.NETCore.App/2.1.5/System.Private.dll"))).To(Equal([]byte("private-2.1.5")))
+
+			Expect(buffer.String()).To(ContainSubstring("Linked 2 duplicate files in dotnet"))
+		})
+
+		It("does nothing without a dotnet install", func() {
+			Expect(os.RemoveAll(dotnetDir)).To(Succeed())
+			Expect(finalizer.DeduplicateDotnet()).To(Succeed())
+		})
+	})
+
+	Describe("PrunePublishOutput", func() {
+		var publishDir string
+
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+			publishDir = filepath.Join(depsDir, depsIdx, "dotnet_publish")
+			for _, name := range []string{
+				"app.dll", "app.pdb", "app.xml",
+				"Lib.dll", "Lib.xml",
+				"web.config.xml",
+				"de/Lib.resources.dll", "de-AT/Lib.resources.dll", "fr/Lib.resources.dll",
+				"wwwroot/index.html",
+			} {
+				path := filepath.Join(publishDir, name)
+				Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(path, []byte("contents"), 0644)).To(Succeed())
+			}
+		})
+
+		It("does nothing unless configured", func() {
+			Expect(finalizer.PrunePublishOutput()).To(Succeed())
+			Expect(filepath.Join(publishDir, "app.pdb")).To(BeAnExistingFile())
+			Expect(filepath.Join(publishDir, "fr")).To(BeADirectory())
+		})
+
+		It("removes docs, symbols and satellite assemblies of other languages", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  prune:\n    docs: true\n    symbols: true\n    languages: [de]\n"), 0644)).To(Succeed())
+
+			Expect(finalizer.PrunePublishOutput()).To(Succeed())
+
+			for _, name := range []string{"app.pdb", "app.xml", "Lib.xml", "fr"} {
+				Expect(filepath.Join(publishDir, name)).ToNot(BeAnExistingFile())
+			}
+			for _, name := range []string{"app.dll", "Lib.dll", "web.config.xml", "de/Lib.resources.dll", "de-AT/Lib.resources.dll", "wwwroot/index.html"} {
+				Expect(filepath.Join(publishDir, name)).To(BeAnExistingFile())
+			}
+			Expect(buffer.String()).To(ContainSubstring("Removed 4 files and directories"))
+		})
+
+		It("removes every satellite assembly for the language none", func() {
+			Expect(os.Setenv("PRUNE_LANGUAGES", "none")).To(Succeed())
+			defer os.Unsetenv("PRUNE_LANGUAGES")
+
+			Expect(finalizer.PrunePublishOutput()).To(Succeed())
+
+			for _, name := range []string{"de", "de-AT", "fr"} {
+				Expect(filepath.Join(publishDir, name)).ToNot(BeAnExistingFile())
+			}
+			Expect(filepath.Join(publishDir, "app.pdb")).To(BeAnExistingFile())
+			Expect(buffer.String()).To(ContainSubstring("Removed satellite assemblies of 3 cultures"))
+		})
+
+		It("keeps every satellite assembly for the language all", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  prune:\n    languages: [all]\n"), 0644)).To(Succeed())
+
+			Expect(finalizer.PrunePublishOutput()).To(Succeed())
+
+			Expect(filepath.Join(publishDir, "fr")).To(BeADirectory())
+		})
+
+		It("keeps refs when the app compiles Razor views at runtime", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte("<Project><PropertyGroup><RazorCompileOnPublish>false</RazorCompileOnPublish></PropertyGroup></Project>"), 0644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(publishDir, "refs"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(publishDir, "refs", "System.Runtime.xml"), []byte("contents"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(publishDir, "refs", "System.Runtime.dll"), []byte("contents"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  prune:\n    docs: true\n"), 0644)).To(Succeed())
+
+			Expect(finalizer.PrunePublishOutput()).To(Succeed())
+
+			Expect(filepath.Join(publishDir, "refs", "System.Runtime.xml")).To(BeAnExistingFile())
+			Expect(filepath.Join(publishDir, "Lib.xml")).ToNot(BeAnExistingFile())
+		})
+	})
+
+	Describe("CheckAssemblyConflicts", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet_publish"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet_publish", "app.deps.json"), []byte(`{
+  "runtimeTarget": {"name": ".NETCoreApp,Version=v6.0/linux-x64"},
+  "targets": {
+    ".NETCoreApp,Version=v6.0": {
+      "Old.Logging/1.0.0": {"runtime": {"lib/netstandard2.0/Logging.dll": {"assemblyVersion": "1.0.0.0"}}},
+      "New.Logging/2.0.0": {"runtime": {"lib/netstandard2.0/Logging.dll": {"assemblyVersion": "2.0.0.0"}}}
+    },
+    ".NETCoreApp,Version=v6.0/linux-x64": {
+      "app/1.0.0": {"runtime": {"app.dll": {}}},
+      "Legacy.Json/1.0.0": {"runtime": {"lib/netstandard2.0/Newtonsoft.Json.dll": {"assemblyVersion": "9.0.0.0"}}},
+      "Newtonsoft.Json/13.0.1": {"runtime": {"lib/netstandard2.0/Newtonsoft.Json.dll": {"assemblyVersion": "13.0.0.0"}}},
+      "Serilog/2.10.0": {"runtime": {"lib/netstandard2.1/Serilog.dll": {"assemblyVersion": "2.0.0.0"}}}
+    }
+  }
+}`), 0644)).To(Succeed())
+		})
+
+		It("warns about assemblies published by libraries with different versions", func() {
+			Expect(finalizer.CheckAssemblyConflicts()).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("Newtonsoft.Json.dll is provided with different versions by Legacy.Json/1.0.0 (9.0.0.0), Newtonsoft.Json/13.0.1 (13.0.0.0)"))
+			Expect(buffer.String()).NotTo(ContainSubstring("Serilog"))
+		})
+
+		It("only reads the runtime target", func() {
+			Expect(finalizer.CheckAssemblyConflicts()).To(Succeed())
+			Expect(buffer.String()).NotTo(ContainSubstring("Logging.dll"))
+		})
+	})
+
+	Describe("PrecompressStaticAssets", func() {
+		var wwwroot string
+
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+			wwwroot = filepath.Join(depsDir, depsIdx, "dotnet_publish", "wwwroot")
+			Expect(os.MkdirAll(filepath.Join(wwwroot, "css"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(wwwroot, "css", "site.css"), bytes.Repeat([]byte("body { margin: 0; }\n"), 100), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(wwwroot, "logo.png"), bytes.Repeat([]byte("x"), 2048), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(wwwroot, "robots.txt"), []byte("User-agent: *\n"), 0644)).To(Succeed())
+		})
+
+		It("does nothing unless enabled", func() {
+			Expect(finalizer.PrecompressStaticAssets()).To(Succeed())
+			Expect(filepath.Join(wwwroot, "css", "site.css.gz")).ToNot(BeAnExistingFile())
+		})
+
+		It("gzips compressible files that are large enough", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  precompress:\n    enabled: true\n"), 0644)).To(Succeed())
+
+			Expect(finalizer.PrecompressStaticAssets()).To(Succeed())
+
+			Expect(filepath.Join(wwwroot, "css", "site.css.gz")).To(BeARegularFile())
+			Expect(filepath.Join(wwwroot, "logo.png.gz")).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(wwwroot, "robots.txt.gz")).ToNot(BeAnExistingFile())
+			Expect(buffer.String()).To(ContainSubstring("Compressed 1 files"))
+		})
+	})
+
+	Describe("ApplyPublishIgnore", func() {
+		var publishDir string
+
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+			publishDir = filepath.Join(depsDir, depsIdx, "dotnet_publish")
+			for _, name := range []string{"app.dll", "README.md", "docs/guide.md", "fixtures/data.json", "wwwroot/samples/data.json", "wwwroot/index.html"} {
+				path := filepath.Join(publishDir, name)
+				Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(path, []byte("contents"), 0644)).To(Succeed())
+			}
+		})
+
+		It("does nothing without a .publishignore", func() {
+			Expect(finalizer.ApplyPublishIgnore()).To(Succeed())
+			Expect(filepath.Join(publishDir, "README.md")).To(BeAnExistingFile())
+		})
+
+		It("removes the matching files and logs the space saved", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, ".publishignore"), []byte("# not needed at runtime\n*.md\nfixtures/\nwwwroot/samples\n"), 0644)).To(Succeed())
+
+			Expect(finalizer.ApplyPublishIgnore()).To(Succeed())
+
+			for _, name := range []string{"README.md", "docs/guide.md", "fixtures", "wwwroot/samples"} {
+				Expect(filepath.Join(publishDir, name)).ToNot(BeAnExistingFile())
+			}
+			for _, name := range []string{"app.dll", "docs", "wwwroot/index.html"} {
+				Expect(filepath.Join(publishDir, name)).To(BeAnExistingFile())
+			}
+			Expect(buffer.String()).To(ContainSubstring("Removed wwwroot/samples"))
+			Expect(buffer.String()).To(ContainSubstring("Removed 4 files and directories, saving 0KB"))
+		})
+
+		It("rejects malformed patterns", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, ".publishignore"), []byte("[\n"), 0644)).To(Succeed())
+			Expect(finalizer.ApplyPublishIgnore()).ToNot(Succeed())
+		})
+	})
+
+	Describe("InjectHostingStartup", func() {
+		var publishDir string
+
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+			publishDir = filepath.Join(depsDir, depsIdx, "dotnet_publish")
+			Expect(os.MkdirAll(publishDir, 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(publishDir, "app.runtimeconfig.json"), []byte(`{"runtimeOptions": {"framework": {"name": "Microsoft.AspNetCore.App", "version": "8.0.0"}}}`), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(publishDir, "app.deps.json"), []byte(`{"runtimeTarget": {"name": ".NETCoreApp,Version=v8.0"}}`), 0644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(depsDir, "3", "hosting_startup"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(depsDir, "3", "hosting_startup", "Platform.Tracing.dll"), []byte("assembly"), 0644)).To(Succeed())
+		})
+
+		It("adds the assemblies from other buildpacks to the app", func() {
+			Expect(finalizer.InjectHostingStartup()).To(Succeed())
+
+			Expect(filepath.Join(publishDir, "Platform.Tracing.dll")).To(BeAnExistingFile())
+			deps, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "hosting-startup.deps.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(deps)).To(ContainSubstring(`".NETCoreApp,Version=v8.0": {
+      "Platform.Tracing/1.0.0": {
+        "runtime": {
+          "Platform.Tracing.dll": {}`))
+			script, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "hosting-startup.sh"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(script)).To(ContainSubstring(`export ASPNETCORE_HOSTINGSTARTUPASSEMBLIES="${ASPNETCORE_HOSTINGSTARTUPASSEMBLIES:+$ASPNETCORE_HOSTINGSTARTUPASSEMBLIES;}Platform.Tracing"`))
+			Expect(string(script)).To(ContainSubstring(`export DOTNET_ADDITIONAL_DEPS="${DOTNET_ADDITIONAL_DEPS:+$DOTNET_ADDITIONAL_DEPS;}$DEPS_DIR/9/hosting-startup.deps.json"`))
+		})
+
+		It("leaves apps that opt out alone", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  hosting-startup: false\n"), 0644)).To(Succeed())
+			Expect(finalizer.InjectHostingStartup()).To(Succeed())
+			Expect(filepath.Join(publishDir, "Platform.Tracing.dll")).ToNot(BeAnExistingFile())
+		})
+
+		It("leaves apps that don't run on ASP.NET Core alone", func() {
+			Expect(ioutil.WriteFile(filepath.Join(publishDir, "app.runtimeconfig.json"), []byte(`{"runtimeOptions": {"framework": {"name": "Microsoft.NETCore.App", "version": "8.0.0"}}}`), 0644)).To(Succeed())
+			Expect(finalizer.InjectHostingStartup()).To(Succeed())
+			Expect(filepath.Join(depsDir, depsIdx, "profile.d", "hosting-startup.sh")).ToNot(BeAnExistingFile())
+		})
+	})
+
+	Describe("RemoveSources", func() {
+		BeforeEach(func() {
+			for _, name := range []string{
+				"app.csproj", "Program.cs", "Controllers/HomeController.cs",
+				"Views/Home/Index.cshtml", "templates/mail.liquid", "templates/mail.cs",
+				".profile", "tmp/dotnet-core-buildpack-release-step.yml", "service-bindings.json",
+			} {
+				path := filepath.Join(buildDir, name)
+				Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(path, []byte("contents"), 0644)).To(Succeed())
+			}
+		})
+
+		It("keeps sources by default", func() {
+			Expect(finalizer.RemoveSources()).To(Succeed())
+			Expect(filepath.Join(buildDir, "Program.cs")).To(BeAnExistingFile())
+		})
+
+		It("removes sources except preserved paths and launch files", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  sources:\n    remove: true\n    preserve: [Views, templates/*.liquid]\n"), 0644)).To(Succeed())
+
+			Expect(finalizer.RemoveSources()).To(Succeed())
+
+			for _, name := range []string{"app.csproj", "Program.cs", "Controllers", "templates/mail.cs"} {
+				Expect(filepath.Join(buildDir, name)).ToNot(BeAnExistingFile())
+			}
+			for _, name := range []string{"Views/Home/Index.cshtml", "templates/mail.liquid", ".profile", "tmp/dotnet-core-buildpack-release-step.yml", "service-bindings.json", "buildpack.yml"} {
+				Expect(filepath.Join(buildDir, name)).To(BeAnExistingFile())
+			}
+		})
+
+		It("rejects malformed patterns before removing anything", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  sources:\n    remove: true\n    preserve: [\"[\"]\n"), 0644)).To(Succeed())
+
+			Expect(finalizer.RemoveSources()).ToNot(Succeed())
+			Expect(filepath.Join(buildDir, "Program.cs")).To(BeAnExistingFile())
+		})
+	})
+
+	Describe("BuildSpa", func() {
+		var (
+			spaRoot string
+			runs    [][]string
+		)
+
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk.Web"><PropertyGroup><SpaRoot>ClientApp\</SpaRoot></PropertyGroup></Project>`), 0644)).To(Succeed())
+			spaRoot = filepath.Join(buildDir, "ClientApp")
+			Expect(os.MkdirAll(spaRoot, 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(spaRoot, "package.json"), []byte("{}"), 0644)).To(Succeed())
+		})
+
+		BeforeEach(func() {
+			mockCommand.EXPECT().Run(gomock.Any()).AnyTimes().Do(func(cmd *exec.Cmd) {
+				Expect(cmd.Dir).To(Equal(spaRoot))
+				runs = append(runs, cmd.Args)
+				if cmd.Args[1] == "ci" || cmd.Args[1] == "install" {
+					Expect(os.MkdirAll(filepath.Join(spaRoot, "node_modules", "left-pad"), 0755)).To(Succeed())
 				}
 			})
+		})
 
-			It("deletes .nuget directory", func() {
-				Expect(finalizer.CleanStagingArea()).To(Succeed())
+		npmRuns := func() [][]string {
+			runs = nil
+			Expect(finalizer.BuildSpa()).To(Succeed())
+			return runs
+		}
 
-				Expect(filepath.Join(depsDir, depsIdx, ".nuget")).ToNot(BeADirectory())
-				Expect(filepath.Join(depsDir, depsIdx, "other", "file.txt")).To(BeARegularFile())
+		It("installs dependencies and runs the build script in the SpaRoot", func() {
+			Expect(npmRuns()).To(Equal([][]string{{"npm", "install"}, {"npm", "run", "build"}}))
+		})
+
+		It("runs a configured script", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  spa:\n    script: build:prod\n"), 0644)).To(Succeed())
+			Expect(npmRuns()).To(Equal([][]string{{"npm", "install"}, {"npm", "run", "build:prod"}}))
+		})
+
+		It("can be turned off", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  spa:\n    build: false\n"), 0644)).To(Succeed())
+			Expect(npmRuns()).To(BeEmpty())
+		})
+
+		Context("with a package-lock.json", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(spaRoot, "package-lock.json"), []byte(`{"lockfileVersion":1}`), 0644)).To(Succeed())
 			})
 
-			It("deletes symlinks to .nuget directory from bin directory", func() {
-				Expect(finalizer.CleanStagingArea()).To(Succeed())
+			It("uses npm ci and caches node_modules for the next build", func() {
+				Expect(npmRuns()).To(Equal([][]string{{"npm", "ci"}, {"npm", "run", "build"}}))
+				Expect(os.RemoveAll(filepath.Join(spaRoot, "node_modules"))).To(Succeed())
 
-				files, err := filepath.Glob(filepath.Join(depsDir, depsIdx, "bin", "*"))
+				Expect(npmRuns()).To(Equal([][]string{{"npm", "run", "build"}}))
+				Expect(filepath.Join(spaRoot, "node_modules", "left-pad")).To(BeADirectory())
+				Expect(buffer.String()).To(ContainSubstring("Using cached node_modules"))
+			})
+
+			It("copies node_modules rather than linking the droplet to the cache", func() {
+				npmRuns()
+				npmRuns()
+				info, err := os.Lstat(filepath.Join(spaRoot, "node_modules"))
 				Expect(err).ToNot(HaveOccurred())
-				Expect(files).To(Equal([]string{filepath.Join(depsDir, depsIdx, "bin", "file.txt")}))
+				Expect(info.IsDir()).To(BeTrue())
+				Expect(filepath.Join(spaRoot, "node_modules", "left-pad")).To(BeADirectory())
+			})
+
+			It("reinstalls when the lock file changes", func() {
+				npmRuns()
+				Expect(ioutil.WriteFile(filepath.Join(spaRoot, "package-lock.json"), []byte(`{"lockfileVersion":2}`), 0644)).To(Succeed())
+				Expect(npmRuns()).To(Equal([][]string{{"npm", "ci"}, {"npm", "run", "build"}}))
+			})
+		})
+	})
+
+	Describe("RestoreLibman", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+		})
+
+		It("does nothing without a libman.json", func() {
+			Expect(finalizer.RestoreLibman()).To(Succeed())
+		})
+
+		Context("The project has a libman.json", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "libman.json"), []byte(`{"version":"1.0","libraries":[]}`), 0644)).To(Succeed())
+			})
+
+			It("installs the libman tool and restores", func() {
+				libman := filepath.Join(depsDir, depsIdx, "dotnet-tools", "libman")
+				gomock.InOrder(
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args).To(Equal([]string{"dotnet", "tool", "install", "Microsoft.Web.LibraryManager.Cli", "--version", "1.0.163", "--tool-path", filepath.Dir(libman)}))
+					}),
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args).To(Equal([]string{libman, "restore"}))
+						Expect(cmd.Dir).To(Equal(buildDir))
+					}),
+				)
+				Expect(finalizer.RestoreLibman()).To(Succeed())
+			})
+
+			It("uses libman from the app's local tools", func() {
+				libman := filepath.Join(depsDir, depsIdx, "dotnet-tools", "libman")
+				Expect(os.MkdirAll(filepath.Dir(libman), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(libman, []byte(""), 0755)).To(Succeed())
+				mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+					Expect(cmd.Args).To(Equal([]string{libman, "restore"}))
+				})
+				Expect(finalizer.RestoreLibman()).To(Succeed())
+			})
+		})
+	})
+
+	Describe("RestorePaket", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.fsproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+		})
+
+		It("does nothing without a paket.dependencies", func() {
+			Expect(finalizer.RestorePaket()).To(Succeed())
+		})
+
+		Context("The app has a paket.dependencies and paket.lock", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "paket.dependencies"), []byte("source https://api.nuget.org/v3/index.json\nnuget FSharp.Core\n"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "paket.lock"), []byte(""), 0644)).To(Succeed())
+			})
+
+			It("installs paket and restores", func() {
+				paket := filepath.Join(depsDir, depsIdx, "dotnet-tools", "paket")
+				gomock.InOrder(
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args).To(Equal([]string{"dotnet", "tool", "install", "Paket", "--version", "5.257.0", "--tool-path", filepath.Dir(paket)}))
+					}),
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args).To(Equal([]string{paket, "restore"}))
+						Expect(cmd.Dir).To(Equal(buildDir))
+					}),
+				)
+				Expect(finalizer.RestorePaket()).To(Succeed())
+			})
+
+			It("uses paket from the app's tool manifest", func() {
+				Expect(os.MkdirAll(filepath.Join(buildDir, ".config"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, ".config", "dotnet-tools.json"), []byte(`{"version": 1, "isRoot": true, "tools": {"paket": {"version": "5.257.0", "commands": ["paket"]}}}`), 0644)).To(Succeed())
+				gomock.InOrder(
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args).To(Equal([]string{"dotnet", "tool", "restore"}))
+					}),
+					mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+						Expect(cmd.Args).To(Equal([]string{"dotnet", "paket", "restore"}))
+					}),
+				)
+				Expect(finalizer.RestorePaket()).To(Succeed())
+			})
+		})
+
+		It("resolves dependencies with paket install when paket.lock is missing", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "paket.dependencies"), []byte(""), 0644)).To(Succeed())
+			paket := filepath.Join(depsDir, depsIdx, "dotnet-tools", "paket")
+			Expect(os.MkdirAll(filepath.Dir(paket), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(paket, []byte(""), 0755)).To(Succeed())
+			mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+				Expect(cmd.Args).To(Equal([]string{paket, "install"}))
+			})
+			Expect(finalizer.RestorePaket()).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("paket.lock is missing"))
+		})
+	})
+
+	Describe("RunHook", func() {
+		Context("The hook does not exist", func() {
+			It("does nothing", func() {
+				Expect(finalizer.RunHook("pre_publish")).To(Succeed())
+			})
+		})
+
+		Context("The hook exists", func() {
+			var hook string
+
+			BeforeEach(func() {
+				hook = filepath.Join(buildDir, ".buildpack", "hooks", "pre_publish")
+				Expect(os.MkdirAll(filepath.Dir(hook), 0755)).To(Succeed())
+			})
+
+			It("runs it from the build dir", func() {
+				Expect(ioutil.WriteFile(hook, []byte("#!/bin/bash\n"), 0755)).To(Succeed())
+				mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+					Expect(cmd.Args).To(Equal([]string{hook}))
+					Expect(cmd.Dir).To(Equal(buildDir))
+					Expect(cmd.Env).To(ContainElement("PUBLISH_DIR=" + filepath.Join(depsDir, depsIdx, "dotnet_publish")))
+				})
+				Expect(finalizer.RunHook("pre_publish")).To(Succeed())
+			})
+
+			It("runs it with bash when it is not executable", func() {
+				Expect(ioutil.WriteFile(hook, []byte("echo hi\n"), 0644)).To(Succeed())
+				mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+					Expect(cmd.Args).To(Equal([]string{"bash", hook}))
+				})
+				Expect(finalizer.RunHook("pre_publish")).To(Succeed())
+			})
+		})
+	})
+
+	Describe("RunTests", func() {
+		BeforeEach(func() {
+			Expect(os.MkdirAll(filepath.Join(buildDir, "tests"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "tests", "app.tests.csproj"), []byte(`<Project><ItemGroup><PackageReference Include="Microsoft.NET.Test.Sdk" /></ItemGroup></Project>`), 0644)).To(Succeed())
+		})
+
+		Context("Tests are not enabled", func() {
+			It("does not run anything", func() {
+				Expect(finalizer.RunTests()).To(Succeed())
+			})
+		})
+
+		Context("Tests are enabled in buildpack.yml", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  tests:\n    enabled: true\n    filter: Category!=Integration\n"), 0644)).To(Succeed())
+			})
+
+			It("runs dotnet test on the test projects", func() {
+				mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+					Expect(cmd.Args).To(Equal([]string{"dotnet", "test", filepath.Join(buildDir, "tests", "app.tests.csproj"), "-c", "Debug", "--filter", "Category!=Integration"}))
+				})
+				Expect(finalizer.RunTests()).To(Succeed())
+			})
+
+			It("fails when the tests fail", func() {
+				mockCommand.EXPECT().Run(gomock.Any()).Return(fmt.Errorf("exit status 1")).Times(2)
+				Expect(finalizer.RunTests()).To(MatchError("tests failed in tests/app.tests.csproj"))
+			})
+
+			It("bounds the whole run, not each project, with TEST_TIMEOUT", func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "tests", "other.tests.csproj"), []byte(`<Project><ItemGroup><PackageReference Include="Microsoft.NET.Test.Sdk" /></ItemGroup></Project>`), 0644)).To(Succeed())
+				Expect(os.Setenv("TEST_TIMEOUT", "300ms")).To(Succeed())
+				defer os.Unsetenv("TEST_TIMEOUT")
+				mockCommand.EXPECT().Run(gomock.Any()).DoAndReturn(func(cmd *exec.Cmd) error {
+					time.Sleep(200 * time.Millisecond)
+					return nil
+				})
+				mockCommand.EXPECT().Run(gomock.Any()).DoAndReturn(func(cmd *exec.Cmd) error {
+					time.Sleep(200 * time.Millisecond)
+					return fmt.Errorf("signal: killed")
+				})
+				mockCommand.EXPECT().Run(gomock.Any())
+
+				Expect(finalizer.RunTests()).To(MatchError(ContainSubstring("dotnet test did not finish within its timeout")))
+			})
+
+			It("explains a selected project that does not exist", func() {
+				Expect(os.Setenv("TEST_PROJECTS", "tests/missing.csproj")).To(Succeed())
+				defer os.Unsetenv("TEST_PROJECTS")
+				Expect(finalizer.RunTests()).To(MatchError("test project tests/missing.csproj does not exist"))
+			})
+		})
+	})
+
+	Describe("AuditPackages", func() {
+		const report = `{"version": 1, "projects": [{"path": "app.csproj", "frameworks": [{"framework": "net8.0",
+  "topLevelPackages": [{"id": "Newtonsoft.Json", "resolvedVersion": "12.0.1", "vulnerabilities": [{"severity": "High", "advisoryurl": "https://github.com/advisories/GHSA-5crp-9r3c-p9vr"}]}],
+  "transitivePackages": [{"id": "System.Net.Http", "resolvedVersion": "4.3.0", "vulnerabilities": [{"severity": "Moderate", "advisoryurl": "https://github.com/advisories/GHSA-7jgj-8wvc-jh57"}]}]}]}]}`
+
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet", "sdk", "8.0.100"), 0755)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Unsetenv("NUGET_AUDIT")).To(Succeed())
+			Expect(os.Unsetenv("NUGET_AUDIT_FAIL_ON")).To(Succeed())
+		})
+
+		It("does nothing unless enabled", func() {
+			Expect(finalizer.AuditPackages()).To(Succeed())
+		})
+
+		It("warns about vulnerable packages", func() {
+			Expect(os.Setenv("NUGET_AUDIT", "true")).To(Succeed())
+			mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+				Expect(cmd.Args).To(Equal([]string{"dotnet", "list", filepath.Join(buildDir, "app.csproj"), "package", "--vulnerable", "--include-transitive", "--format", "json"}))
+				cmd.Stdout.Write([]byte(report))
+			})
+
+			Expect(finalizer.AuditPackages()).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("Newtonsoft.Json 12.0.1: High severity, https://github.com/advisories/GHSA-5crp-9r3c-p9vr"))
+			Expect(buffer.String()).To(ContainSubstring("System.Net.Http 4.3.0: Moderate severity"))
+		})
+
+		It("fails on vulnerabilities at or above the configured severity", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  nuget-audit:\n    enabled: true\n    fail-on: high\n"), 0644)).To(Succeed())
+			mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+				cmd.Stdout.Write([]byte(report))
+			})
+
+			Expect(finalizer.AuditPackages()).To(MatchError("vulnerabilities of high severity or higher found in Newtonsoft.Json 12.0.1"))
+		})
+
+		It("skips the audit with SDKs that can't run it", func() {
+			Expect(os.Setenv("NUGET_AUDIT", "true")).To(Succeed())
+			Expect(os.RemoveAll(filepath.Join(depsDir, depsIdx, "dotnet", "sdk", "8.0.100"))).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet", "sdk", "2.1.300"), 0755)).To(Succeed())
+
+			Expect(finalizer.AuditPackages()).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("**WARNING** Skipping the NuGet audit, as it needs the .NET SDK 7.0.200 or later and the app is built with 2.1.300"))
+		})
+
+		It("rejects unknown severities", func() {
+			Expect(os.Setenv("NUGET_AUDIT", "true")).To(Succeed())
+			Expect(os.Setenv("NUGET_AUDIT_FAIL_ON", "severe")).To(Succeed())
+			Expect(finalizer.AuditPackages()).To(MatchError("unknown NuGet audit severity severe, expected one of low, moderate, high, critical"))
+		})
+	})
+
+	Describe("WriteLicenseReport", func() {
+		BeforeEach(func() {
+			packagesDir := filepath.Join(depsDir, depsIdx, ".nuget", "packages")
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(buildDir, "obj"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "obj", "project.assets.json"), []byte(`{
+  "libraries": {
+    "Newtonsoft.Json/13.0.3": {"type": "package", "path": "newtonsoft.json/13.0.3"},
+    "Legacy.Lib/1.0.0": {"type": "package", "path": "legacy.lib/1.0.0"},
+    "Latin.Lib/2.0.0": {"type": "package", "path": "latin.lib/2.0.0"},
+    "Broken.Lib/3.0.0": {"type": "package", "path": "broken.lib/3.0.0"},
+    "Shared/1.0.0": {"type": "project", "path": "../Shared/Shared.csproj"}
+  },
+  "packageFolders": {"`+packagesDir+`/": {}}
+}`), 0644)).To(Succeed())
+			for name, nuspec := range map[string]string{
+				"newtonsoft.json/13.0.3/newtonsoft.json.nuspec": `<?xml version="1.0"?><package xmlns="http://schemas.microsoft.com/packaging/2013/05/nuspec.xsd"><metadata><id>Newtonsoft.Json</id><license type="expression">MIT</license><licenseUrl>https://licenses.nuget.org/MIT</licenseUrl></metadata></package>`,
+				"legacy.lib/1.0.0/legacy.lib.nuspec":            `<?xml version="1.0"?><package><metadata><id>Legacy.Lib</id><licenseUrl>https://example.com/license</licenseUrl></metadata></package>`,
+				"latin.lib/2.0.0/latin.lib.nuspec":              "<?xml version=\"1.0\" encoding=\"windows-1252\"?><package><metadata><id>Latin.Lib</id><license type=\"file\">Licen\xe7a.txt</license></metadata></package>",
+				"broken.lib/3.0.0/broken.lib.nuspec":            `<?xml version="1.0" encoding="x-unknown"?><package></package>`,
+			} {
+				Expect(os.MkdirAll(filepath.Dir(filepath.Join(packagesDir, name)), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(packagesDir, name), []byte(nuspec), 0644)).To(Succeed())
+			}
+		})
+
+		It("records the licenses of the restored packages", func() {
+			Expect(finalizer.WriteLicenseReport()).To(Succeed())
+
+			report, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "nuget-licenses.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report).To(MatchJSON(`[
+  {"id": "Broken.Lib", "version": "3.0.0"},
+  {"id": "Latin.Lib", "version": "2.0.0", "license": "file Licença.txt"},
+  {"id": "Legacy.Lib", "version": "1.0.0", "licenseUrl": "https://example.com/license"},
+  {"id": "Newtonsoft.Json", "version": "13.0.3", "license": "MIT", "licenseUrl": "https://licenses.nuget.org/MIT"}
+]`))
+			Expect(buffer.String()).To(ContainSubstring("**WARNING** Unable to read the license of Broken.Lib 3.0.0"))
+			Expect(buffer.String()).ToNot(ContainSubstring("Licenses of NuGet packages"))
+		})
+
+		It("prints the report when asked to", func() {
+			Expect(os.Setenv("PRINT_LICENSE_REPORT", "true")).To(Succeed())
+			defer os.Unsetenv("PRINT_LICENSE_REPORT")
+
+			Expect(finalizer.WriteLicenseReport()).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("Newtonsoft.Json 13.0.3: MIT"))
+			Expect(buffer.String()).To(ContainSubstring("Legacy.Lib 1.0.0: https://example.com/license"))
+		})
+	})
+
+	Describe("RunMigrations", func() {
+		BeforeEach(func() {
+			Expect(os.MkdirAll(filepath.Join(buildDir, "src"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "src", "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+		})
+
+		Context("Migrations are not enabled", func() {
+			It("does not run anything", func() {
+				Expect(finalizer.RunMigrations()).To(Succeed())
+			})
+		})
+
+		Context("Migrations are enabled in buildpack.yml", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  migrations:\n    enabled: true\n    connection-string: OrdersDb\n"), 0644)).To(Succeed())
+				Expect(os.Setenv("VCAP_SERVICES", `{"p.mysql": [{"name": "orders", "credentials": {"uri": "mysql://orders"}}]}`)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(os.Unsetenv("VCAP_SERVICES")).To(Succeed())
+			})
+
+			It("runs dotnet ef database update with the bound connection string", func() {
+				mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+					Expect(cmd.Args).To(Equal([]string{"bash", "-c", "dotnet ef database update"}))
+					Expect(cmd.Dir).To(Equal(filepath.Join(buildDir, "src")))
+					Expect(cmd.Env).To(ContainElement("ConnectionStrings__OrdersDb=mysql://orders"))
+				})
+				Expect(finalizer.RunMigrations()).To(Succeed())
+			})
+		})
+	})
+
+	Describe("SmokeTest", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.runtimeconfig.json"), []byte("{}"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  smoke-test:\n    enabled: true\n    seconds: 1\n"), 0644)).To(Succeed())
+		})
+
+		It("does nothing unless enabled", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte(""), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app"), []byte("#!/bin/sh\nexit 1\n"), 0755)).To(Succeed())
+			Expect(finalizer.SmokeTest()).To(Succeed())
+		})
+
+		It("fails with the app's output when it exits", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app"), []byte("#!/bin/sh\necho missing framework >&2\nexit 1\n"), 0755)).To(Succeed())
+			Expect(finalizer.SmokeTest()).To(MatchError("the app exited during the smoke test (exit status 1)"))
+			Expect(buffer.String()).To(ContainSubstring("missing framework"))
+		})
+
+		It("fails when the app does not listen on its port", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app"), []byte("#!/bin/sh\nexec sleep 5\n"), 0755)).To(Succeed())
+			Expect(finalizer.SmokeTest()).To(MatchError(MatchRegexp(`^the app did not listen on port \d+ within 1s$`)))
+		})
+	})
+
+	Describe("InstallLaunchEnv", func() {
+		It("copies the helper into the droplet", func() {
+			finalizer.LaunchEnv = filepath.Join(buildDir, "launchenv")
+			Expect(ioutil.WriteFile(finalizer.LaunchEnv, []byte("#!/bin/sh\n"), 0755)).To(Succeed())
+			Expect(finalizer.InstallLaunchEnv()).To(Succeed())
+			Expect(filepath.Join(depsDir, depsIdx, "bin", "launchenv")).To(BeAnExistingFile())
+		})
+
+		It("warns and carries on when the buildpack has no helper", func() {
+			finalizer.LaunchEnv = filepath.Join(buildDir, "launchenv")
+			Expect(finalizer.InstallLaunchEnv()).To(Succeed())
+			Expect(filepath.Join(depsDir, depsIdx, "bin", "launchenv")).ToNot(BeAnExistingFile())
+			Expect(buffer.String()).To(ContainSubstring("**WARNING** The buildpack has no launchenv helper"))
+		})
+	})
+
+	Describe("GenerateReleaseYaml", func() {
+		Context("The project is a Blazor WebAssembly app", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "client.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk.BlazorWebAssembly"></Project>`), 0644)).To(Succeed())
+			})
+
+			It("serves the published wwwroot with the static file server", func() {
+				data, err := finalizer.GenerateReleaseYaml()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data["default_process_types"]["web"]).To(Equal("cd ${DEPS_DIR}/9/dotnet_publish/wwwroot && ${DEPS_DIR}/9/bin/staticserver"))
+			})
+		})
+
+		Context("Publishing produced nothing to run", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "lib.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk"></Project>`), 0644)).To(Succeed())
+			})
+
+			It("fails rather than writing an empty start command", func() {
+				_, err := finalizer.GenerateReleaseYaml()
+				Expect(err).To(MatchError("no executable or dll was published for " + filepath.Join(buildDir, "lib.csproj") + "; check that the project's OutputType is Exe"))
+			})
+		})
+		Context("The project is a Worker Service", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "worker.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk.Worker"></Project>`), 0644)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet_publish"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet_publish", "worker"), []byte(""), 0755)).To(Succeed())
+			})
+
+			It("runs it without binding a port as the web and worker processes", func() {
+				data, err := finalizer.GenerateReleaseYaml()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data["default_process_types"]).To(Equal(map[string]string{
+					"web":    "cd ${DEPS_DIR}/9/dotnet_publish && ./worker",
+					"worker": "cd ${DEPS_DIR}/9/dotnet_publish && ./worker",
+				}))
+			})
+		})
+
+		Context("The start command runs a dll", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.runtimeconfig.json"), []byte("{}"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.dll"), []byte(""), 0644)).To(Succeed())
+			})
+
+			It("fails when dotnet was not installed", func() {
+				_, err := finalizer.GenerateReleaseYaml()
+				Expect(err).To(MatchError("the start command runs app.dll with dotnet, but dotnet was not installed"))
+			})
+		})
+
+		Context("buildpack.yml declares tasks", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.runtimeconfig.json"), []byte("{}"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.dll"), []byte(""), 0644)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet", "dotnet"), []byte(""), 0755)).To(Succeed())
+			})
+
+			It("adds them as process types run from the app", func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  migrations:\n    task-command: ./efbundle\n  tasks:\n    seed: dotnet app.dll --seed\n"), 0644)).To(Succeed())
+				data, err := finalizer.GenerateReleaseYaml()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data["default_process_types"]).To(Equal(map[string]string{
+					"web":     "cd ${HOME} && dotnet ./app.dll",
+					"migrate": "cd ${HOME} && ./efbundle",
+					"seed":    "cd ${HOME} && dotnet app.dll --seed",
+				}))
+			})
+
+			It("does not let a task replace the start command", func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  tasks:\n    web: ./other\n"), 0644)).To(Succeed())
+				_, err := finalizer.GenerateReleaseYaml()
+				Expect(err).To(MatchError("the task name web is reserved for the start command"))
+			})
+		})
+	})
+
+	Describe("CheckProject", func() {
+		It("explains what it looked for when there is nothing to run", func() {
+			err := finalizer.CheckProject()
+			Expect(err).To(MatchError(ContainSubstring("No project or published app was found")))
+			Expect(err).To(MatchError(ContainSubstring("*.runtimeconfig.json")))
+			Expect(err).To(MatchError(ContainSubstring("cf push -p")))
+		})
+
+		It("passes for apps with a project", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk.Web"></Project>`), 0644)).To(Succeed())
+			Expect(finalizer.CheckProject()).To(Succeed())
+		})
+
+		It("warns when every project seems to be a class library", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, ".deployment"), []byte("[config]\nproject = lib/lib.csproj\n"), 0644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(buildDir, "lib"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "lib", "lib.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk"></Project>`), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "views.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk.Razor"><PropertyGroup><OutputType>Library</OutputType></PropertyGroup></Project>`), 0644)).To(Succeed())
+			Expect(finalizer.CheckProject()).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("**WARNING** No executable project was found, these projects seem to build class libraries: " + filepath.Join("lib", "lib.csproj") + ", views.csproj"))
+		})
+
+		Context("the buildpack has no runtime for the target framework", func() {
+			var mockManifest *MockManifest
+
+			BeforeEach(func() {
+				mockManifest = NewMockManifest(mockCtrl)
+				finalizer.Manifest = mockManifest
+				mockManifest.EXPECT().AllDependencyVersions("dotnet-framework").Return([]string{"6.0.25", "8.0.0", "8.0.11"}).AnyTimes()
+			})
+
+			It("fails before restoring", func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk.Web"><PropertyGroup><TargetFramework>net9.0</TargetFramework></PropertyGroup></Project>`), 0644)).To(Succeed())
+				Expect(finalizer.CheckProject()).To(MatchError("net9.0 requested but this buildpack provides 6.0.x and 8.0.x"))
+			})
+
+			It("passes for frameworks that roll forward to a provided runtime", func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk.Web"><PropertyGroup><TargetFramework>net6.0</TargetFramework></PropertyGroup></Project>`), 0644)).To(Succeed())
+				Expect(finalizer.CheckProject()).To(Succeed())
+			})
+		})
+
+		It("passes for published apps", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.runtimeconfig.json"), []byte(`{}`), 0644)).To(Succeed())
+			Expect(finalizer.CheckProject()).To(Succeed())
+		})
+	})
+
+	Describe("WriteProfileD", func() {
+		It("opts out of CLI telemetry unless configured otherwise", func() {
+			Expect(finalizer.WriteProfileD()).To(Succeed())
+			contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("export DOTNET_CLI_TELEMETRY_OPTOUT=${DOTNET_CLI_TELEMETRY_OPTOUT:-1}\n"))
+		})
+
+		It("binds ASPNETCORE_URLS to $PORT unless it is already set", func() {
+			Expect(finalizer.WriteProfileD()).To(Succeed())
+			contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("export ASPNETCORE_URLS=${ASPNETCORE_URLS:-http://0.0.0.0:${PORT}}\n"))
+		})
+
+		It("trusts the router's forwarded headers unless configured otherwise", func() {
+			Expect(finalizer.WriteProfileD()).To(Succeed())
+			contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("export ASPNETCORE_FORWARDEDHEADERS_ENABLED=${ASPNETCORE_FORWARDEDHEADERS_ENABLED:-true}\n"))
+		})
+
+		It("does not bind ASPNETCORE_URLS for Worker Services", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "worker.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk.Worker"></Project>`), 0644)).To(Succeed())
+			Expect(finalizer.WriteProfileD()).To(Succeed())
+			contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).NotTo(ContainSubstring("ASPNETCORE_URLS"))
+		})
+
+		It("serves HTTP/2 without TLS when asked to", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  kestrel:\n    http2: true\n"), 0644)).To(Succeed())
+			Expect(finalizer.WriteProfileD()).To(Succeed())
+			contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("export Kestrel__EndpointDefaults__Protocols=${Kestrel__EndpointDefaults__Protocols:-Http2}\n"))
+		})
+
+		Context("the launch environment helper is installed", func() {
+			BeforeEach(func() {
+				Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "bin"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "bin", "launchenv"), []byte(""), 0755)).To(Succeed())
+			})
+
+			It("materializes a Kestrel certificate from service bindings at launch", func() {
+				Expect(finalizer.WriteProfileD()).To(Succeed())
+				contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("eval \"$($DEPS_DIR/" + depsIdx + "/bin/launchenv kestrel-certificate $DEPS_DIR/" + depsIdx + "/kestrel)\"\n"))
+			})
+
+			It("persists the Data Protection key ring in a bound service at launch", func() {
+				Expect(finalizer.WriteProfileD()).To(Succeed())
+				contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("eval \"$($DEPS_DIR/" + depsIdx + "/bin/launchenv data-protection $HOME)\"\n"))
+			})
+
+			It("bridges service credentials into configuration at launch", func() {
+				Expect(finalizer.WriteProfileD()).To(Succeed())
+				contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("eval \"$($DEPS_DIR/" + depsIdx + "/bin/launchenv service-configuration $HOME)\"\n"))
+			})
+
+			It("points additional probing paths at the kept NuGet cache at launch", func() {
+				Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet_publish"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet_publish", "app.runtimeconfig.dev.json"), []byte(`{"runtimeOptions": {"additionalProbingPaths": ["/root/.nuget/packages"]}}`), 0644)).To(Succeed())
+
+				Expect(finalizer.WriteProfileD()).To(Succeed())
+				contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("eval \"$($DEPS_DIR/" + depsIdx + "/bin/launchenv probing-paths ${DEPS_DIR}/" + depsIdx + "/dotnet_publish $DEPS_DIR/" + depsIdx + "/.nuget/packages)\"\n"))
+			})
+		})
+
+		Context("globalization invariant mode", func() {
+			It("is not set by default", func() {
+				Expect(finalizer.WriteProfileD()).To(Succeed())
+				contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).NotTo(ContainSubstring("DOTNET_SYSTEM_GLOBALIZATION_INVARIANT"))
+			})
+
+			It("is set when the published app opted in", func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.runtimeconfig.json"), []byte(`{"runtimeOptions":{"configProperties":{"System.Globalization.Invariant":true}}}`), 0644)).To(Succeed())
+				Expect(finalizer.WriteProfileD()).To(Succeed())
+				contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("export DOTNET_SYSTEM_GLOBALIZATION_INVARIANT=${DOTNET_SYSTEM_GLOBALIZATION_INVARIANT:-1}\n"))
+			})
+
+			It("can be turned on in buildpack.yml", func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  globalization:\n    invariant: true\n"), 0644)).To(Succeed())
+				Expect(finalizer.WriteProfileD()).To(Succeed())
+				contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("DOTNET_SYSTEM_GLOBALIZATION_INVARIANT"))
+			})
+		})
+
+		Context("GC heap limit", func() {
+			heapLimitFor := func(env ...string) string {
+				Expect(finalizer.WriteProfileD()).To(Succeed())
+				script := filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh")
+				cmd := exec.Command("bash", "-c", fmt.Sprintf("source %s && echo ${DOTNET_GCHeapHardLimit-unset}", script))
+				cmd.Env = append(env, "PORT=8080", "PATH="+os.Getenv("PATH"))
+				output, err := cmd.Output()
+				Expect(err).ToNot(HaveOccurred())
+				return strings.TrimSpace(string(output))
+			}
+
+			It("derives the limit from MEMORY_LIMIT", func() {
+				Expect(heapLimitFor("MEMORY_LIMIT=1024m")).To(Equal("30000000"))
+				Expect(heapLimitFor("MEMORY_LIMIT=1G", "GC_HEAP_LIMIT_PERCENT=50")).To(Equal("20000000"))
+			})
+
+			It("keeps a limit configured by the app", func() {
+				Expect(heapLimitFor("MEMORY_LIMIT=1024m", "DOTNET_GCHeapHardLimitPercent=32")).To(Equal("unset"))
+			})
+
+			It("does nothing without MEMORY_LIMIT", func() {
+				Expect(heapLimitFor()).To(Equal("unset"))
+			})
+		})
+
+		Context("GC mode", func() {
+			gcServerFor := func(env ...string) string {
+				Expect(finalizer.WriteProfileD()).To(Succeed())
+				script := filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh")
+				cmd := exec.Command("bash", "-c", fmt.Sprintf("source %s && echo ${DOTNET_gcServer-unset} ${DOTNET_gcConcurrent-unset}", script))
+				cmd.Env = append(env, "PORT=8080", "PATH="+os.Getenv("PATH"))
+				output, err := cmd.Output()
+				Expect(err).ToNot(HaveOccurred())
+				return strings.TrimSpace(string(output))
+			}
+
+			It("uses workstation GC in small containers", func() {
+				Expect(gcServerFor("MEMORY_LIMIT=512m")).To(Equal("0 unset"))
+			})
+
+			It("keeps a GC mode set by the app", func() {
+				Expect(gcServerFor("MEMORY_LIMIT=512m", "DOTNET_gcServer=1")).To(Equal("1 unset"))
+			})
+
+			It("keeps the runtime's default without MEMORY_LIMIT", func() {
+				Expect(gcServerFor()).To(Equal("unset unset"))
+			})
+
+			It("keeps a GC mode set in the app's runtimeconfig.json", func() {
+				publishDir := filepath.Join(depsDir, depsIdx, "dotnet_publish")
+				Expect(os.MkdirAll(publishDir, 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(publishDir, "app.runtimeconfig.json"), []byte(`{"runtimeOptions":{"configProperties":{"System.GC.Server":true}}}`), 0644)).To(Succeed())
+				Expect(gcServerFor("MEMORY_LIMIT=512m")).To(Equal("unset unset"))
+			})
+
+			Context("the GC mode is configured", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  gc:\n    server: true\n"), 0644)).To(Succeed())
+					Expect(os.Setenv("GC_CONCURRENT", "false")).To(Succeed())
+				})
+
+				AfterEach(func() {
+					Expect(os.Unsetenv("GC_CONCURRENT")).To(Succeed())
+				})
+
+				It("uses the configured settings", func() {
+					Expect(gcServerFor("MEMORY_LIMIT=512m")).To(Equal("1 0"))
+				})
+			})
+		})
+
+		Context("aspnetcore-environment is configured in buildpack.yml", func() {
+			var script string
+
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte(`dotnet-core:
+  aspnetcore-environment:
+    variable: APP_ENV
+    spaces:
+    - match: prod*
+      environment: Production
+    - match: "*"
+      environment: Development
+`), 0644)).To(Succeed())
+				Expect(finalizer.WriteProfileD()).To(Succeed())
+				script = filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh")
+			})
+
+			environmentFor := func(env ...string) string {
+				cmd := exec.Command("bash", "-c", fmt.Sprintf("source %s && echo ${ASPNETCORE_ENVIRONMENT-unset}", script))
+				cmd.Env = append(env, "PORT=8080", "PATH="+os.Getenv("PATH"))
+				output, err := cmd.Output()
+				Expect(err).ToNot(HaveOccurred())
+				return strings.TrimSpace(string(output))
+			}
+
+			It("keeps a value the app already set", func() {
+				Expect(environmentFor("ASPNETCORE_ENVIRONMENT=Staging", "APP_ENV=Other")).To(Equal("Staging"))
+			})
+
+			It("uses the configured variable", func() {
+				Expect(environmentFor("APP_ENV=Qa")).To(Equal("Qa"))
+			})
+
+			It("falls back to the space name mapping", func() {
+				Expect(environmentFor(`VCAP_APPLICATION={"space_name": "production-east"}`)).To(Equal("Production"))
+				Expect(environmentFor(`VCAP_APPLICATION={"space_name":"dev"}`)).To(Equal("Development"))
+			})
+		})
+
+		Context("The dotnet install is kept in the droplet", func() {
+			BeforeEach(func() {
+				Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet", "store"), 0755)).To(Succeed())
+			})
+
+			It("exports DOTNET_ROOT, PATH and the runtime package store", func() {
+				Expect(finalizer.WriteProfileD()).To(Succeed())
+				contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("export DOTNET_ROOT=$DEPS_DIR/9/dotnet\n"))
+				Expect(string(contents)).To(ContainSubstring("export PATH=$DOTNET_ROOT:$PATH\n"))
+				Expect(string(contents)).To(ContainSubstring("export DOTNET_SHARED_STORE=$DEPS_DIR/9/dotnet/store\n"))
+			})
+		})
+
+		Context("The dotnet install was removed", func() {
+			It("does not export DOTNET_ROOT", func() {
+				Expect(finalizer.WriteProfileD()).To(Succeed())
+				contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "startup.sh"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).ToNot(ContainSubstring("DOTNET_ROOT"))
+			})
+		})
+	})
+
+	Describe("CheckAdvisories", func() {
+		BeforeEach(func() {
+			Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet", "shared", "Microsoft.NETCore.App", "8.0.6"), 0755)).To(Succeed())
+			finalizer.Advisories = filepath.Join(buildDir, "advisories.yml")
+			Expect(ioutil.WriteFile(finalizer.Advisories, []byte("advisories:\n- id: CVE-2024-0001\n  name: dotnet-runtime\n  versions: '< 8.0.7'\n  summary: Denial of service\n"), 0644)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Unsetenv("ADVISORY_POLICY")).To(Succeed())
+			Expect(os.Unsetenv("IGNORE_ADVISORIES")).To(Succeed())
+		})
+
+		It("warns about affected versions", func() {
+			Expect(finalizer.CheckAdvisories()).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("**WARNING** dotnet-runtime 8.0.6 is affected by CVE-2024-0001: Denial of service"))
+		})
+
+		It("fails when the operator asks it to, unless the advisory is ignored", func() {
+			Expect(os.Setenv("ADVISORY_POLICY", "fail")).To(Succeed())
+			Expect(finalizer.CheckAdvisories()).To(MatchError("the installed dotnet versions are affected by CVE-2024-0001; update them, or set IGNORE_ADVISORIES to stage anyway"))
+
+			Expect(os.Setenv("IGNORE_ADVISORIES", "CVE-2024-0001")).To(Succeed())
+			Expect(finalizer.CheckAdvisories()).To(Succeed())
+		})
+	})
+
+	Describe("NormalizePermissions", func() {
+		It("makes installed files readable by all and writable only by their owner", func() {
+			dotnetDir := filepath.Join(depsDir, depsIdx, "dotnet")
+			Expect(os.MkdirAll(filepath.Join(dotnetDir, "shared"), 0777)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dotnetDir, "dotnet"), []byte(""), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dotnetDir, "LICENSE.txt"), []byte(""), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dotnetDir, "shared", "System.dll"), []byte(""), 0644)).To(Succeed())
+			Expect(os.Chmod(filepath.Join(dotnetDir, "shared"), 0777)).To(Succeed())
+			Expect(os.Chmod(filepath.Join(dotnetDir, "shared", "System.dll"), 0666|os.ModeSetuid)).To(Succeed())
+
+			Expect(finalizer.NormalizePermissions()).To(Succeed())
+
+			for name, mode := range map[string]os.FileMode{"dotnet": 0755, "LICENSE.txt": 0644, "shared": os.ModeDir | 0755, "shared/System.dll": 0644} {
+				info, err := os.Stat(filepath.Join(dotnetDir, name))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(info.Mode()).To(Equal(mode), name)
+			}
+			Expect(buffer.String()).To(ContainSubstring("Normalized the permissions of 4 files and directories"))
+		})
+	})
+
+	Describe("CleanStagingArea", func() {
+		Context(`The .nuget directory exists with a symlink to it`, func() {
+			BeforeEach(func() {
+				Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "bin"), 0755)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "lib"), 0755)).To(Succeed())
+				for _, name := range []string{
+					".nuget/fileA.txt",
+					".nuget/fileB.txt",
+					"other/file.txt",
+				} {
+					Expect(os.MkdirAll(filepath.Dir(filepath.Join(depsDir, depsIdx, name)), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, name), []byte(""), 0644)).To(Succeed())
+					Expect(os.Symlink(filepath.Join(depsDir, depsIdx, name), filepath.Join(depsDir, depsIdx, "bin", filepath.Base(name)))).To(Succeed())
+					Expect(os.Symlink(filepath.Join(depsDir, depsIdx, name), filepath.Join(depsDir, depsIdx, "lib", filepath.Base(name)))).To(Succeed())
+				}
+			})
+
+			It("deletes .nuget directory", func() {
+				Expect(finalizer.CleanStagingArea()).To(Succeed())
+
+				Expect(filepath.Join(depsDir, depsIdx, ".nuget")).ToNot(BeADirectory())
+				Expect(filepath.Join(depsDir, depsIdx, "other", "file.txt")).To(BeARegularFile())
+			})
+
+			It("deletes symlinks to .nuget directory from bin directory", func() {
+				Expect(finalizer.CleanStagingArea()).To(Succeed())
+
+				files, err := filepath.Glob(filepath.Join(depsDir, depsIdx, "bin", "*"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(files).To(Equal([]string{filepath.Join(depsDir, depsIdx, "bin", "file.txt")}))
+			})
+
+			It("keeps the .nuget directory when the app probes it at runtime", func() {
+				Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet_publish"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet_publish", "app.runtimeconfig.dev.json"), []byte(`{"runtimeOptions": {"additionalProbingPaths": ["/root/.nuget/packages"]}}`), 0644)).To(Succeed())
+
+				Expect(finalizer.CleanStagingArea()).To(Succeed())
+
+				Expect(filepath.Join(depsDir, depsIdx, ".nuget", "fileA.txt")).To(BeARegularFile())
+			})
+
+			It("keeps the dotnet install of apps that retain the SDK", func() {
+				Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet", "sdk"), 0755)).To(Succeed())
+				Expect(os.Symlink(filepath.Join(depsDir, depsIdx, "dotnet"), filepath.Join(depsDir, depsIdx, "bin", "dotnet"))).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  retain-sdk: true\n"), 0644)).To(Succeed())
+
+				Expect(finalizer.CleanStagingArea()).To(Succeed())
+
+				Expect(filepath.Join(depsDir, depsIdx, "dotnet", "sdk")).To(BeADirectory())
+				Expect(filepath.Join(depsDir, depsIdx, "bin", "dotnet")).To(BeADirectory())
+				Expect(buffer.String()).To(ContainSubstring("Keeping the .NET SDK in the droplet and on PATH"))
+			})
+
+			It("strips a runtime-minimal droplet down to what the start command needs", func() {
+				for _, name := range []string{
+					"dotnet/dotnet", "dotnet/sdk/8.0.100/dotnet.dll",
+					"dotnet/shared/Microsoft.NETCore.App/8.0.0/System.dll", "dotnet/shared/Microsoft.NETCore.App/8.0.1/System.dll",
+					"dotnet/shared/Microsoft.AspNetCore.App/8.0.0/Kestrel.dll", "dotnet/shared/Microsoft.AspNetCore.App/8.0.1/Kestrel.dll", "dotnet/shared/Microsoft.WindowsDesktop.App/8.0.1/Forms.dll",
+					"node/bin/node", "dotnet_publish/app.dll",
+				} {
+					Expect(os.MkdirAll(filepath.Dir(filepath.Join(depsDir, depsIdx, name)), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, name), []byte("contents"), 0755)).To(Succeed())
+				}
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet_publish", "app.runtimeconfig.json"), []byte(`{"runtimeOptions": {"framework": {"name": "Microsoft.AspNetCore.App", "version": "8.0.0"}}}`), 0644)).To(Succeed())
+				Expect(os.Setenv("INSTALL_NODE", "true")).To(Succeed())
+				defer os.Unsetenv("INSTALL_NODE")
+				Expect(os.Setenv("DROPLET_MODE", "runtime-minimal")).To(Succeed())
+				defer os.Unsetenv("DROPLET_MODE")
+
+				Expect(finalizer.CleanStagingArea()).To(Succeed())
+
+				for _, name := range []string{"dotnet/sdk", "dotnet/shared/Microsoft.AspNetCore.App/8.0.0", "dotnet/shared/Microsoft.WindowsDesktop.App", "node"} {
+					Expect(filepath.Join(depsDir, depsIdx, name)).ToNot(BeAnExistingFile())
+				}
+				for _, name := range []string{"dotnet/dotnet", "dotnet/shared/Microsoft.NETCore.App/8.0.0", "dotnet/shared/Microsoft.NETCore.App/8.0.1", "dotnet/shared/Microsoft.AspNetCore.App/8.0.1"} {
+					Expect(filepath.Join(depsDir, depsIdx, name)).To(BeAnExistingFile())
+				}
+				Expect(buffer.String()).To(ContainSubstring("Minimized the droplet from 0MB to 0MB"))
+			})
+
+			It("keeps the shared frameworks a runtime-minimal app's framework is built on", func() {
+				for _, name := range []string{
+					"dotnet/shared/Microsoft.NETCore.App/2.1.0/System.dll", "dotnet/shared/Microsoft.NETCore.App/2.1.2/System.dll",
+					"dotnet/shared/Microsoft.AspNetCore.App/2.1.0/Kestrel.dll", "dotnet/shared/Microsoft.AspNetCore.App/2.1.2/Kestrel.dll",
+					"dotnet/shared/Microsoft.AspNetCore.All/2.1.2/Microsoft.AspNetCore.All.dll", "dotnet_publish/app.dll",
+				} {
+					Expect(os.MkdirAll(filepath.Dir(filepath.Join(depsDir, depsIdx, name)), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, name), []byte("contents"), 0755)).To(Succeed())
+				}
+				Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet", "shared", "Microsoft.AspNetCore.All", "2.1.2", "Microsoft.AspNetCore.All.runtimeconfig.json"), []byte(`{"runtimeOptions": {"framework": {"name": "Microsoft.AspNetCore.App", "version": "2.1.2"}}}`), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet", "shared", "Microsoft.AspNetCore.App", "2.1.2", "Microsoft.AspNetCore.App.runtimeconfig.json"), []byte(`{"runtimeOptions": {"framework": {"name": "Microsoft.NETCore.App", "version": "2.1.2"}}}`), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet_publish", "app.runtimeconfig.json"), []byte(`{"runtimeOptions": {"framework": {"name": "Microsoft.AspNetCore.All", "version": "2.1.0"}}}`), 0644)).To(Succeed())
+				Expect(os.Setenv("DROPLET_MODE", "runtime-minimal")).To(Succeed())
+				defer os.Unsetenv("DROPLET_MODE")
+
+				Expect(finalizer.CleanStagingArea()).To(Succeed())
+
+				for _, name := range []string{"Microsoft.AspNetCore.All/2.1.2", "Microsoft.AspNetCore.App/2.1.2", "Microsoft.NETCore.App/2.1.2"} {
+					Expect(filepath.Join(depsDir, depsIdx, "dotnet", "shared", name)).To(BeAnExistingFile())
+				}
+				for _, name := range []string{"Microsoft.AspNetCore.App/2.1.0", "Microsoft.NETCore.App/2.1.0"} {
+					Expect(filepath.Join(depsDir, depsIdx, "dotnet", "shared", name)).ToNot(BeAnExistingFile())
+				}
+			})
+
+			It("refuses to retain the SDK in a runtime-minimal droplet", func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  retain-sdk: true\n  droplet: runtime-minimal\n"), 0644)).To(Succeed())
+				Expect(finalizer.CleanStagingArea()).To(MatchError("the SDK can't be retained in a runtime-minimal droplet"))
 			})
 
 			It("deletes symlinks to .nuget directory from lib directory", func() {
@@ -0,0 +1,172 @@
+package finalize
+
+import (
+	"dotnetcore/config"
+	"dotnetcore/project"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// targetFrameworkArgs passes the framework chosen for a multi-targeted
+// main project to dotnet publish
+func (f *Finalizer) targetFrameworkArgs(mainProject string) ([]string, error) {
+	tfm, reason, err := f.targetFramework(mainProject)
+	if err != nil || tfm == "" {
+		return []string{}, err
+	}
+	f.Log.Info("Publishing for target framework %s, %s", tfm, reason)
+	return []string{"-f", tfm}, nil
+}
+
+// targetFramework picks the framework to publish a multi-targeted main
+// project for: TARGET_FRAMEWORK or target-framework in buildpack.yml, or
+// else the newest one the buildpack has a runtime for. It is empty for
+// projects with a single target framework.
+func (f *Finalizer) targetFramework(mainProject string) (string, string, error) {
+	if mainProject == "" {
+		return "", "", nil
+	}
+	frameworks, err := f.Project.TargetFrameworks(mainProject)
+	if err != nil {
+		return "", "", err
+	}
+
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return "", "", err
+	}
+	configured := buildpackYML.DotnetCore.TargetFramework
+	if env := os.Getenv("TARGET_FRAMEWORK"); env != "" {
+		configured = env
+	}
+
+	if configured != "" {
+		for _, tfm := range frameworks {
+			if strings.EqualFold(tfm, configured) {
+				return tfm, "as configured", nil
+			}
+		}
+		return "", "", fmt.Errorf("target framework %s is not one of the project's target frameworks %s", configured, strings.Join(frameworks, ", "))
+	}
+	if len(frameworks) < 2 {
+		return "", "", nil
+	}
+
+	provided := f.providedFrameworkVersions()
+	chosen, chosenVersion := "", ""
+	for _, tfm := range frameworks {
+		version, ok := project.FrameworkVersion(tfm)
+		if !ok || !runtimeProvided(provided, version) {
+			continue
+		}
+		if chosen == "" || compareVersions(version, chosenVersion) > 0 {
+			chosen, chosenVersion = tfm, version
+		}
+	}
+	if chosen == "" {
+		return "", "", fmt.Errorf("none of the project's target frameworks %s can run on the runtimes this buildpack provides: %s", strings.Join(frameworks, ", "), describeVersions(provided))
+	}
+	return chosen, fmt.Sprintf("the newest of %s this buildpack supports", strings.Join(frameworks, ", ")), nil
+}
+
+// checkTargetFramework fails before restoring when the buildpack has no
+// runtime the main project's target framework can run on
+func (f *Finalizer) checkTargetFramework(mainProject string) error {
+	tfm, _, err := f.targetFramework(mainProject)
+	if err != nil || tfm != "" {
+		// Multi-targeted projects are checked when choosing the framework
+		return err
+	}
+	frameworks, err := f.Project.TargetFrameworks(mainProject)
+	if err != nil || len(frameworks) != 1 {
+		return err
+	}
+
+	version, ok := project.FrameworkVersion(frameworks[0])
+	if !ok {
+		return nil
+	}
+	if provided := f.providedFrameworkVersions(); !runtimeProvided(provided, version) {
+		return fmt.Errorf("%s requested but this buildpack provides %s", frameworks[0], describeVersions(provided))
+	}
+	return nil
+}
+
+// runtimeProvided reports whether a runtime for the major.minor version, or
+// a later minor version it rolls forward to, is provided. A nil list means
+// the provided runtimes are unknown.
+func runtimeProvided(provided []string, version string) bool {
+	if provided == nil {
+		return true
+	}
+	major := strings.SplitN(version, ".", 2)[0]
+	for _, candidate := range provided {
+		if strings.SplitN(candidate, ".", 2)[0] == major && compareVersions(candidate, version) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// providedFrameworkVersions lists the major.minor versions of the runtimes
+// in the manifest, or nil when there is no manifest to ask
+func (f *Finalizer) providedFrameworkVersions() []string {
+	if f.Manifest == nil {
+		return nil
+	}
+	versions := []string{}
+	for _, version := range f.Manifest.AllDependencyVersions("dotnet-framework") {
+		if majorMinor := strings.Join(strings.SplitN(version, ".", 3)[:2], "."); !contains(versions, majorMinor) {
+			versions = append(versions, majorMinor)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return compareVersions(versions[i], versions[j]) < 0 })
+	return versions
+}
+
+func describeVersions(versions []string) string {
+	if len(versions) == 0 {
+		return "none"
+	}
+	described := make([]string, len(versions))
+	for i, version := range versions {
+		described[i] = version + ".x"
+	}
+	if len(described) == 1 {
+		return described[0]
+	}
+	return strings.Join(described[:len(described)-1], ", ") + " and " + described[len(described)-1]
+}
+
+// compareVersions compares dotted numeric versions
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
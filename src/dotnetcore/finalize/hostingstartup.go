@@ -0,0 +1,113 @@
+package finalize
+
+import (
+	"dotnetcore/config"
+	"dotnetcore/jsonc"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// InjectHostingStartup adds the hosting startup assemblies that buildpacks
+// earlier in the chain leave in the hosting_startup directory of their dep
+// dir to ASP.NET Core apps, so platforms can add middleware to every app.
+// The assemblies are copied next to the app, listed in an additional deps
+// file so the runtime resolves them, and named in
+// ASPNETCORE_HOSTINGSTARTUPASSEMBLIES at launch. Apps opt out with
+// hosting-startup: false in buildpack.yml.
+func (f *Finalizer) InjectHostingStartup() error {
+	assemblies, err := filepath.Glob(filepath.Join(filepath.Dir(f.Stager.DepDir()), "*", "hosting_startup", "*.dll"))
+	if err != nil || len(assemblies) == 0 {
+		return err
+	}
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	if enabled := buildpackYML.DotnetCore.HostingStartup; enabled != nil && !*enabled {
+		f.Log.Info("Skipping hosting startup assemblies, as buildpack.yml disables them")
+		return nil
+	}
+	if frameworks, err := f.runtimeFrameworks(); err != nil {
+		return err
+	} else if _, ok := frameworks["Microsoft.AspNetCore.App"]; !ok {
+		f.Log.Debug("Skipping hosting startup assemblies for an app that doesn't run on ASP.NET Core")
+		return nil
+	}
+
+	dir, err := f.publishOutputDir()
+	if err != nil {
+		return err
+	}
+	target, err := runtimeTarget(dir)
+	if err != nil {
+		return err
+	} else if target == "" {
+		f.Log.Warning("Skipping hosting startup assemblies, as the app has no deps.json naming its runtime target")
+		return nil
+	}
+
+	f.Log.BeginStep("Injecting hosting startup assemblies")
+	var names []string
+	libraries := map[string]interface{}{}
+	runtimes := map[string]interface{}{}
+	for _, assembly := range assemblies {
+		name := strings.TrimSuffix(filepath.Base(assembly), ".dll")
+		if exists, err := libbuildpack.FileExists(filepath.Join(dir, filepath.Base(assembly))); err != nil {
+			return err
+		} else if exists {
+			f.Log.Warning("Skipping hosting startup assembly %s, as the app has an assembly of that name", name)
+			continue
+		}
+		if err := libbuildpack.CopyFile(assembly, filepath.Join(dir, filepath.Base(assembly))); err != nil {
+			return err
+		}
+		f.Log.Info("Adding %s", name)
+		names = append(names, name)
+		library := name + "/1.0.0"
+		runtimes[library] = map[string]interface{}{"runtime": map[string]interface{}{filepath.Base(assembly): map[string]interface{}{}}}
+		libraries[library] = map[string]interface{}{"type": "project", "serviceable": false, "sha512": ""}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	deps, err := json.MarshalIndent(map[string]interface{}{
+		"runtimeTarget": map[string]string{"name": target},
+		"targets":       map[string]interface{}{target: runtimes},
+		"libraries":     libraries,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(f.Stager.DepDir(), "hosting-startup.deps.json"), deps, 0644); err != nil {
+		return err
+	}
+
+	depsFile := filepath.Join("$DEPS_DIR", f.Stager.DepsIdx(), "hosting-startup.deps.json")
+	script := fmt.Sprintf("export ASPNETCORE_HOSTINGSTARTUPASSEMBLIES=\"${ASPNETCORE_HOSTINGSTARTUPASSEMBLIES:+$ASPNETCORE_HOSTINGSTARTUPASSEMBLIES;}%s\"\n", strings.Join(names, ";"))
+	script += fmt.Sprintf("export DOTNET_ADDITIONAL_DEPS=\"${DOTNET_ADDITIONAL_DEPS:+$DOTNET_ADDITIONAL_DEPS;}%s\"\n", depsFile)
+	return f.Stager.WriteProfileD("hosting-startup.sh", script)
+}
+
+// runtimeTarget returns the name of the runtime target in the deps.json of
+// the app in dir, such as .NETCoreApp,Version=v8.0
+func runtimeTarget(dir string) (string, error) {
+	depsFiles, err := filepath.Glob(filepath.Join(dir, "*.deps.json"))
+	if err != nil || len(depsFiles) != 1 {
+		return "", err
+	}
+	obj := struct {
+		RuntimeTarget struct {
+			Name string `json:"name"`
+		} `json:"runtimeTarget"`
+	}{}
+	if err := jsonc.Load(depsFiles[0], &obj); err != nil {
+		return "", err
+	}
+	return obj.RuntimeTarget.Name, nil
+}
@@ -0,0 +1,135 @@
+package finalize
+
+import (
+	"dotnetcore/config"
+	"dotnetcore/jsonc"
+	"dotnetcore/project"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// packageLicense is an entry of the NuGet license report
+type packageLicense struct {
+	ID         string `json:"id"`
+	Version    string `json:"version"`
+	License    string `json:"license,omitempty"`
+	LicenseURL string `json:"licenseUrl,omitempty"`
+}
+
+// WriteLicenseReport records the license of every NuGet package restored
+// for the main project, from the package's nuspec, in nuget-licenses.json
+// in the dep dir. PRINT_LICENSE_REPORT or license-report in buildpack.yml
+// also prints it.
+func (f *Finalizer) WriteLicenseReport() error {
+	if published, err := f.Project.IsPublished(); err != nil || published {
+		return err
+	}
+	mainProject, err := f.Project.MainPath()
+	if err != nil || mainProject == "" {
+		return err
+	}
+	assetsFile := filepath.Join(filepath.Dir(mainProject), "obj", "project.assets.json")
+	if exists, err := libbuildpack.FileExists(assetsFile); err != nil || !exists {
+		return err
+	}
+
+	assets := struct {
+		Libraries map[string]struct {
+			Type string `json:"type"`
+			Path string `json:"path"`
+		} `json:"libraries"`
+		PackageFolders map[string]interface{} `json:"packageFolders"`
+	}{}
+	if err := jsonc.Load(assetsFile, &assets); err != nil {
+		return err
+	}
+
+	report := []packageLicense{}
+	for name, library := range assets.Libraries {
+		if library.Type != "package" {
+			continue
+		}
+		parts := strings.SplitN(name, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		license := packageLicense{ID: parts[0], Version: parts[1]}
+		for folder := range assets.PackageFolders {
+			nuspec := filepath.Join(folder, filepath.FromSlash(library.Path), strings.ToLower(parts[0])+".nuspec")
+			if found, err := readNuspecLicense(nuspec, &license); err != nil {
+				f.Log.Warning("Unable to read the license of %s %s: %s", license.ID, license.Version, err)
+				break
+			} else if found {
+				break
+			}
+		}
+		report = append(report, license)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if !strings.EqualFold(report[i].ID, report[j].ID) {
+			return strings.ToLower(report[i].ID) < strings.ToLower(report[j].ID)
+		}
+		return report[i].Version < report[j].Version
+	})
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(f.Stager.DepDir(), "nuget-licenses.json"), data, 0644); err != nil {
+		return err
+	}
+
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	if !buildpackYML.DotnetCore.LicenseReport.Print && os.Getenv("PRINT_LICENSE_REPORT") != "true" {
+		f.Log.Debug("Wrote the licenses of %d NuGet packages to nuget-licenses.json", len(report))
+		return nil
+	}
+	f.Log.BeginStep("Licenses of NuGet packages")
+	for _, license := range report {
+		terms := license.License
+		if terms == "" {
+			terms = license.LicenseURL
+		}
+		if terms == "" {
+			terms = "unknown"
+		}
+		f.Log.Info("%s %s: %s", license.ID, license.Version, terms)
+	}
+	return nil
+}
+
+// readNuspecLicense fills in the license from the nuspec at path, reporting
+// whether it exists. Packages with a license file name it. Nuspecs are read
+// like project files, so those in a legacy encoding are decoded too.
+func readNuspecLicense(path string, license *packageLicense) (bool, error) {
+	nuspec := struct {
+		Metadata struct {
+			License struct {
+				Type  string `xml:"type,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"license"`
+			LicenseURL string `xml:"licenseUrl"`
+		} `xml:"metadata"`
+	}{}
+	if err := project.UnmarshalProjFile(path, &nuspec); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	license.License = strings.TrimSpace(nuspec.Metadata.License.Value)
+	if nuspec.Metadata.License.Type == "file" && license.License != "" {
+		license.License = "file " + license.License
+	}
+	license.LicenseURL = strings.TrimSpace(nuspec.Metadata.LicenseURL)
+	return true, nil
+}
@@ -0,0 +1,233 @@
+package finalize
+
+import (
+	"dotnetcore/config"
+	"dotnetcore/runtimeconfig"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// sdkDirs are the parts of the dotnet install only the SDK uses
+var sdkDirs = []string{"sdk", "sdk-manifests", "packs", "templates"}
+
+// runtimeMinimal reports whether the droplet is stripped down to what the
+// start command needs, as DROPLET_MODE or droplet in buildpack.yml asks
+// with runtime-minimal
+func (f *Finalizer) runtimeMinimal() (bool, error) {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return false, err
+	}
+	mode := buildpackYML.DotnetCore.Droplet
+	if env := os.Getenv("DROPLET_MODE"); env != "" {
+		mode = env
+	}
+	switch mode {
+	case "", "default":
+		return false, nil
+	case "runtime-minimal":
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown droplet mode %s, expected default or runtime-minimal", mode)
+}
+
+// dropletSize is the size of the app and of the buildpack's dependencies
+func (f *Finalizer) dropletSize() (int64, error) {
+	var total int64
+	for _, dir := range []string{f.Stager.BuildDir(), f.Stager.DepDir()} {
+		size, err := diskSize(dir)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// minimizeDotnet removes the SDK and the shared framework versions the app
+// won't run on from the dotnet install kept for the start command
+func (f *Finalizer) minimizeDotnet() error {
+	dotnetDir := filepath.Join(f.Stager.DepDir(), "dotnet")
+	if exists, err := libbuildpack.FileExists(dotnetDir); err != nil || !exists {
+		return err
+	}
+	for _, dir := range sdkDirs {
+		if exists, err := libbuildpack.FileExists(filepath.Join(dotnetDir, dir)); err != nil {
+			return err
+		} else if exists {
+			f.Log.Info("Removing dotnet/%s", dir)
+			if err := os.RemoveAll(filepath.Join(dotnetDir, dir)); err != nil {
+				return err
+			}
+		}
+	}
+
+	frameworks, err := f.runtimeFrameworks()
+	if err != nil || len(frameworks) == 0 {
+		return err
+	}
+	sharedDir := filepath.Join(dotnetDir, "shared")
+	names, err := ioutil.ReadDir(sharedDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	kept, err := keptFrameworks(sharedDir, frameworks)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		versions, referenced := kept[name.Name()]
+		// The app's other frameworks are built on Microsoft.NETCore.App
+		if !referenced && name.Name() != "Microsoft.NETCore.App" {
+			f.Log.Info("Removing unused shared framework %s", name.Name())
+			if err := os.RemoveAll(filepath.Join(sharedDir, name.Name())); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(versions) != 1 {
+			continue
+		}
+		installed, err := installedVersions(filepath.Join(sharedDir, name.Name()))
+		if err != nil {
+			return err
+		}
+		for _, version := range installed {
+			if version == versions[0] {
+				continue
+			}
+			f.Log.Info("Removing shared framework %s %s, as the app runs on %s", name.Name(), version, versions[0])
+			if err := os.RemoveAll(filepath.Join(sharedDir, name.Name(), version)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// keptFrameworks returns the installed versions of each shared framework
+// the app runs on, following the runtimeconfig.json of every kept version
+// to the frameworks it is built on in turn, e.g. Microsoft.AspNetCore.All
+// on Microsoft.AspNetCore.App. A framework requested at several versions
+// keeps all of them.
+func keptFrameworks(sharedDir string, frameworks map[string]string) (map[string][]string, error) {
+	requested := map[string]string{}
+	var queue []string
+	for name, version := range frameworks {
+		requested[name] = version
+		queue = append(queue, name)
+	}
+
+	kept := map[string][]string{}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		installed, err := installedVersions(filepath.Join(sharedDir, name))
+		if err != nil {
+			return nil, err
+		}
+		versions := installed
+		if keep := latestPatch(requested[name], installed); keep != "" {
+			versions = []string{keep}
+		}
+		kept[name] = versions
+
+		for _, version := range versions {
+			configFile := filepath.Join(sharedDir, name, version, name+".runtimeconfig.json")
+			if exists, err := libbuildpack.FileExists(configFile); err != nil {
+				return nil, err
+			} else if !exists {
+				continue
+			}
+			config, err := runtimeconfig.Load(configFile)
+			if err != nil {
+				return nil, err
+			}
+			for _, framework := range config.Frameworks {
+				want := framework.Version
+				if !config.RollsForwardByDefault() {
+					want = ""
+				}
+				previous, seen := requested[framework.Name]
+				if !seen {
+					requested[framework.Name] = want
+					queue = append(queue, framework.Name)
+				} else if previous != "" && previous != want {
+					requested[framework.Name] = ""
+					queue = append(queue, framework.Name)
+				}
+			}
+		}
+	}
+	return kept, nil
+}
+
+// installedVersions lists the versions of a shared framework in dir
+func installedVersions(dir string) ([]string, error) {
+	versions, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var installed []string
+	for _, version := range versions {
+		installed = append(installed, version.Name())
+	}
+	return installed, nil
+}
+
+// runtimeFrameworks returns the versions of the shared frameworks the
+// published app's runtimeconfig.json references, by name. The versions are
+// empty when the app changes how it rolls forward.
+func (f *Finalizer) runtimeFrameworks() (map[string]string, error) {
+	dir, err := f.publishOutputDir()
+	if err != nil {
+		return nil, err
+	}
+	configFile, err := runtimeconfig.FindIn(dir)
+	if err != nil || configFile == "" {
+		return nil, err
+	}
+	config, err := runtimeconfig.Load(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the default roll forward is predictable enough to drop versions
+	frameworks := map[string]string{}
+	for _, framework := range config.Frameworks {
+		if config.RollsForwardByDefault() {
+			frameworks[framework.Name] = framework.Version
+		} else {
+			frameworks[framework.Name] = ""
+		}
+	}
+	return frameworks, nil
+}
+
+// latestPatch returns the installed version the host rolls the requested
+// version forward to by default: the latest patch of its major.minor. It is
+// empty when none is installed, or nothing was requested, so every
+// version is kept.
+func latestPatch(requested string, installed []string) string {
+	parts := strings.SplitN(requested, ".", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	prefix := parts[0] + "." + parts[1] + "."
+	latest := ""
+	for _, version := range installed {
+		if strings.HasPrefix(version, prefix) && compareVersions(version, requested) >= 0 && (latest == "" || compareVersions(version, latest) > 0) {
+			latest = version
+		}
+	}
+	return latest
+}
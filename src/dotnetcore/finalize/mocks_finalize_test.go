@@ -45,6 +45,18 @@ func (mr *MockStagerMockRecorder) BuildDir() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuildDir", reflect.TypeOf((*MockStager)(nil).BuildDir))
 }
 
+// CacheDir mocks base method
+func (m *MockStager) CacheDir() string {
+	ret := m.ctrl.Call(m, "CacheDir")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// CacheDir indicates an expected call of CacheDir
+func (mr *MockStagerMockRecorder) CacheDir() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CacheDir", reflect.TypeOf((*MockStager)(nil).CacheDir))
+}
+
 // DepsIdx mocks base method
 func (m *MockStager) DepsIdx() string {
 	ret := m.ctrl.Call(m, "DepsIdx")
@@ -150,3 +162,38 @@ func (m *MockDotnetFramework) Install() error {
 func (mr *MockDotnetFrameworkMockRecorder) Install() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Install", reflect.TypeOf((*MockDotnetFramework)(nil).Install))
 }
+
+// MockManifest is a mock of Manifest interface
+type MockManifest struct {
+	ctrl     *gomock.Controller
+	recorder *MockManifestMockRecorder
+}
+
+// MockManifestMockRecorder is the mock recorder for MockManifest
+type MockManifestMockRecorder struct {
+	mock *MockManifest
+}
+
+// NewMockManifest creates a new mock instance
+func NewMockManifest(ctrl *gomock.Controller) *MockManifest {
+	mock := &MockManifest{ctrl: ctrl}
+	mock.recorder = &MockManifestMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockManifest) EXPECT() *MockManifestMockRecorder {
+	return m.recorder
+}
+
+// AllDependencyVersions mocks base method
+func (m *MockManifest) AllDependencyVersions(arg0 string) []string {
+	ret := m.ctrl.Call(m, "AllDependencyVersions", arg0)
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// AllDependencyVersions indicates an expected call of AllDependencyVersions
+func (mr *MockManifestMockRecorder) AllDependencyVersions(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AllDependencyVersions", reflect.TypeOf((*MockManifest)(nil).AllDependencyVersions), arg0)
+}
@@ -0,0 +1,48 @@
+package finalize
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// paketVersion is the Paket release installed for apps that don't have
+// Paket as a local tool. Paket 5 runs on .NET Core 2.1; later releases
+// need newer runtimes than the buildpack has.
+const paketVersion = "5.257.0"
+
+// RestorePaket restores the packages of apps that manage their dependencies
+// with Paket, before dotnet restore picks up the references it generates.
+// Paket comes from the app's local tools when its manifest lists it, and
+// otherwise paketVersion is installed into the deps dir.
+func (f *Finalizer) RestorePaket() error {
+	if published, err := f.Project.IsPublished(); err != nil || published {
+		return err
+	}
+	buildDir := f.Stager.BuildDir()
+	if exists, err := libbuildpack.FileExists(filepath.Join(buildDir, "paket.dependencies")); err != nil || !exists {
+		return err
+	}
+
+	f.Log.BeginStep("Restoring packages with Paket")
+	command := "restore"
+	if exists, err := libbuildpack.FileExists(filepath.Join(buildDir, "paket.lock")); err != nil {
+		return err
+	} else if !exists {
+		f.Log.Warning("paket.lock is missing, so Paket will resolve the latest versions allowed by paket.dependencies; commit paket.lock for repeatable builds")
+		command = "install"
+	}
+
+	paket, err := f.toolCommand("Paket", paketVersion, "paket")
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(paket[0], append(paket[1:], command)...)
+	cmd.Dir = buildDir
+	cmd.Env = f.shellEnvironment()
+	cmd.Stdout = indentWriter(os.Stdout)
+	cmd.Stderr = indentWriter(os.Stderr)
+	return f.Command.Run(cmd)
+}
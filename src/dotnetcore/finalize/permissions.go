@@ -0,0 +1,41 @@
+package finalize
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// NormalizePermissions makes the installed dependencies and publish output
+// in the dep dir readable by everyone and writable only by their owner,
+// whatever the archives they came from contained: directories and
+// executables get 0755, other files 0644, and setuid and setgid bits are
+// dropped. Symlinks are left alone.
+func (f *Finalizer) NormalizePermissions() error {
+	var changed int
+	if err := filepath.Walk(f.Stager.DepDir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		mode := info.Mode()
+		var want os.FileMode
+		switch {
+		case mode.IsDir(), mode.IsRegular() && mode&0111 != 0:
+			want = 0755
+		case mode.IsRegular():
+			want = 0644
+		default:
+			return nil
+		}
+		if mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky) == want {
+			return nil
+		}
+		changed++
+		return os.Chmod(path, want)
+	}); err != nil {
+		return err
+	}
+	if changed > 0 {
+		f.Log.Info("Normalized the permissions of %d files and directories", changed)
+	}
+	return nil
+}
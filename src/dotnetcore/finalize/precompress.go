@@ -0,0 +1,112 @@
+package finalize
+
+import (
+	"compress/gzip"
+	"dotnetcore/config"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// precompressMinSize is the size below which compressing a file saves
+// less than the extra request headers cost
+const precompressMinSize = 1024
+
+// compressedExtensions are file types that are compressed already
+var compressedExtensions = map[string]bool{
+	".gz": true, ".br": true, ".zip": true, ".7z": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".avif": true,
+	".woff": true, ".woff2": true, ".mp3": true, ".mp4": true, ".webm": true, ".ogg": true,
+}
+
+// PrecompressStaticAssets writes a .gz copy of each compressible file under
+// the published wwwroot, and a .br copy when brotli is enabled and the
+// brotli CLI is on the PATH, so the app can serve precompressed assets.
+// PRECOMPRESS_STATIC_ASSETS=true enables it as well as buildpack.yml.
+func (f *Finalizer) PrecompressStaticAssets() error {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	precompress := buildpackYML.DotnetCore.Precompress
+	if !precompress.Enabled && os.Getenv("PRECOMPRESS_STATIC_ASSETS") != "true" {
+		return nil
+	}
+	dir, err := f.publishOutputDir()
+	if err != nil {
+		return err
+	}
+	wwwroot := filepath.Join(dir, "wwwroot")
+	if info, err := os.Stat(wwwroot); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if !info.IsDir() {
+		return nil
+	}
+
+	f.Log.BeginStep("Precompressing static assets")
+	brotli := ""
+	if precompress.Brotli {
+		if brotli, err = exec.LookPath("brotli"); err != nil {
+			f.Log.Warning("brotli was requested but is not on the PATH, only writing gzip files")
+			brotli = ""
+		}
+	}
+
+	var compressed int
+	if err := filepath.Walk(wwwroot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Size() < precompressMinSize || compressedExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		if err := gzipFile(path, info.Mode()); err != nil {
+			return err
+		}
+		if brotli != "" {
+			cmd := exec.Command(brotli, "--best", "--keep", "--force", path)
+			cmd.Stdout = indentWriter(os.Stdout)
+			cmd.Stderr = indentWriter(os.Stderr)
+			if err := f.Command.Run(cmd); err != nil {
+				return err
+			}
+		}
+		compressed++
+		return nil
+	}); err != nil {
+		return err
+	}
+	f.Log.Info("Compressed %d files", compressed)
+	return nil
+}
+
+// gzipFile writes path.gz at the best compression level
+func gzipFile(path string, mode os.FileMode) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w, err := gzip.NewWriterLevel(out, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,177 @@
+package finalize
+
+import (
+	"dotnetcore/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// PrunePublishOutput removes IntelliSense XML docs, symbols and satellite
+// assemblies of unwanted cultures from the publish output, as configured
+// under prune in buildpack.yml. PRUNE_LANGUAGES, a comma separated list,
+// overrides the languages to keep. The refs folder is left alone for apps that
+// compile their Razor views at runtime.
+func (f *Finalizer) PrunePublishOutput() error {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	prune := buildpackYML.DotnetCore.Prune
+	if env := os.Getenv("PRUNE_LANGUAGES"); env != "" {
+		prune.Languages = strings.Split(env, ",")
+	}
+	if len(prune.Languages) == 1 && strings.EqualFold(strings.TrimSpace(prune.Languages[0]), "all") {
+		prune.Languages = nil
+	}
+	if !prune.Docs && !prune.Symbols && len(prune.Languages) == 0 {
+		return nil
+	}
+
+	dir, err := f.publishOutputDir()
+	if err != nil {
+		return err
+	}
+	f.Log.BeginStep("Pruning publish output")
+
+	var removed int
+	var saved int64
+	remove := func(path string) error {
+		size, err := diskSize(path)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		removed++
+		saved += size
+		return nil
+	}
+
+	if len(prune.Languages) > 0 {
+		cultures, err := satelliteCultures(dir)
+		if err != nil {
+			return err
+		}
+		var kept []string
+		var satellites int64
+		for _, culture := range cultures {
+			if keepCulture(culture, prune.Languages) {
+				kept = append(kept, culture)
+				continue
+			}
+			before := saved
+			if err := remove(filepath.Join(dir, culture)); err != nil {
+				return err
+			}
+			satellites += saved - before
+		}
+		if len(kept) > 0 {
+			f.Log.Info("Keeping satellite assemblies for %s", strings.Join(kept, ", "))
+		}
+		f.Log.Info("Removed satellite assemblies of %d cultures, saving %dKB", len(cultures)-len(kept), satellites>>10)
+	}
+
+	runtimeCompilation, err := f.Project.RazorRuntimeCompilation()
+	if err != nil {
+		return err
+	} else if runtimeCompilation {
+		f.Log.Info("Keeping refs for Razor runtime compilation")
+	}
+
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if runtimeCompilation && path == filepath.Join(dir, "refs") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if prune.Symbols && strings.HasSuffix(path, ".pdb") {
+			return remove(path)
+		}
+		if prune.Docs && strings.HasSuffix(path, ".xml") {
+			if exists, err := libbuildpack.FileExists(strings.TrimSuffix(path, ".xml") + ".dll"); err != nil {
+				return err
+			} else if exists {
+				return remove(path)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	f.Log.Info("Removed %d files and directories, saving %dKB", removed, saved>>10)
+	return nil
+}
+
+// publishOutputDir is where the app runs from: the publish directory, or
+// the build dir for apps that were pushed already published
+func (f *Finalizer) publishOutputDir() (string, error) {
+	dir, _, err := f.Project.PublishDir()
+	return dir, err
+}
+
+// satelliteCultures returns the subdirectories of dir that only hold
+// satellite (*.resources.dll) assemblies
+func satelliteCultures(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var cultures []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		satellite := len(files) > 0
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(file.Name(), ".resources.dll") {
+				satellite = false
+				break
+			}
+		}
+		if satellite {
+			cultures = append(cultures, entry.Name())
+		}
+	}
+	return cultures, nil
+}
+
+// keepCulture reports whether the culture is one of the languages, or a
+// regional variant of one, such as de-AT for de. None of them are kept for
+// the language none.
+func keepCulture(culture string, languages []string) bool {
+	for _, language := range languages {
+		language = strings.TrimSpace(language)
+		if strings.EqualFold(culture, language) || strings.HasPrefix(strings.ToLower(culture), strings.ToLower(language)+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+func diskSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,113 @@
+package finalize
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ApplyPublishIgnore removes the files matching the patterns in the app's
+// .publishignore from the publish output. Patterns use the syntax of
+// filepath.Match, one per line; those without a slash match names at any
+// depth, the others paths relative to the publish output. Lines starting
+// with # are comments.
+func (f *Finalizer) ApplyPublishIgnore() error {
+	patterns, err := publishIgnorePatterns(filepath.Join(f.Stager.BuildDir(), ".publishignore"))
+	if err != nil || len(patterns) == 0 {
+		return err
+	}
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+
+	dir, err := f.publishOutputDir()
+	if err != nil {
+		return err
+	}
+	// Apps pushed already published run from the build dir, which also
+	// holds the files needed at launch
+	var kept []string
+	if dir == f.Stager.BuildDir() {
+		kept = keptSources
+	}
+
+	f.Log.BeginStep("Removing files matching .publishignore")
+	var removed int
+	var saved int64
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if preserved(rel, kept) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !ignored(rel, patterns) {
+			return nil
+		}
+		size, err := diskSize(path)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		f.Log.Info("Removed %s", rel)
+		removed++
+		saved += size
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	f.Log.Info("Removed %d files and directories, saving %dKB", removed, saved>>10)
+	f.Project.Index().Reset()
+	return nil
+}
+
+func publishIgnorePatterns(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, strings.Trim(filepath.ToSlash(line), "/"))
+	}
+	return patterns, scanner.Err()
+}
+
+// ignored reports whether rel matches one of the .publishignore patterns
+func ignored(rel string, patterns []string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = filepath.Base(rel)
+		}
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
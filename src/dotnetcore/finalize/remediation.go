@@ -0,0 +1,59 @@
+package finalize
+
+import "regexp"
+
+// remediation is a hint printed when a failed command's output matches a
+// known failure signature.
+type remediation struct {
+	signature *regexp.Regexp
+	tip       string
+	url       string
+}
+
+var remediations = []remediation{
+	{
+		signature: regexp.MustCompile(`\bNU1101\b`),
+		tip:       "A package could not be found in any configured source. Check the package name and that NuGet.Config lists the feed hosting it.",
+		url:       "https://docs.microsoft.com/nuget/reference/errors-and-warnings/nu1101",
+	},
+	{
+		signature: regexp.MustCompile(`\bNU1102\b`),
+		tip:       "The requested package version does not exist in the configured sources. Check the version in your project file.",
+		url:       "https://docs.microsoft.com/nuget/reference/errors-and-warnings/nu1102",
+	},
+	{
+		signature: regexp.MustCompile(`\b401 \(Unauthorized\)|\bNU1301\b.*\b401\b`),
+		tip:       "A NuGet feed rejected the request as unauthorized. Add credentials for private feeds to NuGet.Config, for example with packageSourceCredentials.",
+		url:       "https://docs.microsoft.com/nuget/consume-packages/consuming-packages-authenticated-feeds",
+	},
+	{
+		signature: regexp.MustCompile(`\bNETSDK1045\b`),
+		tip:       "The installed SDK does not support the project's target framework. Pin a newer SDK in buildpack.yml or global.json.",
+		url:       "https://docs.microsoft.com/dotnet/core/tools/sdk-errors/netsdk1045",
+	},
+	{
+		signature: regexp.MustCompile(`runtimeconfig\.json\]? (does not exist|was not found)`),
+		tip:       "No .runtimeconfig.json was produced or found. Make sure the main project is an executable (OutputType Exe) rather than a class library.",
+		url:       "https://docs.cloudfoundry.org/buildpacks/dotnet-core/index.html",
+	},
+	{
+		signature: regexp.MustCompile(`(JSON parsing exception occurred in|Invalid runtimeconfig\.json) \[[^\]]*runtimeconfig\.json`),
+		tip:       "The app's .runtimeconfig.json is not valid JSON. Check runtimeconfig.template.json for syntax errors.",
+		url:       "https://docs.microsoft.com/dotnet/core/run-time-config/",
+	},
+}
+
+// matchRemediations returns the remediations whose signature occurs in any
+// of the lines, in table order and without duplicates.
+func matchRemediations(lines []string) []remediation {
+	var matched []remediation
+	for _, r := range remediations {
+		for _, line := range lines {
+			if r.signature.MatchString(line) {
+				matched = append(matched, r)
+				break
+			}
+		}
+	}
+	return matched
+}
@@ -0,0 +1,114 @@
+package finalize
+
+import (
+	"dotnetcore/config"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SmokeTest starts the published app on a free port, when SMOKE_TEST or
+// buildpack.yml asks for it, and fails unless it stays up and listens on
+// the port for the configured time. Worker Services only have to stay up.
+func (f *Finalizer) SmokeTest() error {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	smokeTest := buildpackYML.DotnetCore.SmokeTest
+	if !smokeTest.Enabled && os.Getenv("SMOKE_TEST") != "true" {
+		return nil
+	}
+	if blazor, err := f.Project.IsBlazorWebAssembly(); err != nil || blazor {
+		return err
+	}
+	startCmd, err := f.Project.StartCommand()
+	if err != nil || startCmd == "" {
+		return err
+	}
+	worker, err := f.Project.IsWorkerService()
+	if err != nil {
+		return err
+	}
+	duration := 10 * time.Second
+	if smokeTest.Seconds > 0 {
+		duration = time.Duration(smokeTest.Seconds) * time.Second
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+	path := f.stagedPath(startCmd)
+	cmd := exec.Command(path)
+	if strings.HasSuffix(path, ".dll") {
+		cmd = exec.Command("dotnet", path)
+	}
+	cmd.Dir = filepath.Dir(path)
+	cmd.Env = append(f.shellEnvironment(), "PORT="+strconv.Itoa(port), fmt.Sprintf("ASPNETCORE_URLS=http://127.0.0.1:%d", port))
+	output := &outputTail{}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	f.Log.BeginStep("Smoke testing the app for %s", duration)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	stop := func() {
+		cmd.Process.Kill()
+		<-exited
+	}
+
+	listening := worker
+	deadline := time.After(duration)
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-exited:
+			message := "the app exited during the smoke test"
+			if err != nil {
+				message += fmt.Sprintf(" (%s)", err)
+			}
+			return f.smokeTestError(message, output)
+		case <-ticker.C:
+			if !listening {
+				if conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
+					conn.Close()
+					listening = true
+				}
+			}
+		case <-deadline:
+			stop()
+			if !listening {
+				return f.smokeTestError(fmt.Sprintf("the app did not listen on port %d within %s", port, duration), output)
+			}
+			f.Log.Info("The app started and kept running")
+			return nil
+		}
+	}
+}
+
+// smokeTestError repeats the app's last output in the staging log
+func (f *Finalizer) smokeTestError(message string, output *outputTail) error {
+	for _, line := range output.Lines() {
+		f.Log.Info("%s", line)
+	}
+	return fmt.Errorf("%s", message)
+}
+
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,101 @@
+package finalize
+
+import (
+	"dotnetcore/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// keptSources are needed at launch whatever the app preserves: the release
+// step, profile scripts and files read by the launch environment helper
+var keptSources = []string{".*", "tmp", "Procfile", "buildpack.yml", "service-bindings.json"}
+
+// RemoveSources deletes the app's sources from the build dir after publish,
+// when enabled in buildpack.yml, keeping the preserved paths. Apps pushed
+// already published run from the build dir and are left alone.
+func (f *Finalizer) RemoveSources() error {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	sources := buildpackYML.DotnetCore.Sources
+	if !sources.Remove {
+		return nil
+	}
+	if published, err := f.Project.IsPublished(); err != nil || published {
+		return err
+	}
+	for _, pattern := range sources.Preserve {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+
+	f.Log.BeginStep("Removing sources")
+	buildDir := f.Stager.BuildDir()
+	preserve := append(append([]string{}, keptSources...), sources.Preserve...)
+	// The app runs from a publish dir inside the app
+	publishDir, _, err := f.Project.PublishDir()
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(buildDir, publishDir); err == nil && !strings.HasPrefix(rel, "..") {
+		preserve = append(preserve, filepath.ToSlash(rel))
+	}
+	var dirs []string
+	if err := filepath.Walk(buildDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == buildDir {
+			return err
+		}
+		rel, err := filepath.Rel(buildDir, path)
+		if err != nil {
+			return err
+		}
+		if preserved(rel, preserve) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		return os.Remove(path)
+	}); err != nil {
+		return err
+	}
+
+	// Deepest first, so parents are empty by the time they are reached;
+	// directories still holding preserved files are kept
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		if err := os.Remove(dir); err != nil && !isNotEmpty(err) {
+			return err
+		}
+	}
+	f.Project.Index().Reset()
+	return nil
+}
+
+// preserved reports whether rel, or a directory it is in, matches one of
+// the patterns. Top level patterns without a slash, like ".*", only match
+// entries at the root.
+func preserved(rel string, patterns []string) bool {
+	for path := rel; path != "."; path = filepath.Dir(path) {
+		for _, pattern := range patterns {
+			if matched, _ := filepath.Match(pattern, path); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isNotEmpty(err error) bool {
+	pathErr, ok := err.(*os.PathError)
+	return ok && pathErr.Err == syscall.ENOTEMPTY
+}
@@ -0,0 +1,148 @@
+package finalize
+
+import (
+	"crypto/sha256"
+	"dotnetcore/config"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// BuildSpa builds the frontend of ASP.NET Core SPA template apps, found
+// through the SpaRoot property of the main project, before publishing.
+// node_modules is cached between builds while package-lock.json is
+// unchanged.
+func (f *Finalizer) BuildSpa() error {
+	spaRoot, err := f.spaRoot()
+	if err != nil || spaRoot == "" {
+		return err
+	}
+
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	spa := buildpackYML.DotnetCore.Spa
+	if spa.Build != nil && !*spa.Build {
+		return nil
+	}
+	script := spa.Script
+	if script == "" {
+		script = "build"
+	}
+
+	f.Log.BeginStep("Building SPA in %s", spaRoot)
+
+	cacheDir := filepath.Join(f.Stager.CacheDir(), "spa")
+	lockHash, err := fileHash(filepath.Join(spaRoot, "package-lock.json"))
+	if err != nil {
+		return err
+	}
+	cached, err := f.restoreNodeModules(spaRoot, cacheDir, lockHash)
+	if err != nil {
+		return err
+	}
+
+	if !cached {
+		install := "install"
+		if lockHash != "" {
+			install = "ci"
+		}
+		if err := f.runNpm(spaRoot, install); err != nil {
+			return err
+		}
+		if err := f.saveNodeModules(spaRoot, cacheDir, lockHash); err != nil {
+			return err
+		}
+	}
+
+	return f.runNpm(spaRoot, "run", script)
+}
+
+// spaRoot returns the absolute SpaRoot directory of the main project, if
+// it has one with a package.json
+func (f *Finalizer) spaRoot() (string, error) {
+	if published, err := f.Project.IsPublished(); err != nil || published {
+		return "", err
+	}
+	mainPath, err := f.Project.MainPath()
+	if err != nil || mainPath == "" {
+		return "", err
+	}
+	spaRoot, err := f.Project.ProjectProperty(mainPath, "SpaRoot")
+	if err != nil || spaRoot == "" {
+		return "", err
+	}
+
+	dir := filepath.Join(filepath.Dir(mainPath), filepath.FromSlash(strings.Replace(spaRoot, `\`, "/", -1)))
+	if exists, err := libbuildpack.FileExists(filepath.Join(dir, "package.json")); err != nil || !exists {
+		return "", err
+	}
+	return dir, nil
+}
+
+func (f *Finalizer) runNpm(dir string, args ...string) error {
+	cmd := exec.Command("npm", args...)
+	cmd.Dir = dir
+	cmd.Env = f.shellEnvironment()
+	cmd.Stdout = indentWriter(os.Stdout)
+	cmd.Stderr = indentWriter(os.Stderr)
+	return f.Command.Run(cmd)
+}
+
+func (f *Finalizer) restoreNodeModules(spaRoot, cacheDir, lockHash string) (bool, error) {
+	if lockHash == "" {
+		return false, nil
+	}
+	cachedHash, err := ioutil.ReadFile(filepath.Join(cacheDir, "package-lock.sha256"))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if string(cachedHash) != lockHash {
+		return false, nil
+	}
+
+	f.Log.Info("Using cached node_modules")
+	nodeModules := filepath.Join(spaRoot, "node_modules")
+	if err := os.RemoveAll(nodeModules); err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(nodeModules, 0755); err != nil {
+		return false, err
+	}
+	return true, libbuildpack.CopyDirectory(filepath.Join(cacheDir, "node_modules"), nodeModules)
+}
+
+func (f *Finalizer) saveNodeModules(spaRoot, cacheDir, lockHash string) error {
+	if lockHash == "" {
+		return nil
+	}
+	if err := os.RemoveAll(cacheDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(cacheDir, "node_modules"), 0755); err != nil {
+		return err
+	}
+	if err := libbuildpack.CopyDirectory(filepath.Join(spaRoot, "node_modules"), filepath.Join(cacheDir, "node_modules")); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(cacheDir, "package-lock.sha256"), []byte(lockHash), 0644)
+}
+
+func fileHash(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,90 @@
+package finalize
+
+import (
+	"dotnetcore/config"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// RunTests runs dotnet test on the app's test projects before it is
+// published, when RUN_TESTS or buildpack.yml asks for it. TEST_PROJECTS,
+// a comma separated list, overrides the projects chosen in buildpack.yml.
+// TEST_TIMEOUT bounds the whole run rather than each project, and every
+// project's command is stopped with its own process group once it is hit.
+func (f *Finalizer) RunTests() error {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	tests := buildpackYML.DotnetCore.Tests
+	if !tests.Enabled && os.Getenv("RUN_TESTS") != "true" {
+		return nil
+	}
+	if published, err := f.Project.IsPublished(); err != nil || published {
+		return err
+	}
+
+	paths, err := f.testProjects(tests.Projects)
+	if err != nil {
+		return err
+	} else if len(paths) == 0 {
+		f.Log.Warning("Tests were requested but the app has no test projects")
+		return nil
+	}
+
+	f.Log.BeginStep("Running dotnet test")
+	verbosity, err := f.verbosityArgs()
+	if err != nil {
+		return err
+	}
+	ctx, cancel, err := f.stepContext("test")
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	for _, path := range paths {
+		args := append([]string{"test", path, "-c", f.publicConfig()}, verbosity...)
+		if tests.Filter != "" {
+			args = append(args, "--filter", tests.Filter)
+		}
+		cmd := exec.CommandContext(ctx, "dotnet", args...)
+		cmd.Dir = f.Stager.BuildDir()
+		cmd.Env = f.shellEnvironment()
+		f.Log.Debug("Running command: %v", cmd)
+		if err := f.runWithDiagnostics(ctx, cmd); err != nil {
+			if ctx.Err() != nil {
+				return stepError(ctx, "test", err)
+			}
+			return fmt.Errorf("tests failed in %s", strings.TrimPrefix(path, f.Stager.BuildDir()+"/"))
+		}
+	}
+	return nil
+}
+
+// testProjects returns the test projects to run, every one the app has
+// unless some are selected
+func (f *Finalizer) testProjects(selected []string) ([]string, error) {
+	if env := os.Getenv("TEST_PROJECTS"); env != "" {
+		selected = strings.Split(env, ",")
+	}
+	if len(selected) == 0 {
+		return f.Project.TestProjectPaths()
+	}
+
+	paths := []string{}
+	for _, name := range selected {
+		path := filepath.Join(f.Stager.BuildDir(), filepath.FromSlash(strings.TrimSpace(name)))
+		if exists, err := libbuildpack.FileExists(path); err != nil {
+			return nil, err
+		} else if !exists {
+			return nil, fmt.Errorf("test project %s does not exist", strings.TrimSpace(name))
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
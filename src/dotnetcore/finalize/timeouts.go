@@ -0,0 +1,68 @@
+package finalize
+
+import (
+	"context"
+	"dotnetcore/config"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stepContext returns a context that expires once the configured timeout of
+// a restore, test or publish step has passed. RESTORE_TIMEOUT, TEST_TIMEOUT
+// and PUBLISH_TIMEOUT override the timeouts in buildpack.yml.
+func (f *Finalizer) stepContext(step string) (context.Context, context.CancelFunc, error) {
+	buildpackYML, err := config.LoadBuildpackYML(f.Stager.BuildDir())
+	if err != nil {
+		return nil, nil, err
+	}
+	value := buildpackYML.DotnetCore.Timeouts.Restore
+	switch step {
+	case "publish":
+		value = buildpackYML.DotnetCore.Timeouts.Publish
+	case "test":
+		value = buildpackYML.DotnetCore.Timeouts.Test
+	}
+	if env := os.Getenv(strings.ToUpper(step) + "_TIMEOUT"); env != "" {
+		value = env
+	}
+
+	timeout, err := parseTimeout(value)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %s timeout %q: %s", step, value, err)
+	} else if timeout == 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		return ctx, cancel, nil
+	}
+	f.Log.Info("Timing out dotnet %s after %s", step, timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	return ctx, cancel, nil
+}
+
+func parseTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if minutes, err := strconv.Atoi(value); err == nil {
+		value = fmt.Sprintf("%dm", minutes)
+	}
+	timeout, err := time.ParseDuration(value)
+	if err == nil && timeout < 0 {
+		err = fmt.Errorf("must not be negative")
+	}
+	return timeout, err
+}
+
+// stepError explains a failure caused by the step's timeout expiring
+func stepError(ctx context.Context, step string, err error) error {
+	if err == nil || ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	message := fmt.Sprintf("dotnet %s did not finish within its timeout and was stopped", step)
+	if step == "restore" {
+		message += "; check that the package sources in NuGet.Config are reachable from staging"
+	}
+	return fmt.Errorf("%s (raise %s_TIMEOUT or timeouts.%s in buildpack.yml if it needs longer)", message, strings.ToUpper(step), step)
+}
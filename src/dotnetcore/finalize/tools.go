@@ -0,0 +1,68 @@
+package finalize
+
+import (
+	"dotnetcore/jsonc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// toolCommand returns the command that runs a dotnet tool, from the app's
+// local tools when its manifest lists the package, and otherwise installed
+// into the deps dir at version, which has to run on the SDKs the buildpack
+// installs
+func (f *Finalizer) toolCommand(packageID, version, command string) ([]string, error) {
+	if local, err := f.hasLocalTool(packageID); err != nil {
+		return nil, err
+	} else if local {
+		cmd := exec.Command("dotnet", "tool", "restore")
+		cmd.Dir = f.Stager.BuildDir()
+		cmd.Env = f.shellEnvironment()
+		cmd.Stdout = indentWriter(os.Stdout)
+		cmd.Stderr = indentWriter(os.Stderr)
+		if err := f.Command.Run(cmd); err != nil {
+			return nil, err
+		}
+		return []string{"dotnet", command}, nil
+	}
+
+	toolPath := filepath.Join(f.Stager.DepDir(), "dotnet-tools")
+	tool := filepath.Join(toolPath, command)
+	if exists, err := libbuildpack.FileExists(tool); err != nil {
+		return nil, err
+	} else if !exists {
+		cmd := exec.Command("dotnet", "tool", "install", packageID, "--version", version, "--tool-path", toolPath)
+		cmd.Dir = f.Stager.BuildDir()
+		cmd.Env = f.shellEnvironment()
+		cmd.Stdout = indentWriter(os.Stdout)
+		cmd.Stderr = indentWriter(os.Stderr)
+		if err := f.Command.Run(cmd); err != nil {
+			return nil, err
+		}
+	}
+	return []string{tool}, nil
+}
+
+// hasLocalTool reports whether the app's .config/dotnet-tools.json manifest
+// lists the tool
+func (f *Finalizer) hasLocalTool(name string) (bool, error) {
+	path := filepath.Join(f.Stager.BuildDir(), ".config", "dotnet-tools.json")
+	if exists, err := libbuildpack.FileExists(path); err != nil || !exists {
+		return false, err
+	}
+	manifest := struct {
+		Tools map[string]interface{} `json:"tools"`
+	}{}
+	if err := jsonc.Load(path, &manifest); err != nil {
+		return false, err
+	}
+	for tool := range manifest.Tools {
+		if strings.EqualFold(tool, name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,24 @@
+package finalize
+
+import (
+	"os"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// moveDir moves src to dst with a rename, which leaves no second copy in
+// the droplet. It falls back to copying when the rename fails, such as
+// across filesystems or onto a directory that isn't empty.
+func moveDir(src, dst string) error {
+	err := os.Rename(src, dst)
+	if _, ok := err.(*os.LinkError); !ok {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	if err := libbuildpack.CopyDirectory(src, dst); err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
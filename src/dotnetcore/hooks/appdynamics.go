@@ -0,0 +1,79 @@
+package hooks
+
+import (
+	"dotnetcore/services"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+const appDynamicsProfilerGUID = "{57e1aa68-2229-41aa-9931-a6e93bbc64d8}"
+
+// AppDynamicsHook installs the AppDynamics .NET Core agent when an
+// AppDynamics service is bound, and points its profiler at the service's
+// controller at launch. The controller settings and access key are read
+// from the binding when the app starts rather than stored in the droplet.
+type AppDynamicsHook struct {
+	libbuildpack.DefaultHook
+	Log       *libbuildpack.Logger
+	Manifest  Manifest
+	Installer Installer
+	LaunchEnv string
+}
+
+func (h AppDynamicsHook) BeforeCompile(stager *libbuildpack.Stager) error {
+	service, err := services.Find("appdynamics")
+	if err != nil || service == nil {
+		return err
+	}
+	host := credentialValue(service, "host-name")
+	if host == "" {
+		return fmt.Errorf("service %s has no host-name credential", service.Name)
+	}
+
+	if len(h.Manifest.AllDependencyVersions("appdynamics")) == 0 {
+		h.Log.Warning("The buildpack has no AppDynamics agent for the %s stack, so the app will run without it", os.Getenv("CF_STACK"))
+		return nil
+	}
+	h.Log.BeginStep("Installing AppDynamics .NET Core agent")
+	if err := h.Installer.InstallOnlyVersion("appdynamics", filepath.Join(stager.DepDir(), "appdynamics")); err != nil {
+		return err
+	}
+
+	credentials, err := credentialsScript(h.LaunchEnv, stager, "appdynamics",
+		"APPDYNAMICS_CONTROLLER_HOST_NAME=host-name",
+		"APPDYNAMICS_CONTROLLER_PORT=port",
+		"APPDYNAMICS_CONTROLLER_SSL_ENABLED=ssl-enabled",
+		"APPDYNAMICS_AGENT_ACCOUNT_NAME=account-name",
+		"APPDYNAMICS_AGENT_ACCOUNT_ACCESS_KEY=account-access-key",
+		"APPDYNAMICS_AGENT_APPLICATION_NAME=application-name",
+		"APPDYNAMICS_AGENT_TIER_NAME=tier-name",
+	)
+	if err != nil {
+		return err
+	}
+
+	home := filepath.Join("$DEPS_DIR", stager.DepsIdx(), "appdynamics")
+	script := "export CORECLR_ENABLE_PROFILING=1\n" +
+		fmt.Sprintf("export CORECLR_PROFILER=%s\n", appDynamicsProfilerGUID) +
+		fmt.Sprintf("export CORECLR_PROFILER_PATH=%s\n", filepath.Join(home, "libappdprofiler.so")) +
+		credentials +
+		fmt.Sprintf("export APPDYNAMICS_AGENT_APPLICATION_NAME=${APPDYNAMICS_AGENT_APPLICATION_NAME:-%s}\n", appNameScript) +
+		fmt.Sprintf("export APPDYNAMICS_AGENT_TIER_NAME=${APPDYNAMICS_AGENT_TIER_NAME:-%s}\n", appNameScript) +
+		"export APPDYNAMICS_AGENT_REUSE_NODE_NAME=true\n" +
+		fmt.Sprintf("export APPDYNAMICS_AGENT_REUSE_NODE_NAME_PREFIX=${APPDYNAMICS_AGENT_REUSE_NODE_NAME_PREFIX:-%s}\n", appNameScript)
+	return stager.WriteProfileD("appdynamics.sh", script)
+}
+
+// credentialValue formats a scalar credential, which service brokers may
+// send as a string, number or boolean
+func credentialValue(service *services.Service, key string) string {
+	switch value := service.Credentials[key].(type) {
+	case nil, map[string]interface{}, []interface{}:
+		return ""
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
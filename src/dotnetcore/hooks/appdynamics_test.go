@@ -0,0 +1,64 @@
+package hooks_test
+
+import (
+	"dotnetcore/hooks"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AppDynamicsHook", func() {
+	var (
+		fixture *agentFixture
+		hook    hooks.AppDynamicsHook
+	)
+
+	BeforeEach(func() {
+		fixture = newAgentFixture("5")
+		hook = hooks.AppDynamicsHook{Log: fixture.logger, Manifest: fixture.mockManifest, Installer: fixture.mockInstaller, LaunchEnv: fixture.launchEnv}
+	})
+
+	AfterEach(func() {
+		fixture.cleanup()
+	})
+
+	It("does nothing without an AppDynamics service", func() {
+		Expect(hook.BeforeCompile(fixture.stager)).To(Succeed())
+	})
+
+	It("installs the agent and reads the controller settings at launch", func() {
+		Expect(os.Setenv("VCAP_SERVICES", `{"appdynamics": [{"name": "appd", "label": "appdynamics", "credentials": {"host-name": "controller.example.com", "port": 443, "ssl-enabled": true, "account-name": "acme", "account-access-key": "secret", "tier-name": "web"}}]}`)).To(Succeed())
+		fixture.mockManifest.EXPECT().AllDependencyVersions("appdynamics").Return([]string{"20.1.0"})
+		fixture.mockInstaller.EXPECT().InstallOnlyVersion("appdynamics", filepath.Join(fixture.depsDir, fixture.depsIdx, "appdynamics"))
+
+		Expect(hook.BeforeCompile(fixture.stager)).To(Succeed())
+
+		contents, err := ioutil.ReadFile(filepath.Join(fixture.depsDir, fixture.depsIdx, "profile.d", "appdynamics.sh"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).To(ContainSubstring("export CORECLR_PROFILER_PATH=$DEPS_DIR/5/appdynamics/libappdprofiler.so\n"))
+		Expect(string(contents)).To(ContainSubstring("eval \"$($DEPS_DIR/5/bin/launchenv service-credentials appdynamics APPDYNAMICS_CONTROLLER_HOST_NAME=host-name APPDYNAMICS_CONTROLLER_PORT=port "))
+		Expect(string(contents)).To(ContainSubstring(" APPDYNAMICS_AGENT_ACCOUNT_ACCESS_KEY=account-access-key "))
+		Expect(string(contents)).To(ContainSubstring("export APPDYNAMICS_AGENT_APPLICATION_NAME=${APPDYNAMICS_AGENT_APPLICATION_NAME:-$(echo"))
+		Expect(string(contents)).ToNot(ContainSubstring("secret"))
+		Expect(string(contents)).ToNot(ContainSubstring("controller.example.com"))
+		Expect(filepath.Join(fixture.depsDir, fixture.depsIdx, "bin", "launchenv")).To(BeAnExistingFile())
+	})
+
+	It("warns and skips the agent when the manifest has none", func() {
+		Expect(os.Setenv("VCAP_SERVICES", `{"appdynamics": [{"name": "appd", "label": "appdynamics", "credentials": {"host-name": "controller.example.com"}}]}`)).To(Succeed())
+		fixture.mockManifest.EXPECT().AllDependencyVersions("appdynamics").Return([]string{})
+
+		Expect(hook.BeforeCompile(fixture.stager)).To(Succeed())
+		Expect(fixture.buffer.String()).To(ContainSubstring("**WARNING** The buildpack has no AppDynamics agent"))
+		Expect(filepath.Join(fixture.depsDir, fixture.depsIdx, "profile.d", "appdynamics.sh")).ToNot(BeAnExistingFile())
+	})
+
+	It("fails when the service has no controller host", func() {
+		Expect(os.Setenv("VCAP_SERVICES", `{"user-provided": [{"name": "appdynamics", "credentials": {}}]}`)).To(Succeed())
+
+		Expect(hook.BeforeCompile(fixture.stager)).To(MatchError("service appdynamics has no host-name credential"))
+	})
+})
@@ -0,0 +1,85 @@
+package hooks
+
+import (
+	"dotnetcore/services"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// AppInsightsHook installs the Application Insights auto-instrumentation
+// startup hook when APPLICATIONINSIGHTS_CONNECTION_STRING is set or an
+// Application Insights service is bound, and loads it at launch.
+type AppInsightsHook struct {
+	libbuildpack.DefaultHook
+	Log       *libbuildpack.Logger
+	Manifest  Manifest
+	Installer Installer
+	LaunchEnv string
+}
+
+// appInsightsCredentials maps the connection string, or else the
+// instrumentation key, of a bound service for launchenv
+const appInsightsCredentials = "APPLICATIONINSIGHTS_CONNECTION_STRING=connectionString,connection_string,ConnectionString," +
+	"InstrumentationKey={instrumentationKey},InstrumentationKey={instrumentation_key},InstrumentationKey={InstrumentationKey}"
+
+func (h AppInsightsHook) BeforeCompile(stager *libbuildpack.Stager) error {
+	connectionString := os.Getenv("APPLICATIONINSIGHTS_CONNECTION_STRING")
+	service, err := appInsightsService()
+	if err != nil || (service == nil && connectionString == "") {
+		return err
+	}
+
+	if len(h.Manifest.AllDependencyVersions("appinsights")) == 0 {
+		h.Log.Warning("The buildpack has no Application Insights auto-instrumentation for the %s stack, so the app will run without it", os.Getenv("CF_STACK"))
+		return nil
+	}
+	h.Log.BeginStep("Installing Application Insights auto-instrumentation")
+	installDir := filepath.Join(stager.DepDir(), "appinsights")
+	if err := h.Installer.InstallOnlyVersion("appinsights", installDir); err != nil {
+		return err
+	}
+
+	hooks, err := filepath.Glob(filepath.Join(installDir, "*StartupHook*.dll"))
+	if err != nil {
+		return err
+	}
+	if len(hooks) == 0 {
+		return fmt.Errorf("no startup hook assembly found in the Application Insights auto-instrumentation")
+	}
+	hook := filepath.Join("$DEPS_DIR", stager.DepsIdx(), "appinsights", filepath.Base(hooks[0]))
+
+	script := fmt.Sprintf("export DOTNET_STARTUP_HOOKS=%s${DOTNET_STARTUP_HOOKS:+:$DOTNET_STARTUP_HOOKS}\n", hook)
+	if service != nil {
+		// The service's connection string is read at launch, so it stays
+		// out of the droplet
+		credentials, err := credentialsScript(h.LaunchEnv, stager, "insights", appInsightsCredentials)
+		if err != nil {
+			return err
+		}
+		script += credentials
+	} else {
+		script += fmt.Sprintf("export APPLICATIONINSIGHTS_CONNECTION_STRING=${APPLICATIONINSIGHTS_CONNECTION_STRING:-'%s'}\n", strings.Replace(connectionString, "'", `'\''`, -1))
+	}
+	return stager.WriteProfileD("appinsights.sh", script)
+}
+
+// appInsightsService returns the bound service matching "insights" when
+// APPLICATIONINSIGHTS_CONNECTION_STRING doesn't provide the connection
+// string
+func appInsightsService() (*services.Service, error) {
+	if os.Getenv("APPLICATIONINSIGHTS_CONNECTION_STRING") != "" {
+		return nil, nil
+	}
+	service, err := services.Find("insights")
+	if err != nil || service == nil {
+		return nil, err
+	}
+	if service.Credential("connectionString", "connection_string", "ConnectionString", "instrumentationKey", "instrumentation_key", "InstrumentationKey") == "" {
+		return nil, fmt.Errorf("service %s has neither a connectionString nor an instrumentationKey credential", service.Name)
+	}
+	return service, nil
+}
@@ -0,0 +1,90 @@
+package hooks_test
+
+import (
+	"dotnetcore/hooks"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AppInsightsHook", func() {
+	var (
+		fixture *agentFixture
+		hook    hooks.AppInsightsHook
+	)
+
+	BeforeEach(func() {
+		fixture = newAgentFixture("7")
+		hook = hooks.AppInsightsHook{Log: fixture.logger, Manifest: fixture.mockManifest, Installer: fixture.mockInstaller, LaunchEnv: fixture.launchEnv}
+	})
+
+	AfterEach(func() {
+		fixture.cleanup()
+		Expect(os.Unsetenv("APPLICATIONINSIGHTS_CONNECTION_STRING")).To(Succeed())
+		Expect(os.Unsetenv("VCAP_SERVICES")).To(Succeed())
+	})
+
+	installWithHook := func(name string) {
+		fixture.mockManifest.EXPECT().AllDependencyVersions("appinsights").Return([]string{"1.0.0"})
+		fixture.mockInstaller.EXPECT().InstallOnlyVersion("appinsights", filepath.Join(fixture.depsDir, fixture.depsIdx, "appinsights")).DoAndReturn(func(_, dir string) error {
+			Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+			if name == "" {
+				return nil
+			}
+			return ioutil.WriteFile(filepath.Join(dir, name), []byte{}, 0644)
+		})
+	}
+
+	It("does nothing without a connection string", func() {
+		Expect(hook.BeforeCompile(fixture.stager)).To(Succeed())
+	})
+
+	It("loads the startup hook with the connection string from the environment", func() {
+		Expect(os.Setenv("APPLICATIONINSIGHTS_CONNECTION_STRING", "InstrumentationKey=abc;IngestionEndpoint=https://example.com")).To(Succeed())
+		installWithHook("Microsoft.ApplicationInsights.StartupHook.dll")
+
+		Expect(hook.BeforeCompile(fixture.stager)).To(Succeed())
+
+		contents, err := ioutil.ReadFile(filepath.Join(fixture.depsDir, fixture.depsIdx, "profile.d", "appinsights.sh"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).To(Equal("export DOTNET_STARTUP_HOOKS=$DEPS_DIR/7/appinsights/Microsoft.ApplicationInsights.StartupHook.dll${DOTNET_STARTUP_HOOKS:+:$DOTNET_STARTUP_HOOKS}\n" +
+			"export APPLICATIONINSIGHTS_CONNECTION_STRING=${APPLICATIONINSIGHTS_CONNECTION_STRING:-'InstrumentationKey=abc;IngestionEndpoint=https://example.com'}\n"))
+	})
+
+	It("reads a bound service's connection string at launch, keeping it out of the droplet", func() {
+		Expect(os.Setenv("VCAP_SERVICES", `{"azure-appinsights": [{"name": "telemetry", "label": "azure-appinsights", "credentials": {"instrumentationKey": "abc"}}]}`)).To(Succeed())
+		installWithHook("Microsoft.ApplicationInsights.StartupHook.dll")
+
+		Expect(hook.BeforeCompile(fixture.stager)).To(Succeed())
+
+		contents, err := ioutil.ReadFile(filepath.Join(fixture.depsDir, fixture.depsIdx, "profile.d", "appinsights.sh"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).To(ContainSubstring(`eval "$($DEPS_DIR/7/bin/launchenv service-credentials insights APPLICATIONINSIGHTS_CONNECTION_STRING=connectionString,connection_string,ConnectionString,InstrumentationKey={instrumentationKey},InstrumentationKey={instrumentation_key},InstrumentationKey={InstrumentationKey})"`))
+		Expect(string(contents)).ToNot(ContainSubstring("abc"))
+		Expect(filepath.Join(fixture.depsDir, fixture.depsIdx, "bin", "launchenv")).To(BeAnExistingFile())
+	})
+
+	It("fails when the bound service has no connection string", func() {
+		Expect(os.Setenv("VCAP_SERVICES", `{"azure-appinsights": [{"name": "telemetry", "label": "azure-appinsights", "credentials": {}}]}`)).To(Succeed())
+		Expect(hook.BeforeCompile(fixture.stager)).To(MatchError("service telemetry has neither a connectionString nor an instrumentationKey credential"))
+	})
+
+	It("warns and skips the agent when the manifest has none", func() {
+		Expect(os.Setenv("APPLICATIONINSIGHTS_CONNECTION_STRING", "InstrumentationKey=abc")).To(Succeed())
+		fixture.mockManifest.EXPECT().AllDependencyVersions("appinsights").Return([]string{})
+
+		Expect(hook.BeforeCompile(fixture.stager)).To(Succeed())
+		Expect(fixture.buffer.String()).To(ContainSubstring("**WARNING** The buildpack has no Application Insights auto-instrumentation"))
+		Expect(filepath.Join(fixture.depsDir, fixture.depsIdx, "profile.d", "appinsights.sh")).ToNot(BeAnExistingFile())
+	})
+
+	It("fails when the installed assets have no startup hook", func() {
+		Expect(os.Setenv("APPLICATIONINSIGHTS_CONNECTION_STRING", "InstrumentationKey=abc")).To(Succeed())
+		installWithHook("")
+
+		Expect(hook.BeforeCompile(fixture.stager)).To(MatchError(ContainSubstring("no startup hook assembly found")))
+	})
+})
@@ -0,0 +1,133 @@
+package hooks
+
+import (
+	"dotnetcore/installer"
+	"dotnetcore/services"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/kr/text"
+)
+
+// DynatraceHook installs the Dynatrace OneAgent code modules when a
+// Dynatrace service with environmentid and apitoken credentials is bound,
+// and preloads the agent at launch.
+type DynatraceHook struct {
+	libbuildpack.DefaultHook
+	Log     *libbuildpack.Logger
+	Command Command
+}
+
+type dynatraceManifest struct {
+	Technologies struct {
+		Process map[string][]struct {
+			Path       string `json:"path"`
+			BinaryType string `json:"binarytype"`
+		} `json:"process"`
+	} `json:"technologies"`
+}
+
+func (h DynatraceHook) BeforeCompile(stager *libbuildpack.Stager) error {
+	service, err := services.Find("dynatrace")
+	if err != nil || service == nil {
+		return err
+	}
+	environmentID := service.Credential("environmentid")
+	apiToken := service.Credential("apitoken")
+	if environmentID == "" || apiToken == "" {
+		return fmt.Errorf("service %s needs environmentid and apitoken credentials", service.Name)
+	}
+
+	h.Log.BeginStep("Installing Dynatrace OneAgent")
+	if err := h.install(stager, service, environmentID, apiToken); err != nil {
+		if service.Credential("skiperrors") == "true" {
+			h.Log.Warning("Skipping Dynatrace OneAgent: %s", err.Error())
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (h DynatraceHook) install(stager *libbuildpack.Stager, service *services.Service, environmentID, apiToken string) error {
+	apiURL := service.Credential("apiurl")
+	if apiURL == "" {
+		apiURL = fmt.Sprintf("https://%s.live.dynatrace.com/api", environmentID)
+	}
+
+	installer, err := ioutil.TempFile("", "dynatrace-installer")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(installer.Name())
+	defer installer.Close()
+
+	url := strings.TrimSuffix(apiURL, "/") + "/v1/deployment/installer/agent/unix/paas-sh/latest?bitness=64&include=dotnet&include=process"
+	if err := downloadWithToken(url, apiToken, installer); err != nil {
+		return err
+	}
+
+	if err := h.Command.Execute(stager.BuildDir(), indentWriter(os.Stdout), indentWriter(os.Stderr), "sh", installer.Name(), stager.DepDir()); err != nil {
+		return fmt.Errorf("running the OneAgent installer: %v", err)
+	}
+
+	agentDir := filepath.Join(stager.DepDir(), "dynatrace", "oneagent")
+	manifest := dynatraceManifest{}
+	if err := libbuildpack.NewJSON().Load(filepath.Join(agentDir, "manifest.json"), &manifest); err != nil {
+		return fmt.Errorf("reading the OneAgent manifest: %v", err)
+	}
+	agentPath := ""
+	for _, binary := range manifest.Technologies.Process["linux-x86-64"] {
+		if binary.BinaryType == "primary" {
+			agentPath = binary.Path
+		}
+	}
+	if agentPath == "" {
+		return fmt.Errorf("the OneAgent manifest has no primary linux-x86-64 process agent")
+	}
+
+	script := fmt.Sprintf("export LD_PRELOAD=%s\n", filepath.Join("$DEPS_DIR", stager.DepsIdx(), "dynatrace", "oneagent", agentPath))
+	if zone := service.Credential("networkzone"); zone != "" {
+		script += fmt.Sprintf("export DT_NETWORK_ZONE=${DT_NETWORK_ZONE:-%s}\n", zone)
+	}
+	return stager.WriteProfileD("dynatrace.sh", script)
+}
+
+// dynatraceTimeout bounds the download of the OneAgent installer
+const dynatraceTimeout = 5 * time.Minute
+
+// downloadWithToken follows the installer's integrity policy, as the
+// script it downloads is run during staging
+func downloadWithToken(url, token string, w io.Writer) error {
+	if err := installer.CheckHTTPS("the OneAgent installer", url); err != nil {
+		return err
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Api-Token "+token)
+	client := *installer.HTTPClient()
+	client.Timeout = dynatraceTimeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading %s: %s", strings.SplitN(url, "?", 2)[0], resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func indentWriter(writer io.Writer) io.Writer {
+	return text.NewIndentWriter(writer, []byte("       "))
+}
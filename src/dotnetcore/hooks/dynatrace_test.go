@@ -0,0 +1,114 @@
+package hooks_test
+
+import (
+	"bytes"
+	"dotnetcore/hooks"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DynatraceHook", func() {
+	var (
+		err         error
+		buildDir    string
+		depsDir     string
+		depsIdx     string
+		buffer      *bytes.Buffer
+		stager      *libbuildpack.Stager
+		mockCtrl    *gomock.Controller
+		mockCommand *MockCommand
+		server      *httptest.Server
+		status      int
+		hook        hooks.DynatraceHook
+	)
+
+	BeforeEach(func() {
+		buildDir, err = ioutil.TempDir("", "dotnetcore-buildpack.build.")
+		Expect(err).To(BeNil())
+		depsDir, err = ioutil.TempDir("", "dotnetcore-buildpack.deps.")
+		Expect(err).To(BeNil())
+		depsIdx = "4"
+		Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx), 0755)).To(Succeed())
+
+		buffer = new(bytes.Buffer)
+		logger := libbuildpack.NewLogger(ansicleaner.New(buffer))
+		stager = libbuildpack.NewStager([]string{buildDir, "", depsDir, depsIdx}, logger, &libbuildpack.Manifest{})
+
+		status = http.StatusOK
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Path).To(Equal("/api/v1/deployment/installer/agent/unix/paas-sh/latest"))
+			Expect(r.Header.Get("Authorization")).To(Equal("Api-Token token"))
+			w.WriteHeader(status)
+			io.WriteString(w, "echo installing")
+		}))
+
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockCommand = NewMockCommand(mockCtrl)
+		hook = hooks.DynatraceHook{Log: logger, Command: mockCommand}
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+		server.Close()
+		Expect(os.Unsetenv("VCAP_SERVICES")).To(Succeed())
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+		Expect(os.RemoveAll(depsDir)).To(Succeed())
+	})
+
+	bindService := func(extra string) {
+		Expect(os.Setenv("VCAP_SERVICES", `{"dynatrace": [{"name": "dt", "label": "dynatrace", "credentials": {"environmentid": "env", "apitoken": "token", "apiurl": "`+server.URL+`/api"`+extra+`}}]}`)).To(Succeed())
+	}
+
+	It("does nothing without a Dynatrace service", func() {
+		Expect(hook.BeforeCompile(stager)).To(Succeed())
+	})
+
+	It("runs the installer and preloads the agent at launch", func() {
+		bindService(`, "networkzone": "eu"`)
+		mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "sh", gomock.Any(), filepath.Join(depsDir, depsIdx)).DoAndReturn(func(_ string, _, _ io.Writer, _ string, args ...string) error {
+			Expect(ioutil.ReadFile(args[0])).To(Equal([]byte("echo installing")))
+			agentDir := filepath.Join(depsDir, depsIdx, "dynatrace", "oneagent")
+			Expect(os.MkdirAll(agentDir, 0755)).To(Succeed())
+			return ioutil.WriteFile(filepath.Join(agentDir, "manifest.json"), []byte(`{"technologies": {"process": {"linux-x86-64": [{"path": "agent/lib64/liboneagentproc.so", "binarytype": "primary"}]}}}`), 0644)
+		})
+
+		Expect(hook.BeforeCompile(stager)).To(Succeed())
+
+		contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "dynatrace.sh"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).To(Equal("export LD_PRELOAD=$DEPS_DIR/4/dynatrace/oneagent/agent/lib64/liboneagentproc.so\nexport DT_NETWORK_ZONE=${DT_NETWORK_ZONE:-eu}\n"))
+	})
+
+	It("fails when the installer cannot be downloaded", func() {
+		bindService("")
+		status = http.StatusUnauthorized
+
+		Expect(hook.BeforeCompile(stager)).To(MatchError(ContainSubstring("401 Unauthorized")))
+	})
+
+	It("refuses an http apiurl under the strict integrity policy", func() {
+		Expect(os.Setenv("INTEGRITY_POLICY", "strict")).To(Succeed())
+		defer os.Unsetenv("INTEGRITY_POLICY")
+		bindService("")
+
+		Expect(hook.BeforeCompile(stager)).To(MatchError(ContainSubstring("the OneAgent installer is downloaded from " + server.URL + "/api/v1/deployment/installer/agent/unix/paas-sh/latest?bitness=64&include=dotnet&include=process, but INTEGRITY_POLICY=strict only allows https")))
+	})
+
+	It("only warns about failures when skiperrors is set", func() {
+		bindService(`, "skiperrors": "true"`)
+		status = http.StatusUnauthorized
+
+		Expect(hook.BeforeCompile(stager)).To(Succeed())
+		Expect(buffer.String()).To(ContainSubstring("Skipping Dynatrace OneAgent"))
+	})
+})
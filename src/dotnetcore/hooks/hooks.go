@@ -0,0 +1,73 @@
+// Package hooks contains the integrations with third party agents. The
+// hooks are registered with libbuildpack when the package is imported by
+// the supply and finalize commands: BeforeCompile runs before supply and
+// AfterCompile runs after finalize, before release.
+//
+// To add an integration in Go, implement libbuildpack.Hook (embedding
+// libbuildpack.DefaultHook for the phase you don't need) and register it in
+// init below. Integrations that don't need Go can instead drop an
+// executable into the buildpack's hooks.d directory; see ScriptHook.
+package hooks
+
+import (
+	"dotnetcore/commandlog"
+	"dotnetcore/installer"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+type Manifest interface {
+	AllDependencyVersions(string) []string
+}
+
+type Command interface {
+	Execute(string, io.Writer, io.Writer, string, ...string) error
+}
+
+type Installer interface {
+	InstallOnlyVersion(string, string) error
+}
+
+func init() {
+	logger := libbuildpack.NewLogger(os.Stdout)
+	buildpackDir, err := libbuildpack.GetBuildpackDir()
+	if err != nil {
+		return
+	}
+	libbuildpack.AddHook(ScriptHook{Log: logger, Command: commandlog.New(logger), Dir: filepath.Join(buildpackDir, "hooks.d")})
+
+	manifest, err := libbuildpack.NewManifest(buildpackDir, logger, time.Now())
+	if err != nil {
+		logger.Error("Unable to load the buildpack manifest, so the agent integrations are disabled: %s", err.Error())
+		return
+	}
+	installer := installer.New(manifest, logger)
+	launchEnv := filepath.Join(filepath.Dir(os.Args[0]), "launchenv")
+
+	libbuildpack.AddHook(NewRelicHook{Log: logger, Manifest: manifest, Installer: installer, LaunchEnv: launchEnv})
+	libbuildpack.AddHook(DynatraceHook{Log: logger, Command: commandlog.New(logger)})
+	libbuildpack.AddHook(AppDynamicsHook{Log: logger, Manifest: manifest, Installer: installer, LaunchEnv: launchEnv})
+	libbuildpack.AddHook(AppInsightsHook{Log: logger, Manifest: manifest, Installer: installer, LaunchEnv: launchEnv})
+}
+
+// credentialsScript installs the launchenv helper and returns the profile.d
+// line that uses it to export credentials of the bound service matching
+// term when the app starts, which keeps secrets out of the droplet
+func credentialsScript(launchEnv string, stager *libbuildpack.Stager, term string, mappings ...string) (string, error) {
+	if exists, err := libbuildpack.FileExists(launchEnv); err != nil {
+		return "", err
+	} else if !exists {
+		return "", fmt.Errorf("the buildpack has no launchenv helper to read the %s credentials at launch", term)
+	}
+	if err := libbuildpack.CopyFile(launchEnv, filepath.Join(stager.DepDir(), "bin", "launchenv")); err != nil {
+		return "", err
+	}
+	helper := filepath.Join("$DEPS_DIR", stager.DepsIdx(), "bin", "launchenv")
+	return fmt.Sprintf("eval \"$(%s service-credentials %s %s)\"\n", helper, term, strings.Join(mappings, " ")), nil
+}
@@ -0,0 +1,65 @@
+package hooks_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Hooks Suite")
+}
+
+// agentFixture is the staging environment the agent hook tests share: a
+// build and deps dir, a stager, mocks for the manifest and installer, and a
+// stand-in for the launchenv helper
+type agentFixture struct {
+	buildDir      string
+	depsDir       string
+	depsIdx       string
+	buffer        *bytes.Buffer
+	logger        *libbuildpack.Logger
+	stager        *libbuildpack.Stager
+	mockCtrl      *gomock.Controller
+	mockManifest  *MockManifest
+	mockInstaller *MockInstaller
+	launchEnv     string
+}
+
+func newAgentFixture(depsIdx string) *agentFixture {
+	var err error
+	f := &agentFixture{depsIdx: depsIdx, buffer: new(bytes.Buffer)}
+	f.buildDir, err = ioutil.TempDir("", "dotnetcore-buildpack.build.")
+	Expect(err).To(BeNil())
+	f.depsDir, err = ioutil.TempDir("", "dotnetcore-buildpack.deps.")
+	Expect(err).To(BeNil())
+	Expect(os.MkdirAll(filepath.Join(f.depsDir, depsIdx), 0755)).To(Succeed())
+
+	f.logger = libbuildpack.NewLogger(ansicleaner.New(f.buffer))
+	f.stager = libbuildpack.NewStager([]string{f.buildDir, "", f.depsDir, depsIdx}, f.logger, &libbuildpack.Manifest{})
+
+	f.mockCtrl = gomock.NewController(GinkgoT())
+	f.mockManifest = NewMockManifest(f.mockCtrl)
+	f.mockInstaller = NewMockInstaller(f.mockCtrl)
+
+	f.launchEnv = filepath.Join(f.buildDir, "launchenv")
+	Expect(ioutil.WriteFile(f.launchEnv, []byte("#!/bin/sh\n"), 0755)).To(Succeed())
+	return f
+}
+
+func (f *agentFixture) cleanup() {
+	f.mockCtrl.Finish()
+	Expect(os.Unsetenv("VCAP_SERVICES")).To(Succeed())
+	Expect(os.RemoveAll(f.buildDir)).To(Succeed())
+	Expect(os.RemoveAll(f.depsDir)).To(Succeed())
+}
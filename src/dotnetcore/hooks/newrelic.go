@@ -0,0 +1,74 @@
+package hooks
+
+import (
+	"dotnetcore/services"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+const newRelicProfilerGUID = "{36032161-FFC0-4B61-B559-F6C5D41BAE5A}"
+
+// appNameScript prints the application name from VCAP_APPLICATION at launch
+const appNameScript = `$(echo "${VCAP_APPLICATION:-}" | sed -n 's/.*"application_name": *"\([^"]*\)".*/\1/p')`
+
+// NewRelicHook installs the New Relic .NET agent when a New Relic service
+// is bound or NEW_RELIC_LICENSE_KEY is set, and enables its CoreCLR
+// profiler at launch. The license key is read from the binding when the app
+// starts rather than stored in the droplet.
+type NewRelicHook struct {
+	libbuildpack.DefaultHook
+	Log       *libbuildpack.Logger
+	Manifest  Manifest
+	Installer Installer
+	LaunchEnv string
+}
+
+func (h NewRelicHook) BeforeCompile(stager *libbuildpack.Stager) error {
+	service, err := newRelicService()
+	if err != nil || (service == nil && os.Getenv("NEW_RELIC_LICENSE_KEY") == "") {
+		return err
+	}
+
+	if len(h.Manifest.AllDependencyVersions("newrelic")) == 0 {
+		h.Log.Warning("The buildpack has no New Relic agent for the %s stack, so the app will run without it", os.Getenv("CF_STACK"))
+		return nil
+	}
+	h.Log.BeginStep("Installing New Relic .NET agent")
+	if err := h.Installer.InstallOnlyVersion("newrelic", filepath.Join(stager.DepDir(), "newrelic")); err != nil {
+		return err
+	}
+
+	home := filepath.Join("$DEPS_DIR", stager.DepsIdx(), "newrelic")
+	script := "export CORECLR_ENABLE_PROFILING=1\n" +
+		fmt.Sprintf("export CORECLR_PROFILER=%s\n", newRelicProfilerGUID) +
+		fmt.Sprintf("export CORECLR_NEWRELIC_HOME=%s\n", home) +
+		fmt.Sprintf("export CORECLR_PROFILER_PATH=%s\n", filepath.Join(home, "libNewRelicProfiler.so"))
+	if service != nil {
+		credentials, err := credentialsScript(h.LaunchEnv, stager, "newrelic", "NEW_RELIC_LICENSE_KEY=licenseKey,license_key")
+		if err != nil {
+			return err
+		}
+		script += credentials
+	}
+	script += fmt.Sprintf("export NEW_RELIC_APP_NAME=${NEW_RELIC_APP_NAME:-%s}\n", appNameScript)
+	return stager.WriteProfileD("newrelic.sh", script)
+}
+
+// newRelicService returns the bound service matching "newrelic" when
+// NEW_RELIC_LICENSE_KEY doesn't provide the license key
+func newRelicService() (*services.Service, error) {
+	if os.Getenv("NEW_RELIC_LICENSE_KEY") != "" {
+		return nil, nil
+	}
+	service, err := services.Find("newrelic")
+	if err != nil || service == nil {
+		return nil, err
+	}
+	if service.Credential("licenseKey", "license_key") == "" {
+		return nil, fmt.Errorf("service %s has no licenseKey credential", service.Name)
+	}
+	return service, nil
+}
@@ -0,0 +1,79 @@
+package hooks_test
+
+import (
+	"dotnetcore/hooks"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//go:generate mockgen -source=hooks.go --destination=mocks_test.go --package=hooks_test
+
+var _ = Describe("NewRelicHook", func() {
+	var (
+		fixture *agentFixture
+		hook    hooks.NewRelicHook
+	)
+
+	BeforeEach(func() {
+		fixture = newAgentFixture("3")
+		hook = hooks.NewRelicHook{Log: fixture.logger, Manifest: fixture.mockManifest, Installer: fixture.mockInstaller, LaunchEnv: fixture.launchEnv}
+	})
+
+	AfterEach(func() {
+		fixture.cleanup()
+		Expect(os.Unsetenv("NEW_RELIC_LICENSE_KEY")).To(Succeed())
+	})
+
+	It("does nothing without a license key", func() {
+		Expect(hook.BeforeCompile(fixture.stager)).To(Succeed())
+		Expect(filepath.Join(fixture.depsDir, fixture.depsIdx, "profile.d", "newrelic.sh")).ToNot(BeAnExistingFile())
+	})
+
+	It("installs the agent and enables its profiler for a bound service", func() {
+		Expect(os.Setenv("VCAP_SERVICES", `{"newrelic": [{"name": "apm", "label": "newrelic", "credentials": {"licenseKey": "abc123"}}]}`)).To(Succeed())
+		fixture.mockManifest.EXPECT().AllDependencyVersions("newrelic").Return([]string{"8.0.0"})
+		fixture.mockInstaller.EXPECT().InstallOnlyVersion("newrelic", filepath.Join(fixture.depsDir, fixture.depsIdx, "newrelic"))
+
+		Expect(hook.BeforeCompile(fixture.stager)).To(Succeed())
+
+		contents, err := ioutil.ReadFile(filepath.Join(fixture.depsDir, fixture.depsIdx, "profile.d", "newrelic.sh"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).To(ContainSubstring("export CORECLR_ENABLE_PROFILING=1\n"))
+		Expect(string(contents)).To(ContainSubstring("export CORECLR_PROFILER_PATH=$DEPS_DIR/3/newrelic/libNewRelicProfiler.so\n"))
+		Expect(string(contents)).To(ContainSubstring("eval \"$($DEPS_DIR/3/bin/launchenv service-credentials newrelic NEW_RELIC_LICENSE_KEY=licenseKey,license_key)\"\n"))
+		Expect(string(contents)).ToNot(ContainSubstring("abc123"))
+		Expect(filepath.Join(fixture.depsDir, fixture.depsIdx, "bin", "launchenv")).To(BeAnExistingFile())
+	})
+
+	It("leaves a license key set in the environment to the app's environment", func() {
+		Expect(os.Setenv("NEW_RELIC_LICENSE_KEY", "abc123")).To(Succeed())
+		fixture.mockManifest.EXPECT().AllDependencyVersions("newrelic").Return([]string{"8.0.0"})
+		fixture.mockInstaller.EXPECT().InstallOnlyVersion("newrelic", filepath.Join(fixture.depsDir, fixture.depsIdx, "newrelic"))
+
+		Expect(hook.BeforeCompile(fixture.stager)).To(Succeed())
+
+		contents, err := ioutil.ReadFile(filepath.Join(fixture.depsDir, fixture.depsIdx, "profile.d", "newrelic.sh"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).ToNot(ContainSubstring("NEW_RELIC_LICENSE_KEY"))
+		Expect(string(contents)).ToNot(ContainSubstring("abc123"))
+	})
+
+	It("warns and skips the agent when the manifest has none", func() {
+		Expect(os.Setenv("NEW_RELIC_LICENSE_KEY", "abc123")).To(Succeed())
+		fixture.mockManifest.EXPECT().AllDependencyVersions("newrelic").Return([]string{})
+
+		Expect(hook.BeforeCompile(fixture.stager)).To(Succeed())
+		Expect(fixture.buffer.String()).To(ContainSubstring("**WARNING** The buildpack has no New Relic agent"))
+		Expect(filepath.Join(fixture.depsDir, fixture.depsIdx, "profile.d", "newrelic.sh")).ToNot(BeAnExistingFile())
+	})
+
+	It("fails when the bound service has no license key", func() {
+		Expect(os.Setenv("VCAP_SERVICES", `{"user-provided": [{"name": "newrelic", "credentials": {}}]}`)).To(Succeed())
+
+		Expect(hook.BeforeCompile(fixture.stager)).To(MatchError("service newrelic has no licenseKey credential"))
+	})
+})
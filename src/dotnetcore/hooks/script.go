@@ -0,0 +1,49 @@
+package hooks
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// ScriptHook runs the executables in a drop-in directory of the buildpack,
+// so agent vendors can contribute an integration without changing the
+// buildpack's Go code. Each executable is called in name order with
+// "before-compile" before supply and "after-compile" before release,
+// followed by the build, cache and deps directories and the deps index.
+type ScriptHook struct {
+	Log     *libbuildpack.Logger
+	Command Command
+	Dir     string
+}
+
+func (h ScriptHook) BeforeCompile(stager *libbuildpack.Stager) error {
+	return h.run("before-compile", stager)
+}
+
+func (h ScriptHook) AfterCompile(stager *libbuildpack.Stager) error {
+	return h.run("after-compile", stager)
+}
+
+func (h ScriptHook) run(phase string, stager *libbuildpack.Stager) error {
+	files, err := ioutil.ReadDir(h.Dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || file.Mode()&0111 == 0 {
+			continue
+		}
+		h.Log.BeginStep("Running %s hook %s", phase, file.Name())
+		if err := h.Command.Execute(stager.BuildDir(), indentWriter(os.Stdout), indentWriter(os.Stderr), filepath.Join(h.Dir, file.Name()), phase, stager.BuildDir(), stager.CacheDir(), stager.DepsDir(), stager.DepsIdx()); err != nil {
+			h.Log.Error("Hook %s failed: %s", file.Name(), err.Error())
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package hooks_test
+
+import (
+	"bytes"
+	"dotnetcore/hooks"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ScriptHook", func() {
+	var (
+		err         error
+		buildDir    string
+		cacheDir    string
+		depsDir     string
+		hooksDir    string
+		stager      *libbuildpack.Stager
+		mockCtrl    *gomock.Controller
+		mockCommand *MockCommand
+		hook        hooks.ScriptHook
+	)
+
+	BeforeEach(func() {
+		buildDir, err = ioutil.TempDir("", "dotnetcore-buildpack.build.")
+		Expect(err).To(BeNil())
+		cacheDir, err = ioutil.TempDir("", "dotnetcore-buildpack.cache.")
+		Expect(err).To(BeNil())
+		depsDir, err = ioutil.TempDir("", "dotnetcore-buildpack.deps.")
+		Expect(err).To(BeNil())
+		hooksDir, err = ioutil.TempDir("", "dotnetcore-buildpack.hooks.")
+		Expect(err).To(BeNil())
+		Expect(os.MkdirAll(filepath.Join(depsDir, "6"), 0755)).To(Succeed())
+
+		logger := libbuildpack.NewLogger(ansicleaner.New(new(bytes.Buffer)))
+		stager = libbuildpack.NewStager([]string{buildDir, cacheDir, depsDir, "6"}, logger, &libbuildpack.Manifest{})
+
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockCommand = NewMockCommand(mockCtrl)
+		hook = hooks.ScriptHook{Log: logger, Command: mockCommand, Dir: hooksDir}
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+		for _, dir := range []string{buildDir, cacheDir, depsDir, hooksDir} {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		}
+	})
+
+	It("does nothing without a hooks directory", func() {
+		hook.Dir = filepath.Join(hooksDir, "missing")
+		Expect(hook.BeforeCompile(stager)).To(Succeed())
+	})
+
+	It("runs the executables in name order with the phase and staging directories", func() {
+		Expect(ioutil.WriteFile(filepath.Join(hooksDir, "b-agent"), []byte("#!/bin/sh"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(hooksDir, "a-agent"), []byte("#!/bin/sh"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(hooksDir, "README"), []byte("docs"), 0644)).To(Succeed())
+
+		gomock.InOrder(
+			mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), filepath.Join(hooksDir, "a-agent"), "after-compile", buildDir, cacheDir, depsDir, "6"),
+			mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), filepath.Join(hooksDir, "b-agent"), "after-compile", buildDir, cacheDir, depsDir, "6"),
+		)
+
+		Expect(hook.AfterCompile(stager)).To(Succeed())
+	})
+
+	It("stops at the first failing hook", func() {
+		Expect(ioutil.WriteFile(filepath.Join(hooksDir, "a-agent"), []byte("#!/bin/sh"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(hooksDir, "b-agent"), []byte("#!/bin/sh"), 0755)).To(Succeed())
+		mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), filepath.Join(hooksDir, "a-agent"), "before-compile", buildDir, cacheDir, depsDir, "6").Return(errors.New("exit status 1"))
+
+		Expect(hook.BeforeCompile(stager)).To(MatchError("exit status 1"))
+	})
+})
@@ -0,0 +1,248 @@
+package installer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+const downloadAttempts = 4
+
+var retryDelay = 2 * time.Second
+
+// SetAppCacheDir caches downloads in the app cache like libbuildpack's
+// installer, and remembers the location so downloads can be resumed there
+func (i *Installer) SetAppCacheDir(appCacheDir string) error {
+	dir, err := filepath.Abs(filepath.Join(appCacheDir, "dependencies"))
+	if err != nil {
+		return err
+	}
+	i.appCacheDir = dir
+	return i.Installer.SetAppCacheDir(appCacheDir)
+}
+
+func (i *Installer) FetchDependency(dep libbuildpack.Dependency, outputFile string) error {
+	return i.FetchDependencyContext(context.Background(), dep, outputFile)
+}
+
+// FetchDependencyContext downloads the dependency to outputFile, giving up
+// once ctx is done
+func (i *Installer) FetchDependencyContext(ctx context.Context, dep libbuildpack.Dependency, outputFile string) error {
+	if err := i.checkIntegrity(dep); err != nil {
+		return err
+	}
+	if i.dryRun {
+		i.log.Info("Would download %s %s", dep.Name, dep.Version)
+		return nil
+	}
+	entry, err := i.manifest.GetEntry(dep)
+	if err != nil {
+		return err
+	}
+	if entry.File == "" && i.appCacheDir == "" {
+		defer os.Remove(outputFile + ".partial")
+		return i.fetch(ctx, dep, entry, outputFile)
+	}
+	// Copied from the packaged buildpack or the app cache
+	if err := i.prefetch(ctx, dep); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return i.Installer.FetchDependency(dep, outputFile)
+}
+
+// prefetch downloads an uncached dependency into the app cache, when there
+// is one, where libbuildpack's installer then finds it. Unlike libbuildpack's download,
+// an interrupted transfer resumes from where it stopped when the server
+// supports range requests.
+func (i *Installer) prefetch(ctx context.Context, dep libbuildpack.Dependency) error {
+	if i.appCacheDir == "" {
+		return nil
+	}
+	entry, err := i.manifest.GetEntry(dep)
+	if err != nil || entry.File != "" {
+		return err
+	}
+
+	sum := sha256.Sum256([]byte(entry.URI))
+	cacheFile := filepath.Join(i.appCacheDir, hex.EncodeToString(sum[:]), filepath.Base(entry.URI))
+	if exists, err := libbuildpack.FileExists(cacheFile); err != nil || exists {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err != nil {
+		return err
+	}
+	return i.fetch(ctx, dep, entry, cacheFile)
+}
+
+// fetch downloads the dependency to path, through path.partial so a failed
+// download can be resumed and a corrupt one is never mistaken for it
+func (i *Installer) fetch(ctx context.Context, dep libbuildpack.Dependency, entry *libbuildpack.ManifestEntry, path string) error {
+	i.log.Info("Download [%s]", redactURI(entry.URI))
+	partial := path + ".partial"
+	var progress func(done, total int64)
+	if i.progress != nil {
+		progress = func(done, total int64) { i.progress(dep, done, total) }
+	}
+	if err := download(ctx, entry.URI, partial, i.log, progress); err != nil {
+		return err
+	}
+	if err := checkSha256(partial, entry.SHA256); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, path)
+}
+
+// download fetches url into path, continuing from the bytes already in
+// path after a failed attempt, and tells progress how much of it arrived
+func download(ctx context.Context, url, path string, log *libbuildpack.Logger, progress func(done, total int64)) error {
+	var err error
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		if attempt > 1 {
+			log.Warning("Download failed, resuming: %s", err.Error())
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryDelay):
+			}
+		}
+		var retry bool
+		retry, err = downloadOnce(ctx, url, path, progress)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+func downloadOnce(ctx context.Context, url, path string, progress func(done, total int64)) (bool, error) {
+	fh, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return false, err
+	}
+	defer fh.Close()
+	offset, err := fh.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	resp, err := HTTPClient().Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// Everything was downloaded before the connection dropped
+		return false, nil
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		// The server ignored the range, so start over
+		if err := fh.Truncate(0); err != nil {
+			return false, err
+		}
+		if _, err := fh.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+	default:
+		return resp.StatusCode >= 500, fmt.Errorf("could not download: %d", resp.StatusCode)
+	}
+
+	var w io.Writer = fh
+	if progress != nil {
+		done, err := fh.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return false, err
+		}
+		total := int64(-1)
+		if resp.ContentLength >= 0 {
+			total = done + resp.ContentLength
+		}
+		// Chunked partial responses still give the size in Content-Range
+		fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", new(int64), new(int64), &total)
+		w = &progressWriter{w: fh, done: done, total: total, report: progress}
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return true, err
+	}
+	return false, nil
+}
+
+type progressWriter struct {
+	w           io.Writer
+	done, total int64
+	report      func(done, total int64)
+}
+
+func (p *progressWriter) Write(data []byte) (int, error) {
+	n, err := p.w.Write(data)
+	p.done += int64(n)
+	p.report(p.done, p.total)
+	return n, err
+}
+
+// LogProgress logs each quarter of a download as it arrives
+func LogProgress(log *libbuildpack.Logger) Progress {
+	logged := map[string]int64{}
+	return func(dep libbuildpack.Dependency, done, total int64) {
+		if total <= 0 {
+			return
+		}
+		key := dep.Name + " " + dep.Version
+		if quarter := done * 4 / total; quarter > logged[key] {
+			logged[key] = quarter
+			log.Info("Downloaded %d%% of %s", quarter*25, key)
+		}
+	}
+}
+
+func checkSha256(path, expected string) error {
+	fh, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, fh); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != expected {
+		return fmt.Errorf("dependency sha256 mismatch: expected sha256 %s, actual sha256 %s", expected, actual)
+	}
+	return nil
+}
+
+// redactURI hides credentials in dependency URIs before they are logged
+func redactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.User == nil {
+		return uri
+	}
+	u.User = url.User("-redacted-")
+	return u.String()
+}
@@ -0,0 +1,181 @@
+package installer_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"dotnetcore/installer"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FetchDependency", func() {
+	var (
+		tmpDir      string
+		content     []byte
+		ranges      []string
+		interrupted bool
+		server      *httptest.Server
+		buffer      *bytes.Buffer
+		subject     *installer.Installer
+		logger      *libbuildpack.Logger
+		m           *libbuildpack.Manifest
+		dep         = libbuildpack.Dependency{Name: "dotnet", Version: "2.1.500"}
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "installer")
+		Expect(err).ToNot(HaveOccurred())
+		content = []byte(strings.Repeat("dotnet sdk ", 1000))
+		ranges = nil
+		interrupted = false
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ranges = append(ranges, r.Header.Get("Range"))
+			if !interrupted {
+				interrupted = true
+				conn, bufrw, err := w.(http.Hijacker).Hijack()
+				Expect(err).ToNot(HaveOccurred())
+				fmt.Fprintf(bufrw, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n", len(content))
+				bufrw.Write(content[:len(content)/2])
+				bufrw.Flush()
+				conn.Close()
+				return
+			}
+			var start int
+			fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[start:])
+		}))
+
+		sum := sha256.Sum256(content)
+		manifest := fmt.Sprintf("---\nlanguage: dotnet-core\ndependencies:\n- name: dotnet\n  version: 2.1.500\n  uri: %s/dotnet.tar.xz\n  sha256: %s\n  cf_stacks: [cflinuxfs2]\n", server.URL, hex.EncodeToString(sum[:]))
+		Expect(ioutil.WriteFile(filepath.Join(tmpDir, "manifest.yml"), []byte(manifest), 0644)).To(Succeed())
+		Expect(os.Setenv("CF_STACK", "cflinuxfs2")).To(Succeed())
+
+		buffer = new(bytes.Buffer)
+		logger = libbuildpack.NewLogger(ansicleaner.New(buffer))
+		m, err = libbuildpack.NewManifest(tmpDir, logger, time.Now())
+		Expect(err).ToNot(HaveOccurred())
+		subject = installer.New(m, logger)
+		Expect(subject.SetAppCacheDir(filepath.Join(tmpDir, "cache"))).To(Succeed())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		Expect(os.Unsetenv("CF_STACK")).To(Succeed())
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("resumes an interrupted download from where it stopped", func() {
+		output := filepath.Join(tmpDir, "dotnet.tar.xz")
+		Expect(subject.FetchDependency(dep, output)).To(Succeed())
+
+		Expect(ioutil.ReadFile(output)).To(Equal(content))
+		Expect(ranges).To(Equal([]string{"", fmt.Sprintf("bytes=%d-", len(content)/2)}))
+		Expect(buffer.String()).To(ContainSubstring("Download failed, resuming"))
+	})
+
+	It("reuses the completed download from the app cache", func() {
+		Expect(subject.FetchDependency(dep, filepath.Join(tmpDir, "first.tar.xz"))).To(Succeed())
+		ranges = nil
+
+		Expect(subject.FetchDependency(dep, filepath.Join(tmpDir, "second.tar.xz"))).To(Succeed())
+		Expect(ranges).To(BeEmpty())
+		Expect(ioutil.ReadFile(filepath.Join(tmpDir, "second.tar.xz"))).To(Equal(content))
+	})
+
+	It("reports the progress of the download, counting the resumed bytes", func() {
+		var last, total int64
+		subject.SetProgress(func(d libbuildpack.Dependency, done, t int64) {
+			Expect(d).To(Equal(dep))
+			Expect(done).To(BeNumerically(">=", last))
+			last, total = done, t
+		})
+
+		Expect(subject.FetchDependency(dep, filepath.Join(tmpDir, "dotnet.tar.xz"))).To(Succeed())
+		Expect(last).To(Equal(int64(len(content))))
+		Expect(total).To(Equal(int64(len(content))))
+	})
+
+	It("gives up without retrying once the context is cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		subject.SetProgress(func(libbuildpack.Dependency, int64, int64) { cancel() })
+
+		Expect(subject.FetchDependencyContext(ctx, dep, filepath.Join(tmpDir, "dotnet.tar.xz"))).To(MatchError(context.Canceled))
+		Expect(ranges).To(HaveLen(1))
+		Expect(filepath.Join(tmpDir, "dotnet.tar.xz")).ToNot(BeAnExistingFile())
+	})
+
+	It("downloads without an app cache dir, as in finalize", func() {
+		subject = installer.New(m, logger)
+		output := filepath.Join(tmpDir, "dotnet.tar.xz")
+
+		Expect(subject.FetchDependency(dep, output)).To(Succeed())
+		Expect(ioutil.ReadFile(output)).To(Equal(content))
+		Expect(ranges).To(Equal([]string{"", fmt.Sprintf("bytes=%d-", len(content)/2)}))
+		Expect(output + ".partial").ToNot(BeAnExistingFile())
+	})
+
+	It("gives up an install once the context is cancelled without an app cache dir", func() {
+		subject = installer.New(m, logger)
+		ctx, cancel := context.WithCancel(context.Background())
+		subject.SetProgress(func(libbuildpack.Dependency, int64, int64) { cancel() })
+
+		Expect(subject.InstallDependencyContext(ctx, dep, filepath.Join(tmpDir, "dotnet"))).To(MatchError(context.Canceled))
+		Expect(ranges).To(HaveLen(1))
+		Expect(filepath.Join(tmpDir, "dotnet")).ToNot(BeAnExistingFile())
+	})
+
+	It("only logs the dependencies in a dry run", func() {
+		subject.SetDryRun(true)
+
+		Expect(subject.FetchDependency(dep, filepath.Join(tmpDir, "dotnet.tar.xz"))).To(Succeed())
+		Expect(subject.InstallDependency(dep, filepath.Join(tmpDir, "dotnet"))).To(Succeed())
+		Expect(ranges).To(BeEmpty())
+		Expect(filepath.Join(tmpDir, "dotnet")).ToNot(BeAnExistingFile())
+		Expect(buffer.String()).To(ContainSubstring("Would download dotnet 2.1.500"))
+		Expect(buffer.String()).To(ContainSubstring(fmt.Sprintf("Would install dotnet 2.1.500 from %s/dotnet.tar.xz", server.URL)))
+	})
+
+	Context("under the strict integrity policy", func() {
+		BeforeEach(func() {
+			Expect(os.Setenv("INTEGRITY_POLICY", "strict")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Unsetenv("INTEGRITY_POLICY")).To(Succeed())
+		})
+
+		It("refuses downloads over plain HTTP", func() {
+			Expect(subject.FetchDependency(dep, filepath.Join(tmpDir, "dotnet.tar.xz"))).To(MatchError(fmt.Sprintf("dotnet 2.1.500 is downloaded from %s/dotnet.tar.xz, but INTEGRITY_POLICY=strict only allows https", server.URL)))
+			Expect(ranges).To(BeEmpty())
+		})
+
+		It("refuses dependencies without a sha256 checksum", func() {
+			manifest := "---\nlanguage: dotnet-core\ndependencies:\n- name: dotnet\n  version: 2.1.500\n  uri: https://example.com/dotnet.tar.xz\n  sha256: 0123456789abcdef0123456789abcdef\n  cf_stacks: [cflinuxfs2]\n- name: node\n  version: 6.0.0\n  uri: https://example.com/node.tar.gz\n  md5: 0123456789abcdef0123456789abcdef\n  cf_stacks: [cflinuxfs2]\n"
+			Expect(ioutil.WriteFile(filepath.Join(tmpDir, "manifest.yml"), []byte(manifest), 0644)).To(Succeed())
+			logger := libbuildpack.NewLogger(ansicleaner.New(buffer))
+			m, err := libbuildpack.NewManifest(tmpDir, logger, time.Now())
+			Expect(err).ToNot(HaveOccurred())
+			subject = installer.New(m, logger)
+
+			Expect(subject.FetchDependency(dep, filepath.Join(tmpDir, "dotnet.tar.xz"))).To(MatchError("dotnet 2.1.500 has a 128 bit checksum, but INTEGRITY_POLICY=strict only accepts sha256, not md5 or sha1"))
+			Expect(subject.InstallOnlyVersion("node", filepath.Join(tmpDir, "node"))).To(MatchError("node 6.0.0 has no sha256 checksum, which INTEGRITY_POLICY=strict requires"))
+		})
+	})
+})
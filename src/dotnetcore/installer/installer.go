@@ -0,0 +1,214 @@
+package installer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Installer installs dependencies like libbuildpack's, but resumes
+// interrupted downloads, abandons them once the staging context is done,
+// and extracts gzip and zstd archives with a parallel decompressor when the
+// stack has one. Archives it can't speed up are extracted by libbuildpack.
+type Installer struct {
+	*libbuildpack.Installer
+	manifest    *libbuildpack.Manifest
+	log         *libbuildpack.Logger
+	appCacheDir string
+	progress    Progress
+	dryRun      bool
+}
+
+// Progress is told how many bytes of a dependency's download have arrived,
+// out of total, which is -1 when the server doesn't say
+type Progress func(dep libbuildpack.Dependency, done, total int64)
+
+func New(manifest *libbuildpack.Manifest, logger *libbuildpack.Logger) *Installer {
+	return &Installer{Installer: libbuildpack.NewInstaller(manifest), manifest: manifest, log: logger}
+}
+
+// SetProgress reports the progress of downloads to progress
+func (i *Installer) SetProgress(progress Progress) *Installer {
+	i.progress = progress
+	return i
+}
+
+// SetDryRun makes the installer check and log the dependencies it would
+// install, without downloading or installing them
+func (i *Installer) SetDryRun(dryRun bool) *Installer {
+	i.dryRun = dryRun
+	return i
+}
+
+func (i *Installer) InstallDependency(dep libbuildpack.Dependency, outputDir string) error {
+	return i.InstallDependencyContext(context.Background(), dep, outputDir)
+}
+
+// InstallDependencyContext installs the dependency, abandoning the download
+// or extraction once ctx is done
+func (i *Installer) InstallDependencyContext(ctx context.Context, dep libbuildpack.Dependency, outputDir string) error {
+	entry, err := i.manifest.GetEntry(dep)
+	if err != nil {
+		return err
+	}
+	if err := checkIntegrity(entry); err != nil {
+		return err
+	}
+	if i.dryRun {
+		i.log.Info("Would install %s %s from %s", dep.Name, dep.Version, redactURI(entry.URI))
+		return nil
+	}
+	ext := archiveExtension(entry.URI)
+
+	i.log.BeginStep("Installing %s %s", dep.Name, dep.Version)
+	tmpDir, err := ioutil.TempDir("", "installer")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archive := filepath.Join(tmpDir, dep.Name+ext)
+	if err := i.FetchDependencyContext(ctx, dep, archive); err != nil {
+		return err
+	}
+	if err := i.warnOutdated(dep); err != nil {
+		return err
+	}
+	if parallel(ext) {
+		return ExtractContext(ctx, archive, outputDir)
+	}
+
+	// The same as libbuildpack's installer does
+	if ext == ".sh" {
+		return os.Rename(archive, outputDir)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+	switch ext {
+	case ".zip":
+		return libbuildpack.ExtractZip(archive, outputDir)
+	case ".tar.xz":
+		return libbuildpack.ExtractTarXz(archive, outputDir)
+	}
+	return libbuildpack.ExtractTarGz(archive, outputDir)
+}
+
+// InstallOnlyVersion installs the single version of depName in the
+// manifest through InstallDependency, so it is checked and downloaded the
+// same way
+func (i *Installer) InstallOnlyVersion(depName string, installDir string) error {
+	versions := i.manifest.AllDependencyVersions(depName)
+	if len(versions) > 1 {
+		return fmt.Errorf("more than one version of %s found", depName)
+	} else if len(versions) == 0 {
+		return fmt.Errorf("no versions of %s found", depName)
+	}
+	return i.InstallDependency(libbuildpack.Dependency{Name: depName, Version: versions[0]}, installDir)
+}
+
+func (i *Installer) checkIntegrity(dep libbuildpack.Dependency) error {
+	entry, err := i.manifest.GetEntry(dep)
+	if err != nil {
+		return err
+	}
+	return checkIntegrity(entry)
+}
+
+// Extract unpacks a .tar.gz, .tgz, .tar.xz, .tar.zst or .tzst archive into
+// destDir, decompressing with all cores where the decompressor supports it
+func Extract(archive, destDir string) error {
+	return ExtractContext(context.Background(), archive, destDir)
+}
+
+// ExtractContext extracts like Extract, killing the decompressor and tar
+// once ctx is done
+func ExtractContext(ctx context.Context, archive, destDir string) error {
+	decompressor, err := decompressorFor(archiveExtension(archive))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	input, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	decompress := exec.CommandContext(ctx, decompressor[0], decompressor[1:]...)
+	decompress.Stdin = input
+	untar := exec.CommandContext(ctx, "tar", "-x", "-C", destDir)
+	if untar.Stdin, err = decompress.StdoutPipe(); err != nil {
+		return err
+	}
+	decompressErr := &bytes.Buffer{}
+	untarErr := &bytes.Buffer{}
+	decompress.Stderr = decompressErr
+	untar.Stderr = untarErr
+
+	if err := untar.Start(); err != nil {
+		return err
+	}
+	if err := decompress.Run(); err != nil {
+		untar.Wait()
+		return fmt.Errorf("decompressing %s with %s: %v %s", filepath.Base(archive), decompressor[0], err, decompressErr.String())
+	}
+	if err := untar.Wait(); err != nil {
+		return fmt.Errorf("extracting %s: %v %s", filepath.Base(archive), err, untarErr.String())
+	}
+	return nil
+}
+
+func archiveExtension(path string) string {
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar.xz", ".tar.zst", ".tzst"} {
+		if strings.HasSuffix(path, ext) {
+			return ext
+		}
+	}
+	return filepath.Ext(path)
+}
+
+// parallel reports whether this stack can decompress the archive type on
+// several cores
+func parallel(ext string) bool {
+	switch ext {
+	case ".tar.zst", ".tzst":
+		return available("zstd")
+	case ".tar.gz", ".tgz":
+		return available("pigz")
+	}
+	return false
+}
+
+func decompressorFor(ext string) ([]string, error) {
+	switch ext {
+	case ".tar.zst", ".tzst":
+		if !available("zstd") {
+			return nil, fmt.Errorf("zstd is needed to extract %s archives", ext)
+		}
+		return []string{"zstd", "-d", "-c", "-T0"}, nil
+	case ".tar.gz", ".tgz":
+		if available("pigz") {
+			return []string{"pigz", "-d", "-c"}, nil
+		}
+		return []string{"gzip", "-d", "-c"}, nil
+	case ".tar.xz":
+		return []string{"xz", "-d", "-c", "-T0"}, nil
+	}
+	return nil, fmt.Errorf("unsupported archive type %s", ext)
+}
+
+func available(program string) bool {
+	_, err := exec.LookPath(program)
+	return err == nil
+}
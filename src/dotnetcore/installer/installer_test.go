@@ -0,0 +1,142 @@
+package installer_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"dotnetcore/installer"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Extract", func() {
+	var (
+		srcDir  string
+		destDir string
+		tmpDir  string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "installer")
+		Expect(err).ToNot(HaveOccurred())
+		srcDir = filepath.Join(tmpDir, "src")
+		destDir = filepath.Join(tmpDir, "dest")
+		Expect(os.MkdirAll(filepath.Join(srcDir, "sdk", "2.1.500"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(srcDir, "dotnet"), []byte("host"), 0755)).To(Succeed())
+		Expect(os.Symlink("dotnet", filepath.Join(srcDir, "dotnet-link"))).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	archive := func(name, compressor string) string {
+		path := filepath.Join(tmpDir, name)
+		cmd := exec.Command("sh", "-c", "tar -cf - . | "+compressor+" > "+path)
+		cmd.Dir = srcDir
+		Expect(cmd.Run()).To(Succeed())
+		return path
+	}
+
+	expectExtracted := func() {
+		Expect(filepath.Join(destDir, "sdk", "2.1.500")).To(BeADirectory())
+		Expect(ioutil.ReadFile(filepath.Join(destDir, "dotnet"))).To(Equal([]byte("host")))
+		Expect(os.Readlink(filepath.Join(destDir, "dotnet-link"))).To(Equal("dotnet"))
+		info, err := os.Stat(filepath.Join(destDir, "dotnet"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+	}
+
+	It("extracts gzip archives", func() {
+		Expect(installer.Extract(archive("dotnet.tar.gz", "gzip"), destDir)).To(Succeed())
+		expectExtracted()
+	})
+
+	It("extracts zstd archives", func() {
+		if _, err := exec.LookPath("zstd"); err != nil {
+			Skip("zstd is not installed")
+		}
+		Expect(installer.Extract(archive("dotnet.tar.zst", "zstd"), destDir)).To(Succeed())
+		expectExtracted()
+	})
+
+	It("reports corrupt archives", func() {
+		path := filepath.Join(tmpDir, "broken.tar.gz")
+		Expect(ioutil.WriteFile(path, []byte("not gzip"), 0644)).To(Succeed())
+		Expect(installer.Extract(path, destDir)).To(MatchError(ContainSubstring("decompressing broken.tar.gz")))
+	})
+
+	It("rejects unknown archive types", func() {
+		Expect(installer.Extract(filepath.Join(tmpDir, "dotnet.rar"), destDir)).To(MatchError("unsupported archive type .rar"))
+	})
+})
+
+var _ = Describe("InstallDependency", func() {
+	var (
+		tmpDir string
+		server *httptest.Server
+		buffer *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("zstd"); err != nil {
+			Skip("zstd is not installed")
+		}
+		var err error
+		tmpDir, err = ioutil.TempDir("", "installer")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Join(tmpDir, "src"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(tmpDir, "src", "dotnet"), []byte("host"), 0755)).To(Succeed())
+		cmd := exec.Command("sh", "-c", "tar -cf - . | zstd > ../dotnet.tar.zst")
+		cmd.Dir = filepath.Join(tmpDir, "src")
+		Expect(cmd.Run()).To(Succeed())
+		content, err := ioutil.ReadFile(filepath.Join(tmpDir, "dotnet.tar.zst"))
+		Expect(err).ToNot(HaveOccurred())
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(content)
+		}))
+		sum := sha256.Sum256(content)
+		manifest := "---\nlanguage: dotnet-core\n" +
+			fmt.Sprintf("dependency_deprecation_dates:\n- name: dotnet\n  version_line: 2.1.x\n  date: %s\n  link: https://example.com/eol\n", time.Now().Format("2006-01-02")) +
+			"dependencies:\n"
+		for _, version := range []string{"2.1.500", "2.1.502"} {
+			manifest += fmt.Sprintf("- name: dotnet\n  version: %s\n  uri: %s/dotnet.tar.zst\n  sha256: %s\n  cf_stacks: [cflinuxfs2]\n", version, server.URL, hex.EncodeToString(sum[:]))
+		}
+		Expect(ioutil.WriteFile(filepath.Join(tmpDir, "manifest.yml"), []byte(manifest), 0644)).To(Succeed())
+		Expect(os.Setenv("CF_STACK", "cflinuxfs2")).To(Succeed())
+		buffer = new(bytes.Buffer)
+	})
+
+	AfterEach(func() {
+		if server == nil {
+			return
+		}
+		server.Close()
+		Expect(os.Unsetenv("CF_STACK")).To(Succeed())
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("warns about newer patches and end of life like libbuildpack's installer", func() {
+		logger := libbuildpack.NewLogger(ansicleaner.New(buffer))
+		m, err := libbuildpack.NewManifest(tmpDir, logger, time.Now())
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(installer.New(m, logger).InstallDependency(libbuildpack.Dependency{Name: "dotnet", Version: "2.1.500"}, filepath.Join(tmpDir, "dotnet"))).To(Succeed())
+		Expect(ioutil.ReadFile(filepath.Join(tmpDir, "dotnet", "dotnet"))).To(Equal([]byte("host")))
+		Expect(buffer.String()).To(ContainSubstring("**WARNING** A newer version of dotnet is available in this buildpack. Please adjust your app to use version 2.1.502 instead of version 2.1.500"))
+		Expect(buffer.String()).To(ContainSubstring("**WARNING** dotnet 2.1.x will no longer be available in new buildpacks released after"))
+	})
+})
@@ -0,0 +1,68 @@
+package installer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// StrictIntegrity reports whether the operator set INTEGRITY_POLICY=strict,
+// for platforms that must only install verified dependencies fetched over
+// TLS, such as FIPS environments
+func StrictIntegrity() bool {
+	return os.Getenv("INTEGRITY_POLICY") == "strict"
+}
+
+// checkIntegrity refuses, under the strict integrity policy, dependencies
+// without a SHA-256 checksum, including those with only an MD5 or SHA-1
+// one, and dependencies downloaded over plain HTTP
+func checkIntegrity(entry *libbuildpack.ManifestEntry) error {
+	if !StrictIntegrity() {
+		return nil
+	}
+	name := entry.Dependency.Name + " " + entry.Dependency.Version
+	if sum, err := hex.DecodeString(entry.SHA256); err != nil || entry.SHA256 == "" {
+		return fmt.Errorf("%s has no sha256 checksum, which INTEGRITY_POLICY=strict requires", name)
+	} else if len(sum) != 32 {
+		return fmt.Errorf("%s has a %d bit checksum, but INTEGRITY_POLICY=strict only accepts sha256, not md5 or sha1", name, len(sum)*8)
+	}
+	if entry.File != "" {
+		return nil
+	}
+	return CheckHTTPS(name, entry.URI)
+}
+
+// CheckHTTPS refuses, under the strict integrity policy, to download what
+// is named from a URI that isn't https
+func CheckHTTPS(name, uri string) error {
+	if !StrictIntegrity() {
+		return nil
+	}
+	if u, err := url.Parse(uri); err != nil {
+		return err
+	} else if u.Scheme != "https" {
+		return fmt.Errorf("%s is downloaded from %s, but INTEGRITY_POLICY=strict only allows https", name, redactURI(uri))
+	}
+	return nil
+}
+
+// HTTPClient follows redirects to https only under the strict integrity
+// policy
+func HTTPClient() *http.Client {
+	if !StrictIntegrity() {
+		return http.DefaultClient
+	}
+	return &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("redirected to %s, but INTEGRITY_POLICY=strict only allows https", redactURI(req.URL.String()))
+		}
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		return nil
+	}}
+}
@@ -0,0 +1,50 @@
+package installer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// warnOutdated gives the warnings libbuildpack's installer gives when it
+// installs a dependency: that the manifest has a newer patch of it, or
+// that its version line reaches end of life within 30 days
+func (i *Installer) warnOutdated(dep libbuildpack.Dependency) error {
+	v, err := semver.NewVersion(dep.Version)
+	if err != nil {
+		return nil
+	}
+
+	latest, err := libbuildpack.FindMatchingVersion(fmt.Sprintf("%d.%d.x", v.Major(), v.Minor()), i.manifest.AllDependencyVersions(dep.Name))
+	if err != nil {
+		return err
+	}
+	if latest != dep.Version {
+		i.log.Warning("A newer version of %s is available in this buildpack. "+
+			"Please adjust your app to use version %s instead of version %s as soon as possible. "+
+			"Old versions of %s are only provided to assist in migrating to newer versions.", dep.Name, latest, dep.Version, dep.Name)
+	}
+
+	for _, deprecation := range i.manifest.Deprecations {
+		if deprecation.Name != dep.Name {
+			continue
+		}
+		if constraint, err := semver.NewConstraint(deprecation.VersionLine); err != nil || !constraint.Check(v) {
+			continue
+		}
+		eol, err := time.Parse("2006-01-02", deprecation.Date)
+		if err != nil {
+			return err
+		}
+		if time.Until(eol) < 30*24*time.Hour {
+			warning := fmt.Sprintf("%s %s will no longer be available in new buildpacks released after %s.", dep.Name, deprecation.VersionLine, deprecation.Date)
+			if deprecation.Link != "" {
+				warning += "\nSee: " + deprecation.Link
+			}
+			i.log.Warning("%s", warning)
+		}
+	}
+	return nil
+}
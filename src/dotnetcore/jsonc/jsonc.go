@@ -0,0 +1,74 @@
+// Package jsonc reads the JSON files dotnet itself accepts with comments and
+// trailing commas, such as runtimeconfig.json and global.json.
+package jsonc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Load reads the JSON file into obj after removing comments, trailing
+// commas and a byte order mark
+func Load(path string, obj interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(Standardize(data), obj); err != nil {
+		return fmt.Errorf("could not parse %s: %s", path, err)
+	}
+	return nil
+}
+
+// Standardize turns JSON with comments into plain JSON. Comments become
+// whitespace, so the offsets in any error still point into the original.
+func Standardize(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	out := make([]byte, len(data))
+	copy(out, data)
+
+	// Index of the last comma outside a string, to drop if a closing
+	// bracket follows it with only whitespace and comments between
+	comma := -1
+	for i := 0; i < len(out); i++ {
+		switch c := out[i]; {
+		case c == '"':
+			comma = -1
+			for i++; i < len(out) && out[i] != '"'; i++ {
+				if out[i] == '\\' {
+					i++
+				}
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := bytes.Index(out[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(out)
+			} else {
+				end += i + 4
+			}
+			for ; i < end; i++ {
+				if out[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+			i--
+		case c == ',':
+			comma = i
+		case c == '}' || c == ']':
+			if comma >= 0 {
+				out[comma] = ' '
+			}
+			comma = -1
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+		default:
+			comma = -1
+		}
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package jsonc_test
+
+import (
+	"dotnetcore/jsonc"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("jsonc", func() {
+	Describe("Standardize", func() {
+		It("removes comments and trailing commas outside strings", func() {
+			input := "\xef\xbb\xbf" + `{
+  // the runtime
+  "runtimeOptions": {
+    "tfm": "netcoreapp2.1", /* pinned */
+    "framework": { "name": "Microsoft.NETCore.App", "version": "2.1.0", },
+    "configProperties": { "url": "http://example.com/*x*/", "glob": "a//b", "quote": "\"//\"", },
+    "probingPaths": ["a", "b",
+      // more later
+    ],
+  },
+}`
+			obj := map[string]interface{}{}
+			Expect(json.Unmarshal(jsonc.Standardize([]byte(input)), &obj)).To(Succeed())
+			options := obj["runtimeOptions"].(map[string]interface{})
+			Expect(options["tfm"]).To(Equal("netcoreapp2.1"))
+			Expect(options["configProperties"]).To(Equal(map[string]interface{}{"url": "http://example.com/*x*/", "glob": "a//b", "quote": `"//"`}))
+			Expect(options["probingPaths"]).To(Equal([]interface{}{"a", "b"}))
+		})
+
+		It("leaves plain JSON alone", func() {
+			input := `{"a": [1, 2], "b": "c,]"}`
+			Expect(string(jsonc.Standardize([]byte(input)))).To(Equal(input))
+		})
+	})
+
+	Describe("Load", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "jsonc")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("names the file it could not parse", func() {
+			Expect(ioutil.WriteFile(filepath.Join(dir, "app.runtimeconfig.json"), []byte(`{"a": }`), 0644)).To(Succeed())
+			obj := map[string]interface{}{}
+			Expect(jsonc.Load(filepath.Join(dir, "app.runtimeconfig.json"), &obj)).To(MatchError(ContainSubstring("could not parse " + filepath.Join(dir, "app.runtimeconfig.json"))))
+		})
+	})
+})
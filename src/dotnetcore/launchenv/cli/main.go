@@ -0,0 +1,56 @@
+package main
+
+import (
+	"dotnetcore/launchenv"
+	"fmt"
+	"os"
+)
+
+// Prints shell exports for the app's launch environment, derived from the
+// service bindings the app has when it starts. Used from profile.d.
+func main() {
+	if len(os.Args) < 2 {
+		fail("Usage: %s <command> [args]", os.Args[0])
+	}
+
+	var exports []launchenv.Export
+	var err error
+	switch os.Args[1] {
+	case "kestrel-certificate":
+		if len(os.Args) != 3 {
+			fail("Usage: %s kestrel-certificate <dir>", os.Args[0])
+		}
+		exports, err = launchenv.KestrelCertificate(os.Args[2])
+	case "data-protection":
+		if len(os.Args) != 3 {
+			fail("Usage: %s data-protection <home>", os.Args[0])
+		}
+		exports, err = launchenv.DataProtection(os.Args[2])
+	case "service-configuration":
+		if len(os.Args) != 3 {
+			fail("Usage: %s service-configuration <app dir>", os.Args[0])
+		}
+		exports, err = launchenv.ServiceConfiguration(os.Args[2])
+	case "service-credentials":
+		if len(os.Args) < 4 {
+			fail("Usage: %s service-credentials <service> <variable>=<credential>[,<credential>]...", os.Args[0])
+		}
+		exports, err = launchenv.ServiceCredentials(os.Args[2], os.Args[3:])
+	case "probing-paths":
+		if len(os.Args) != 4 {
+			fail("Usage: %s probing-paths <app dir> <packages dir>", os.Args[0])
+		}
+		exports, err = launchenv.ProbingPaths(os.Args[2], os.Args[3])
+	default:
+		fail("Unknown command %s", os.Args[1])
+	}
+	if err != nil {
+		fail("%s: %s", os.Args[1], err.Error())
+	}
+	fmt.Print(launchenv.Script(exports))
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "launchenv: "+format+"\n", args...)
+	os.Exit(1)
+}
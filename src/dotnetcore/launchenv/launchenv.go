@@ -0,0 +1,283 @@
+package launchenv
+
+import (
+	"dotnetcore/services"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Export is an environment variable set for the app at launch
+type Export struct {
+	Name  string
+	Value string
+}
+
+// Script renders exports as shell export statements
+func Script(exports []Export) string {
+	script := ""
+	for _, e := range exports {
+		script += fmt.Sprintf("export %s='%s'\n", e.Name, strings.Replace(e.Value, "'", `'\''`, -1))
+	}
+	return script
+}
+
+// KestrelCertificate writes the certificate of a bound service matching
+// "kestrel-certificate" to dir and points Kestrel's default certificate at
+// it. The service provides either PEM certificate and private_key
+// credentials, or a base64 encoded pfx with an optional password.
+func KestrelCertificate(dir string) ([]Export, error) {
+	service, err := services.Find("kestrel-certificate")
+	if err != nil || service == nil {
+		return nil, err
+	}
+	const prefix = "ASPNETCORE_Kestrel__Certificates__Default__"
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	if pfx := service.Credential("pfx"); pfx != "" {
+		data, err := base64.StdEncoding.DecodeString(pfx)
+		if err != nil {
+			return nil, fmt.Errorf("decoding pfx of service %s: %v", service.Name, err)
+		}
+		path := filepath.Join(dir, "certificate.pfx")
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			return nil, err
+		}
+		exports := []Export{{prefix + "Path", path}}
+		if password := service.Credential("password"); password != "" {
+			exports = append(exports, Export{prefix + "Password", password})
+		}
+		return exports, nil
+	}
+
+	certificate := service.Credential("certificate")
+	key := service.Credential("private_key")
+	if certificate == "" || key == "" {
+		return nil, fmt.Errorf("service %s has neither a pfx nor a certificate and private_key", service.Name)
+	}
+	certPath := filepath.Join(dir, "certificate.pem")
+	keyPath := filepath.Join(dir, "private_key.pem")
+	if err := ioutil.WriteFile(certPath, []byte(certificate), 0600); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(keyPath, []byte(key), 0600); err != nil {
+		return nil, err
+	}
+	return []Export{{prefix + "Path", certPath}, {prefix + "KeyPath", keyPath}}, nil
+}
+
+// DataProtection persists the ASP.NET Core Data Protection key ring in the
+// bound service matching DATA_PROTECTION_SERVICE, or "data-protection" by
+// default. For a volume service the default key directory under home is
+// linked into the volume, so every instance shares the same keys. For a
+// Redis service the connection is exported as configuration for apps that
+// persist their keys to Redis.
+func DataProtection(home string) ([]Export, error) {
+	term := os.Getenv("DATA_PROTECTION_SERVICE")
+	if term == "" {
+		term = "data-protection"
+	}
+	service, err := services.Find(term)
+	if err != nil || service == nil {
+		return nil, err
+	}
+
+	if len(service.VolumeMounts) > 0 {
+		keys := filepath.Join(service.VolumeMounts[0].ContainerDir, "DataProtection-Keys")
+		if err := os.MkdirAll(keys, 0700); err != nil {
+			return nil, err
+		}
+		link := filepath.Join(home, ".aspnet", "DataProtection-Keys")
+		if err := os.MkdirAll(filepath.Dir(link), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.RemoveAll(link); err != nil {
+			return nil, err
+		}
+		if err := os.Symlink(keys, link); err != nil {
+			return nil, err
+		}
+		return []Export{{"DataProtection__KeysDirectory", keys}}, nil
+	}
+
+	host := service.Credential("host", "hostname")
+	if host == "" {
+		return nil, fmt.Errorf("service %s has neither a volume mount nor a redis host", service.Name)
+	}
+	configuration := host
+	if port, ok := service.Credentials["port"]; ok {
+		configuration += fmt.Sprintf(":%v", port)
+	}
+	if password := service.Credential("password"); password != "" {
+		configuration += ",password=" + password
+	}
+	return []Export{
+		{"DataProtection__Redis__Configuration", configuration},
+		{"DataProtection__Redis__Key", "DataProtection-Keys"},
+	}, nil
+}
+
+var nonEnvNameRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// ServiceConfiguration flattens service credentials into environment
+// variables that .NET configuration reads, so apps can bind services
+// without Steeltoe. A service-bindings.json in appDir maps configuration
+// keys to "<service name>.<credential path>", for example
+// {"ConnectionStrings:Orders": "orders-db.uri"}. Without it, setting
+// SERVICE_CONFIGURATION=true exports every scalar credential as
+// Services__<name>__<credential>, and the uri or connection string of each
+// service as ConnectionStrings__<name>.
+func ServiceConfiguration(appDir string) ([]Export, error) {
+	mappingPath := filepath.Join(appDir, "service-bindings.json")
+	mappingExists, err := fileExists(mappingPath)
+	if err != nil {
+		return nil, err
+	}
+	if !mappingExists && os.Getenv("SERVICE_CONFIGURATION") != "true" {
+		return nil, nil
+	}
+
+	all, err := services.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	if mappingExists {
+		return mappedServiceConfiguration(mappingPath, all)
+	}
+
+	var exports []Export
+	for _, service := range all {
+		name := nonEnvNameRe.ReplaceAllString(service.Name, "_")
+		if uri := service.Credential("uri", "connectionString", "connection_string"); uri != "" {
+			exports = append(exports, Export{"ConnectionStrings__" + name, uri})
+		}
+		exports = append(exports, flattenCredentials("Services__"+name, service.Credentials)...)
+	}
+	return exports, nil
+}
+
+func mappedServiceConfiguration(path string, all []services.Service) ([]Export, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mapping := map[string]string{}
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", filepath.Base(path), err)
+	}
+
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	byName := map[string]services.Service{}
+	for _, service := range all {
+		byName[service.Name] = service
+	}
+
+	var exports []Export
+	for _, key := range keys {
+		source := mapping[key]
+		parts := strings.SplitN(source, ".", 2)
+		service, ok := byName[parts[0]]
+		if !ok || len(parts) != 2 {
+			return nil, fmt.Errorf("%s maps %s to %s, but no service named %s is bound", filepath.Base(path), key, source, parts[0])
+		}
+		var value interface{} = service.Credentials
+		for _, field := range strings.Split(parts[1], ".") {
+			fields, _ := value.(map[string]interface{})
+			value = fields[field]
+		}
+		if value == nil {
+			return nil, fmt.Errorf("service %s has no credential %s", service.Name, parts[1])
+		}
+		if _, nested := value.(map[string]interface{}); nested {
+			return nil, fmt.Errorf("credential %s of service %s is not a single value", parts[1], service.Name)
+		}
+		name := nonEnvNameRe.ReplaceAllString(strings.Replace(key, ":", "__", -1), "_")
+		exports = append(exports, Export{name, fmt.Sprintf("%v", value)})
+	}
+	return exports, nil
+}
+
+func flattenCredentials(prefix string, credentials map[string]interface{}) []Export {
+	keys := make([]string, 0, len(credentials))
+	for key := range credentials {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var exports []Export
+	for _, key := range keys {
+		name := prefix + "__" + nonEnvNameRe.ReplaceAllString(key, "_")
+		switch value := credentials[key].(type) {
+		case map[string]interface{}:
+			exports = append(exports, flattenCredentials(name, value)...)
+		case []interface{}, nil:
+		default:
+			exports = append(exports, Export{name, fmt.Sprintf("%v", value)})
+		}
+	}
+	return exports
+}
+
+// ServiceCredentials exports credentials of the bound service matching
+// term, so agent hooks can read secrets at launch instead of writing them
+// into the droplet. Each mapping is "<variable>=<credential>[,<credential>]"
+// and exports the first of the credentials with a scalar value. A
+// credential written as "<prefix>{<credential>}" is exported with the
+// prefix, e.g. InstrumentationKey={instrumentationKey}. Variables the app
+// already sets are left alone.
+func ServiceCredentials(term string, mappings []string) ([]Export, error) {
+	service, err := services.Find(term)
+	if err != nil || service == nil {
+		return nil, err
+	}
+
+	var exports []Export
+	for _, mapping := range mappings {
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s is not <variable>=<credential>", mapping)
+		}
+		if os.Getenv(parts[0]) != "" {
+			continue
+		}
+	credentials:
+		for _, key := range strings.Split(parts[1], ",") {
+			prefix := ""
+			if open := strings.Index(key, "{"); open >= 0 && strings.HasSuffix(key, "}") {
+				prefix, key = key[:open], key[open+1:len(key)-1]
+			}
+			switch value := service.Credentials[key].(type) {
+			case nil, map[string]interface{}, []interface{}:
+			default:
+				exports = append(exports, Export{parts[0], prefix + fmt.Sprintf("%v", value)})
+				break credentials
+			}
+		}
+	}
+	return exports, nil
+}
+
+func fileExists(path string) (bool, error) {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,13 @@
+package launchenv_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestLaunchenv(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Launchenv Suite")
+}
@@ -0,0 +1,205 @@
+package launchenv_test
+
+import (
+	"dotnetcore/launchenv"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Launchenv", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "launchenv")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.Unsetenv("VCAP_SERVICES")).To(Succeed())
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	Describe("Script", func() {
+		It("quotes values for the shell", func() {
+			script := launchenv.Script([]launchenv.Export{{Name: "A", Value: "it's $HOME"}})
+			output, err := exec.Command("bash", "-c", script+"echo \"$A\"").Output()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(output)).To(Equal("it's $HOME\n"))
+		})
+	})
+
+	Describe("KestrelCertificate", func() {
+		It("does nothing without a bound certificate", func() {
+			Expect(launchenv.KestrelCertificate(dir)).To(BeEmpty())
+		})
+
+		It("writes a PEM certificate and key", func() {
+			Expect(os.Setenv("VCAP_SERVICES", `{"user-provided":[{"name":"tls","tags":["kestrel-certificate"],"credentials":{"certificate":"CERT","private_key":"KEY"}}]}`)).To(Succeed())
+			exports, err := launchenv.KestrelCertificate(dir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exports).To(Equal([]launchenv.Export{
+				{Name: "ASPNETCORE_Kestrel__Certificates__Default__Path", Value: filepath.Join(dir, "certificate.pem")},
+				{Name: "ASPNETCORE_Kestrel__Certificates__Default__KeyPath", Value: filepath.Join(dir, "private_key.pem")},
+			}))
+			Expect(ioutil.ReadFile(filepath.Join(dir, "private_key.pem"))).To(Equal([]byte("KEY")))
+		})
+
+		It("writes a pfx with its password", func() {
+			Expect(os.Setenv("VCAP_SERVICES", `{"user-provided":[{"name":"kestrel-certificate","credentials":{"pfx":"UEZY","password":"secret"}}]}`)).To(Succeed())
+			exports, err := launchenv.KestrelCertificate(dir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exports).To(ContainElement(launchenv.Export{Name: "ASPNETCORE_Kestrel__Certificates__Default__Password", Value: "secret"}))
+			Expect(ioutil.ReadFile(filepath.Join(dir, "certificate.pfx"))).To(Equal([]byte("PFX")))
+		})
+
+		It("fails when the service has no usable credentials", func() {
+			Expect(os.Setenv("VCAP_SERVICES", `{"user-provided":[{"name":"kestrel-certificate","credentials":{}}]}`)).To(Succeed())
+			_, err := launchenv.KestrelCertificate(dir)
+			Expect(err).To(MatchError(ContainSubstring("neither a pfx nor a certificate")))
+		})
+	})
+
+	Describe("DataProtection", func() {
+		AfterEach(func() {
+			Expect(os.Unsetenv("DATA_PROTECTION_SERVICE")).To(Succeed())
+		})
+
+		It("does nothing without a bound service", func() {
+			Expect(launchenv.DataProtection(dir)).To(BeEmpty())
+		})
+
+		It("links the key directory into a volume service", func() {
+			volume := filepath.Join(dir, "volume")
+			Expect(os.Setenv("VCAP_SERVICES", `{"nfs":[{"name":"keys","tags":["data-protection"],"volume_mounts":[{"container_dir":"`+volume+`","mode":"rw"}]}]}`)).To(Succeed())
+			home := filepath.Join(dir, "home")
+
+			exports, err := launchenv.DataProtection(home)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exports).To(Equal([]launchenv.Export{{Name: "DataProtection__KeysDirectory", Value: filepath.Join(volume, "DataProtection-Keys")}}))
+			Expect(os.Readlink(filepath.Join(home, ".aspnet", "DataProtection-Keys"))).To(Equal(filepath.Join(volume, "DataProtection-Keys")))
+			Expect(filepath.Join(volume, "DataProtection-Keys")).To(BeADirectory())
+		})
+
+		It("exports the connection of a redis service chosen by DATA_PROTECTION_SERVICE", func() {
+			Expect(os.Setenv("DATA_PROTECTION_SERVICE", "session-redis")).To(Succeed())
+			Expect(os.Setenv("VCAP_SERVICES", `{"p-redis":[{"name":"session-redis","credentials":{"host":"10.0.0.1","port":6379,"password":"pw"}}]}`)).To(Succeed())
+
+			Expect(launchenv.DataProtection(dir)).To(Equal([]launchenv.Export{
+				{Name: "DataProtection__Redis__Configuration", Value: "10.0.0.1:6379,password=pw"},
+				{Name: "DataProtection__Redis__Key", Value: "DataProtection-Keys"},
+			}))
+		})
+	})
+
+	Describe("ServiceConfiguration", func() {
+		BeforeEach(func() {
+			Expect(os.Setenv("VCAP_SERVICES", `{
+				"p.mysql": [{"name": "orders-db", "credentials": {"uri": "mysql://orders", "port": 3306, "tls": {"ca": "CA"}}}]
+			}`)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Unsetenv("SERVICE_CONFIGURATION")).To(Succeed())
+		})
+
+		It("does nothing unless enabled", func() {
+			Expect(launchenv.ServiceConfiguration(dir)).To(BeEmpty())
+		})
+
+		It("flattens every service when SERVICE_CONFIGURATION is true", func() {
+			Expect(os.Setenv("SERVICE_CONFIGURATION", "true")).To(Succeed())
+			Expect(launchenv.ServiceConfiguration(dir)).To(Equal([]launchenv.Export{
+				{Name: "ConnectionStrings__orders_db", Value: "mysql://orders"},
+				{Name: "Services__orders_db__port", Value: "3306"},
+				{Name: "Services__orders_db__tls__ca", Value: "CA"},
+				{Name: "Services__orders_db__uri", Value: "mysql://orders"},
+			}))
+		})
+
+		It("exports only the keys in service-bindings.json", func() {
+			Expect(ioutil.WriteFile(filepath.Join(dir, "service-bindings.json"), []byte(`{"ConnectionStrings:Orders": "orders-db.uri", "Orders:CA": "orders-db.tls.ca"}`), 0644)).To(Succeed())
+			Expect(launchenv.ServiceConfiguration(dir)).To(Equal([]launchenv.Export{
+				{Name: "ConnectionStrings__Orders", Value: "mysql://orders"},
+				{Name: "Orders__CA", Value: "CA"},
+			}))
+		})
+
+		It("fails when the mapping names a service that is not bound", func() {
+			Expect(ioutil.WriteFile(filepath.Join(dir, "service-bindings.json"), []byte(`{"ConnectionStrings:Cache": "cache.uri"}`), 0644)).To(Succeed())
+			_, err := launchenv.ServiceConfiguration(dir)
+			Expect(err).To(MatchError(ContainSubstring("no service named cache is bound")))
+		})
+
+		It("fails when the credential is missing", func() {
+			Expect(ioutil.WriteFile(filepath.Join(dir, "service-bindings.json"), []byte(`{"Orders:User": "orders-db.username"}`), 0644)).To(Succeed())
+			_, err := launchenv.ServiceConfiguration(dir)
+			Expect(err).To(MatchError("service orders-db has no credential username"))
+		})
+	})
+
+	Describe("ServiceCredentials", func() {
+		BeforeEach(func() {
+			Expect(os.Setenv("VCAP_SERVICES", `{"newrelic": [{"name": "apm", "label": "newrelic", "credentials": {"license_key": "it's secret", "port": 443}}]}`)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Unsetenv("NEW_RELIC_LICENSE_KEY")).To(Succeed())
+		})
+
+		It("exports the first scalar credential of each mapping", func() {
+			Expect(launchenv.ServiceCredentials("newrelic", []string{"NEW_RELIC_LICENSE_KEY=licenseKey,license_key", "PORT=port", "HOST=host"})).To(Equal([]launchenv.Export{
+				{Name: "NEW_RELIC_LICENSE_KEY", Value: "it's secret"},
+				{Name: "PORT", Value: "443"},
+			}))
+		})
+
+		It("exports a credential with the prefix it is written with", func() {
+			Expect(os.Setenv("VCAP_SERVICES", `{"azure-appinsights": [{"name": "telemetry", "label": "azure-appinsights", "credentials": {"instrumentationKey": "abc"}}]}`)).To(Succeed())
+			Expect(launchenv.ServiceCredentials("insights", []string{"APPLICATIONINSIGHTS_CONNECTION_STRING=connectionString,InstrumentationKey={instrumentationKey}"})).To(Equal([]launchenv.Export{
+				{Name: "APPLICATIONINSIGHTS_CONNECTION_STRING", Value: "InstrumentationKey=abc"},
+			}))
+		})
+
+		It("leaves variables the app sets alone", func() {
+			Expect(os.Setenv("NEW_RELIC_LICENSE_KEY", "abc123")).To(Succeed())
+			Expect(launchenv.ServiceCredentials("newrelic", []string{"NEW_RELIC_LICENSE_KEY=license_key"})).To(BeEmpty())
+		})
+
+		It("does nothing without a matching service", func() {
+			Expect(launchenv.ServiceCredentials("appdynamics", []string{"APPDYNAMICS_AGENT_ACCOUNT_ACCESS_KEY=account-access-key"})).To(BeEmpty())
+		})
+	})
+
+	Describe("ProbingPaths", func() {
+		It("points additionalProbingPaths at the packages dir", func() {
+			path := filepath.Join(dir, "app.runtimeconfig.dev.json")
+			Expect(ioutil.WriteFile(path, []byte(`{
+  // generated by dotnet build
+  "runtimeOptions": { "additionalProbingPaths": ["/Users/dev/.nuget/packages"] }
+}`), 0644)).To(Succeed())
+
+			Expect(launchenv.HasProbingPaths(dir)).To(BeTrue())
+			Expect(launchenv.ProbingPaths(dir, "/deps/0/.nuget/packages")).To(BeEmpty())
+
+			data, err := ioutil.ReadFile(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(ContainSubstring(`"/deps/0/.nuget/packages"`))
+			Expect(string(data)).ToNot(ContainSubstring("/Users/dev"))
+		})
+
+		It("leaves runtimeconfigs without probing paths alone", func() {
+			path := filepath.Join(dir, "app.runtimeconfig.json")
+			Expect(ioutil.WriteFile(path, []byte(`{"runtimeOptions": {}}`), 0644)).To(Succeed())
+
+			Expect(launchenv.HasProbingPaths(dir)).To(BeFalse())
+			Expect(launchenv.ProbingPaths(dir, "/deps/0/.nuget/packages")).To(BeEmpty())
+			Expect(ioutil.ReadFile(path)).To(Equal([]byte(`{"runtimeOptions": {}}`)))
+		})
+	})
+})
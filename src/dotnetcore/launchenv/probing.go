@@ -0,0 +1,63 @@
+package launchenv
+
+import (
+	"dotnetcore/jsonc"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// probingConfigs returns the runtimeconfig.json and runtimeconfig.dev.json
+// files in appDir that set additionalProbingPaths, parsed
+func probingConfigs(appDir string) (map[string]map[string]interface{}, error) {
+	var paths []string
+	for _, pattern := range []string{"*.runtimeconfig.json", "*.runtimeconfig.dev.json"} {
+		matches, err := filepath.Glob(filepath.Join(appDir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+
+	configs := map[string]map[string]interface{}{}
+	for _, path := range paths {
+		config := map[string]interface{}{}
+		if err := jsonc.Load(path, &config); err != nil {
+			return nil, err
+		}
+		if options, ok := config["runtimeOptions"].(map[string]interface{}); ok {
+			if _, ok := options["additionalProbingPaths"]; ok {
+				configs[path] = config
+			}
+		}
+	}
+	return configs, nil
+}
+
+// HasProbingPaths reports whether the app in appDir looks for assemblies
+// in additional probing paths, typically the NuGet cache of the machine it
+// was built on
+func HasProbingPaths(appDir string) (bool, error) {
+	configs, err := probingConfigs(appDir)
+	return len(configs) > 0, err
+}
+
+// ProbingPaths points the additional probing paths of the app in appDir at
+// packagesDir, the NuGet cache kept in the droplet. It exports nothing.
+func ProbingPaths(appDir, packagesDir string) ([]Export, error) {
+	configs, err := probingConfigs(appDir)
+	if err != nil {
+		return nil, err
+	}
+	for path, config := range configs {
+		config["runtimeOptions"].(map[string]interface{})["additionalProbingPaths"] = []string{packagesDir}
+		data, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,90 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	propertyRefRe = regexp.MustCompile(`\$\(([A-Za-z_][A-Za-z0-9_.-]*)\)`)
+	comparisonRe  = regexp.MustCompile(`^'([^']*)'\s*(==|!=)\s*'([^']*)'$`)
+	andOrRe       = regexp.MustCompile(`(?i)\s+(and|or)\s+`)
+)
+
+// Configuration is the build configuration dotnet publish runs with:
+// Release when PUBLISH_RELEASE_CONFIG is true, Debug otherwise
+func Configuration() string {
+	if os.Getenv("PUBLISH_RELEASE_CONFIG") == "true" {
+		return "Release"
+	}
+	return "Debug"
+}
+
+// evaluator resolves the properties of one project file the way MSBuild
+// would for a publish, in document order and honouring conditions
+type evaluator struct {
+	properties map[string]string
+}
+
+func newEvaluator(projectPath, configuration string) *evaluator {
+	name := strings.TrimSuffix(filepath.Base(projectPath), filepath.Ext(projectPath))
+	return &evaluator{properties: map[string]string{
+		"Configuration":      configuration,
+		"Platform":           "AnyCPU",
+		"MSBuildProjectName": name,
+	}}
+}
+
+// expand replaces references to properties defined so far, or to env
+// vars, which MSBuild also exposes as properties. Other references are left
+// as they are in values, and are empty in conditions as they are for MSBuild.
+func (e *evaluator) expand(value string, inCondition bool) string {
+	return propertyRefRe.ReplaceAllStringFunc(value, func(ref string) string {
+		name := propertyRefRe.FindStringSubmatch(ref)[1]
+		if value, ok := e.properties[name]; ok {
+			return value
+		} else if value, ok := os.LookupEnv(name); ok {
+			return value
+		} else if inCondition {
+			return ""
+		}
+		return ref
+	})
+}
+
+// condition evaluates comparisons of quoted strings, optionally joined by
+// and or or without parentheses. Other conditions, such as Exists(), are
+// treated as false.
+func (e *evaluator) condition(condition string) bool {
+	condition = strings.TrimSpace(condition)
+	if condition == "" {
+		return true
+	}
+
+	operators := andOrRe.FindAllStringSubmatch(condition, -1)
+	terms := andOrRe.Split(condition, -1)
+	result := e.comparison(terms[0])
+	for i, operator := range operators {
+		if strings.EqualFold(operator[1], "and") {
+			result = result && e.comparison(terms[i+1])
+		} else {
+			result = result || e.comparison(terms[i+1])
+		}
+	}
+	return result
+}
+
+func (e *evaluator) comparison(term string) bool {
+	match := comparisonRe.FindStringSubmatch(strings.TrimSpace(term))
+	if match == nil {
+		return false
+	}
+	equal := strings.EqualFold(e.expand(match[1], true), e.expand(match[3], true))
+	return equal == (match[2] == "==")
+}
+
+func (e *evaluator) set(name, value string) {
+	e.properties[name] = e.expand(value, false)
+}
@@ -0,0 +1,44 @@
+package project
+
+import (
+	"regexp"
+	"strings"
+)
+
+// netcoreTfmRe matches the target frameworks that run on .NET Core:
+// netcoreapp1.0 to netcoreapp3.1, and net5.0 onwards with an optional
+// platform such as net6.0-android
+var netcoreTfmRe = regexp.MustCompile(`^(?:netcoreapp(\d+\.\d+)|net([5-9]\d*\.\d+|[1-9]\d+\.\d+))(?:-.*)?$`)
+
+// TargetFrameworks returns the frameworks the project builds for, from
+// TargetFramework or else the semicolon separated TargetFrameworks
+func (p *Project) TargetFrameworks(projectPath string) ([]string, error) {
+	if tfm, err := p.ProjectProperty(projectPath, "TargetFramework"); err != nil || tfm != "" {
+		if tfm == "" {
+			return nil, err
+		}
+		return []string{tfm}, err
+	}
+	tfms, err := p.ProjectProperty(projectPath, "TargetFrameworks")
+	if err != nil {
+		return nil, err
+	}
+	var frameworks []string
+	for _, tfm := range strings.Split(tfms, ";") {
+		if tfm = strings.TrimSpace(tfm); tfm != "" {
+			frameworks = append(frameworks, tfm)
+		}
+	}
+	return frameworks, nil
+}
+
+// FrameworkVersion returns the major.minor version of the .NET Core runtime
+// a target framework runs on, and false for frameworks that don't run on
+// it, such as netstandard2.0 or net472
+func FrameworkVersion(tfm string) (string, bool) {
+	match := netcoreTfmRe.FindStringSubmatch(strings.ToLower(strings.TrimSpace(tfm)))
+	if match == nil {
+		return "", false
+	}
+	return match[1] + match[2], true
+}
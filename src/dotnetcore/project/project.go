@@ -1,9 +1,11 @@
 package project
 
 import (
+	"dotnetcore/config"
+	"dotnetcore/fileindex"
+	"dotnetcore/runtimeconfig"
 	"encoding/xml"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -17,10 +19,30 @@ type Project struct {
 	buildDir string
 	depDir   string
 	depsIdx  string
+	files    *fileindex.Index
+	log      *libbuildpack.Logger
 }
 
 func New(buildDir, depDir, depsIdx string) *Project {
-	return &Project{buildDir: buildDir, depDir: depDir, depsIdx: depsIdx}
+	return &Project{buildDir: buildDir, depDir: depDir, depsIdx: depsIdx, files: fileindex.New(buildDir)}
+}
+
+// Index is the listing of the build dir that the project's lookups share
+func (p *Project) Index() *fileindex.Index {
+	return p.files
+}
+
+// SetLogger makes the project log how it finds and chooses project files
+// at debug level
+func (p *Project) SetLogger(logger *libbuildpack.Logger) *Project {
+	p.log = logger
+	return p
+}
+
+func (p *Project) debug(format string, args ...interface{}) {
+	if p.log != nil {
+		p.log.Debug(format, args...)
+	}
 }
 
 func (p *Project) IsPublished() (bool, error) {
@@ -33,20 +55,112 @@ func (p *Project) IsPublished() (bool, error) {
 
 func (p *Project) ProjFilePaths() ([]string, error) {
 	paths := []string{}
-	if err := filepath.Walk(p.buildDir, func(path string, _ os.FileInfo, err error) error {
-		if strings.Contains(path, "/.cloudfoundry/") {
-			return filepath.SkipDir
-		}
+	files, err := p.files.Files()
+	if err != nil {
+		return []string{}, err
+	}
+	for _, path := range files {
 		if strings.HasSuffix(path, ".csproj") || strings.HasSuffix(path, ".vbproj") || strings.HasSuffix(path, ".fsproj") {
 			paths = append(paths, path)
 		}
-		return nil
-	}); err != nil {
-		return []string{}, err
 	}
+	p.debug("Found project files: %v", paths)
 	return paths, nil
 }
 
+// ReferencesPackage reports whether any project file has a PackageReference
+// to the NuGet package, or for published apps whether its assembly exists
+func (p *Project) ReferencesPackage(name string) (bool, error) {
+	if published, err := p.IsPublished(); err != nil {
+		return false, err
+	} else if published {
+		return libbuildpack.FileExists(filepath.Join(p.buildDir, name+".dll"))
+	}
+
+	paths, err := p.ProjFilePaths()
+	if err != nil {
+		return false, err
+	}
+	for _, path := range paths {
+		if found, err := p.projectReferencesPackage(path, name); err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+func (p *Project) projectReferencesPackage(projectPath, name string) (bool, error) {
+	proj := struct {
+		ItemGroup []struct {
+			PackageReference []struct {
+				Include string `xml:"Include,attr"`
+			}
+		}
+	}{}
+	if err := UnmarshalProjFile(projectPath, &proj); err != nil {
+		return false, err
+	}
+	for _, group := range proj.ItemGroup {
+		for _, ref := range group.PackageReference {
+			if strings.EqualFold(ref.Include, name) {
+				p.debug("%s references %s", projectPath, name)
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// IsTestProject reports whether the project holds tests, through its
+// IsTestProject property or a reference to Microsoft.NET.Test.Sdk
+func (p *Project) IsTestProject(projectPath string) (bool, error) {
+	if isTestProject, err := p.ProjectProperty(projectPath, "IsTestProject"); err != nil {
+		return false, err
+	} else if isTestProject != "" {
+		return strings.EqualFold(isTestProject, "true"), nil
+	}
+	return p.projectReferencesPackage(projectPath, "Microsoft.NET.Test.Sdk")
+}
+
+// TestProjectPaths returns the project files that hold tests
+func (p *Project) TestProjectPaths() ([]string, error) {
+	paths, err := p.ProjFilePaths()
+	if err != nil {
+		return nil, err
+	}
+	testPaths := []string{}
+	for _, path := range paths {
+		if test, err := p.IsTestProject(path); err != nil {
+			return nil, err
+		} else if test {
+			testPaths = append(testPaths, path)
+		}
+	}
+	return testPaths, nil
+}
+
+// InvariantGlobalization reports whether the app opted into globalization
+// invariant mode, through the runtimeconfig of a published app or the
+// InvariantGlobalization property of the main project
+func (p *Project) InvariantGlobalization() (bool, error) {
+	if runtimeConfig, err := p.RuntimeConfigFile(); err != nil {
+		return false, err
+	} else if runtimeConfig != "" {
+		config, err := runtimeconfig.Load(runtimeConfig)
+		if err != nil {
+			return false, err
+		}
+		return config.InvariantGlobalization(), nil
+	}
+
+	mainPath, err := p.MainPath()
+	if err != nil || mainPath == "" {
+		return false, err
+	}
+	invariant, err := p.ProjectProperty(mainPath, "InvariantGlobalization")
+	return strings.EqualFold(invariant, "true"), err
+}
+
 func (p *Project) IsFsharp() (bool, error) {
 	if paths, err := p.ProjFilePaths(); err != nil {
 		return false, err
@@ -61,104 +175,393 @@ func (p *Project) IsFsharp() (bool, error) {
 }
 
 func (p *Project) RuntimeConfigFile() (string, error) {
-	if configFiles, err := filepath.Glob(filepath.Join(p.buildDir, "*.runtimeconfig.json")); err != nil {
-		return "", err
-	} else if len(configFiles) == 1 {
-		return configFiles[0], nil
-	} else if len(configFiles) > 1 {
-		return "", fmt.Errorf("Multiple .runtimeconfig.json files present")
-	}
-	return "", nil
+	return runtimeconfig.Find(p.files)
 }
 
 func (p *Project) MainPath() (string, error) {
 	if runtimeConfigFile, err := p.RuntimeConfigFile(); err != nil {
 		return "", err
 	} else if runtimeConfigFile != "" {
+		p.debug("Using %s as the main project because the app is published", runtimeConfigFile)
 		return runtimeConfigFile, nil
 	}
+	if value := os.Getenv("PROJECT_PATH"); value != "" {
+		mainPath, err := p.resolveProject("PROJECT_PATH", value)
+		if err == nil {
+			p.debug("Using %s as the main project because PROJECT_PATH selects it", mainPath)
+		}
+		return mainPath, err
+	}
 	paths, err := p.ProjFilePaths()
 	if err != nil {
 		return "", err
 	}
 
 	if len(paths) == 1 {
+		p.debug("Using %s as the main project because it is the only project file", paths[0])
 		return paths[0], nil
 	} else if len(paths) > 1 {
-		if exists, err := libbuildpack.FileExists(filepath.Join(p.buildDir, ".deployment")); err != nil {
-			return "", err
-		} else if exists {
-			deployment, err := ini.Load(filepath.Join(p.buildDir, ".deployment"))
-			if err != nil {
-				return "", err
+		if mainPath, err := p.deploymentProject(); err != nil || mainPath != "" {
+			if mainPath != "" {
+				p.debug("Using %s as the main project because .deployment selects it", mainPath)
 			}
-			config, err := deployment.GetSection("config")
-			if err != nil {
-				return "", err
-			}
-			project, err := config.GetKey("project")
-			if err != nil {
+			return mainPath, err
+		}
+		var appPaths []string
+		for _, path := range paths {
+			if test, err := p.IsTestProject(path); err != nil {
 				return "", err
+			} else if !test {
+				appPaths = append(appPaths, path)
 			}
-			return filepath.Join(p.buildDir, strings.Trim(project.String(), ".")), nil
+		}
+		if len(appPaths) == 1 {
+			p.debug("Using %s as the main project because the other project files hold tests", appPaths[0])
+			return appPaths[0], nil
 		}
 		return "", fmt.Errorf("Multiple paths: %v contain a project file, but no .deployment file was used", paths)
 	}
 	return "", nil
 }
 
-func (p *Project) publishedStartCommand(projectPath string) (string, error) {
-	var publishedPath string
-	var runtimePath string
-
-	if published, err := p.IsPublished(); err != nil {
+// deploymentProject returns the project selected by the project setting
+// in the [config] section of a .deployment file, as Kudu reads it: names
+// are case insensitive, the value may be quoted, and it may name the
+// directory holding the project file
+func (p *Project) deploymentProject() (string, error) {
+	path := filepath.Join(p.buildDir, ".deployment")
+	if exists, err := libbuildpack.FileExists(path); err != nil || !exists {
 		return "", err
-	} else if published {
-		publishedPath = p.buildDir
-		runtimePath = "${HOME}"
-	} else {
-		publishedPath = filepath.Join(p.depDir, "dotnet_publish")
-		runtimePath = filepath.Join("${DEPS_DIR}", p.depsIdx, "dotnet_publish")
 	}
 
-	if exists, err := libbuildpack.FileExists(filepath.Join(publishedPath, projectPath)); err != nil {
+	deployment, err := ini.InsensitiveLoad(path)
+	if err != nil {
+		return "", fmt.Errorf("could not parse .deployment: %s", err)
+	}
+	config, err := deployment.GetSection("config")
+	if err != nil {
+		return "", fmt.Errorf(".deployment has no [config] section")
+	}
+	key, err := config.GetKey("project")
+	if err != nil {
+		return "", fmt.Errorf(".deployment has no project setting in its [config] section")
+	}
+	return p.resolveProject(".deployment", key.String())
+}
+
+// resolveProject returns the project file that a setting names, either
+// directly or as the directory holding it
+func (p *Project) resolveProject(setting, value string) (string, error) {
+	value = strings.Trim(strings.TrimSpace(value), `"'`)
+	value = strings.Replace(value, `\`, "/", -1)
+
+	projectPath := filepath.Join(p.buildDir, filepath.FromSlash(value))
+	if rel, err := filepath.Rel(p.buildDir, projectPath); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%s project %s is outside the app", setting, value)
+	}
+	info, err := os.Stat(projectPath)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("%s project %s does not exist", setting, value)
+	} else if err != nil {
 		return "", err
-	} else if exists {
-		if err := os.Chmod(filepath.Join(filepath.Join(publishedPath, projectPath)), 0755); err != nil {
+	} else if !info.IsDir() {
+		return projectPath, nil
+	}
+
+	var projFiles []string
+	for _, pattern := range []string{"*.csproj", "*.fsproj", "*.vbproj"} {
+		matches, err := filepath.Glob(filepath.Join(projectPath, pattern))
+		if err != nil {
 			return "", err
 		}
-		return filepath.Join(runtimePath, projectPath), nil
+		projFiles = append(projFiles, matches...)
+	}
+	if len(projFiles) != 1 {
+		return "", fmt.Errorf("%s project %s is a directory with %d project files, expected 1", setting, value, len(projFiles))
+	}
+	return projFiles[0], nil
+}
+
+// PublishDir returns where the app is published to during staging and
+// where that is at launch: the build dir for apps pushed already published,
+// the directory PUBLISH_OUTPUT_DIR or publish-dir in buildpack.yml names,
+// and otherwise dotnet_publish in the dep dir. Setting either to "project"
+// uses the main project's PublishDir instead. Configured directories are
+// relative to the app and must be inside it, so they are part of the
+// droplet.
+func (p *Project) PublishDir() (string, string, error) {
+	if published, err := p.IsPublished(); err != nil {
+		return "", "", err
+	} else if published {
+		return p.buildDir, filepath.Join("${HOME}", config.BuildSubdir()), nil
 	}
 
-	if exists, err := libbuildpack.FileExists(filepath.Join(publishedPath, fmt.Sprintf("%s.dll", projectPath))); err != nil {
-		return "", fmt.Errorf("checking if a %s.dll file exists: %v", projectPath, err)
-	} else if exists {
-		return fmt.Sprintf("%s.dll", filepath.Join(runtimePath, projectPath)), nil
+	setting, value := "PUBLISH_OUTPUT_DIR", os.Getenv("PUBLISH_OUTPUT_DIR")
+	if value == "" {
+		buildpackYML, err := config.LoadBuildpackYML(p.buildDir)
+		if err != nil {
+			return "", "", err
+		}
+		setting, value = "publish-dir", buildpackYML.DotnetCore.PublishDir
 	}
-	return "", nil
+	base := p.buildDir
+	if value == "project" {
+		mainPath, err := p.MainPath()
+		if err != nil || mainPath == "" {
+			return filepath.Join(p.depDir, "dotnet_publish"), filepath.Join("${DEPS_DIR}", p.depsIdx, "dotnet_publish"), err
+		}
+		if value, err = p.ProjectProperty(mainPath, "PublishDir"); err != nil {
+			return "", "", err
+		}
+		setting, base = "PublishDir", filepath.Dir(mainPath)
+		if strings.Contains(value, "$(") {
+			p.debug("Ignoring the PublishDir %s of %s, which refers to properties set outside it", value, mainPath)
+			value = ""
+		}
+	}
+	if value == "" {
+		return filepath.Join(p.depDir, "dotnet_publish"), filepath.Join("${DEPS_DIR}", p.depsIdx, "dotnet_publish"), nil
+	}
+
+	path := filepath.FromSlash(strings.Replace(strings.TrimSpace(value), `\`, "/", -1))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	rel, err := filepath.Rel(p.buildDir, filepath.Clean(path))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", "", fmt.Errorf("%s %s must be a directory inside the app", setting, value)
+	}
+	p.debug("Publishing to %s, as %s sets", rel, setting)
+	return filepath.Join(p.buildDir, rel), filepath.Join("${HOME}", config.BuildSubdir(), rel), nil
 }
 
-func (p *Project) getAssemblyName(projectPath string) (string, error) {
-	projFile, err := os.Open(projectPath)
+// publishedStartCommand returns the published apphost for the first of
+// names that was published, or its dll when there is no apphost or appHost
+// is false. The name of the runtimeconfig.json in the publish output is
+// tried last, since it is always named after the assembly.
+func (p *Project) publishedStartCommand(names []string, appHost bool) (string, error) {
+	publishedPath, runtimePath, err := p.PublishDir()
 	if err != nil {
 		return "", err
 	}
-	defer projFile.Close()
-	projBytes, err := ioutil.ReadAll(projFile)
+
+	if configFile, err := runtimeconfig.FindIn(publishedPath); err != nil {
+		return "", err
+	} else if configFile != "" {
+		names = append(names, strings.TrimSuffix(filepath.Base(configFile), ".runtimeconfig.json"))
+	}
+
+	for _, name := range names {
+		if appHost {
+			if info, err := os.Stat(filepath.Join(publishedPath, name)); err != nil && !os.IsNotExist(err) {
+				return "", err
+			} else if err == nil && info.Mode().IsRegular() {
+				if err := os.Chmod(filepath.Join(publishedPath, name), 0755); err != nil {
+					return "", err
+				}
+				return filepath.Join(runtimePath, name), nil
+			}
+		}
+
+		if exists, err := libbuildpack.FileExists(filepath.Join(publishedPath, fmt.Sprintf("%s.dll", name))); err != nil {
+			return "", fmt.Errorf("checking if a %s.dll file exists: %v", name, err)
+		} else if exists {
+			return fmt.Sprintf("%s.dll", filepath.Join(runtimePath, name)), nil
+		}
+	}
+	return "", nil
+}
+
+// UseAppHost reports whether publishing the project produces a native
+// executable next to its dll, which it does unless UseAppHost is false
+func (p *Project) UseAppHost(projectPath string) (bool, error) {
+	useAppHost, err := p.ProjectProperty(projectPath, "UseAppHost")
 	if err != nil {
+		return false, err
+	}
+	return !strings.EqualFold(useAppHost, "false"), nil
+}
+
+func (p *Project) getAssemblyName(projectPath string) (string, error) {
+	return p.ProjectProperty(projectPath, "AssemblyName")
+}
+
+// assemblyName returns the name of the assembly the project builds, from
+// its AssemblyName, the RootNamespace of VB.NET projects, or else its file
+// name
+func (p *Project) assemblyName(projectPath string) (string, error) {
+	projRe := regexp.MustCompile(`\.([a-z]+proj)$`)
+	if assemblyName, err := p.getAssemblyName(projectPath); err != nil {
 		return "", err
+	} else if assemblyName != "" {
+		return projRe.ReplaceAllString(assemblyName, ""), nil
+	}
+	if strings.HasSuffix(projectPath, ".vbproj") {
+		if rootNamespace, err := p.ProjectProperty(projectPath, "RootNamespace"); err != nil {
+			return "", err
+		} else if rootNamespace != "" {
+			p.debug("Using the RootNamespace of %s as its assembly name", projectPath)
+			return rootNamespace, nil
+		}
 	}
+	return filepath.Base(projRe.ReplaceAllString(projectPath, "")), nil
+}
 
+// projectProperties evaluates the properties declared in the project file
+// for the configuration being published. Groups and properties whose
+// Condition does not hold are skipped, and later definitions win.
+func (p *Project) projectProperties(projectPath string) (map[string]string, error) {
 	proj := struct {
-		PropertyGroup struct {
-			AssemblyName string
+		PropertyGroup []struct {
+			Condition  string `xml:"Condition,attr"`
+			Properties []struct {
+				XMLName   xml.Name
+				Condition string `xml:"Condition,attr"`
+				Value     string `xml:",chardata"`
+			} `xml:",any"`
 		}
 	}{}
-	err = xml.Unmarshal(projBytes, &proj)
+	if err := UnmarshalProjFile(projectPath, &proj); err != nil {
+		return nil, err
+	}
+
+	e := newEvaluator(projectPath, Configuration())
+	properties := map[string]string{}
+	for _, group := range proj.PropertyGroup {
+		if !e.condition(group.Condition) {
+			p.debug("Skipping PropertyGroup in %s with condition %s", projectPath, group.Condition)
+			continue
+		}
+		for _, property := range group.Properties {
+			if !e.condition(property.Condition) {
+				continue
+			}
+			e.set(property.XMLName.Local, strings.TrimSpace(property.Value))
+			properties[property.XMLName.Local] = e.properties[property.XMLName.Local]
+		}
+	}
+	return properties, nil
+}
+
+// ProjectProperty returns the value of an MSBuild property declared in the
+// project file, or an empty string if it is not set
+func (p *Project) ProjectProperty(projectPath, name string) (string, error) {
+	properties, err := p.projectProperties(projectPath)
 	if err != nil {
 		return "", err
 	}
-	return proj.PropertyGroup.AssemblyName, nil
+	return properties[name], nil
+}
+
+// ProjectSdk returns the Sdk attribute of the project file's root element
+func (p *Project) ProjectSdk(projectPath string) (string, error) {
+	proj := struct {
+		Sdk string `xml:"Sdk,attr"`
+	}{}
+	if err := UnmarshalProjFile(projectPath, &proj); err != nil {
+		return "", err
+	}
+	return proj.Sdk, nil
+}
+
+// executableSdks default OutputType to Exe, unlike Microsoft.NET.Sdk and
+// Microsoft.NET.Sdk.Razor which build class libraries
+var executableSdks = map[string]bool{
+	"Microsoft.NET.Sdk.Web":               true,
+	"Microsoft.NET.Sdk.Worker":            true,
+	"Microsoft.NET.Sdk.BlazorWebAssembly": true,
+	"Microsoft.NET.Sdk.WebAssembly":       true,
+}
+
+// IsExecutable reports whether the project builds an app rather than a
+// class library, from its OutputType or else the default of its SDKs
+func (p *Project) IsExecutable(projectPath string) (bool, error) {
+	outputType, err := p.ProjectProperty(projectPath, "OutputType")
+	if err != nil {
+		return false, err
+	} else if outputType != "" {
+		return strings.EqualFold(outputType, "Exe") || strings.EqualFold(outputType, "WinExe"), nil
+	}
+
+	sdks, err := p.ProjectSdk(projectPath)
+	if err != nil {
+		return false, err
+	}
+	for _, sdk := range strings.Split(sdks, ";") {
+		if executableSdks[strings.TrimSpace(strings.SplitN(sdk, "/", 2)[0])] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IsWorkerService reports whether the main project uses the Worker SDK,
+// which runs background services without an HTTP listener
+func (p *Project) IsWorkerService() (bool, error) {
+	if published, err := p.IsPublished(); err != nil || published {
+		return false, err
+	}
+
+	mainPath, err := p.MainPath()
+	if err != nil || mainPath == "" {
+		return false, err
+	}
+	sdks, err := p.ProjectSdk(mainPath)
+	if err != nil {
+		return false, err
+	}
+	for _, sdk := range strings.Split(sdks, ";") {
+		if strings.TrimSpace(strings.SplitN(sdk, "/", 2)[0]) == "Microsoft.NET.Sdk.Worker" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RazorRuntimeCompilation reports whether the app compiles its Razor views
+// at runtime, which needs the refs folder of the publish output and the
+// .cshtml files. Published apps are taken to do so when they have refs.
+func (p *Project) RazorRuntimeCompilation() (bool, error) {
+	if published, err := p.IsPublished(); err != nil {
+		return false, err
+	} else if published {
+		return libbuildpack.FileExists(filepath.Join(p.buildDir, "refs"))
+	}
+
+	mainPath, err := p.MainPath()
+	if err != nil || mainPath == "" {
+		return false, err
+	}
+	properties, err := p.projectProperties(mainPath)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range []string{"RazorCompileOnPublish", "MvcRazorCompileOnPublish"} {
+		if strings.EqualFold(properties[name], "false") {
+			p.debug("%s sets %s to false", mainPath, name)
+			return true, nil
+		}
+	}
+	return p.projectReferencesPackage(mainPath, "Microsoft.AspNetCore.Mvc.Razor.RuntimeCompilation")
+}
+
+// IsBlazorWebAssembly reports whether the main project is a standalone
+// Blazor WebAssembly app, which publishes to static files only
+func (p *Project) IsBlazorWebAssembly() (bool, error) {
+	if published, err := p.IsPublished(); err != nil || published {
+		return false, err
+	}
+
+	mainPath, err := p.MainPath()
+	if err != nil || mainPath == "" {
+		return false, err
+	}
+
+	sdk, err := p.ProjectSdk(mainPath)
+	if err != nil {
+		return false, err
+	}
+	return sdk == "Microsoft.NET.Sdk.BlazorWebAssembly" || sdk == "Microsoft.NET.Sdk.WebAssembly", nil
 }
 
 func (p *Project) StartCommand() (string, error) {
@@ -170,22 +573,37 @@ func (p *Project) StartCommand() (string, error) {
 	}
 	runtimeConfigRe := regexp.MustCompile(`\.(runtimeconfig\.json)$`)
 	projRe := regexp.MustCompile(`\.([a-z]+proj)$`)
+	appHost := true
+	var names []string
 
 	if runtimeConfigRe.MatchString(projectPath) {
-		projectPath = runtimeConfigRe.ReplaceAllString(projectPath, "")
-		projectPath = filepath.Base(projectPath)
-	} else if projRe.MatchString(projectPath) {
-		assemblyName, err := p.getAssemblyName(projectPath)
+		names = append(names, filepath.Base(runtimeConfigRe.ReplaceAllString(projectPath, "")))
+
+		// Published output can be pushed along with the projects it was
+		// published from, whose AssemblyName may name the apphost
+		paths, err := p.ProjFilePaths()
 		if err != nil {
 			return "", err
 		}
-		if assemblyName != "" {
-			projectPath = projRe.ReplaceAllString(assemblyName, "")
-		} else {
-			projectPath = projRe.ReplaceAllString(projectPath, "")
-			projectPath = filepath.Base(projectPath)
+		for _, path := range paths {
+			name, err := p.assemblyName(path)
+			if err != nil {
+				return "", err
+			}
+			names = append(names, name)
+		}
+	} else if projRe.MatchString(projectPath) {
+		if appHost, err = p.UseAppHost(projectPath); err != nil {
+			return "", err
+		} else if !appHost {
+			p.debug("%s sets UseAppHost to false, running its dll with dotnet", projectPath)
+		}
+		name, err := p.assemblyName(projectPath)
+		if err != nil {
+			return "", err
 		}
+		names = append(names, name)
 	}
 
-	return p.publishedStartCommand(projectPath)
+	return p.publishedStartCommand(names, appHost)
 }
@@ -1,15 +1,34 @@
 package project_test
 
 import (
+	"bytes"
 	"dotnetcore/project"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 
+	"github.com/cloudfoundry/libbuildpack"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
+const classicCsproj = `<?xml version="1.0" encoding="utf-16"?>
+<Project ToolsVersion="15.0" DefaultTargets="Build" xmlns="http://schemas.microsoft.com/developer/msbuild/2003">
+  <Import Project="$(MSBuildExtensionsPath)\\$(MSBuildToolsVersion)\\Microsoft.Common.props" Condition="Exists('$(MSBuildExtensionsPath)\\$(MSBuildToolsVersion)\\Microsoft.Common.props')" />
+  <PropertyGroup>
+    <Configuration Condition=" '$(Configuration)' == '' ">Debug</Configuration>
+    <OutputType>Exe</OutputType>
+    <RootNamespace>Fred.Web</RootNamespace>
+    <AssemblyName>Fred.Web</AssemblyName>
+    <TargetFrameworkVersion>v4.6.1</TargetFrameworkVersion>
+  </PropertyGroup>
+  <ItemGroup>
+    <Compile Include="Program.cs" />
+  </ItemGroup>
+  <Import Project="$(MSBuildToolsPath)\\Microsoft.CSharp.targets" />
+</Project>
+`
+
 var _ = Describe("Project", func() {
 	var (
 		err      error
@@ -48,15 +67,20 @@ var _ = Describe("Project", func() {
 				"a/b/first.vbproj",
 				"b/c/first.fsproj",
 				"c/d/other.txt",
+				"dir/bin/Debug/second.csproj",
+				"dir/obj/second.csproj",
+				"ClientApp/node_modules/pkg/pkg.csproj",
+				"first.csproj.d/bin.csproj",
 			} {
 				Expect(os.MkdirAll(filepath.Dir(filepath.Join(buildDir, name)), 0755)).To(Succeed())
 				Expect(ioutil.WriteFile(filepath.Join(buildDir, name), []byte(""), 0644)).To(Succeed())
 			}
 		})
 
-		It("returns csproj, fsproj and vbproj files (excluding .cloudfoundry)", func() {
+		It("returns csproj, fsproj and vbproj files (excluding .cloudfoundry, bin, obj and node_modules)", func() {
 			Expect(subject.ProjFilePaths()).To(ConsistOf([]string{
 				filepath.Join(buildDir, "first.csproj"),
+				filepath.Join(buildDir, "first.csproj.d", "bin.csproj"),
 				filepath.Join(buildDir, "dir", "second.csproj"),
 				filepath.Join(buildDir, "a", "b", "first.vbproj"),
 				filepath.Join(buildDir, "b", "c", "first.fsproj"),
@@ -129,6 +153,42 @@ var _ = Describe("Project", func() {
 			})
 		})
 	})
+	Describe("ReferencesPackage", func() {
+		It("finds package references in project files", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte(`<Project><ItemGroup><PackageReference Include="system.drawing.common" Version="4.5.0" /></ItemGroup></Project>`), 0644)).To(Succeed())
+			Expect(subject.ReferencesPackage("System.Drawing.Common")).To(BeTrue())
+			Expect(subject.ReferencesPackage("Newtonsoft.Json")).To(BeFalse())
+		})
+
+		It("looks for the assembly in published apps", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.runtimeconfig.json"), []byte("{}"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "System.Drawing.Common.dll"), []byte(""), 0644)).To(Succeed())
+			Expect(subject.ReferencesPackage("System.Drawing.Common")).To(BeTrue())
+		})
+	})
+
+	Describe("InvariantGlobalization", func() {
+		It("reads the runtimeconfig of published apps", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.runtimeconfig.json"), []byte(`{"runtimeOptions":{"configProperties":{"System.Globalization.Invariant":true}}}`), 0644)).To(Succeed())
+			Expect(subject.InvariantGlobalization()).To(BeTrue())
+		})
+
+		It("reads hand edited runtimeconfigs with comments and trailing commas", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.runtimeconfig.json"), []byte("{\n  \"runtimeOptions\": {\n    // no ICU on the stack\n    \"configProperties\": { \"System.Globalization.Invariant\": true, },\n  },\n}\n"), 0644)).To(Succeed())
+			Expect(subject.InvariantGlobalization()).To(BeTrue())
+		})
+
+		It("reads the InvariantGlobalization property of the main project", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte(`<Project><PropertyGroup><InvariantGlobalization>true</InvariantGlobalization></PropertyGroup></Project>`), 0644)).To(Succeed())
+			Expect(subject.InvariantGlobalization()).To(BeTrue())
+		})
+
+		It("is false by default", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte(`<Project></Project>`), 0644)).To(Succeed())
+			Expect(subject.InvariantGlobalization()).To(BeFalse())
+		})
+	})
+
 	Describe("MainPath", func() {
 		Context("There is a runtimeconfig file present", func() {
 			BeforeEach(func() {
@@ -158,6 +218,17 @@ var _ = Describe("Project", func() {
 				Expect(err).To(BeNil())
 				Expect(path).To(Equal(filepath.Join(buildDir, "subdir", "first.csproj")))
 			})
+
+			It("explains the choice at debug level", func() {
+				Expect(os.Setenv("BP_DEBUG", "1")).To(Succeed())
+				defer os.Unsetenv("BP_DEBUG")
+				buffer := new(bytes.Buffer)
+				subject.SetLogger(libbuildpack.NewLogger(buffer))
+
+				_, err := subject.MainPath()
+				Expect(err).To(BeNil())
+				Expect(buffer.String()).To(ContainSubstring("because it is the only project file"))
+			})
 		})
 		Context("More than one project path in paths", func() {
 			BeforeEach(func() {
@@ -186,6 +257,36 @@ var _ = Describe("Project", func() {
 				})
 			})
 
+			Context("The .deployment file is written the way Kudu accepts", func() {
+				It("ignores the case of names and quotes around the value", func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, ".deployment"), []byte("[Config]\nPROJECT = \"a\\b\\first.vbproj\"\n"), 0644)).To(Succeed())
+					Expect(subject.MainPath()).To(Equal(filepath.Join(buildDir, "a", "b", "first.vbproj")))
+				})
+
+				It("resolves a directory to the project file in it", func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, ".deployment"), []byte("[config]\nproject = dir\n"), 0644)).To(Succeed())
+					Expect(subject.MainPath()).To(Equal(filepath.Join(buildDir, "dir", "second.csproj")))
+				})
+
+				It("explains a directory without exactly one project file", func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, ".deployment"), []byte("[config]\nproject = c/d\n"), 0644)).To(Succeed())
+					_, err := subject.MainPath()
+					Expect(err).To(MatchError(".deployment project c/d is a directory with 0 project files, expected 1"))
+				})
+
+				It("explains a project that does not exist", func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, ".deployment"), []byte("[config]\nproject = missing.csproj\n"), 0644)).To(Succeed())
+					_, err := subject.MainPath()
+					Expect(err).To(MatchError(".deployment project missing.csproj does not exist"))
+				})
+
+				It("explains a missing project setting", func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, ".deployment"), []byte("[config]\ncommand = deploy.cmd\n"), 0644)).To(Succeed())
+					_, err := subject.MainPath()
+					Expect(err).To(MatchError(".deployment has no project setting in its [config] section"))
+				})
+			})
+
 			Context("There is NOT a .deployment file present", func() {
 
 				It("Returns an error", func() {
@@ -193,8 +294,269 @@ var _ = Describe("Project", func() {
 					Expect(err).ToNot(BeNil())
 				})
 			})
+
+			Context("PROJECT_PATH is set", func() {
+				AfterEach(func() {
+					Expect(os.Unsetenv("PROJECT_PATH")).To(Succeed())
+				})
+
+				It("returns the project it selects", func() {
+					Expect(os.Setenv("PROJECT_PATH", "dir")).To(Succeed())
+					Expect(subject.MainPath()).To(Equal(filepath.Join(buildDir, "dir", "second.csproj")))
+				})
+
+				It("explains a project that does not exist", func() {
+					Expect(os.Setenv("PROJECT_PATH", "missing")).To(Succeed())
+					_, err := subject.MainPath()
+					Expect(err).To(MatchError("PROJECT_PATH project missing does not exist"))
+				})
+			})
+
+			Context("All but one of the projects hold tests", func() {
+				BeforeEach(func() {
+					Expect(os.RemoveAll(filepath.Join(buildDir, "a"))).To(Succeed())
+					Expect(os.RemoveAll(filepath.Join(buildDir, "b"))).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "first.csproj"), []byte(`<Project><ItemGroup><PackageReference Include="Microsoft.NET.Test.Sdk" Version="17.0.0" /></ItemGroup></Project>`), 0644)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "dir", "second.csproj"), []byte(`<Project><PropertyGroup><IsTestProject>false</IsTestProject></PropertyGroup></Project>`), 0644)).To(Succeed())
+				})
+
+				It("returns the project that does not hold tests", func() {
+					Expect(subject.MainPath()).To(Equal(filepath.Join(buildDir, "dir", "second.csproj")))
+				})
+			})
 		})
 	})
+	Describe("ProjectProperty", func() {
+		BeforeEach(func() {
+			csprojContents := `
+<Project Sdk="Microsoft.NET.Sdk.Web">
+	<PropertyGroup>
+		<TargetFramework>net6.0</TargetFramework>
+	</PropertyGroup>
+	<PropertyGroup>
+		<RunAOTCompilation> true </RunAOTCompilation>
+	</PropertyGroup>
+</Project>`
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "fred.csproj"), []byte(csprojContents), 0644)).To(Succeed())
+		})
+
+		It("returns properties from any PropertyGroup", func() {
+			Expect(subject.ProjectProperty(filepath.Join(buildDir, "fred.csproj"), "TargetFramework")).To(Equal("net6.0"))
+			Expect(subject.ProjectProperty(filepath.Join(buildDir, "fred.csproj"), "RunAOTCompilation")).To(Equal("true"))
+		})
+
+		It("returns an empty string for missing properties", func() {
+			Expect(subject.ProjectProperty(filepath.Join(buildDir, "fred.csproj"), "AssemblyName")).To(Equal(""))
+		})
+
+		Context("properties are conditioned on the configuration", func() {
+			BeforeEach(func() {
+				csprojContents := `
+<Project Sdk="Microsoft.NET.Sdk.Web">
+	<PropertyGroup>
+		<AssemblyName>$(MSBuildProjectName).Web</AssemblyName>
+		<Flavor>plain</Flavor>
+	</PropertyGroup>
+	<PropertyGroup Condition=" '$(Configuration)|$(Platform)' == 'Release|AnyCPU' ">
+		<AssemblyName>Fred.Release</AssemblyName>
+	</PropertyGroup>
+	<PropertyGroup Condition="'$(Configuration)' != 'Release' and '$(Flavor)' == 'plain'">
+		<Flavor>debug-$(Flavor)</Flavor>
+	</PropertyGroup>
+	<PropertyGroup Condition="Exists('local.props')">
+		<Flavor>local</Flavor>
+	</PropertyGroup>
+	<PropertyGroup>
+		<Region Condition="'$(Region)' == ''">eu</Region>
+	</PropertyGroup>
+</Project>`
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "fred.csproj"), []byte(csprojContents), 0644)).To(Succeed())
+			})
+			AfterEach(func() {
+				Expect(os.Unsetenv("PUBLISH_RELEASE_CONFIG")).To(Succeed())
+			})
+
+			It("evaluates them for the Debug configuration by default", func() {
+				Expect(subject.ProjectProperty(filepath.Join(buildDir, "fred.csproj"), "AssemblyName")).To(Equal("fred.Web"))
+				Expect(subject.ProjectProperty(filepath.Join(buildDir, "fred.csproj"), "Flavor")).To(Equal("debug-plain"))
+				Expect(subject.ProjectProperty(filepath.Join(buildDir, "fred.csproj"), "Region")).To(Equal("eu"))
+			})
+
+			It("evaluates them for the Release configuration when publishing it", func() {
+				Expect(os.Setenv("PUBLISH_RELEASE_CONFIG", "true")).To(Succeed())
+				Expect(subject.ProjectProperty(filepath.Join(buildDir, "fred.csproj"), "AssemblyName")).To(Equal("Fred.Release"))
+				Expect(subject.ProjectProperty(filepath.Join(buildDir, "fred.csproj"), "Flavor")).To(Equal("plain"))
+			})
+		})
+
+		Context("project files as Visual Studio writes them", func() {
+			path := func() string { return filepath.Join(buildDir, "fred.csproj") }
+
+			It("reads classic projects in the MSBuild namespace", func() {
+				Expect(ioutil.WriteFile(path(), []byte(classicCsproj), 0644)).To(Succeed())
+				Expect(subject.ProjectProperty(path(), "AssemblyName")).To(Equal("Fred.Web"))
+				Expect(subject.ProjectProperty(path(), "TargetFrameworkVersion")).To(Equal("v4.6.1"))
+			})
+
+			It("skips a UTF-8 byte order mark", func() {
+				Expect(ioutil.WriteFile(path(), append([]byte("\xef\xbb\xbf"), classicCsproj...), 0644)).To(Succeed())
+				Expect(subject.ProjectProperty(path(), "AssemblyName")).To(Equal("Fred.Web"))
+			})
+
+			It("decodes UTF-16 files with a byte order mark", func() {
+				utf16 := []byte{0xff, 0xfe}
+				for _, r := range classicCsproj {
+					utf16 = append(utf16, byte(r), 0)
+				}
+				Expect(ioutil.WriteFile(path(), utf16, 0644)).To(Succeed())
+				Expect(subject.ProjectProperty(path(), "AssemblyName")).To(Equal("Fred.Web"))
+			})
+
+			It("decodes legacy encodings", func() {
+				Expect(ioutil.WriteFile(path(), []byte("<?xml version=\"1.0\" encoding=\"windows-1252\"?><Project><PropertyGroup><Company>Caf\xe9</Company></PropertyGroup></Project>"), 0644)).To(Succeed())
+				Expect(subject.ProjectProperty(path(), "Company")).To(Equal("Café"))
+			})
+
+			It("treats an empty file as having no properties", func() {
+				Expect(ioutil.WriteFile(path(), []byte{}, 0644)).To(Succeed())
+				Expect(subject.ProjectProperty(path(), "AssemblyName")).To(Equal(""))
+			})
+
+			It("names the file it could not parse", func() {
+				Expect(ioutil.WriteFile(path(), []byte("<Project><PropertyGroup>"), 0644)).To(Succeed())
+				_, err := subject.ProjectProperty(path(), "AssemblyName")
+				Expect(err).To(MatchError(ContainSubstring("could not parse " + path())))
+			})
+		})
+	})
+
+	Describe("TargetFrameworks", func() {
+		It("splits TargetFrameworks", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "fred.csproj"), []byte(`<Project><PropertyGroup><TargetFrameworks> net6.0;net8.0; </TargetFrameworks></PropertyGroup></Project>`), 0644)).To(Succeed())
+			Expect(subject.TargetFrameworks(filepath.Join(buildDir, "fred.csproj"))).To(Equal([]string{"net6.0", "net8.0"}))
+		})
+
+		It("prefers TargetFramework", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "fred.csproj"), []byte(`<Project><PropertyGroup><TargetFrameworks>net6.0;net8.0</TargetFrameworks><TargetFramework>net8.0</TargetFramework></PropertyGroup></Project>`), 0644)).To(Succeed())
+			Expect(subject.TargetFrameworks(filepath.Join(buildDir, "fred.csproj"))).To(Equal([]string{"net8.0"}))
+		})
+	})
+
+	Describe("FrameworkVersion", func() {
+		It("returns the runtime version of .NET Core frameworks", func() {
+			for tfm, version := range map[string]string{"netcoreapp2.1": "2.1", "net5.0": "5.0", "net8.0-android": "8.0", "net10.0": "10.0"} {
+				actual, ok := project.FrameworkVersion(tfm)
+				Expect(ok).To(BeTrue(), tfm)
+				Expect(actual).To(Equal(version))
+			}
+		})
+
+		It("rejects other frameworks", func() {
+			for _, tfm := range []string{"netstandard2.0", "net472", "net48"} {
+				_, ok := project.FrameworkVersion(tfm)
+				Expect(ok).To(BeFalse(), tfm)
+			}
+		})
+	})
+
+	Describe("IsExecutable", func() {
+		isExecutable := func(contents string) bool {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "fred.csproj"), []byte(contents), 0644)).To(Succeed())
+			executable, err := subject.IsExecutable(filepath.Join(buildDir, "fred.csproj"))
+			Expect(err).ToNot(HaveOccurred())
+			return executable
+		}
+
+		It("is true for apps", func() {
+			Expect(isExecutable(`<Project Sdk="Microsoft.NET.Sdk.Web"></Project>`)).To(BeTrue())
+			Expect(isExecutable(`<Project Sdk="Microsoft.NET.Sdk.Worker"></Project>`)).To(BeTrue())
+			Expect(isExecutable(`<Project Sdk="FSharp.NET.Sdk;Microsoft.NET.Sdk.Web/2.1.0"></Project>`)).To(BeTrue())
+			Expect(isExecutable(`<Project Sdk="Microsoft.NET.Sdk"><PropertyGroup><OutputType>Exe</OutputType></PropertyGroup></Project>`)).To(BeTrue())
+		})
+
+		It("is false for class libraries", func() {
+			Expect(isExecutable(`<Project Sdk="Microsoft.NET.Sdk"></Project>`)).To(BeFalse())
+			Expect(isExecutable(`<Project Sdk="Microsoft.NET.Sdk.Razor"></Project>`)).To(BeFalse())
+			Expect(isExecutable(`<Project Sdk="Microsoft.NET.Sdk.Web"><PropertyGroup><OutputType>Library</OutputType></PropertyGroup></Project>`)).To(BeFalse())
+		})
+	})
+
+	Describe("IsBlazorWebAssembly", func() {
+		Context("The project uses the BlazorWebAssembly SDK", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "fred.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk.BlazorWebAssembly"></Project>`), 0644)).To(Succeed())
+			})
+
+			It("returns true", func() {
+				Expect(subject.IsBlazorWebAssembly()).To(BeTrue())
+			})
+		})
+
+		Context("The project uses the Web SDK", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "fred.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk.Web"></Project>`), 0644)).To(Succeed())
+			})
+
+			It("returns false", func() {
+				Expect(subject.IsBlazorWebAssembly()).To(BeFalse())
+			})
+		})
+	})
+
+	Describe("PublishDir", func() {
+		BeforeEach(func() {
+			Expect(os.MkdirAll(filepath.Join(buildDir, "src", "web"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "src", "web", "web.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Unsetenv("PUBLISH_OUTPUT_DIR")).To(Succeed())
+		})
+
+		It("defaults to dotnet_publish in the dep dir", func() {
+			dir, runtimeDir, err := subject.PublishDir()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dir).To(Equal(filepath.Join(depsDir, depsIdx, "dotnet_publish")))
+			Expect(runtimeDir).To(Equal(filepath.Join("${DEPS_DIR}", depsIdx, "dotnet_publish")))
+		})
+
+		It("ignores the PublishDir of the main project by default", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "src", "web", "web.csproj"), []byte(`<Project><PropertyGroup><PublishDir>..\..\out\</PublishDir></PropertyGroup></Project>`), 0644)).To(Succeed())
+
+			dir, _, err := subject.PublishDir()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dir).To(Equal(filepath.Join(depsDir, depsIdx, "dotnet_publish")))
+		})
+
+		It("honors the PublishDir of the main project when publish-dir is project", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  publish-dir: project\n"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "src", "web", "web.csproj"), []byte(`<Project><PropertyGroup><PublishDir>..\..\out\$(Configuration)\</PublishDir></PropertyGroup></Project>`), 0644)).To(Succeed())
+
+			dir, runtimeDir, err := subject.PublishDir()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dir).To(Equal(filepath.Join(buildDir, "out", "Debug")))
+			Expect(runtimeDir).To(Equal(filepath.Join("${HOME}", "out", "Debug")))
+		})
+
+		It("prefers the configured directory", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  publish-dir: dist\n"), 0644)).To(Succeed())
+			dir, _, err := subject.PublishDir()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dir).To(Equal(filepath.Join(buildDir, "dist")))
+
+			Expect(os.Setenv("PUBLISH_OUTPUT_DIR", "build/app")).To(Succeed())
+			dir, _, err = subject.PublishDir()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dir).To(Equal(filepath.Join(buildDir, "build", "app")))
+		})
+
+		It("rejects directories outside the app", func() {
+			Expect(os.Setenv("PUBLISH_OUTPUT_DIR", "../out")).To(Succeed())
+			_, _, err := subject.PublishDir()
+			Expect(err).To(MatchError("PUBLISH_OUTPUT_DIR ../out must be a directory inside the app"))
+		})
+	})
+
 	Describe("StartCommand", func() {
 		Context("The project is published", func() {
 			BeforeEach(func() {
@@ -228,6 +590,28 @@ var _ = Describe("Project", func() {
 					Expect(startCmd).To(Equal(""))
 				})
 			})
+			Context("The project published alongside it sets an AssemblyName", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "fred.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk.Web">
+	<PropertyGroup>
+		<AssemblyName>Fred.Web</AssemblyName>
+	</PropertyGroup>
+</Project>`), 0644)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "Fred.Web"), []byte(""), 0644)).To(Succeed())
+				})
+				It("returns the apphost named after the AssemblyName", func() {
+					Expect(subject.StartCommand()).To(Equal(filepath.Join("${HOME}", "Fred.Web")))
+				})
+			})
+			Context("A directory is named after the project", func() {
+				BeforeEach(func() {
+					Expect(os.MkdirAll(filepath.Join(buildDir, "fred"), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "fred.dll"), []byte(""), 0644)).To(Succeed())
+				})
+				It("returns ${HOME}/project.dll", func() {
+					Expect(subject.StartCommand()).To(Equal(filepath.Join("${HOME}", "fred.dll")))
+				})
+			})
 		})
 		Context("The project is NOT published", func() {
 			Context("The csproj file does not have an AssemblyName tag", func() {
@@ -284,6 +668,56 @@ var _ = Describe("Project", func() {
 					Expect(startCmd).To(Equal(filepath.Join("${DEPS_DIR}", depsIdx, "dotnet_publish", "f.red")))
 				})
 			})
+			Context("The assembly is named elsewhere, e.g. in Directory.Build.props", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "fred.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+					Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet_publish"), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet_publish", "Fred.Web.runtimeconfig.json"), []byte("{}"), 0644)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet_publish", "Fred.Web"), []byte(""), 0644)).To(Succeed())
+				})
+				It("returns the apphost named after the published runtimeconfig", func() {
+					Expect(subject.StartCommand()).To(Equal(filepath.Join("${DEPS_DIR}", depsIdx, "dotnet_publish", "Fred.Web")))
+				})
+			})
+			Context("The vbproj file has a RootNamespace but no AssemblyName", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "fred.vbproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk.Web">
+	<PropertyGroup>
+		<RootNamespace>Fred.Web</RootNamespace>
+	</PropertyGroup>
+</Project>`), 0644)).To(Succeed())
+					Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet_publish"), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet_publish", "Fred.Web.dll"), []byte(""), 0644)).To(Succeed())
+				})
+				It("returns a start command with the RootNamespace", func() {
+					Expect(subject.StartCommand()).To(Equal(filepath.Join("${DEPS_DIR}", depsIdx, "dotnet_publish", "Fred.Web.dll")))
+				})
+			})
+			Context("The csproj file sets UseAppHost to false", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "fred.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk.Web">
+	<PropertyGroup>
+		<UseAppHost>False</UseAppHost>
+	</PropertyGroup>
+</Project>`), 0644)).To(Succeed())
+					Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet_publish"), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet_publish", "fred"), []byte(""), 0644)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet_publish", "fred.dll"), []byte(""), 0644)).To(Succeed())
+				})
+				It("returns the dll rather than a stale executable", func() {
+					Expect(subject.StartCommand()).To(Equal(filepath.Join("${DEPS_DIR}", depsIdx, "dotnet_publish", "fred.dll")))
+				})
+			})
+			Context("The csproj file is a classic project with a byte order mark", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "fred.csproj"), append([]byte("\xef\xbb\xbf"), classicCsproj...), 0644)).To(Succeed())
+					Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet_publish"), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet_publish", "Fred.Web.dll"), []byte(""), 0644)).To(Succeed())
+				})
+				It("returns a start command with the AssemblyName", func() {
+					Expect(subject.StartCommand()).To(Equal(filepath.Join("${DEPS_DIR}", depsIdx, "dotnet_publish", "Fred.Web.dll")))
+				})
+			})
 		})
 
 		Context("mainPath could be determined", func() {
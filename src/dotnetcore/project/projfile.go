@@ -0,0 +1,45 @@
+package project
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// UnmarshalProjFile decodes an MSBuild project file into v. Besides plain
+// UTF-8 it reads files with a byte order mark, as Visual Studio writes
+// them, and files declaring a legacy encoding such as windows-1252. An empty
+// file decodes to nothing rather than failing.
+func UnmarshalProjFile(path string, v interface{}) error {
+	projBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// Decode UTF-16 and strip any byte order mark, leaving UTF-8
+	reader := transform.NewReader(bytes.NewReader(projBytes), unicode.BOMOverride(transform.Nop))
+	decoder := xml.NewDecoder(reader)
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		if strings.HasPrefix(strings.ToLower(label), "utf-16") {
+			// Already decoded through its byte order mark
+			return input, nil
+		}
+		encoding, err := htmlindex.Get(label)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported encoding %s", label)
+		}
+		return encoding.NewDecoder().Reader(input), nil
+	}
+
+	if err := decoder.Decode(v); err != nil && err != io.EOF {
+		return fmt.Errorf("could not parse %s: %s", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"dotnetcore/config"
+	"dotnetcore/dotnetframework"
+	"dotnetcore/installer"
+	"dotnetcore/project"
+	"dotnetcore/supply"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// cleanStack reports every command as missing, as on a staging container
+// where no other buildpack has supplied node or bower
+type cleanStack struct{}
+
+func (cleanStack) Execute(string, io.Writer, io.Writer, string, ...string) error {
+	return errors.New("not available during dry run")
+}
+
+func (cleanStack) Output(string, string, ...string) (string, error) {
+	return "", errors.New("not available during dry run")
+}
+
+// Prints the SDK, runtime, node version and main project that staging the
+// given build dir would choose, without downloading or building anything
+func main() {
+	logger := libbuildpack.NewLogger(os.Stderr)
+
+	if len(os.Args) != 2 {
+		logger.Error("Usage: %s <build-dir>", os.Args[0])
+		os.Exit(1)
+	}
+	buildDir := os.Args[1]
+
+	if os.Getenv("CF_STACK") == "" {
+		os.Setenv("CF_STACK", "cflinuxfs2")
+	}
+
+	buildpackDir, err := libbuildpack.GetBuildpackDir()
+	if err != nil {
+		logger.Error("Unable to determine buildpack directory: %s", err.Error())
+		os.Exit(9)
+	}
+
+	manifest, err := libbuildpack.NewManifest(buildpackDir, logger, time.Now())
+	if err != nil {
+		logger.Error("Unable to load buildpack manifest: %s", err.Error())
+		os.Exit(10)
+	}
+
+	depsDir, err := ioutil.TempDir("", "dotnetcore-resolve")
+	if err != nil {
+		logger.Error("Unable to create temporary deps dir: %s", err.Error())
+		os.Exit(11)
+	}
+	defer os.RemoveAll(depsDir)
+
+	stager := libbuildpack.NewStager([]string{buildDir, "", depsDir, "0"}, logger, manifest)
+	proj := project.New(stager.BuildDir(), stager.DepDir(), stager.DepsIdx()).SetLogger(logger)
+	framework := dotnetframework.New(stager.DepDir(), stager.BuildDir(), installer.New(manifest, logger).SetDryRun(true), manifest, logger).SetIndex(proj.Index())
+	s := supply.Supplier{
+		Stager:          stager,
+		Manifest:        manifest,
+		Log:             logger,
+		Command:         cleanStack{},
+		Config:          &config.Config{},
+		Project:         proj,
+		DotnetFramework: framework,
+	}
+
+	sdk, err := s.ResolveSdkVersion()
+	if err != nil {
+		logger.Error("Unable to resolve dotnet SDK version: %s", err.Error())
+		os.Exit(12)
+	}
+	runtimes, err := framework.RequiredVersions()
+	if err != nil {
+		logger.Error("Unable to resolve dotnet runtime versions: %s", err.Error())
+		os.Exit(13)
+	}
+	node, err := s.ResolveNodeVersion()
+	if err != nil {
+		logger.Error("Unable to resolve node version: %s", err.Error())
+		os.Exit(14)
+	}
+	mainProject, err := proj.MainPath()
+	if err != nil {
+		logger.Error("Unable to find main project: %s", err.Error())
+		os.Exit(15)
+	}
+
+	fmt.Printf("stack: %s\n", os.Getenv("CF_STACK"))
+	fmt.Printf("sdk: %s\n", orNone(sdk, "none (runtime only)"))
+	if len(runtimes) == 0 {
+		fmt.Println("runtimes: determined by dotnet restore")
+	} else {
+		fmt.Printf("runtimes: %v\n", runtimes)
+	}
+	fmt.Printf("node: %s\n", orNone(node, "none"))
+	fmt.Printf("main project: %s\n", orNone(mainProject, "none found"))
+}
+
+func orNone(value, none string) string {
+	if value == "" {
+		return none
+	}
+	return value
+}
@@ -0,0 +1,124 @@
+// Package runtimeconfig reads the runtimeconfig.json that publishing writes
+// next to an app's dll, which names the shared frameworks the app runs on
+// and how it rolls forward to newer versions of them.
+package runtimeconfig
+
+import (
+	"dotnetcore/fileindex"
+	"dotnetcore/jsonc"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+type Framework struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type RuntimeConfig struct {
+	// Frameworks holds the single framework of most apps, or the several
+	// frameworks of apps that set frameworks instead
+	Frameworks       []Framework
+	RollForward      string
+	ApplyPatches     *bool
+	ConfigProperties map[string]interface{}
+}
+
+// Load parses the runtimeconfig.json at path
+func Load(path string) (*RuntimeConfig, error) {
+	obj := struct {
+		RuntimeOptions struct {
+			Framework        Framework              `json:"framework"`
+			Frameworks       []Framework            `json:"frameworks"`
+			RollForward      string                 `json:"rollForward"`
+			ApplyPatches     *bool                  `json:"applyPatches"`
+			ConfigProperties map[string]interface{} `json:"configProperties"`
+		} `json:"runtimeOptions"`
+	}{}
+	if err := jsonc.Load(path, &obj); err != nil {
+		return nil, err
+	}
+
+	options := obj.RuntimeOptions
+	config := &RuntimeConfig{RollForward: options.RollForward, ApplyPatches: options.ApplyPatches, ConfigProperties: options.ConfigProperties}
+	if options.Framework.Name != "" {
+		config.Frameworks = append(config.Frameworks, options.Framework)
+	}
+	for _, framework := range options.Frameworks {
+		if framework.Name != "" {
+			config.Frameworks = append(config.Frameworks, framework)
+		}
+	}
+	return config, nil
+}
+
+// Find returns the runtimeconfig.json at the root of the listed files, or
+// an empty string when there is none. The app is ambiguous when there are
+// several.
+func Find(files *fileindex.Index) (string, error) {
+	configFiles, err := files.Glob("*.runtimeconfig.json")
+	if err != nil {
+		return "", err
+	} else if len(configFiles) > 1 {
+		return "", fmt.Errorf("Multiple .runtimeconfig.json files present")
+	} else if len(configFiles) == 1 {
+		return configFiles[0], nil
+	}
+	return "", nil
+}
+
+// FindIn returns the runtimeconfig.json in a publish output dir. It is
+// empty unless there is exactly one, as the output may also hold those of
+// executables the app references.
+func FindIn(dir string) (string, error) {
+	configFiles, err := filepath.Glob(filepath.Join(dir, "*.runtimeconfig.json"))
+	if err != nil || len(configFiles) != 1 {
+		return "", err
+	}
+	return configFiles[0], nil
+}
+
+// Framework returns the framework of the given name the app runs on
+func (c *RuntimeConfig) Framework(name string) (Framework, bool) {
+	for _, framework := range c.Frameworks {
+		if framework.Name == name {
+			return framework, true
+		}
+	}
+	return Framework{}, false
+}
+
+// AppliesPatches reports whether the app runs on the latest patch of its
+// frameworks, as it does unless applyPatches is false or rollForward is
+// Disable
+func (c *RuntimeConfig) AppliesPatches() bool {
+	return (c.ApplyPatches == nil || *c.ApplyPatches) && !strings.EqualFold(c.RollForward, "Disable")
+}
+
+// PatchConstraint returns the constraint matching the patches the host
+// rolls the framework forward to when the app applies patches, e.g. 2.1.x
+// for 2.1.0. Versions without a patch number, such as 2.1, are read as its
+// first patch.
+func (f Framework) PatchConstraint() (string, error) {
+	v, err := semver.NewVersion(f.Version)
+	if err != nil {
+		return "", fmt.Errorf("framework %s has an invalid version %q: %s", f.Name, f.Version, err)
+	}
+	return fmt.Sprintf("%d.%d.x", v.Major(), v.Minor()), nil
+}
+
+// RollsForwardByDefault reports whether the app picks framework versions
+// the default way, the latest patch of the lowest matching minor version
+func (c *RuntimeConfig) RollsForwardByDefault() bool {
+	rollForward := c.RollForward
+	return c.AppliesPatches() && (rollForward == "" || strings.EqualFold(rollForward, "Minor") || strings.EqualFold(rollForward, "LatestPatch"))
+}
+
+// InvariantGlobalization reports whether the app runs without ICU
+func (c *RuntimeConfig) InvariantGlobalization() bool {
+	invariant, _ := c.ConfigProperties["System.Globalization.Invariant"].(bool)
+	return invariant
+}
@@ -0,0 +1,130 @@
+package runtimeconfig_test
+
+import (
+	"dotnetcore/fileindex"
+	"dotnetcore/runtimeconfig"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Runtimeconfig", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "runtimeconfig")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+		return path
+	}
+
+	Describe("Load", func() {
+		It("reads a single framework and the config properties", func() {
+			path := write("app.runtimeconfig.json", `{
+  // written by dotnet publish
+  "runtimeOptions": {
+    "framework": {"name": "Microsoft.AspNetCore.App", "version": "8.0.0"},
+    "configProperties": {"System.Globalization.Invariant": true,},
+  }
+}`)
+			config, err := runtimeconfig.Load(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.Frameworks).To(Equal([]runtimeconfig.Framework{{Name: "Microsoft.AspNetCore.App", Version: "8.0.0"}}))
+			Expect(config.InvariantGlobalization()).To(BeTrue())
+			Expect(config.AppliesPatches()).To(BeTrue())
+			Expect(config.RollsForwardByDefault()).To(BeTrue())
+		})
+
+		It("reads several frameworks", func() {
+			path := write("app.runtimeconfig.json", `{"runtimeOptions": {"frameworks": [
+  {"name": "Microsoft.NETCore.App", "version": "8.0.0"},
+  {"name": "Microsoft.WindowsDesktop.App", "version": "8.0.0"}
+]}}`)
+			config, err := runtimeconfig.Load(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.Frameworks).To(HaveLen(2))
+			framework, ok := config.Framework("Microsoft.WindowsDesktop.App")
+			Expect(ok).To(BeTrue())
+			Expect(framework.Version).To(Equal("8.0.0"))
+			_, ok = config.Framework("Microsoft.AspNetCore.App")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("reads how the app rolls forward", func() {
+			config, err := runtimeconfig.Load(write("patches.runtimeconfig.json", `{"runtimeOptions": {"applyPatches": false}}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.AppliesPatches()).To(BeFalse())
+
+			config, err = runtimeconfig.Load(write("disable.runtimeconfig.json", `{"runtimeOptions": {"rollForward": "Disable"}}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.AppliesPatches()).To(BeFalse())
+
+			config, err = runtimeconfig.Load(write("major.runtimeconfig.json", `{"runtimeOptions": {"rollForward": "Major"}}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.AppliesPatches()).To(BeTrue())
+			Expect(config.RollsForwardByDefault()).To(BeFalse())
+		})
+
+		It("reports malformed files", func() {
+			_, err := runtimeconfig.Load(write("app.runtimeconfig.json", `{"runtimeOptions": [}`))
+			Expect(err).To(MatchError(ContainSubstring("could not parse")))
+		})
+	})
+
+	Describe("Find", func() {
+		It("finds the runtimeconfig.json at the root of the app", func() {
+			path := write("app.runtimeconfig.json", "{}")
+			write("sub/other.runtimeconfig.json", "{}")
+			Expect(runtimeconfig.Find(fileindex.New(dir))).To(Equal(path))
+		})
+
+		It("is empty without one", func() {
+			Expect(runtimeconfig.Find(fileindex.New(dir))).To(BeEmpty())
+		})
+
+		It("fails when there are several", func() {
+			write("app.runtimeconfig.json", "{}")
+			write("tool.runtimeconfig.json", "{}")
+			_, err := runtimeconfig.Find(fileindex.New(dir))
+			Expect(err).To(MatchError("Multiple .runtimeconfig.json files present"))
+		})
+	})
+
+	Describe("FindIn", func() {
+		It("finds the only runtimeconfig.json in a publish dir", func() {
+			path := write("app.runtimeconfig.json", "{}")
+			Expect(runtimeconfig.FindIn(dir)).To(Equal(path))
+		})
+
+		It("is empty when there are several", func() {
+			write("app.runtimeconfig.json", "{}")
+			write("tool.runtimeconfig.json", "{}")
+			Expect(runtimeconfig.FindIn(dir)).To(BeEmpty())
+		})
+	})
+
+	Describe("PatchConstraint", func() {
+		It("matches the patches of the framework's major.minor", func() {
+			Expect(runtimeconfig.Framework{Name: "Microsoft.NETCore.App", Version: "2.1.3"}.PatchConstraint()).To(Equal("2.1.x"))
+			Expect(runtimeconfig.Framework{Name: "Microsoft.NETCore.App", Version: "2.1"}.PatchConstraint()).To(Equal("2.1.x"))
+		})
+
+		It("rejects invalid versions", func() {
+			_, err := runtimeconfig.Framework{Name: "Microsoft.NETCore.App", Version: "latest"}.PatchConstraint()
+			Expect(err).To(MatchError(ContainSubstring(`framework Microsoft.NETCore.App has an invalid version "latest"`)))
+		})
+	})
+})
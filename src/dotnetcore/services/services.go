@@ -0,0 +1,84 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+type Service struct {
+	Label        string                 `json:"label"`
+	Name         string                 `json:"name"`
+	Tags         []string               `json:"tags"`
+	Credentials  map[string]interface{} `json:"credentials"`
+	VolumeMounts []VolumeMount          `json:"volume_mounts"`
+}
+
+type VolumeMount struct {
+	ContainerDir string `json:"container_dir"`
+	Mode         string `json:"mode"`
+}
+
+// Load parses the service bindings in VCAP_SERVICES
+func Load() ([]Service, error) {
+	vcapServices := os.Getenv("VCAP_SERVICES")
+	if vcapServices == "" {
+		return []Service{}, nil
+	}
+
+	byLabel := map[string][]Service{}
+	if err := json.Unmarshal([]byte(vcapServices), &byLabel); err != nil {
+		return nil, fmt.Errorf("parsing VCAP_SERVICES: %v", err)
+	}
+
+	labels := make([]string, 0, len(byLabel))
+	for label := range byLabel {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	all := []Service{}
+	for _, label := range labels {
+		all = append(all, byLabel[label]...)
+	}
+	return all, nil
+}
+
+// Credential returns the first of the given credential keys that has a
+// string value
+func (s Service) Credential(keys ...string) string {
+	for _, key := range keys {
+		if value, ok := s.Credentials[key].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Matches reports whether the service's name, label or one of its tags
+// contains the given term, ignoring case
+func (s Service) Matches(term string) bool {
+	term = strings.ToLower(term)
+	for _, value := range append([]string{s.Name, s.Label}, s.Tags...) {
+		if strings.Contains(strings.ToLower(value), term) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the first bound service matching the term
+func Find(term string) (*Service, error) {
+	all, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range all {
+		if all[i].Matches(term) {
+			return &all[i], nil
+		}
+	}
+	return nil, nil
+}
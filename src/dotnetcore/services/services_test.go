@@ -0,0 +1,51 @@
+package services_test
+
+import (
+	"dotnetcore/services"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Services", func() {
+	AfterEach(func() {
+		Expect(os.Unsetenv("VCAP_SERVICES")).To(Succeed())
+	})
+
+	Describe("Load", func() {
+		It("returns no services when VCAP_SERVICES is unset", func() {
+			Expect(services.Load()).To(BeEmpty())
+		})
+
+		It("returns an error for malformed VCAP_SERVICES", func() {
+			Expect(os.Setenv("VCAP_SERVICES", "not json")).To(Succeed())
+			_, err := services.Load()
+			Expect(err).To(MatchError(ContainSubstring("parsing VCAP_SERVICES")))
+		})
+	})
+
+	Describe("Find", func() {
+		BeforeEach(func() {
+			Expect(os.Setenv("VCAP_SERVICES", `{
+				"p.mysql": [{"name": "orders-db", "label": "p.mysql", "tags": ["mysql"], "credentials": {"uri": "mysql://orders"}}],
+				"user-provided": [{"name": "newrelic", "label": "user-provided", "tags": [], "credentials": {"licenseKey": "abc", "port": 1}}]
+			}`)).To(Succeed())
+		})
+
+		It("matches on name, label and tags", func() {
+			service, err := services.Find("MySQL")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(service.Name).To(Equal("orders-db"))
+
+			service, err = services.Find("newrelic")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(service.Credential("license_key", "licenseKey")).To(Equal("abc"))
+			Expect(service.Credential("port")).To(Equal(""))
+		})
+
+		It("returns nil when nothing matches", func() {
+			Expect(services.Find("redis")).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"dotnetcore/staticserver"
+	"log"
+	"net/http"
+	"os"
+)
+
+func main() {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	root, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Serving %s on port %s", root, port)
+	log.Fatal(http.ListenAndServe(":"+port, staticserver.New(root)))
+}
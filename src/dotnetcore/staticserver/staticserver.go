@@ -0,0 +1,43 @@
+package staticserver
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+func init() {
+	for ext, contentType := range map[string]string{
+		".wasm": "application/wasm",
+		".dll":  "application/octet-stream",
+		".pdb":  "application/octet-stream",
+		".dat":  "application/octet-stream",
+		".blat": "application/octet-stream",
+		".json": "application/json",
+	} {
+		mime.AddExtensionType(ext, contentType)
+	}
+}
+
+type Server struct {
+	root  string
+	files http.Handler
+}
+
+func New(root string) *Server {
+	return &Server{root: root, files: http.FileServer(http.Dir(root))}
+}
+
+// ServeHTTP serves files from the root directory. Requests for paths that
+// don't exist and have no file extension are client side routes, so they
+// are answered with index.html
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestPath := path.Clean("/" + r.URL.Path)
+	if _, err := os.Stat(filepath.Join(s.root, filepath.FromSlash(requestPath))); os.IsNotExist(err) && path.Ext(requestPath) == "" {
+		http.ServeFile(w, r, filepath.Join(s.root, "index.html"))
+		return
+	}
+	s.files.ServeHTTP(w, r)
+}
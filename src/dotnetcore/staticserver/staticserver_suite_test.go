@@ -0,0 +1,13 @@
+package staticserver_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestStaticserver(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Staticserver Suite")
+}
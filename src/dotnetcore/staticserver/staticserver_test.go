@@ -0,0 +1,59 @@
+package staticserver_test
+
+import (
+	"dotnetcore/staticserver"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Staticserver", func() {
+	var (
+		err     error
+		rootDir string
+		subject *staticserver.Server
+	)
+
+	BeforeEach(func() {
+		rootDir, err = ioutil.TempDir("", "dotnetcore-buildpack.wwwroot.")
+		Expect(err).To(BeNil())
+
+		Expect(os.MkdirAll(filepath.Join(rootDir, "_framework"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(rootDir, "index.html"), []byte("<app>index</app>"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(rootDir, "_framework", "dotnet.wasm"), []byte("wasm"), 0644)).To(Succeed())
+
+		subject = staticserver.New(rootDir)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(rootDir)).To(Succeed())
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		subject.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+		return recorder
+	}
+
+	It("serves files from the root directory", func() {
+		response := get("/_framework/dotnet.wasm")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Body.String()).To(Equal("wasm"))
+		Expect(response.Header().Get("Content-Type")).To(Equal("application/wasm"))
+	})
+
+	It("serves index.html for client side routes", func() {
+		response := get("/counter")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Body.String()).To(Equal("<app>index</app>"))
+	})
+
+	It("returns 404 for missing files", func() {
+		Expect(get("/_framework/missing.dll").Code).To(Equal(http.StatusNotFound))
+	})
+})
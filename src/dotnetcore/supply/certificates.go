@@ -0,0 +1,79 @@
+package supply
+
+import (
+	"bytes"
+	"dotnetcore/services"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const systemCABundle = "/etc/ssl/certs/ca-certificates.crt"
+
+// InstallCACertificates adds PEM certificates from CA_CERTIFICATES, or from
+// a bound service matching "ca-certificates", to a copy of the stack's CA
+// bundle. SSL_CERT_FILE points at it for the rest of staging and at launch,
+// which OpenSSL, and so .NET on Linux, uses to verify TLS connections.
+func (s *Supplier) InstallCACertificates() error {
+	certs, source, err := s.caCertificates()
+	if err != nil || certs == "" {
+		return err
+	}
+
+	var bundle bytes.Buffer
+	rest := []byte(certs)
+	count := 0
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			if err := pem.Encode(&bundle, block); err != nil {
+				return err
+			}
+			count++
+		}
+	}
+	if count == 0 {
+		return fmt.Errorf("no PEM certificates found in %s", source)
+	}
+	s.Log.BeginStep("Adding %d CA certificate(s) from %s", count, source)
+
+	system, err := ioutil.ReadFile(systemCABundle)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	certsDir := filepath.Join(s.Stager.DepDir(), "certs")
+	if err := os.MkdirAll(certsDir, 0755); err != nil {
+		return err
+	}
+	bundlePath := filepath.Join(certsDir, "ca-certificates.crt")
+	if err := ioutil.WriteFile(bundlePath, append(append(system, '\n'), bundle.Bytes()...), 0644); err != nil {
+		return err
+	}
+
+	if err := os.Setenv("SSL_CERT_FILE", bundlePath); err != nil {
+		return err
+	}
+	if err := s.Stager.WriteEnvFile("SSL_CERT_FILE", bundlePath); err != nil {
+		return err
+	}
+	return s.Stager.WriteProfileD("ca-certificates.sh", fmt.Sprintf("export SSL_CERT_FILE=%s\n", filepath.Join("$DEPS_DIR", s.Stager.DepsIdx(), "certs", "ca-certificates.crt")))
+}
+
+func (s *Supplier) caCertificates() (string, string, error) {
+	if certs := os.Getenv("CA_CERTIFICATES"); certs != "" {
+		return certs, "CA_CERTIFICATES", nil
+	}
+
+	service, err := services.Find("ca-certificates")
+	if err != nil || service == nil {
+		return "", "", err
+	}
+	return service.Credential("certificates", "ca_certificates", "certificate", "ca"), fmt.Sprintf("service %s", service.Name), nil
+}
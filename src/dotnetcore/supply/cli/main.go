@@ -1,19 +1,26 @@
 package main
 
 import (
-
-	// _ "dotnetcore/hooks"
+	"context"
+	"dotnetcore/commandlog"
 	"dotnetcore/config"
+	"dotnetcore/dotnetframework"
+	"dotnetcore/events"
+	_ "dotnetcore/hooks"
+	"dotnetcore/installer"
 	"dotnetcore/project"
 	"dotnetcore/supply"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/cloudfoundry/libbuildpack"
 )
 
 func main() {
+	commandlog.Enable()
 	logger := libbuildpack.NewLogger(os.Stdout)
 
 	buildpackDir, err := libbuildpack.GetBuildpackDir()
@@ -27,9 +34,26 @@ func main() {
 		logger.Error("Unable to load buildpack manifest: %s", err.Error())
 		os.Exit(10)
 	}
-	installer := libbuildpack.NewInstaller(manifest)
+	installer := installer.New(manifest, logger).SetProgress(installer.LogProgress(logger))
+
+	// Downloads stop cleanly when staging times out, and a second signal
+	// terminates supply as usual
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		cancel()
+	}()
 
-	stager := libbuildpack.NewStager(os.Args[1:], logger, manifest)
+	stagerArgs, err := config.StagerArgs(os.Args[1:])
+	if err != nil {
+		logger.Error("Unable to find the app root: %s", err.Error())
+		os.Exit(21)
+	}
+	stager := libbuildpack.NewStager(stagerArgs, logger, manifest)
 	if err := stager.CheckBuildpackValid(); err != nil {
 		os.Exit(11)
 	}
@@ -60,16 +84,32 @@ func main() {
 		os.Exit(14)
 	}
 
+	projectTOML, err := config.LoadProjectTOML(stager.BuildDir())
+	if err != nil {
+		logger.Error("Unable to read project.toml: %s", err.Error())
+		os.Exit(20)
+	}
+	for _, name := range projectTOML.SetEnv() {
+		logger.Info("Setting %s from project.toml", name)
+	}
+	for _, alias := range config.ApplyBPAliases() {
+		logger.Info("Using %s", alias)
+	}
+
 	cfg := &config.Config{}
+	project := project.New(stager.BuildDir(), stager.DepDir(), stager.DepsIdx()).SetLogger(logger)
 
 	s := supply.Supplier{
-		Stager:    stager,
-		Installer: installer,
-		Manifest:  manifest,
-		Log:       logger,
-		Command:   &libbuildpack.Command{},
-		Config:    cfg,
-		Project:   project.New(stager.BuildDir(), stager.DepDir(), stager.DepsIdx()),
+		Stager:          stager,
+		Installer:       installer,
+		Manifest:        manifest,
+		Log:             logger,
+		Command:         commandlog.New(logger),
+		Config:          cfg,
+		Project:         project,
+		DotnetFramework: dotnetframework.New(stager.DepDir(), stager.BuildDir(), installer, manifest, logger).SetIndex(project.Index()).SetContext(ctx),
+		Events:          events.New(os.Stdout),
+		Context:         ctx,
 	}
 
 	err = supply.Run(&s)
@@ -5,6 +5,7 @@
 package supply_test
 
 import (
+	context "context"
 	libbuildpack "github.com/cloudfoundry/libbuildpack"
 	gomock "github.com/golang/mock/gomock"
 	io "io"
@@ -117,6 +118,19 @@ func (mr *MockManifestMockRecorder) DefaultVersion(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DefaultVersion", reflect.TypeOf((*MockManifest)(nil).DefaultVersion), arg0)
 }
 
+// GetEntry mocks base method
+func (m *MockManifest) GetEntry(arg0 libbuildpack.Dependency) (*libbuildpack.ManifestEntry, error) {
+	ret := m.ctrl.Call(m, "GetEntry", arg0)
+	ret0, _ := ret[0].(*libbuildpack.ManifestEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetEntry indicates an expected call of GetEntry
+func (mr *MockManifestMockRecorder) GetEntry(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEntry", reflect.TypeOf((*MockManifest)(nil).GetEntry), arg0)
+}
+
 // MockInstaller is a mock of Installer interface
 type MockInstaller struct {
 	ctrl     *gomock.Controller
@@ -164,6 +178,18 @@ func (mr *MockInstallerMockRecorder) InstallDependency(arg0, arg1 interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InstallDependency", reflect.TypeOf((*MockInstaller)(nil).InstallDependency), arg0, arg1)
 }
 
+// InstallDependencyContext mocks base method
+func (m *MockInstaller) InstallDependencyContext(arg0 context.Context, arg1 libbuildpack.Dependency, arg2 string) error {
+	ret := m.ctrl.Call(m, "InstallDependencyContext", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InstallDependencyContext indicates an expected call of InstallDependencyContext
+func (mr *MockInstallerMockRecorder) InstallDependencyContext(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InstallDependencyContext", reflect.TypeOf((*MockInstaller)(nil).InstallDependencyContext), arg0, arg1, arg2)
+}
+
 // InstallOnlyVersion mocks base method
 func (m *MockInstaller) InstallOnlyVersion(arg0, arg1 string) error {
 	ret := m.ctrl.Call(m, "InstallOnlyVersion", arg0, arg1)
@@ -176,6 +202,41 @@ func (mr *MockInstallerMockRecorder) InstallOnlyVersion(arg0, arg1 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InstallOnlyVersion", reflect.TypeOf((*MockInstaller)(nil).InstallOnlyVersion), arg0, arg1)
 }
 
+// MockDotnetFramework is a mock of DotnetFramework interface
+type MockDotnetFramework struct {
+	ctrl     *gomock.Controller
+	recorder *MockDotnetFrameworkMockRecorder
+}
+
+// MockDotnetFrameworkMockRecorder is the mock recorder for MockDotnetFramework
+type MockDotnetFrameworkMockRecorder struct {
+	mock *MockDotnetFramework
+}
+
+// NewMockDotnetFramework creates a new mock instance
+func NewMockDotnetFramework(ctrl *gomock.Controller) *MockDotnetFramework {
+	mock := &MockDotnetFramework{ctrl: ctrl}
+	mock.recorder = &MockDotnetFrameworkMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockDotnetFramework) EXPECT() *MockDotnetFrameworkMockRecorder {
+	return m.recorder
+}
+
+// Install mocks base method
+func (m *MockDotnetFramework) Install() error {
+	ret := m.ctrl.Call(m, "Install")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Install indicates an expected call of Install
+func (mr *MockDotnetFrameworkMockRecorder) Install() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Install", reflect.TypeOf((*MockDotnetFramework)(nil).Install))
+}
+
 // MockStager is a mock of Stager interface
 type MockStager struct {
 	ctrl     *gomock.Controller
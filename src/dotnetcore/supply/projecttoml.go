@@ -0,0 +1,106 @@
+package supply
+
+import (
+	"dotnetcore/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// ApplyProjectTOML removes the files a project.toml leaves out of the app,
+// either by not matching its include patterns or by matching its exclude
+// patterns, the way Cloud Native Buildpacks platforms do before building.
+// Patterns without a slash match names at any depth. project.toml and
+// buildpack.yml are always kept.
+func (s *Supplier) ApplyProjectTOML() error {
+	projectTOML, err := config.LoadProjectTOML(s.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	if len(projectTOML.Include) == 0 && len(projectTOML.Exclude) == 0 {
+		return nil
+	}
+	for _, pattern := range append(append([]string{}, projectTOML.Include...), projectTOML.Exclude...) {
+		if _, err := filepath.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+			return err
+		}
+	}
+
+	s.Log.BeginStep("Applying include and exclude patterns from project.toml")
+	buildDir := s.Stager.BuildDir()
+	var removed int
+	var dirs []string
+	if err := filepath.Walk(buildDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == buildDir {
+			return err
+		}
+		rel, err := filepath.Rel(buildDir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "project.toml" || rel == "buildpack.yml" {
+			return nil
+		}
+		excluded := matchesProjectPattern(rel, projectTOML.Exclude)
+		if !excluded && len(projectTOML.Include) > 0 && !matchesProjectPattern(rel, projectTOML.Include) {
+			if info.IsDir() {
+				// Files deeper down may still be included
+				dirs = append(dirs, path)
+				return nil
+			}
+			excluded = true
+		}
+		if !excluded {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		removed++
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) && !isNotEmpty(err) {
+			return err
+		}
+	}
+	s.Project.Index().Reset()
+	s.Log.Info("Removed %d files and directories", removed)
+	return nil
+}
+
+// matchesProjectPattern reports whether rel, or a directory it is in,
+// matches one of the patterns
+func matchesProjectPattern(rel string, patterns []string) bool {
+	for path := rel; path != "."; path = filepath.Dir(path) {
+		for _, pattern := range patterns {
+			pattern = strings.TrimPrefix(strings.TrimSuffix(pattern, "/"), "/")
+			if matched, _ := filepath.Match(pattern, path); matched {
+				return true
+			}
+			if !strings.Contains(pattern, "/") {
+				if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func isNotEmpty(err error) bool {
+	pathErr, ok := err.(*os.PathError)
+	return ok && pathErr.Err == syscall.ENOTEMPTY
+}
@@ -0,0 +1,63 @@
+package supply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// sdkCacheDir holds the extracted SDK of the last staging, keyed by stack,
+// version and the sha256 of the manifest's download, so restaging with the
+// same SDK skips download and extraction while a rebuilt SDK of the same
+// version is not mistaken for the cached one. It is empty when the manifest
+// has no entry for the SDK.
+func (s *Supplier) sdkCacheDir(dep libbuildpack.Dependency) string {
+	entry, err := s.Manifest.GetEntry(dep)
+	if err != nil || entry.SHA256 == "" {
+		return ""
+	}
+	return filepath.Join(s.Stager.CacheDir(), "dotnet-sdk", os.Getenv("CF_STACK"), dep.Version, entry.SHA256)
+}
+
+// restoreCachedSdk copies a cached SDK into dotnetDir, reporting whether
+// there was one
+func (s *Supplier) restoreCachedSdk(dep libbuildpack.Dependency, dotnetDir string) (bool, error) {
+	cacheDir := s.sdkCacheDir(dep)
+	if cacheDir == "" {
+		return false, nil
+	}
+	if complete, err := libbuildpack.FileExists(filepath.Join(cacheDir, "complete")); err != nil || !complete {
+		return false, err
+	}
+
+	s.Log.Info("Using cached dotnet SDK %s", dep.Version)
+	if err := os.MkdirAll(dotnetDir, 0755); err != nil {
+		return false, err
+	}
+	return true, libbuildpack.CopyDirectory(filepath.Join(cacheDir, "dotnet"), dotnetDir)
+}
+
+// cacheSdk replaces the cached SDK with the one just installed to dotnetDir
+func (s *Supplier) cacheSdk(dep libbuildpack.Dependency, dotnetDir string) error {
+	cacheDir := s.sdkCacheDir(dep)
+	if cacheDir == "" {
+		return nil
+	}
+	if exists, err := libbuildpack.FileExists(dotnetDir); err != nil || !exists {
+		return err
+	}
+
+	if err := os.RemoveAll(filepath.Join(s.Stager.CacheDir(), "dotnet-sdk")); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(cacheDir, "dotnet"), 0755); err != nil {
+		return err
+	}
+	if err := libbuildpack.CopyDirectory(dotnetDir, filepath.Join(cacheDir, "dotnet")); err != nil {
+		return err
+	}
+	// Written last, so an interrupted copy is never restored
+	return ioutil.WriteFile(filepath.Join(cacheDir, "complete"), []byte{}, 0644)
+}
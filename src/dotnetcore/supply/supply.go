@@ -1,16 +1,20 @@
 package supply
 
 import (
+	"context"
 	"crypto/md5"
 	"dotnetcore/config"
+	"dotnetcore/events"
+	"dotnetcore/jsonc"
 	"dotnetcore/project"
-	"encoding/xml"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/cloudfoundry/libbuildpack"
@@ -24,14 +28,20 @@ type Command interface {
 type Manifest interface {
 	AllDependencyVersions(string) []string
 	DefaultVersion(string) (libbuildpack.Dependency, error)
+	GetEntry(libbuildpack.Dependency) (*libbuildpack.ManifestEntry, error)
 }
 
 type Installer interface {
 	FetchDependency(libbuildpack.Dependency, string) error
 	InstallDependency(libbuildpack.Dependency, string) error
+	InstallDependencyContext(context.Context, libbuildpack.Dependency, string) error
 	InstallOnlyVersion(string, string) error
 }
 
+type DotnetFramework interface {
+	Install() error
+}
+
 type Stager interface {
 	BuildDir() string
 	CacheDir() string
@@ -45,17 +55,35 @@ type Stager interface {
 }
 
 type Supplier struct {
-	Stager    Stager
-	Manifest  Manifest
-	Installer Installer
-	Log       *libbuildpack.Logger
-	Command   Command
-	Config    *config.Config
-	Project   *project.Project
+	Stager          Stager
+	Manifest        Manifest
+	Installer       Installer
+	Log             *libbuildpack.Logger
+	Command         Command
+	Config          *config.Config
+	Project         *project.Project
+	DotnetFramework DotnetFramework
+	Events          *events.Log
+	// Context is done when staging should stop, such as on a timeout
+	Context context.Context
+}
+
+func (s *Supplier) context() context.Context {
+	if s.Context == nil {
+		return context.Background()
+	}
+	return s.Context
 }
 
 func Run(s *Supplier) error {
 	s.Log.BeginStep("Supplying Dotnet Core")
+	defer s.Events.PrintTimings(s.Log)
+
+	// Telemetry is opted out of unless the app explicitly set
+	// DOTNET_CLI_TELEMETRY_OPTOUT, e.g. to 0 to opt back in
+	if _, set := os.LookupEnv("DOTNET_CLI_TELEMETRY_OPTOUT"); !set {
+		os.Setenv("DOTNET_CLI_TELEMETRY_OPTOUT", "1")
+	}
 
 	if err := s.Command.Execute(s.Stager.BuildDir(), ioutil.Discard, ioutil.Discard, "touch", "/tmp/checkpoint"); err != nil {
 		s.Log.Error("Unable to execute command: %s", err.Error())
@@ -66,21 +94,76 @@ func Run(s *Supplier) error {
 		s.Log.Debug("BuildDir Checksum Before Supply: %s", checksum)
 	}
 
-	if err := s.InstallLibunwind(); err != nil {
+	if err := s.Events.Phase("apply-project-toml", s.ApplyProjectTOML); err != nil {
+		s.Log.Error("Unable to apply project.toml: %s", err.Error())
+		return err
+	}
+
+	if err := s.Events.Phase("install-ca-certificates", s.InstallCACertificates); err != nil {
+		s.Log.Error("Unable to install CA certificates: %s", err.Error())
+		return err
+	}
+
+	if err := s.Events.Phase("install-libunwind", s.InstallLibunwind); err != nil {
 		s.Log.Error("Unable to install Libunwind: %s", err.Error())
 		return err
 	}
-	if err := s.InstallDotnet(); err != nil {
+	if err := s.Events.Phase("install-libgdiplus", s.InstallLibgdiplus); err != nil {
+		s.Log.Error("Unable to install libgdiplus: %s", err.Error())
+		return err
+	}
+
+	if err := s.Events.Phase("install-icu", s.InstallICU); err != nil {
+		s.Log.Error("Unable to install ICU: %s", err.Error())
+		return err
+	}
+
+	if err := s.Events.Phase("install-tzdata", s.InstallTzdata); err != nil {
+		s.Log.Error("Unable to install tzdata: %s", err.Error())
+		return err
+	}
+
+	if err := s.Events.Phase("install-krb5", s.InstallKrb5); err != nil {
+		s.Log.Error("Unable to install krb5: %s", err.Error())
+		return err
+	}
+
+	if err := s.Events.Phase("install-dotnet", s.InstallDotnet); err != nil {
 		s.Log.Error("Unable to install Dotnet: %s", err.Error())
 		return err
 	}
 
-	if err := s.InstallNode(); err != nil {
+	if err := s.Events.Phase("export-dotnet", s.ExportDotnet); err != nil {
+		s.Log.Error("Unable to export dotnet to subsequent buildpacks: %s", err.Error())
+		return err
+	}
+
+	if err := s.Events.Phase("restore-workloads", s.RestoreWorkloads); err != nil {
+		s.Log.Error("Unable to restore dotnet workloads: %s", err.Error())
+		return err
+	}
+
+	if err := s.Events.Phase("restore-local-tools", s.RestoreLocalTools); err != nil {
+		s.Log.Error("Unable to restore dotnet local tools: %s", err.Error())
+		return err
+	}
+
+	if err := s.Events.Phase("install-diagnostic-tools", s.InstallDiagnosticTools); err != nil {
+		s.Log.Error("Unable to install dotnet diagnostic tools: %s", err.Error())
+		return err
+	}
+
+	if err := s.Events.Phase("install-node", s.InstallNode); err != nil {
 		s.Log.Error("Unable to install NodeJs: %s", err.Error())
 		return err
 	}
 
-	if err := s.InstallBower(); err != nil {
+	if err := s.Events.Phase("install-yarn", s.InstallYarn); err != nil {
+		s.Log.Error("Unable to install Yarn: %s", err.Error())
+		return err
+	}
+
+	if err := s.Events.Phase("install-bower", s.InstallBower); err != nil {
 		s.Log.Error("Unable to install Bower: %s", err.Error())
 		return err
 	}
@@ -96,18 +179,203 @@ func Run(s *Supplier) error {
 
 	if filesChanged, err := s.Command.Output(s.Stager.BuildDir(), "find", ".", "-newer", "/tmp/checkpoint", "-not", "-path", "./.cloudfoundry/*", "-not", "-path", "./.cloudfoundry"); err == nil && filesChanged != "" {
 		s.Log.Debug("Below files changed:")
-		s.Log.Debug(filesChanged)
+		s.Log.Debug("%s", filesChanged)
 	}
 
 	return nil
 }
 
 func (s *Supplier) InstallLibunwind() error {
-	if err := s.Installer.InstallOnlyVersion("libunwind", filepath.Join(s.Stager.DepDir(), "libunwind")); err != nil {
+	return s.installStackLibrary("libunwind", "", false)
+}
+
+// InstallLibgdiplus installs libgdiplus for apps that use System.Drawing.
+// INSTALL_LIBGDIPLUS or buildpack.yml can turn it on or off regardless.
+func (s *Supplier) InstallLibgdiplus() error {
+	buildpackYML, err := config.LoadBuildpackYML(s.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	lib := buildpackYML.DotnetCore.Libgdiplus
+
+	install, requested, err := s.shouldInstallOptional("INSTALL_LIBGDIPLUS", lib, func() (bool, error) {
+		return s.Project.ReferencesPackage("System.Drawing.Common")
+	})
+	if err != nil || !install {
+		return err
+	}
+	return s.installStackLibrary("libgdiplus", lib.Version, requested)
+}
+
+// InstallICU installs ICU from the manifest when INSTALL_ICU or
+// buildpack.yml asks for it. Apps in globalization invariant mode don't
+// load ICU, so it is never installed for them.
+func (s *Supplier) InstallICU() error {
+	buildpackYML, err := config.LoadBuildpackYML(s.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	globalization := buildpackYML.DotnetCore.Globalization
+
+	install, requested, err := s.shouldInstallOptional("INSTALL_ICU", globalization.ICU, func() (bool, error) { return false, nil })
+	if err != nil || !install {
+		return err
+	}
+
+	if invariant, err := s.Project.InvariantGlobalization(); err != nil {
+		return err
+	} else if invariant || (globalization.Invariant != nil && *globalization.Invariant) {
+		s.Log.Warning("Not installing ICU because the app runs in globalization invariant mode")
+		return nil
+	}
+	return s.installStackLibrary("icu", globalization.ICU.Version, requested)
+}
+
+// InstallTzdata installs time zone data when INSTALL_TZDATA or
+// buildpack.yml asks for it, for stacks whose own tzdata is incomplete
+func (s *Supplier) InstallTzdata() error {
+	buildpackYML, err := config.LoadBuildpackYML(s.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	lib := buildpackYML.DotnetCore.Tzdata
+
+	install, requested, err := s.shouldInstallOptional("INSTALL_TZDATA", lib, func() (bool, error) { return false, nil })
+	if err != nil || !install {
+		return err
+	}
+	if installed, err := s.installStackDependency("tzdata", lib.Version, requested); err != nil || !installed {
+		return err
+	}
+
+	if err := s.Stager.WriteEnvFile("TZDIR", filepath.Join(s.Stager.DepDir(), "tzdata")); err != nil {
+		return err
+	}
+	return s.Stager.WriteProfileD("tzdata.sh", fmt.Sprintf("export TZDIR=%s\n", filepath.Join("$DEPS_DIR", s.Stager.DepsIdx(), "tzdata")))
+}
+
+// InstallKrb5 installs the Kerberos GSSAPI libraries when INSTALL_KRB5 or
+// buildpack.yml asks for it, for apps using integrated authentication
+func (s *Supplier) InstallKrb5() error {
+	buildpackYML, err := config.LoadBuildpackYML(s.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	lib := buildpackYML.DotnetCore.Krb5
+
+	install, requested, err := s.shouldInstallOptional("INSTALL_KRB5", lib, func() (bool, error) { return false, nil })
+	if err != nil || !install {
+		return err
+	}
+	return s.installStackLibrary("krb5", lib.Version, requested)
+}
+
+// shouldInstallOptional reports whether to install an optional dependency,
+// and whether envVar or buildpack.yml explicitly asked for it rather than
+// detect finding the app needs it
+func (s *Supplier) shouldInstallOptional(envVar string, dep config.OptionalDependency, detect func() (bool, error)) (bool, bool, error) {
+	switch env := os.Getenv(envVar); env {
+	case "true":
+		return true, true, nil
+	case "false":
+		return false, false, nil
+	case "":
+	default:
+		return false, false, fmt.Errorf("%s must be true or false, not %s", envVar, env)
+	}
+	if dep.Install != nil {
+		return *dep.Install, *dep.Install, nil
+	}
+	install, err := detect()
+	return install, install && dep.Version != "", err
+}
+
+// installStackLibrary installs a native library from the manifest and puts
+// it on LD_LIBRARY_PATH. Newer stacks ship some of these libraries
+// themselves, so there may be no manifest entry for the current stack.
+// An empty version installs the only version in the manifest.
+func (s *Supplier) installStackLibrary(name, version string, requested bool) error {
+	if installed, err := s.installStackDependency(name, version, requested); err != nil || !installed {
 		return err
 	}
+	return s.Stager.LinkDirectoryInDepDir(filepath.Join(s.Stager.DepDir(), name, "lib"), "lib")
+}
+
+// stackLibraries are the shared objects that show a stack ships one of
+// the native libraries the buildpack otherwise installs
+var stackLibraries = map[string]string{
+	"libunwind":  "libunwind.so.8",
+	"icu":        "libicuuc.so",
+	"libgdiplus": "libgdiplus.so",
+	"krb5":       "libgssapi_krb5.so.2",
+}
+
+// installStackDependency installs name from the manifest into the dep dir,
+// returning false when the manifest has no version for the current stack.
+// Manifest entries are matched to the stack by their cf_stacks, so a stack
+// without one relies on its own copy of the library. It is an error when
+// the app requested a dependency that neither provides.
+func (s *Supplier) installStackDependency(name, version string, requested bool) (bool, error) {
+	stack := os.Getenv("CF_STACK")
+	versions := s.Manifest.AllDependencyVersions(name)
+	if len(versions) == 0 {
+		if version != "" {
+			if requested {
+				return false, fmt.Errorf("%s %s was requested but the buildpack has no %s for the %s stack", name, version, name, stack)
+			}
+			s.Log.Warning("%s %s was requested but the buildpack has no %s for the %s stack", name, version, name, stack)
+		}
+		if provided, err := s.stackProvides(name); err != nil {
+			return false, err
+		} else if !provided {
+			if requested {
+				return false, fmt.Errorf("%s was requested but neither the buildpack nor the %s stack provides it", name, stack)
+			}
+			s.Log.Warning("The %s stack does not provide %s and the buildpack has none for it", stack, name)
+			return false, nil
+		}
+		s.Log.Info("Using %s provided by the %s stack", name, stack)
+		return false, nil
+	}
+
+	installDir := filepath.Join(s.Stager.DepDir(), name)
+	if version == "" {
+		if err := s.Installer.InstallOnlyVersion(name, installDir); err != nil {
+			return false, err
+		}
+		version = versions[0]
+	} else {
+		resolved, err := libbuildpack.FindMatchingVersion(version, versions)
+		if err != nil {
+			return false, fmt.Errorf("%s %s is not available, available versions: %v", name, version, versions)
+		}
+		if err := s.Installer.InstallDependency(libbuildpack.Dependency{Name: name, Version: resolved}, installDir); err != nil {
+			return false, err
+		}
+		version = resolved
+	}
+	s.Events.Dependency(name, version)
+	return true, nil
+}
 
-	return s.Stager.LinkDirectoryInDepDir(filepath.Join(s.Stager.DepDir(), "libunwind", "lib"), "lib")
+// stackProvides reports whether the stack's linker cache has the library.
+// Only the stackLibraries can be looked up.
+func (s *Supplier) stackProvides(name string) (bool, error) {
+	library, ok := stackLibraries[name]
+	if !ok {
+		return false, nil
+	}
+	cache, err := s.Command.Output("/", "/sbin/ldconfig", "-p")
+	if err != nil {
+		s.Log.Debug("Unable to list the stack's libraries: %s", err.Error())
+		return true, nil
+	}
+	for _, line := range strings.Split(cache, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && strings.HasPrefix(fields[0], library) {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 func (s *Supplier) shouldInstallBower() (bool, error) {
@@ -116,16 +384,42 @@ func (s *Supplier) shouldInstallBower() (bool, error) {
 		return false, nil
 	}
 
-	if isPublished, err := s.Project.IsPublished(); err != nil {
+	buildpackYML, err := config.LoadBuildpackYML(s.Stager.BuildDir())
+	if err != nil {
 		return false, err
-	} else if isPublished {
-		return false, nil
 	}
+	install := config.OptionalDependency{Install: buildpackYML.DotnetCore.InstallBower}
+
+	shouldInstall, _, err := s.shouldInstallOptional("INSTALL_BOWER", install, func() (bool, error) {
+		if isPublished, err := s.Project.IsPublished(); err != nil || isPublished {
+			return false, err
+		}
+
+		if found, err := s.hasBowerConfig(); err != nil || !found {
+			return false, err
+		}
 
-	if commandsPresent, err := s.commandsInProjFiles([]string{"bower"}); err != nil {
+		return s.commandsInProjFiles([]string{"bower"})
+	})
+	return shouldInstall, err
+}
+
+// hasBowerConfig reports whether a bower.json or .bowerrc sits next to the
+// main project or at the root of the app. Bower is obsolete, so it is
+// skipped for apps without either.
+func (s *Supplier) hasBowerConfig() (bool, error) {
+	dirs := []string{s.Stager.BuildDir()}
+	if mainPath, err := s.Project.MainPath(); err != nil {
 		return false, err
-	} else if commandsPresent {
-		return true, nil
+	} else if mainPath != "" {
+		dirs = append(dirs, filepath.Dir(mainPath))
+	}
+	for _, dir := range dirs {
+		for _, name := range []string{"bower.json", ".bowerrc"} {
+			if found, err := libbuildpack.FileExists(filepath.Join(dir, name)); err != nil || found {
+				return found, err
+			}
+		}
 	}
 	return false, nil
 }
@@ -170,10 +464,24 @@ func (s *Supplier) InstallNode() error {
 		return err
 	}
 	if shouldInstallNode {
-		if err := s.Installer.InstallOnlyVersion("node", s.Stager.DepDir()); err != nil {
+		requested, err := s.requestedNodeVersion()
+		if err != nil {
+			return err
+		}
+		version, err := s.nodeVersion(requested)
+		if err != nil {
 			return err
 		}
-		version := s.Manifest.AllDependencyVersions("node")[0]
+		if requested == "" {
+			err = s.Installer.InstallOnlyVersion("node", s.Stager.DepDir())
+		} else {
+			s.Log.Info("Using node %s for requested version %s", version, requested)
+			err = s.Installer.InstallDependency(libbuildpack.Dependency{Name: "node", Version: version}, s.Stager.DepDir())
+		}
+		if err != nil {
+			return err
+		}
+		s.Events.Dependency("node", version)
 		if err := os.Rename(filepath.Join(s.Stager.DepDir(), fmt.Sprintf("node-v%s-linux-x64", version)), filepath.Join(s.Stager.DepDir(), "node")); err != nil {
 			return err
 		}
@@ -182,23 +490,139 @@ func (s *Supplier) InstallNode() error {
 	return nil
 }
 
+// requestedNodeVersion returns the node version line set in NODE_VERSION
+// or buildpack.yml, if any
+func (s *Supplier) requestedNodeVersion() (string, error) {
+	if version := os.Getenv("NODE_VERSION"); version != "" {
+		return version, nil
+	}
+	buildpackYML, err := config.LoadBuildpackYML(s.Stager.BuildDir())
+	if err != nil {
+		return "", err
+	}
+	return buildpackYML.DotnetCore.NodeVersion, nil
+}
+
+func (s *Supplier) nodeVersion(requested string) (string, error) {
+	versions := s.Manifest.AllDependencyVersions("node")
+	if len(versions) == 0 {
+		return "", fmt.Errorf("the buildpack has no node for the %s stack", os.Getenv("CF_STACK"))
+	}
+	if requested == "" {
+		return versions[0], nil
+	}
+	version, err := libbuildpack.FindMatchingVersion(requested, versions)
+	if err != nil {
+		return "", fmt.Errorf("node %s is not available, available versions: %v", requested, versions)
+	}
+	return version, nil
+}
+
 func (s *Supplier) shouldInstallNode() (bool, error) {
 	err := s.Command.Execute(s.Stager.BuildDir(), ioutil.Discard, ioutil.Discard, "node", "-v")
 	if err == nil {
 		return false, nil
 	}
 
-	if os.Getenv("INSTALL_NODE") != "" {
+	// INSTALL_NODE=false skips node, any other value forces it
+	if installNode := os.Getenv("INSTALL_NODE"); installNode == "false" {
+		return false, nil
+	} else if installNode != "" {
 		return true, nil
 	}
 
+	buildpackYML, err := config.LoadBuildpackYML(s.Stager.BuildDir())
+	if err != nil {
+		return false, err
+	}
+	if buildpackYML.DotnetCore.InstallNode != nil {
+		return *buildpackYML.DotnetCore.InstallNode, nil
+	}
+
 	if isPublished, err := s.Project.IsPublished(); err != nil {
 		return false, err
 	} else if isPublished {
 		return false, nil
 	}
 
-	return s.commandsInProjFiles([]string{"npm", "bower"})
+	if found, err := s.hasYarnLock(); err != nil || found {
+		return found, err
+	}
+
+	if found, err := s.hasFrontend(); err != nil || found {
+		return found, err
+	}
+
+	return s.commandsInProjFiles([]string{"npm", "bower", "yarn"})
+}
+
+// hasFrontend reports whether the main project declares a SpaRoot or has
+// a package.json next to it
+func (s *Supplier) hasFrontend() (bool, error) {
+	mainPath, err := s.Project.MainPath()
+	if err != nil || mainPath == "" {
+		return false, err
+	}
+	if spaRoot, err := s.Project.ProjectProperty(mainPath, "SpaRoot"); err != nil || spaRoot != "" {
+		return spaRoot != "", err
+	}
+	return libbuildpack.FileExists(filepath.Join(filepath.Dir(mainPath), "package.json"))
+}
+
+// InstallYarn installs yarn for apps with a yarn.lock or project targets
+// that run yarn. INSTALL_YARN or buildpack.yml can turn it on or off.
+func (s *Supplier) InstallYarn() error {
+	if err := s.Command.Execute(s.Stager.BuildDir(), ioutil.Discard, ioutil.Discard, "yarn", "--version"); err == nil {
+		return nil
+	}
+
+	buildpackYML, err := config.LoadBuildpackYML(s.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	yarn := buildpackYML.DotnetCore.Yarn
+
+	install, requested, err := s.shouldInstallOptional("INSTALL_YARN", yarn, func() (bool, error) {
+		if isPublished, err := s.Project.IsPublished(); err != nil || isPublished {
+			return false, err
+		}
+		if found, err := s.hasYarnLock(); err != nil || found {
+			return found, err
+		}
+		return s.commandsInProjFiles([]string{"yarn"})
+	})
+	if err != nil || !install {
+		return err
+	}
+
+	if len(s.Manifest.AllDependencyVersions("yarn")) == 0 {
+		if requested {
+			return fmt.Errorf("yarn was requested but the buildpack has no yarn for the %s stack", os.Getenv("CF_STACK"))
+		}
+		s.Log.Warning("The app uses yarn, but the buildpack has no yarn for the %s stack; packages will be installed with npm", os.Getenv("CF_STACK"))
+		return nil
+	}
+	if _, err := s.installStackDependency("yarn", yarn.Version, true); err != nil {
+		return err
+	}
+	return s.Stager.LinkDirectoryInDepDir(filepath.Join(s.Stager.DepDir(), "yarn", "bin"), "bin")
+}
+
+// hasYarnLock reports whether a yarn.lock sits next to the main project
+// or at the root of the app
+func (s *Supplier) hasYarnLock() (bool, error) {
+	dirs := []string{s.Stager.BuildDir()}
+	if mainPath, err := s.Project.MainPath(); err != nil {
+		return false, err
+	} else if mainPath != "" {
+		dirs = append(dirs, filepath.Dir(mainPath))
+	}
+	for _, dir := range dirs {
+		if found, err := libbuildpack.FileExists(filepath.Join(dir, "yarn.lock")); err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
 }
 
 func (s *Supplier) commandsInProjFiles(commands []string) (bool, error) {
@@ -220,11 +644,7 @@ func (s *Supplier) commandsInProjFiles(commands []string) (bool, error) {
 			} `xml:"Target"`
 		}{}
 
-		projFileContent, err := ioutil.ReadFile(projFile)
-		if err != nil {
-			return false, err
-		}
-		if err := xml.Unmarshal(projFileContent, &obj); err != nil {
+		if err := project.UnmarshalProjFile(projFile, &obj); err != nil {
 			return false, err
 		}
 
@@ -268,6 +688,7 @@ func majorMinorOnly(version string) string {
 
 func (s *Supplier) pickVersionToInstall() (string, error) {
 	allVersions := s.Manifest.AllDependencyVersions("dotnet")
+	s.Log.Debug("Available dotnet SDK versions: %v", allVersions)
 
 	buildpackVersion, err := s.buildpackYamlSdkVersion()
 	if err != nil {
@@ -279,6 +700,7 @@ func (s *Supplier) pickVersionToInstall() (string, error) {
 			s.Log.Warning("SDK %s in buildpack.yml is not available", buildpackVersion)
 			return "", err
 		}
+		s.Log.Debug("SDK %s in buildpack.yml resolved to %s", buildpackVersion, version)
 		return version, err
 	}
 
@@ -287,6 +709,7 @@ func (s *Supplier) pickVersionToInstall() (string, error) {
 		return "", err
 	}
 	if globalJSONVersion != "" {
+		s.Log.Debug("global.json requests SDK %s", globalJSONVersion)
 		if contains(allVersions, globalJSONVersion) {
 			return globalJSONVersion, nil
 		}
@@ -314,19 +737,289 @@ func (s *Supplier) pickVersionToInstall() (string, error) {
 }
 
 func (s *Supplier) InstallDotnet() error {
+	if runtimeOnly, err := s.runtimeOnly(); err != nil {
+		return err
+	} else if runtimeOnly {
+		return s.installRuntimeOnly()
+	}
+
 	installVersion, err := s.pickVersionToInstall()
 	if err != nil {
 		return err
 	}
 	s.Config.DotnetSdkVersion = installVersion
 
-	if err := s.Installer.InstallDependency(libbuildpack.Dependency{Name: "dotnet", Version: installVersion}, filepath.Join(s.Stager.DepDir(), "dotnet")); err != nil {
+	dep := libbuildpack.Dependency{Name: "dotnet", Version: installVersion}
+	dotnetDir := filepath.Join(s.Stager.DepDir(), "dotnet")
+	if cached, err := s.restoreCachedSdk(dep, dotnetDir); err != nil {
 		return err
+	} else if !cached {
+		if err := s.Installer.InstallDependencyContext(s.context(), dep, dotnetDir); err != nil {
+			return err
+		}
+		if err := s.cacheSdk(dep, dotnetDir); err != nil {
+			return err
+		}
 	}
+	s.Events.Dependency("dotnet", installVersion)
 
 	return s.Stager.AddBinDependencyLink(filepath.Join(s.Stager.DepDir(), "dotnet", "dotnet"), "dotnet")
 }
 
+// ResolveSdkVersion returns the SDK version InstallDotnet would install, or
+// an empty string when only the runtime is needed
+func (s *Supplier) ResolveSdkVersion() (string, error) {
+	if runtimeOnly, err := s.runtimeOnly(); err != nil || runtimeOnly {
+		return "", err
+	}
+	return s.pickVersionToInstall()
+}
+
+// ResolveNodeVersion returns the node version InstallNode would install, or
+// an empty string when node is not needed
+func (s *Supplier) ResolveNodeVersion() (string, error) {
+	if shouldInstallNode, err := s.shouldInstallNode(); err != nil || !shouldInstallNode {
+		return "", err
+	}
+	requested, err := s.requestedNodeVersion()
+	if err != nil {
+		return "", err
+	}
+	return s.nodeVersion(requested)
+}
+
+// Published apps don't need the SDK, only the shared runtime they were
+// built against. DOTNET_RUNTIME_ONLY=false installs the SDK regardless.
+func (s *Supplier) runtimeOnly() (bool, error) {
+	if os.Getenv("DOTNET_RUNTIME_ONLY") == "false" {
+		return false, nil
+	}
+	return s.Project.IsPublished()
+}
+
+func (s *Supplier) installRuntimeOnly() error {
+	s.Log.Info("App is already published, installing the dotnet runtime only")
+	if err := s.DotnetFramework.Install(); err != nil {
+		return err
+	}
+
+	dotnetHost := filepath.Join(s.Stager.DepDir(), "dotnet", "dotnet")
+	if exists, err := libbuildpack.FileExists(dotnetHost); err != nil || !exists {
+		return err
+	}
+	return s.Stager.AddBinDependencyLink(dotnetHost, "dotnet")
+}
+
+// ExportDotnet makes the installed dotnet CLI available to buildpacks that
+// run after this one, and to the app at launch when another buildpack
+// finalizes
+func (s *Supplier) ExportDotnet() error {
+	dotnetRoot := filepath.Join(s.Stager.DepDir(), "dotnet")
+	s.Config.DotnetRoot = dotnetRoot
+
+	if err := s.Stager.WriteEnvFile("DOTNET_ROOT", dotnetRoot); err != nil {
+		return err
+	}
+	return s.Stager.WriteProfileD("dotnet-root.sh", fmt.Sprintf("export DOTNET_ROOT=%s\n", filepath.Join("$DEPS_DIR", s.Stager.DepsIdx(), "dotnet")))
+}
+
+func (s *Supplier) RestoreWorkloads() error {
+	if shouldRestore, err := s.shouldRestoreWorkloads(); err != nil {
+		return err
+	} else if !shouldRestore {
+		return nil
+	}
+
+	mainProject, err := s.Project.MainPath()
+	if err != nil {
+		return err
+	}
+
+	s.Log.BeginStep("Restoring dotnet workloads")
+	args := []string{"workload", "restore", mainProject}
+	if source := os.Getenv("DOTNET_WORKLOAD_SOURCE"); source != "" {
+		args = append(args, "--source", source)
+	}
+	return s.Command.Execute(s.Stager.BuildDir(), s.Log.Output(), s.Log.Output(), "dotnet", args...)
+}
+
+func (s *Supplier) shouldRestoreWorkloads() (bool, error) {
+	if isPublished, err := s.Project.IsPublished(); err != nil {
+		return false, err
+	} else if isPublished {
+		return false, nil
+	}
+
+	if os.Getenv("DOTNET_WORKLOAD_RESTORE") == "false" {
+		return false, nil
+	}
+
+	// dotnet workload was introduced with the 6.0 SDK
+	if !sdkAtLeast(s.Config.DotnetSdkVersion, 6) {
+		return false, nil
+	}
+
+	if os.Getenv("DOTNET_WORKLOAD_RESTORE") == "true" {
+		return true, nil
+	}
+
+	return s.workloadsInProjFiles()
+}
+
+// Workloads are only required when a project builds native WebAssembly
+// or targets a workload platform such as net6.0-android
+func (s *Supplier) workloadsInProjFiles() (bool, error) {
+	projFiles, err := s.Project.ProjFilePaths()
+	if err != nil {
+		return false, err
+	}
+
+	for _, projFile := range projFiles {
+		for _, name := range []string{"RunAOTCompilation", "WasmBuildNative"} {
+			if value, err := s.Project.ProjectProperty(projFile, name); err != nil {
+				return false, err
+			} else if strings.EqualFold(value, "true") {
+				return true, nil
+			}
+		}
+		for _, name := range []string{"TargetFramework", "TargetFrameworks"} {
+			if value, err := s.Project.ProjectProperty(projFile, name); err != nil {
+				return false, err
+			} else if needsWorkload(value) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// workloadPlatforms are the target framework platforms only buildable with
+// an optional workload installed
+var workloadPlatforms = []string{"android", "ios", "maccatalyst", "macos", "tvos", "browser"}
+
+// needsWorkload reports whether one of the semicolon separated target
+// frameworks, such as net6.0-android31.0, targets a workload platform
+func needsWorkload(frameworks string) bool {
+	for _, framework := range strings.Split(frameworks, ";") {
+		parts := strings.SplitN(strings.TrimSpace(framework), "-", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		platform := strings.ToLower(strings.TrimRight(parts[1], "0123456789."))
+		for _, workload := range workloadPlatforms {
+			if platform == workload {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RestoreLocalTools installs the tools listed in the app's dotnet tool
+// manifest into a tool path linked into bin, so they are on PATH both
+// during staging and at launch
+func (s *Supplier) RestoreLocalTools() error {
+	toolManifest, err := s.toolManifestPath()
+	if err != nil || toolManifest == "" {
+		return err
+	}
+
+	if !sdkAtLeast(s.Config.DotnetSdkVersion, 3) {
+		s.Log.Warning("dotnet local tools require SDK 3.0 or later, not restoring %s", toolManifest)
+		return nil
+	}
+
+	obj := struct {
+		Tools map[string]struct {
+			Version string `json:"version"`
+		} `json:"tools"`
+	}{}
+	if err := libbuildpack.NewJSON().Load(toolManifest, &obj); err != nil {
+		return err
+	}
+	if len(obj.Tools) == 0 {
+		return nil
+	}
+
+	s.Log.BeginStep("Restoring dotnet local tools")
+	names := make([]string, 0, len(obj.Tools))
+	for name := range obj.Tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := s.installTool("dotnet-tools", name, obj.Tools[name].Version); err != nil {
+			return err
+		}
+	}
+	return s.Stager.LinkDirectoryInDepDir(filepath.Join(s.Stager.DepDir(), "dotnet-tools"), "bin")
+}
+
+var diagnosticTools = []string{"dotnet-counters", "dotnet-dump", "dotnet-trace"}
+
+// InstallDiagnosticTools installs the dotnet diagnostic tools onto PATH
+// when INSTALL_DIAGNOSTIC_TOOLS is true, or a comma separated list of them,
+// so they can be used over cf ssh
+func (s *Supplier) InstallDiagnosticTools() error {
+	setting := os.Getenv("INSTALL_DIAGNOSTIC_TOOLS")
+	if setting == "" || setting == "false" {
+		return nil
+	}
+
+	tools := diagnosticTools
+	if setting != "true" {
+		tools = strings.Split(setting, ",")
+		for i, tool := range tools {
+			tools[i] = strings.TrimSpace(tool)
+			if !contains(diagnosticTools, tools[i]) {
+				return fmt.Errorf("unknown diagnostic tool %s, expected one of %v", tools[i], diagnosticTools)
+			}
+		}
+	}
+
+	if !sdkAtLeast(s.Config.DotnetSdkVersion, 3) {
+		s.Log.Warning("dotnet diagnostic tools require SDK 3.0 or later, not installing %v", tools)
+		return nil
+	}
+
+	s.Log.BeginStep("Installing dotnet diagnostic tools")
+	for _, tool := range tools {
+		if err := s.installTool("diagnostic-tools", tool, ""); err != nil {
+			return err
+		}
+	}
+	return s.Stager.LinkDirectoryInDepDir(filepath.Join(s.Stager.DepDir(), "diagnostic-tools"), "bin")
+}
+
+// installTool installs a dotnet tool into a tool path under the dep dir,
+// using the latest version when none is given
+func (s *Supplier) installTool(toolPath, name, version string) error {
+	args := []string{"tool", "install", name, "--tool-path", filepath.Join(s.Stager.DepDir(), toolPath)}
+	if version != "" {
+		s.Log.Info("Installing %s %s", name, version)
+		args = append(args, "--version", version)
+	} else {
+		s.Log.Info("Installing %s", name)
+	}
+	return s.Command.Execute(s.Stager.BuildDir(), s.Log.Output(), s.Log.Output(), "dotnet", args...)
+}
+
+func (s *Supplier) toolManifestPath() (string, error) {
+	for _, path := range []string{filepath.Join(".config", "dotnet-tools.json"), "dotnet-tools.json"} {
+		if exists, err := libbuildpack.FileExists(filepath.Join(s.Stager.BuildDir(), path)); err != nil {
+			return "", err
+		} else if exists {
+			return filepath.Join(s.Stager.BuildDir(), path), nil
+		}
+	}
+	return "", nil
+}
+
+func sdkAtLeast(version string, major int) bool {
+	versionMajor, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	return err == nil && versionMajor >= major
+}
+
 func (s *Supplier) suppliedVersion(allVersions []string) (string, error) {
 	buildpackVersion, err := s.buildpackYamlSdkVersion()
 	if err != nil {
@@ -362,20 +1055,11 @@ func (s *Supplier) suppliedVersion(allVersions []string) (string, error) {
 }
 
 func (s *Supplier) buildpackYamlSdkVersion() (string, error) {
-	if found, err := libbuildpack.FileExists(filepath.Join(s.Stager.BuildDir(), "buildpack.yml")); err != nil || !found {
-		return "", err
-	}
-
-	obj := struct {
-		DotnetCore struct {
-			Version string `yaml:"sdk"`
-		} `yaml:"dotnet-core"`
-	}{}
-	if err := libbuildpack.NewYAML().Load(filepath.Join(s.Stager.BuildDir(), "buildpack.yml"), &obj); err != nil {
+	buildpackYML, err := config.LoadBuildpackYML(s.Stager.BuildDir())
+	if err != nil {
 		return "", err
 	}
-
-	return obj.DotnetCore.Version, nil
+	return buildpackYML.DotnetCore.Sdk, nil
 }
 
 func (s *Supplier) globalJsonSdkVersion() (string, error) {
@@ -388,7 +1072,7 @@ func (s *Supplier) globalJsonSdkVersion() (string, error) {
 			Version string `json:"version"`
 		} `json:"sdk"`
 	}{}
-	if err := libbuildpack.NewJSON().Load(filepath.Join(s.Stager.BuildDir(), "global.json"), &obj); err != nil {
+	if err := jsonc.Load(filepath.Join(s.Stager.BuildDir(), "global.json"), &obj); err != nil {
 		return "", err
 	}
 	return obj.Sdk.Version, nil
@@ -2,13 +2,16 @@ package supply_test
 
 import (
 	"bytes"
+	"context"
 	"dotnetcore/config"
 	"dotnetcore/project"
 	"dotnetcore/supply"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/cloudfoundry/libbuildpack"
 	"github.com/cloudfoundry/libbuildpack/ansicleaner"
@@ -33,6 +36,7 @@ var _ = Describe("Supply", func() {
 		mockManifest  *MockManifest
 		mockInstaller *MockInstaller
 		mockCommand   *MockCommand
+		mockFramework *MockDotnetFramework
 		installNode   func(string, string)
 		installBower  func(string, string)
 	)
@@ -58,6 +62,7 @@ var _ = Describe("Supply", func() {
 		mockManifest = NewMockManifest(mockCtrl)
 		mockInstaller = NewMockInstaller(mockCtrl)
 		mockCommand = NewMockCommand(mockCtrl)
+		mockFramework = NewMockDotnetFramework(mockCtrl)
 
 		args := []string{buildDir, cacheDir, depsDir, depsIdx}
 		stager := libbuildpack.NewStager(args, logger, &libbuildpack.Manifest{})
@@ -65,13 +70,14 @@ var _ = Describe("Supply", func() {
 		cfg := &config.Config{}
 
 		supplier = &supply.Supplier{
-			Stager:    stager,
-			Manifest:  mockManifest,
-			Installer: mockInstaller,
-			Log:       logger,
-			Command:   mockCommand,
-			Project:   project,
-			Config:    cfg,
+			Stager:          stager,
+			Manifest:        mockManifest,
+			Installer:       mockInstaller,
+			Log:             logger,
+			Command:         mockCommand,
+			Project:         project,
+			Config:          cfg,
+			DotnetFramework: mockFramework,
 		}
 
 		installNode = func(dep, nodeDir string) {
@@ -100,6 +106,336 @@ var _ = Describe("Supply", func() {
 		Expect(err).To(BeNil())
 	})
 
+	Describe("ApplyProjectTOML", func() {
+		BeforeEach(func() {
+			for _, name := range []string{"src/app.csproj", "src/Program.cs", "docs/guide.md", "README.md", "tests/app.tests.csproj", "buildpack.yml"} {
+				path := filepath.Join(buildDir, name)
+				Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(path, []byte(""), 0644)).To(Succeed())
+			}
+		})
+
+		It("removes excluded files", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "project.toml"), []byte("[build]\nexclude = [\"docs/\", \"*.md\"]\n"), 0644)).To(Succeed())
+			Expect(supplier.ApplyProjectTOML()).To(Succeed())
+			Expect(filepath.Join(buildDir, "docs")).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(buildDir, "README.md")).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(buildDir, "src", "Program.cs")).To(BeARegularFile())
+		})
+
+		It("keeps only included files", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "project.toml"), []byte("[io.buildpacks]\ninclude = [\"src\"]\n"), 0644)).To(Succeed())
+			Expect(supplier.ApplyProjectTOML()).To(Succeed())
+			Expect(filepath.Join(buildDir, "src", "app.csproj")).To(BeARegularFile())
+			Expect(filepath.Join(buildDir, "buildpack.yml")).To(BeARegularFile())
+			Expect(filepath.Join(buildDir, "project.toml")).To(BeARegularFile())
+			Expect(filepath.Join(buildDir, "tests")).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(buildDir, "README.md")).ToNot(BeAnExistingFile())
+		})
+	})
+
+	Describe("InstallCACertificates", func() {
+		const cert = "-----BEGIN CERTIFICATE-----\nZm9v\n-----END CERTIFICATE-----\n"
+
+		AfterEach(func() {
+			Expect(os.Unsetenv("CA_CERTIFICATES")).To(Succeed())
+			Expect(os.Unsetenv("VCAP_SERVICES")).To(Succeed())
+			Expect(os.Unsetenv("SSL_CERT_FILE")).To(Succeed())
+		})
+
+		It("does nothing without certificates", func() {
+			Expect(supplier.InstallCACertificates()).To(Succeed())
+			Expect(filepath.Join(depsDir, depsIdx, "certs")).NotTo(BeADirectory())
+		})
+
+		It("adds certificates from CA_CERTIFICATES to the bundle", func() {
+			Expect(os.Setenv("CA_CERTIFICATES", cert)).To(Succeed())
+			Expect(supplier.InstallCACertificates()).To(Succeed())
+
+			bundle := filepath.Join(depsDir, depsIdx, "certs", "ca-certificates.crt")
+			contents, err := ioutil.ReadFile(bundle)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(HaveSuffix(cert))
+			Expect(os.Getenv("SSL_CERT_FILE")).To(Equal(bundle))
+
+			contents, err = ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "ca-certificates.sh"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("export SSL_CERT_FILE=$DEPS_DIR/" + depsIdx + "/certs/ca-certificates.crt\n"))
+		})
+
+		It("adds certificates from a bound service", func() {
+			Expect(os.Setenv("VCAP_SERVICES", `{"user-provided":[{"name":"corp-ca","tags":["ca-certificates"],"credentials":{"certificates":"`+strings.Replace(cert, "\n", "\\n", -1)+`"}}]}`)).To(Succeed())
+			Expect(supplier.InstallCACertificates()).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("Adding 1 CA certificate(s) from service corp-ca"))
+		})
+
+		It("rejects values without certificates", func() {
+			Expect(os.Setenv("CA_CERTIFICATES", "not a cert")).To(Succeed())
+			Expect(supplier.InstallCACertificates()).To(MatchError("no PEM certificates found in CA_CERTIFICATES"))
+		})
+	})
+
+	Describe("InstallLibunwind", func() {
+		Context("The manifest provides libunwind for the stack", func() {
+			BeforeEach(func() {
+				mockManifest.EXPECT().AllDependencyVersions("libunwind").Return([]string{"1.2.1"})
+			})
+
+			It("installs libunwind", func() {
+				mockInstaller.EXPECT().InstallOnlyVersion("libunwind", filepath.Join(depsDir, depsIdx, "libunwind")).Do(func(_, dir string) {
+					Expect(os.MkdirAll(filepath.Join(dir, "lib"), 0755)).To(Succeed())
+				}).Return(nil)
+				Expect(supplier.InstallLibunwind()).To(Succeed())
+				Expect(filepath.Join(depsDir, depsIdx, "lib")).To(BeADirectory())
+			})
+		})
+
+		Context("The manifest has no libunwind for the stack", func() {
+			BeforeEach(func() {
+				Expect(os.Setenv("CF_STACK", "cflinuxfs4")).To(Succeed())
+				mockManifest.EXPECT().AllDependencyVersions("libunwind").Return([]string{})
+			})
+
+			AfterEach(func() {
+				Expect(os.Unsetenv("CF_STACK")).To(Succeed())
+			})
+
+			It("uses the stack's libunwind", func() {
+				mockCommand.EXPECT().Output("/", "/sbin/ldconfig", "-p").Return("\tlibunwind.so.8 (libc6,x86-64) => /usr/lib/x86_64-linux-gnu/libunwind.so.8\n", nil)
+				Expect(supplier.InstallLibunwind()).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Using libunwind provided by the cflinuxfs4 stack"))
+			})
+
+			It("warns when the stack has no libunwind either", func() {
+				mockCommand.EXPECT().Output("/", "/sbin/ldconfig", "-p").Return("\tlibc.so.6 (libc6,x86-64) => /lib/x86_64-linux-gnu/libc.so.6\n", nil)
+				Expect(supplier.InstallLibunwind()).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("The cflinuxfs4 stack does not provide libunwind and the buildpack has none for it"))
+			})
+		})
+	})
+
+	Describe("InstallLibgdiplus", func() {
+		AfterEach(func() {
+			Expect(os.Unsetenv("INSTALL_LIBGDIPLUS")).To(Succeed())
+		})
+
+		Context("The app does not use System.Drawing", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte(`<Project><ItemGroup><PackageReference Include="Newtonsoft.Json" Version="11.0.2" /></ItemGroup></Project>`), 0644)).To(Succeed())
+			})
+
+			It("does not install libgdiplus", func() {
+				Expect(supplier.InstallLibgdiplus()).To(Succeed())
+			})
+
+			It("installs it when INSTALL_LIBGDIPLUS is true", func() {
+				Expect(os.Setenv("INSTALL_LIBGDIPLUS", "true")).To(Succeed())
+				mockManifest.EXPECT().AllDependencyVersions("libgdiplus").Return([]string{})
+				mockCommand.EXPECT().Output("/", "/sbin/ldconfig", "-p").Return("\tlibgdiplus.so.0 (libc6,x86-64) => /usr/lib/libgdiplus.so.0\n", nil)
+				Expect(supplier.InstallLibgdiplus()).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Using libgdiplus provided by the"))
+			})
+
+			It("fails when INSTALL_LIBGDIPLUS is true but libgdiplus is unavailable", func() {
+				Expect(os.Setenv("INSTALL_LIBGDIPLUS", "true")).To(Succeed())
+				mockManifest.EXPECT().AllDependencyVersions("libgdiplus").Return([]string{})
+				mockCommand.EXPECT().Output("/", "/sbin/ldconfig", "-p").Return("", nil)
+				Expect(supplier.InstallLibgdiplus()).To(MatchError(ContainSubstring("libgdiplus was requested but neither the buildpack nor the")))
+			})
+		})
+
+		Context("The app references System.Drawing.Common", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte(`<Project><ItemGroup><PackageReference Include="System.Drawing.Common" Version="4.5.0" /></ItemGroup></Project>`), 0644)).To(Succeed())
+				mockManifest.EXPECT().AllDependencyVersions("libgdiplus").Return([]string{"4.2", "5.6"}).AnyTimes()
+			})
+
+			It("installs the pinned version from buildpack.yml", func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  libgdiplus:\n    version: 4.x\n"), 0644)).To(Succeed())
+				mockInstaller.EXPECT().InstallDependency(libbuildpack.Dependency{Name: "libgdiplus", Version: "4.2"}, filepath.Join(depsDir, depsIdx, "libgdiplus")).Do(func(_ libbuildpack.Dependency, dir string) {
+					Expect(os.MkdirAll(filepath.Join(dir, "lib"), 0755)).To(Succeed())
+				}).Return(nil)
+				Expect(supplier.InstallLibgdiplus()).To(Succeed())
+			})
+
+			It("rejects unavailable pinned versions", func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  libgdiplus:\n    version: 6.0\n"), 0644)).To(Succeed())
+				Expect(supplier.InstallLibgdiplus()).To(MatchError(ContainSubstring("libgdiplus 6.0 is not available")))
+			})
+
+			It("can be disabled in buildpack.yml", func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  libgdiplus:\n    install: false\n"), 0644)).To(Succeed())
+				Expect(supplier.InstallLibgdiplus()).To(Succeed())
+			})
+
+			It("can be disabled with INSTALL_LIBGDIPLUS", func() {
+				Expect(os.Setenv("INSTALL_LIBGDIPLUS", "false")).To(Succeed())
+				Expect(supplier.InstallLibgdiplus()).To(Succeed())
+			})
+		})
+	})
+
+	Describe("InstallICU", func() {
+		AfterEach(func() {
+			Expect(os.Unsetenv("INSTALL_ICU")).To(Succeed())
+		})
+
+		It("does not install ICU by default", func() {
+			Expect(supplier.InstallICU()).To(Succeed())
+		})
+
+		Context("INSTALL_ICU is true", func() {
+			BeforeEach(func() {
+				Expect(os.Setenv("INSTALL_ICU", "true")).To(Succeed())
+			})
+
+			It("installs ICU from the manifest", func() {
+				mockManifest.EXPECT().AllDependencyVersions("icu").Return([]string{"63.1"})
+				mockInstaller.EXPECT().InstallOnlyVersion("icu", filepath.Join(depsDir, depsIdx, "icu")).Do(func(_, dir string) {
+					Expect(os.MkdirAll(filepath.Join(dir, "lib"), 0755)).To(Succeed())
+				}).Return(nil)
+				Expect(supplier.InstallICU()).To(Succeed())
+			})
+
+			It("fails when ICU is unavailable for the stack", func() {
+				mockManifest.EXPECT().AllDependencyVersions("icu").Return([]string{})
+				mockCommand.EXPECT().Output("/", "/sbin/ldconfig", "-p").Return("", nil)
+				Expect(supplier.InstallICU()).To(MatchError(ContainSubstring("icu was requested but neither the buildpack nor the")))
+			})
+
+			It("uses the stack's ICU when the manifest has none", func() {
+				mockManifest.EXPECT().AllDependencyVersions("icu").Return([]string{})
+				mockCommand.EXPECT().Output("/", "/sbin/ldconfig", "-p").Return("\tlibicuuc.so.60 (libc6,x86-64) => /usr/lib/x86_64-linux-gnu/libicuuc.so.60\n", nil)
+				Expect(supplier.InstallICU()).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Using icu provided by the"))
+			})
+
+			It("skips ICU for apps in invariant mode", func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte(`<Project><PropertyGroup><InvariantGlobalization>true</InvariantGlobalization></PropertyGroup></Project>`), 0644)).To(Succeed())
+				Expect(supplier.InstallICU()).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("globalization invariant mode"))
+			})
+		})
+	})
+
+	Describe("InstallTzdata", func() {
+		AfterEach(func() {
+			Expect(os.Unsetenv("INSTALL_TZDATA")).To(Succeed())
+		})
+
+		It("does not install tzdata by default", func() {
+			Expect(supplier.InstallTzdata()).To(Succeed())
+		})
+
+		It("fails when INSTALL_TZDATA is true but the manifest has no tzdata", func() {
+			Expect(os.Setenv("INSTALL_TZDATA", "true")).To(Succeed())
+			mockManifest.EXPECT().AllDependencyVersions("tzdata").Return([]string{})
+			Expect(supplier.InstallTzdata()).To(MatchError(ContainSubstring("tzdata was requested but neither the buildpack nor the")))
+			Expect(filepath.Join(depsDir, depsIdx, "env", "TZDIR")).NotTo(BeAnExistingFile())
+		})
+
+		Context("buildpack.yml asks for tzdata", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  tzdata:\n    install: true\n"), 0644)).To(Succeed())
+				mockManifest.EXPECT().AllDependencyVersions("tzdata").Return([]string{"2018e"})
+				mockInstaller.EXPECT().InstallOnlyVersion("tzdata", filepath.Join(depsDir, depsIdx, "tzdata")).Return(nil)
+			})
+
+			It("installs tzdata and exports TZDIR", func() {
+				Expect(supplier.InstallTzdata()).To(Succeed())
+				contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "env", "TZDIR"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).To(Equal(filepath.Join(depsDir, depsIdx, "tzdata")))
+				contents, err = ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "tzdata.sh"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).To(Equal("export TZDIR=$DEPS_DIR/" + depsIdx + "/tzdata\n"))
+			})
+		})
+	})
+
+	Describe("InstallKrb5", func() {
+		AfterEach(func() {
+			Expect(os.Unsetenv("INSTALL_KRB5")).To(Succeed())
+		})
+
+		It("does not install krb5 by default", func() {
+			Expect(supplier.InstallKrb5()).To(Succeed())
+		})
+
+		It("installs krb5 and links its libraries when INSTALL_KRB5 is true", func() {
+			Expect(os.Setenv("INSTALL_KRB5", "true")).To(Succeed())
+			mockManifest.EXPECT().AllDependencyVersions("krb5").Return([]string{"1.16.1"})
+			mockInstaller.EXPECT().InstallOnlyVersion("krb5", filepath.Join(depsDir, depsIdx, "krb5")).Do(func(_, dir string) {
+				Expect(os.MkdirAll(filepath.Join(dir, "lib"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "lib", "libgssapi_krb5.so.2"), []byte(""), 0644)).To(Succeed())
+			}).Return(nil)
+			Expect(supplier.InstallKrb5()).To(Succeed())
+			Expect(filepath.Join(depsDir, depsIdx, "lib", "libgssapi_krb5.so.2")).To(BeAnExistingFile())
+		})
+
+		It("fails when INSTALL_KRB5 is true but krb5 is unavailable", func() {
+			Expect(os.Setenv("INSTALL_KRB5", "true")).To(Succeed())
+			mockManifest.EXPECT().AllDependencyVersions("krb5").Return([]string{})
+			mockCommand.EXPECT().Output("/", "/sbin/ldconfig", "-p").Return("", nil)
+			Expect(supplier.InstallKrb5()).To(MatchError(ContainSubstring("krb5 was requested but neither the buildpack nor the")))
+		})
+
+		It("rejects invalid INSTALL_KRB5 values", func() {
+			Expect(os.Setenv("INSTALL_KRB5", "yes")).To(Succeed())
+			Expect(supplier.InstallKrb5()).To(MatchError("INSTALL_KRB5 must be true or false, not yes"))
+		})
+	})
+
+	Describe("InstallYarn", func() {
+		BeforeEach(func() {
+			mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "yarn", "--version").AnyTimes().Return(fmt.Errorf("not found"))
+		})
+
+		AfterEach(func() {
+			Expect(os.Unsetenv("INSTALL_YARN")).To(Succeed())
+		})
+
+		It("does not install yarn for apps that don't use it", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+			Expect(supplier.InstallYarn()).To(Succeed())
+		})
+
+		Context("The app has a yarn.lock", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "yarn.lock"), []byte(""), 0644)).To(Succeed())
+			})
+
+			It("installs yarn and puts it on the PATH", func() {
+				mockManifest.EXPECT().AllDependencyVersions("yarn").Return([]string{"1.9.4"}).Times(2)
+				mockInstaller.EXPECT().InstallOnlyVersion("yarn", filepath.Join(depsDir, depsIdx, "yarn")).Do(func(_, dir string) {
+					Expect(os.MkdirAll(filepath.Join(dir, "bin"), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(dir, "bin", "yarn"), []byte(""), 0755)).To(Succeed())
+				}).Return(nil)
+				Expect(supplier.InstallYarn()).To(Succeed())
+				Expect(filepath.Join(depsDir, depsIdx, "bin", "yarn")).To(BeAnExistingFile())
+			})
+
+			It("falls back to npm with a warning when the manifest has no yarn", func() {
+				mockManifest.EXPECT().AllDependencyVersions("yarn").Return([]string{})
+				Expect(supplier.InstallYarn()).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("**WARNING** The app uses yarn, but the buildpack has no yarn for the"))
+				Expect(filepath.Join(depsDir, depsIdx, "bin", "yarn")).ToNot(BeAnExistingFile())
+			})
+
+			It("fails when yarn is requested but the manifest has none", func() {
+				Expect(os.Setenv("INSTALL_YARN", "true")).To(Succeed())
+				mockManifest.EXPECT().AllDependencyVersions("yarn").Return([]string{})
+				Expect(supplier.InstallYarn()).To(MatchError(ContainSubstring("yarn was requested but the buildpack has no yarn")))
+			})
+
+			It("can be turned off with INSTALL_YARN", func() {
+				Expect(os.Setenv("INSTALL_YARN", "false")).To(Succeed())
+				Expect(supplier.InstallYarn()).To(Succeed())
+			})
+		})
+	})
+
 	Describe("InstallBower", func() {
 		var bowerInstallDir string
 		BeforeEach(func() {
@@ -119,12 +455,36 @@ var _ = Describe("Supply", func() {
 		Context("Not a published project and bower command necessary", func() {
 			BeforeEach(func() {
 				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", "-v").AnyTimes()
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "bower.json"), []byte("{}"), 0644)).To(Succeed())
 			})
+
+			AfterEach(func() {
+				Expect(os.Unsetenv("INSTALL_BOWER")).To(Succeed())
+			})
+
 			It("Installs bower", func() {
-				mockInstaller.EXPECT().FetchDependency(libbuildpack.Dependency{Name: "bower", Version: "1.8.2"}, gomock.Any()).Return(nil)
+				mockInstaller.EXPECT().FetchDependency(libbuildpack.Dependency{Name: "bower", Version: "1.8.2"}, gomock.Any()).Do(func(dep libbuildpack.Dependency, tarball string) {
+					installBower(dep.Name, filepath.Dir(tarball))
+				}).Return(nil)
 				mockManifest.EXPECT().AllDependencyVersions("bower").AnyTimes().Return([]string{"1.8.2"})
 				Expect(supplier.InstallBower()).To(Succeed())
 			})
+
+			It("Does not install bower when INSTALL_BOWER is false", func() {
+				Expect(os.Setenv("INSTALL_BOWER", "false")).To(Succeed())
+				Expect(supplier.InstallBower()).To(Succeed())
+			})
+
+			It("Does not install bower when buildpack.yml turns it off", func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  install-bower: false\n"), 0644)).To(Succeed())
+				Expect(supplier.InstallBower()).To(Succeed())
+			})
+		})
+
+		Context("Not a published project without bower.json or .bowerrc", func() {
+			It("Does not install bower", func() {
+				Expect(supplier.InstallBower()).To(Succeed())
+			})
 		})
 
 		Context("It is a published project and bower command necessary", func() {
@@ -138,6 +498,10 @@ var _ = Describe("Supply", func() {
 		})
 
 		Context("NPM is NOT installed and bower command necessary", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, ".bowerrc"), []byte("{}"), 0644)).To(Succeed())
+			})
+
 			It("Does not install bower", func() {
 				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", "-v").AnyTimes().Return(fmt.Errorf("error"))
 				Expect(supplier.InstallBower()).ToNot(Succeed())
@@ -184,6 +548,28 @@ var _ = Describe("Supply", func() {
 					mockManifest.EXPECT().AllDependencyVersions("node").Return([]string{"6.12.0"})
 					Expect(supplier.InstallNode()).To(Succeed())
 				})
+
+				Context("A node version is requested", func() {
+					AfterEach(func() {
+						Expect(os.Unsetenv("NODE_VERSION")).To(Succeed())
+					})
+
+					It("installs the matching version from buildpack.yml", func() {
+						Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  node-version: 6.x\n"), 0644)).To(Succeed())
+						mockManifest.EXPECT().AllDependencyVersions("node").Return([]string{"6.12.0", "8.11.3"})
+						mockInstaller.EXPECT().InstallDependency(libbuildpack.Dependency{Name: "node", Version: "6.12.0"}, filepath.Join(depsDir, depsIdx)).Do(func(_ libbuildpack.Dependency, dir string) {
+							installNode("", dir)
+						}).Return(nil)
+						Expect(supplier.InstallNode()).To(Succeed())
+						Expect(filepath.Join(nodeInstallDir, "bin")).To(BeADirectory())
+					})
+
+					It("fails clearly when NODE_VERSION is not available", func() {
+						Expect(os.Setenv("NODE_VERSION", "10.x")).To(Succeed())
+						mockManifest.EXPECT().AllDependencyVersions("node").Return([]string{"6.12.0", "8.11.3"})
+						Expect(supplier.InstallNode()).To(MatchError("node 10.x is not available, available versions: [6.12.0 8.11.3]"))
+					})
+				})
 			})
 
 			Context("Not a published project and bower/npm commands necessary", func() {
@@ -208,6 +594,55 @@ var _ = Describe("Supply", func() {
 					Expect(supplier.InstallNode()).To(Succeed())
 				})
 			})
+
+			Context("The project has a SpaRoot", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "test_app.csproj"), []byte(`<Project><PropertyGroup><SpaRoot>ClientApp\</SpaRoot></PropertyGroup></Project>`), 0644)).To(Succeed())
+				})
+
+				It("Installs node", func() {
+					mockInstaller.EXPECT().InstallOnlyVersion("node", gomock.Any()).Do(installNode).Return(nil)
+					mockManifest.EXPECT().AllDependencyVersions("node").Return([]string{"6.12.0"})
+					Expect(supplier.InstallNode()).To(Succeed())
+				})
+			})
+
+			Context("The project has a package.json", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "test_app.csproj"), []byte("<Project></Project>"), 0644)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte("{}"), 0644)).To(Succeed())
+				})
+
+				AfterEach(func() {
+					Expect(os.Unsetenv("INSTALL_NODE")).To(Succeed())
+				})
+
+				It("Installs node", func() {
+					mockInstaller.EXPECT().InstallOnlyVersion("node", gomock.Any()).Do(installNode).Return(nil)
+					mockManifest.EXPECT().AllDependencyVersions("node").Return([]string{"6.12.0"})
+					Expect(supplier.InstallNode()).To(Succeed())
+				})
+
+				It("Does not install node when INSTALL_NODE is false", func() {
+					Expect(os.Setenv("INSTALL_NODE", "false")).To(Succeed())
+					Expect(supplier.InstallNode()).To(Succeed())
+				})
+
+				It("Does not install node when buildpack.yml turns it off", func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  install-node: false\n"), 0644)).To(Succeed())
+					Expect(supplier.InstallNode()).To(Succeed())
+				})
+			})
+
+			Context("A backend only project", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "test_app.csproj"), []byte(`<Project Sdk="Microsoft.NET.Sdk.Web"></Project>`), 0644)).To(Succeed())
+				})
+
+				It("Does not install node", func() {
+					Expect(supplier.InstallNode()).To(Succeed())
+				})
+			})
 		})
 
 		Context("Node is installed", func() {
@@ -222,8 +657,244 @@ var _ = Describe("Supply", func() {
 		})
 	})
 
+	Describe("ExportDotnet", func() {
+		It("writes DOTNET_ROOT for subsequent buildpacks and launch", func() {
+			Expect(supplier.ExportDotnet()).To(Succeed())
+			Expect(supplier.Config.DotnetRoot).To(Equal(filepath.Join(depsDir, depsIdx, "dotnet")))
+
+			contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "env", "DOTNET_ROOT"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal(filepath.Join(depsDir, depsIdx, "dotnet")))
+
+			contents, err = ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "dotnet-root.sh"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("export DOTNET_ROOT=$DEPS_DIR/9/dotnet\n"))
+		})
+	})
+
+	Describe("RestoreWorkloads", func() {
+		BeforeEach(func() {
+			supplier.Config.DotnetSdkVersion = "6.0.400"
+		})
+
+		Context("The project builds native WebAssembly", func() {
+			BeforeEach(func() {
+				csprojXml := `<Project Sdk="Microsoft.NET.Sdk.BlazorWebAssembly">
+												<PropertyGroup>
+													<TargetFramework>net6.0</TargetFramework>
+													<RunAOTCompilation>true</RunAOTCompilation>
+												</PropertyGroup>
+											</Project>`
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "test_app.csproj"), []byte(csprojXml), 0644)).To(Succeed())
+			})
+
+			It("runs dotnet workload restore", func() {
+				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "dotnet", "workload", "restore", filepath.Join(buildDir, "test_app.csproj")).Return(nil)
+				Expect(supplier.RestoreWorkloads()).To(Succeed())
+			})
+
+			Context("DOTNET_WORKLOAD_SOURCE is set", func() {
+				BeforeEach(func() {
+					Expect(os.Setenv("DOTNET_WORKLOAD_SOURCE", "https://feed.example.com/index.json")).To(Succeed())
+				})
+
+				AfterEach(func() {
+					Expect(os.Unsetenv("DOTNET_WORKLOAD_SOURCE")).To(Succeed())
+				})
+
+				It("restores from the configured source", func() {
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "dotnet", "workload", "restore", filepath.Join(buildDir, "test_app.csproj"), "--source", "https://feed.example.com/index.json").Return(nil)
+					Expect(supplier.RestoreWorkloads()).To(Succeed())
+				})
+			})
+
+			Context("The SDK predates workloads", func() {
+				BeforeEach(func() {
+					supplier.Config.DotnetSdkVersion = "2.1.301"
+				})
+
+				It("does not run dotnet workload restore", func() {
+					Expect(supplier.RestoreWorkloads()).To(Succeed())
+				})
+			})
+		})
+
+		Context("The project targets a workload platform", func() {
+			BeforeEach(func() {
+				csprojXml := `<Project Sdk="Microsoft.NET.Sdk">
+												<PropertyGroup>
+													<TargetFrameworks>net6.0;net6.0-android31.0</TargetFrameworks>
+												</PropertyGroup>
+											</Project>`
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "test_app.csproj"), []byte(csprojXml), 0644)).To(Succeed())
+			})
+
+			It("runs dotnet workload restore", func() {
+				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "dotnet", "workload", "restore", filepath.Join(buildDir, "test_app.csproj")).Return(nil)
+				Expect(supplier.RestoreWorkloads()).To(Succeed())
+			})
+		})
+
+		Context("The project does not need any workloads", func() {
+			BeforeEach(func() {
+				csprojXml := `<Project Sdk="Microsoft.NET.Sdk.Web">
+												<PropertyGroup>
+													<TargetFramework>net6.0</TargetFramework>
+												</PropertyGroup>
+											</Project>`
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "test_app.csproj"), []byte(csprojXml), 0644)).To(Succeed())
+			})
+
+			It("does not run dotnet workload restore", func() {
+				Expect(supplier.RestoreWorkloads()).To(Succeed())
+			})
+		})
+
+		Context("The project targets a platform without workloads", func() {
+			BeforeEach(func() {
+				csprojXml := `<Project Sdk="Microsoft.NET.Sdk">
+												<PropertyGroup>
+													<TargetFramework>net6.0-windows</TargetFramework>
+												</PropertyGroup>
+											</Project>`
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "test_app.csproj"), []byte(csprojXml), 0644)).To(Succeed())
+			})
+
+			It("does not run dotnet workload restore", func() {
+				Expect(supplier.RestoreWorkloads()).To(Succeed())
+			})
+		})
+	})
+
+	Describe("RestoreLocalTools", func() {
+		BeforeEach(func() {
+			supplier.Config.DotnetSdkVersion = "6.0.400"
+		})
+
+		Context("The app has a dotnet tool manifest", func() {
+			BeforeEach(func() {
+				Expect(os.MkdirAll(filepath.Join(buildDir, ".config"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, ".config", "dotnet-tools.json"), []byte(`{
+					"version": 1,
+					"isRoot": true,
+					"tools": {
+						"swashbuckle.aspnetcore.cli": {"version": "6.4.0", "commands": ["swagger"]},
+						"dotnet-ef": {"version": "6.0.9", "commands": ["dotnet-ef"]}
+					}
+				}`), 0644)).To(Succeed())
+			})
+
+			It("installs every tool into the tool path and links it into bin", func() {
+				toolPath := filepath.Join(depsDir, depsIdx, "dotnet-tools")
+				gomock.InOrder(
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "dotnet", "tool", "install", "dotnet-ef", "--tool-path", toolPath, "--version", "6.0.9").Do(func(_ string, _, _ io.Writer, _ string, _ ...string) {
+						Expect(os.MkdirAll(toolPath, 0755)).To(Succeed())
+						Expect(ioutil.WriteFile(filepath.Join(toolPath, "dotnet-ef"), []byte(""), 0755)).To(Succeed())
+					}),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "dotnet", "tool", "install", "swashbuckle.aspnetcore.cli", "--tool-path", toolPath, "--version", "6.4.0"),
+				)
+				Expect(supplier.RestoreLocalTools()).To(Succeed())
+				Expect(filepath.Join(depsDir, depsIdx, "bin", "dotnet-ef")).To(BeAnExistingFile())
+			})
+		})
+
+		Context("The app does not have a dotnet tool manifest", func() {
+			It("does not install any tools", func() {
+				Expect(supplier.RestoreLocalTools()).To(Succeed())
+			})
+		})
+	})
+
+	Describe("InstallDiagnosticTools", func() {
+		BeforeEach(func() {
+			supplier.Config.DotnetSdkVersion = "6.0.400"
+			Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "diagnostic-tools"), 0755)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Unsetenv("INSTALL_DIAGNOSTIC_TOOLS")).To(Succeed())
+		})
+
+		It("does nothing by default", func() {
+			Expect(supplier.InstallDiagnosticTools()).To(Succeed())
+		})
+
+		It("installs all diagnostic tools when enabled", func() {
+			Expect(os.Setenv("INSTALL_DIAGNOSTIC_TOOLS", "true")).To(Succeed())
+			toolPath := filepath.Join(depsDir, depsIdx, "diagnostic-tools")
+			for _, tool := range []string{"dotnet-counters", "dotnet-dump", "dotnet-trace"} {
+				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "dotnet", "tool", "install", tool, "--tool-path", toolPath)
+			}
+			Expect(supplier.InstallDiagnosticTools()).To(Succeed())
+		})
+
+		It("installs the listed diagnostic tools", func() {
+			Expect(os.Setenv("INSTALL_DIAGNOSTIC_TOOLS", "dotnet-dump, dotnet-trace")).To(Succeed())
+			mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "dotnet", "tool", "install", "dotnet-dump", "--tool-path", gomock.Any())
+			mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "dotnet", "tool", "install", "dotnet-trace", "--tool-path", gomock.Any())
+			Expect(supplier.InstallDiagnosticTools()).To(Succeed())
+		})
+
+		It("rejects unknown tools", func() {
+			Expect(os.Setenv("INSTALL_DIAGNOSTIC_TOOLS", "dotnet-gcdump")).To(Succeed())
+			Expect(supplier.InstallDiagnosticTools()).To(MatchError(ContainSubstring("unknown diagnostic tool dotnet-gcdump")))
+		})
+	})
+
 	Describe("InstallDotnet", func() {
-		var defaultDep = libbuildpack.Dependency{Name: "dotnet", Version: "3.4.5"}
+		var (
+			defaultDep = libbuildpack.Dependency{Name: "dotnet", Version: "3.4.5"}
+			sdkSha256  string
+		)
+
+		BeforeEach(func() {
+			sdkSha256 = "0123abcd"
+			mockManifest.EXPECT().GetEntry(gomock.Any()).AnyTimes().DoAndReturn(func(dep libbuildpack.Dependency) (*libbuildpack.ManifestEntry, error) {
+				return &libbuildpack.ManifestEntry{Dependency: dep, SHA256: sdkSha256}, nil
+			})
+		})
+
+		Context("with the SDK cached by an earlier staging", func() {
+			var versions []string
+
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  sdk: 6.7.8"), 0644)).To(Succeed())
+				versions = []string{"6.7.8"}
+				mockManifest.EXPECT().AllDependencyVersions("dotnet").AnyTimes().DoAndReturn(func(string) []string { return versions })
+				mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), libbuildpack.Dependency{Name: "dotnet", Version: "6.7.8"}, filepath.Join(depsDir, depsIdx, "dotnet")).DoAndReturn(func(_ context.Context, _ libbuildpack.Dependency, dir string) error {
+					Expect(os.MkdirAll(filepath.Join(dir, "sdk", "6.7.8"), 0755)).To(Succeed())
+					return ioutil.WriteFile(filepath.Join(dir, "dotnet"), []byte("host"), 0755)
+				})
+				Expect(supplier.InstallDotnet()).To(Succeed())
+
+				// A new staging starts with an empty deps dir
+				Expect(os.RemoveAll(filepath.Join(depsDir, depsIdx))).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx), 0755)).To(Succeed())
+			})
+
+			It("restores it instead of installing again", func() {
+				Expect(supplier.InstallDotnet()).To(Succeed())
+				Expect(filepath.Join(depsDir, depsIdx, "dotnet", "sdk", "6.7.8")).To(BeADirectory())
+				Expect(ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "dotnet", "dotnet"))).To(Equal([]byte("host")))
+				Expect(buffer.String()).To(ContainSubstring("Using cached dotnet SDK 6.7.8"))
+			})
+
+			It("ignores a cached SDK of another version", func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("dotnet-core:\n  sdk: 6.7.9"), 0644)).To(Succeed())
+				versions = []string{"6.7.8", "6.7.9"}
+				mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), libbuildpack.Dependency{Name: "dotnet", Version: "6.7.9"}, filepath.Join(depsDir, depsIdx, "dotnet"))
+
+				Expect(supplier.InstallDotnet()).To(Succeed())
+			})
+
+			It("ignores a cached SDK of the same version with another checksum", func() {
+				sdkSha256 = "4567ef01"
+				mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), libbuildpack.Dependency{Name: "dotnet", Version: "6.7.8"}, filepath.Join(depsDir, depsIdx, "dotnet"))
+
+				Expect(supplier.InstallDotnet()).To(Succeed())
+				Expect(buffer.String()).ToNot(ContainSubstring("Using cached dotnet SDK"))
+			})
+		})
 
 		Context("with buildpack.yml", func() {
 			Context("with exact sdk/version", func() {
@@ -235,7 +906,7 @@ var _ = Describe("Supply", func() {
 
 					It("installs the requested version", func() {
 						dep := libbuildpack.Dependency{Name: "dotnet", Version: "6.7.8"}
-						mockInstaller.EXPECT().InstallDependency(dep, filepath.Join(depsDir, depsIdx, "dotnet"))
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), dep, filepath.Join(depsDir, depsIdx, "dotnet"))
 
 						Expect(supplier.InstallDotnet()).To(Succeed())
 					})
@@ -262,7 +933,7 @@ var _ = Describe("Supply", func() {
 
 					It("installs the latest available version of the requested version line", func() {
 						dep := libbuildpack.Dependency{Name: "dotnet", Version: "6.7.8"}
-						mockInstaller.EXPECT().InstallDependency(dep, filepath.Join(depsDir, depsIdx, "dotnet"))
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), dep, filepath.Join(depsDir, depsIdx, "dotnet"))
 
 						Expect(supplier.InstallDotnet()).To(Succeed())
 					})
@@ -276,7 +947,7 @@ var _ = Describe("Supply", func() {
 
 					It("matches on major version", func() {
 						dep := libbuildpack.Dependency{Name: "dotnet", Version: "6.7.8"}
-						mockInstaller.EXPECT().InstallDependency(dep, filepath.Join(depsDir, depsIdx, "dotnet"))
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), dep, filepath.Join(depsDir, depsIdx, "dotnet"))
 
 						Expect(supplier.InstallDotnet()).To(Succeed())
 					})
@@ -290,7 +961,7 @@ var _ = Describe("Supply", func() {
 
 					It("matches on major version with one x", func() {
 						dep := libbuildpack.Dependency{Name: "dotnet", Version: "6.7.8"}
-						mockInstaller.EXPECT().InstallDependency(dep, filepath.Join(depsDir, depsIdx, "dotnet"))
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), dep, filepath.Join(depsDir, depsIdx, "dotnet"))
 
 						Expect(supplier.InstallDotnet()).To(Succeed())
 					})
@@ -319,7 +990,7 @@ var _ = Describe("Supply", func() {
 
 					It("installs the requested version", func() {
 						dep := libbuildpack.Dependency{Name: "dotnet", Version: "6.7.8"}
-						mockInstaller.EXPECT().InstallDependency(dep, filepath.Join(depsDir, depsIdx, "dotnet"))
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), dep, filepath.Join(depsDir, depsIdx, "dotnet"))
 
 						Expect(supplier.InstallDotnet()).To(Succeed())
 					})
@@ -333,7 +1004,7 @@ var _ = Describe("Supply", func() {
 
 					It("installs the latest of the same version line", func() {
 						dep := libbuildpack.Dependency{Name: "dotnet", Version: "1.2.6"}
-						mockInstaller.EXPECT().InstallDependency(dep, filepath.Join(depsDir, depsIdx, "dotnet"))
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), dep, filepath.Join(depsDir, depsIdx, "dotnet"))
 
 						Expect(supplier.InstallDotnet()).To(Succeed())
 					})
@@ -347,7 +1018,7 @@ var _ = Describe("Supply", func() {
 
 					It("installs the default version", func() {
 						mockManifest.EXPECT().DefaultVersion("dotnet").Return(defaultDep, nil)
-						mockInstaller.EXPECT().InstallDependency(defaultDep, filepath.Join(depsDir, depsIdx, "dotnet"))
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), defaultDep, filepath.Join(depsDir, depsIdx, "dotnet"))
 
 						Expect(supplier.InstallDotnet()).To(Succeed())
 					})
@@ -362,7 +1033,7 @@ var _ = Describe("Supply", func() {
 				It("installs the default version", func() {
 					mockManifest.EXPECT().AllDependencyVersions("dotnet").Return([]string{})
 					mockManifest.EXPECT().DefaultVersion("dotnet").Return(defaultDep, nil)
-					mockInstaller.EXPECT().InstallDependency(defaultDep, filepath.Join(depsDir, depsIdx, "dotnet"))
+					mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), defaultDep, filepath.Join(depsDir, depsIdx, "dotnet"))
 
 					Expect(supplier.InstallDotnet()).To(Succeed())
 				})
@@ -390,7 +1061,7 @@ var _ = Describe("Supply", func() {
 
 			It("uses the buildpack.yml version", func() {
 				dep := libbuildpack.Dependency{Name: "dotnet", Version: "5.4.3"}
-				mockInstaller.EXPECT().InstallDependency(dep, filepath.Join(depsDir, depsIdx, "dotnet"))
+				mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), dep, filepath.Join(depsDir, depsIdx, "dotnet"))
 
 				Expect(supplier.InstallDotnet()).To(Succeed())
 			})
@@ -406,7 +1077,7 @@ var _ = Describe("Supply", func() {
 
 					It("installs the requested version", func() {
 						dep := libbuildpack.Dependency{Name: "dotnet", Version: "6.7.8"}
-						mockInstaller.EXPECT().InstallDependency(dep, filepath.Join(depsDir, depsIdx, "dotnet"))
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), dep, filepath.Join(depsDir, depsIdx, "dotnet"))
 
 						Expect(supplier.InstallDotnet()).To(Succeed())
 					})
@@ -420,7 +1091,7 @@ var _ = Describe("Supply", func() {
 
 					It("installs the latest of the same version line", func() {
 						dep := libbuildpack.Dependency{Name: "dotnet", Version: "1.2.6"}
-						mockInstaller.EXPECT().InstallDependency(dep, filepath.Join(depsDir, depsIdx, "dotnet"))
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), dep, filepath.Join(depsDir, depsIdx, "dotnet"))
 
 						Expect(supplier.InstallDotnet()).To(Succeed())
 					})
@@ -434,7 +1105,7 @@ var _ = Describe("Supply", func() {
 
 					It("installs the default version", func() {
 						mockManifest.EXPECT().DefaultVersion("dotnet").Return(defaultDep, nil)
-						mockInstaller.EXPECT().InstallDependency(defaultDep, filepath.Join(depsDir, depsIdx, "dotnet"))
+						mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), defaultDep, filepath.Join(depsDir, depsIdx, "dotnet"))
 
 						Expect(supplier.InstallDotnet()).To(Succeed())
 					})
@@ -451,17 +1122,49 @@ var _ = Describe("Supply", func() {
 				mockManifest.EXPECT().AllDependencyVersions("dotnet").Return([]string{"1.0.4", "1.1.6", "1.1.7", "1.1.5", "2.0.0"})
 
 				fSharpDep := libbuildpack.Dependency{Name: "dotnet", Version: "1.1.7"}
-				mockInstaller.EXPECT().InstallDependency(fSharpDep, filepath.Join(depsDir, depsIdx, "dotnet"))
+				mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), fSharpDep, filepath.Join(depsDir, depsIdx, "dotnet"))
 
 				Expect(supplier.InstallDotnet()).To(Succeed())
 			})
 		})
 
+		Context("The app is already published", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "app.runtimeconfig.json"), []byte(`{}`), 0644)).To(Succeed())
+			})
+
+			It("installs the runtime instead of the SDK", func() {
+				mockFramework.EXPECT().Install().Do(func() {
+					Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "dotnet"), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "dotnet", "dotnet"), []byte(""), 0755)).To(Succeed())
+				}).Return(nil)
+				Expect(supplier.InstallDotnet()).To(Succeed())
+				Expect(filepath.Join(depsDir, depsIdx, "bin", "dotnet")).To(BeAnExistingFile())
+			})
+
+			Context("DOTNET_RUNTIME_ONLY is false", func() {
+				BeforeEach(func() {
+					Expect(os.Setenv("DOTNET_RUNTIME_ONLY", "false")).To(Succeed())
+				})
+
+				AfterEach(func() {
+					Expect(os.Unsetenv("DOTNET_RUNTIME_ONLY")).To(Succeed())
+				})
+
+				It("installs the SDK", func() {
+					mockManifest.EXPECT().AllDependencyVersions("dotnet").Return([]string{})
+					mockManifest.EXPECT().DefaultVersion("dotnet").Return(defaultDep, nil)
+					mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), defaultDep, filepath.Join(depsDir, depsIdx, "dotnet"))
+					Expect(supplier.InstallDotnet()).To(Succeed())
+				})
+			})
+		})
+
 		Context("no known version", func() {
 			It("returns the default version", func() {
 				mockManifest.EXPECT().AllDependencyVersions("dotnet").Return([]string{})
 				mockManifest.EXPECT().DefaultVersion("dotnet").Return(defaultDep, nil)
-				mockInstaller.EXPECT().InstallDependency(defaultDep, filepath.Join(depsDir, depsIdx, "dotnet"))
+				mockInstaller.EXPECT().InstallDependencyContext(gomock.Any(), defaultDep, filepath.Join(depsDir, depsIdx, "dotnet"))
 
 				Expect(supplier.InstallDotnet()).To(Succeed())
 			})